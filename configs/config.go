@@ -3,6 +3,7 @@ package configs
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 )
@@ -14,19 +15,196 @@ type Config struct {
 	Hostname   string `envconfig:"HOSTNAME" required:"true"`
 	ListenPort string `envconfig:"LISTEN_PORT" required:"true"`
 
-	PostgresDBURL            string `envconfig:"POSTGRES_DB_URL" required:"true"`
+	//StoreDriver selects the backend of the stores, either
+	//StoreDriverPostgres or StoreDriverMemory
+	StoreDriver string `envconfig:"STORE_DRIVER" default:"postgres"`
+
+	PostgresDBURL            string `envconfig:"POSTGRES_DB_URL"`
 	PostgresDBMaxConnections int    `envconfig:"POSTGRES_DB_MAX_CONNECTIONS" default:"6"`
-	MigrationsPath           string `envconfig:"DB_MIGRATIONS_PATH" required:"true"`
+	MigrationsPath           string `envconfig:"DB_MIGRATIONS_PATH"`
 	LoadData                 bool   `envconfig:"LOAD_FIRST_TIME_DATA" required:"true"`
+	//LoadDataPath is the file LoadData loads. LoadDataFieldMapping
+	//renames its keys to the fields of an ice cream, e.g.
+	//`productId:product_id`, scripts.DefaultFieldMapping when unset.
+	//LoadDataDryRun only logs what loading it would change
+	LoadDataPath         string            `envconfig:"LOAD_DATA_PATH" default:"icecream.json"`
+	LoadDataFieldMapping map[string]string `envconfig:"LOAD_DATA_FIELD_MAPPING"`
+	LoadDataDryRun       bool              `envconfig:"LOAD_DATA_DRY_RUN" default:"false"`
+
+	//BackfillIngredients repairs the ingredients and allergens of the
+	//ice creams stored before they were parsed or derived on startup
+	BackfillIngredients bool `envconfig:"BACKFILL_INGREDIENTS" default:"false"`
+
+	//RedisURL enables a read-through redis cache in front of the stores when set
+	RedisURL     string        `envconfig:"REDIS_URL"`
+	RedisTimeout time.Duration `envconfig:"REDIS_TIMEOUT" default:"200ms"`
+	CacheTTL     time.Duration `envconfig:"CACHE_TTL" default:"5m"`
+	CacheListTTL time.Duration `envconfig:"CACHE_LIST_TTL" default:"1m"`
+
+	//RequireIfMatch rejects updates and deletes without an If-Match header
+	RequireIfMatch bool `envconfig:"REQUIRE_IF_MATCH" default:"false"`
+
+	//TrashRetention is how long deleted ice creams are kept before
+	//a purge removes them for good
+	TrashRetention time.Duration `envconfig:"TRASH_RETENTION" default:"720h"`
+
+	//RequestTimeout bounds the handling of every request. RouteTimeouts
+	//overrides it per route pattern, e.g. `/api/v1/search:2s`. The
+	//export and bulk import stream their responses and are unbounded
+	//unless RouteTimeouts lists them
+	RequestTimeout time.Duration            `envconfig:"REQUEST_TIMEOUT" default:"10s"`
+	RouteTimeouts  map[string]time.Duration `envconfig:"ROUTE_TIMEOUTS"`
+	//QueryTimeout bounds every call to the stores
+	QueryTimeout time.Duration `envconfig:"QUERY_TIMEOUT" default:"5s"`
+
+	//AuthHandlers lists the authentication schemes a request is tried
+	//against, in order, out of AuthHandlerStatic, AuthHandlerJWT,
+	//AuthHandlerStored and AuthHandlerOAuth
+	AuthHandlers []string     `envconfig:"AUTH_HANDLERS" default:"static"`
+	StaticTokens StaticTokens `envconfig:"STATIC_TOKENS"`
+	//StaticTokenFile replaces StaticTokens with a file of static tokens
+	//that is reloaded when it changes, checked every
+	//StaticTokenFileInterval, or on SIGHUP
+	StaticTokenFile         string        `envconfig:"STATIC_TOKEN_FILE"`
+	StaticTokenFileInterval time.Duration `envconfig:"STATIC_TOKEN_FILE_INTERVAL" default:"5s"`
+
+	//JWTJWKSPath and JWTPEMDir hold the keys bearer JWTs are verified
+	//with, at least one of them is required by AuthHandlerJWT.
+	//JWTScopesClaim names the claim the scopes of a token are read from
+	JWTJWKSPath    string        `envconfig:"JWT_JWKS_PATH"`
+	JWTPEMDir      string        `envconfig:"JWT_PEM_DIR"`
+	JWTAudience    string        `envconfig:"JWT_AUDIENCE"`
+	JWTIssuer      string        `envconfig:"JWT_ISSUER"`
+	JWTScopesClaim string        `envconfig:"JWT_SCOPES_CLAIM" default:"scope"`
+	JWTLeeway      time.Duration `envconfig:"JWT_LEEWAY" default:"30s"`
 
-	StaticTokens StaticTokens `envconfig:"STATIC_TOKENS" required:"true"`
+	//OAuthSigningKey signs the access tokens AuthHandlerOAuth issues to
+	//clients for OAuthTokenTTL
+	OAuthSigningKey string        `envconfig:"OAUTH_SIGNING_KEY"`
+	OAuthIssuer     string        `envconfig:"OAUTH_ISSUER" default:"benjerry"`
+	OAuthTokenTTL   time.Duration `envconfig:"OAUTH_TOKEN_TTL" default:"15m"`
+
+	//PolicyFile holds the scopes every route requires, replacing the
+	//default policy of the router
+	PolicyFile string `envconfig:"POLICY_FILE"`
+
+	//AdminToken is a bearer token holding every scope, to mint the first
+	//stored tokens with. It is meant to come from a secret of the
+	//deployment rather than from a file kept with the source
+	AdminToken string `envconfig:"ADMIN_TOKEN"`
+
+	//TokenCacheTTL is how long AuthHandlerStored uses a token, and
+	//AuthHandlerOAuth a client, before reading it again, and so how long
+	//a revoked token or the access tokens of a revoked client are still
+	//accepted
+	TokenCacheTTL time.Duration `envconfig:"TOKEN_CACHE_TTL" default:"30s"`
 }
 
+const (
+	//StoreDriverPostgres keeps the data in the postgres db at PostgresDBURL
+	StoreDriverPostgres = "postgres"
+	//StoreDriverMemory keeps the data in process. It is lost on restart
+	StoreDriverMemory = "memory"
+)
+
+const (
+	//AuthHandlerStatic accepts the bearer tokens of StaticTokens or
+	//StaticTokenFile
+	AuthHandlerStatic = "static"
+	//AuthHandlerJWT accepts bearer JWTs signed by the keys of
+	//JWTJWKSPath and JWTPEMDir
+	AuthHandlerJWT = "jwt"
+	//AuthHandlerStored accepts the bearer tokens minted through the
+	//tokens endpoints, kept hashed by the store
+	AuthHandlerStored = "stored"
+	//AuthHandlerOAuth accepts the access tokens issued through the
+	//client credentials grant of /oauth/token, to clients that are
+	//tokens of the store
+	AuthHandlerOAuth = "oauth"
+)
+
+//minOAuthSigningKeyLength is the size of the output of HS256, which is
+//as short as its keys should be
+const minOAuthSigningKeyLength = 32
+
+//minAdminTokenLength is as short as AdminToken can be, the length of
+//the static tokens
+const minAdminTokenLength = 16
+
 //Load loads all the configs
 func Load() (*Config, error) {
 	var config Config
-	err := envconfig.Process("BENJERRY", &config)
-	return &config, err
+	if err := envconfig.Process("BENJERRY", &config); err != nil {
+		return &config, err
+	}
+	return &config, config.validate()
+}
+
+//validate checks the constraints between configs that envconfig
+//cannot express on its own
+func (c *Config) validate() error {
+	switch c.StoreDriver {
+	case StoreDriverMemory:
+	case StoreDriverPostgres:
+		if c.PostgresDBURL == "" {
+			return fmt.Errorf("BENJERRY_POSTGRES_DB_URL is required for store driver %s", c.StoreDriver)
+		}
+		if c.MigrationsPath == "" {
+			return fmt.Errorf("BENJERRY_DB_MIGRATIONS_PATH is required for store driver %s", c.StoreDriver)
+		}
+	default:
+		return fmt.Errorf("invalid store driver : %s", c.StoreDriver)
+	}
+	if c.AdminToken != "" && len(c.AdminToken) < minAdminTokenLength {
+		return fmt.Errorf("BENJERRY_ADMIN_TOKEN should be at least %d characters long", minAdminTokenLength)
+	}
+	return c.validateAuthHandlers()
+}
+
+//validateAuthHandlers checks every auth handler is known, listed once
+//and configured
+func (c *Config) validateAuthHandlers() error {
+	if len(c.AuthHandlers) == 0 {
+		return fmt.Errorf("BENJERRY_AUTH_HANDLERS should list at least one auth handler")
+	}
+	listed := map[string]bool{}
+	for _, authHandler := range c.AuthHandlers {
+		if listed[authHandler] {
+			return fmt.Errorf("duplicate auth handler : %s", authHandler)
+		}
+		listed[authHandler] = true
+
+		switch authHandler {
+		case AuthHandlerStatic:
+			if len(c.StaticTokens) == 0 && c.StaticTokenFile == "" {
+				return fmt.Errorf("BENJERRY_STATIC_TOKENS or BENJERRY_STATIC_TOKEN_FILE is required for auth handler %s",
+					authHandler)
+			}
+			if len(c.StaticTokens) != 0 && c.StaticTokenFile != "" {
+				return fmt.Errorf("only one of BENJERRY_STATIC_TOKENS and BENJERRY_STATIC_TOKEN_FILE can be set")
+			}
+			if c.StaticTokenFile != "" && c.StaticTokenFileInterval <= 0 {
+				return fmt.Errorf("BENJERRY_STATIC_TOKEN_FILE_INTERVAL should be positive")
+			}
+		case AuthHandlerJWT:
+			if c.JWTJWKSPath == "" && c.JWTPEMDir == "" {
+				return fmt.Errorf("BENJERRY_JWT_JWKS_PATH or BENJERRY_JWT_PEM_DIR is required for auth handler %s",
+					authHandler)
+			}
+		case AuthHandlerStored:
+		case AuthHandlerOAuth:
+			if len(c.OAuthSigningKey) < minOAuthSigningKeyLength {
+				return fmt.Errorf("BENJERRY_OAUTH_SIGNING_KEY of at least %d bytes is required for auth handler %s",
+					minOAuthSigningKeyLength, authHandler)
+			}
+			if c.OAuthTokenTTL <= 0 {
+				return fmt.Errorf("BENJERRY_OAUTH_TOKEN_TTL should be positive")
+			}
+		default:
+			return fmt.Errorf("invalid auth handler : %s", authHandler)
+		}
+	}
+	return nil
 }
 
 //StaticTokens is a custom config type
@@ -0,0 +1,212 @@
+package configs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//LoadStaticTokenFile reads the static tokens of the file at path. Files
+//ending in .yaml or .yml map every token to the list of its scopes:
+//
+//	suWsnKCXYjz12hQO: [post.icecream, read.icecream]
+//	kfcmUYgqxzM0ZTAs:
+//	  - read.icecream
+//
+//Any other file holds `token=scope,scope` entries, like
+//BENJERRY_STATIC_TOKENS, separated by semicolons or new lines. Both
+//ignore blank lines and lines starting with #. A file without tokens
+//is invalid, it is more likely being written than meant to lock
+//everyone out
+func LoadStaticTokenFile(path string) (StaticTokens, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens StaticTokens
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		tokens, err = parseYAMLTokens(string(data))
+	default:
+		tokens, err = parseTokenEntries(string(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("no static tokens found")
+	}
+	return tokens, nil
+}
+
+//tokenFileLines returns the lines of a token file along with their
+//line numbers, leaving out blank lines and comments
+func tokenFileLines(data string) ([]string, []int) {
+	var lines []string
+	var numbers []int
+	for index, line := range strings.Split(data, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		lines = append(lines, strings.TrimRight(line, " \t\r"))
+		numbers = append(numbers, index+1)
+	}
+	return lines, numbers
+}
+
+func parseTokenEntries(data string) (StaticTokens, error) {
+	var entries []string
+	lines, _ := tokenFileLines(data)
+	for _, line := range lines {
+		for _, entry := range strings.Split(line, ";") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return StaticTokens{}, nil
+	}
+
+	var tokens StaticTokens
+	if err := tokens.Decode(strings.Join(entries, ";")); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+//parseYAMLTokens parses the subset of YAML LoadStaticTokenFile accepts:
+//a mapping of tokens to flow or block sequences of scopes
+func parseYAMLTokens(data string) (StaticTokens, error) {
+	tokens := StaticTokens{}
+	//token is the last token read, whose scopes may follow as a block
+	var token string
+	lines, numbers := tokenFileLines(data)
+	for index, line := range lines {
+		fail := func(format string, args ...interface{}) (StaticTokens, error) {
+			return nil, fmt.Errorf("line %d: %s", numbers[index], fmt.Sprintf(format, args...))
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed != line {
+			if token == "" || !strings.HasPrefix(trimmed, "- ") {
+				return fail("expected a token or a scope, like `- read.icecream`")
+			}
+			tokens[token] = append(tokens[token], unquoteYAML(strings.TrimPrefix(trimmed, "- ")))
+			continue
+		}
+
+		separator := strings.Index(line, ":")
+		if separator < 0 {
+			return fail("expected a token, like `token: [scope, scope]`")
+		}
+		token = unquoteYAML(line[:separator])
+		if _, ok := tokens[token]; ok || token == "" {
+			return fail("duplicate or empty bearer token : %s", token)
+		}
+		tokens[token] = []string{}
+
+		value := strings.TrimSpace(line[separator+1:])
+		switch {
+		case value == "":
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			for _, scope := range strings.Split(value[1:len(value)-1], ",") {
+				tokens[token] = append(tokens[token], unquoteYAML(scope))
+			}
+			token = ""
+		default:
+			return fail("the scopes of a token should be a list, like `[scope, scope]`")
+		}
+	}
+
+	for token, scopes := range tokens {
+		for _, scope := range scopes {
+			if scope == "" {
+				return nil, fmt.Errorf("empty scope for token : %s", token)
+			}
+		}
+		if len(scopes) == 0 {
+			return nil, fmt.Errorf("no scopes for token : %s", token)
+		}
+	}
+	return tokens, nil
+}
+
+//unquoteYAML trims value and the quotes around it
+func unquoteYAML(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+//WatchStaticTokenFile calls onLoad with the tokens of the file at path
+//every time it changes, which is checked every interval, and whenever
+//reload receives, like on SIGHUP. A file that fails to load is logged
+//and leaves the previous tokens in place. The first load has to succeed
+//and happens before WatchStaticTokenFile returns. Closing stop stops
+//the watch
+func WatchStaticTokenFile(path string, interval time.Duration, reload <-chan os.Signal,
+	stop <-chan struct{}, onLoad func(StaticTokens)) error {
+	tokens, err := LoadStaticTokenFile(path)
+	if err != nil {
+		return err
+	}
+	onLoad(tokens)
+	stamp := statTokenFile(path)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				current := statTokenFile(path)
+				if !current.changedFrom(stamp) {
+					continue
+				}
+				stamp = current
+			case <-reload:
+				stamp = statTokenFile(path)
+			}
+
+			tokens, err := LoadStaticTokenFile(path)
+			if err != nil {
+				log.Errorf("error reloading static tokens from %s, keeping the previous ones : %s", path, err)
+				continue
+			}
+			onLoad(tokens)
+			log.Infof("reloaded %d static tokens from %s", len(tokens), path)
+		}
+	}()
+	return nil
+}
+
+//fileStamp tells whether a file changed between two stats
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	missing bool
+}
+
+func (f fileStamp) changedFrom(previous fileStamp) bool {
+	return f.missing != previous.missing || f.size != previous.size || !f.modTime.Equal(previous.modTime)
+}
+
+func statTokenFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{missing: true}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
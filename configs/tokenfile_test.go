@@ -0,0 +1,165 @@
+package configs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//writeTokenFile writes data to the file name of dir and returns its path
+func writeTokenFile(t *testing.T, dir, name, data string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func Test_LoadStaticTokenFile(t *testing.T) {
+	var tests = []struct {
+		desc        string
+		name        string
+		data        string
+		expected    StaticTokens
+		expectedErr string
+	}{
+		{
+			desc: "entries are read across lines and semicolons",
+			name: "tokens",
+			data: "# catalog\nsuWsnKCXYjz12hQO=post.icecream,read.icecream;\n\nkfcmUYgqxzM0ZTAs=read.icecream\n",
+			expected: StaticTokens{
+				"suWsnKCXYjz12hQO": {"post.icecream", "read.icecream"},
+				"kfcmUYgqxzM0ZTAs": {"read.icecream"},
+			},
+		},
+		{
+			desc: "yaml maps tokens to flow and block lists",
+			name: "tokens.yaml",
+			data: "# catalog\nsuWsnKCXYjz12hQO: [post.icecream, 'read.icecream']\n" +
+				"\"kfcmUYgqxzM0ZTAs\":\n  - read.icecream\n  - delete.icecream\n",
+			expected: StaticTokens{
+				"suWsnKCXYjz12hQO": {"post.icecream", "read.icecream"},
+				"kfcmUYgqxzM0ZTAs": {"read.icecream", "delete.icecream"},
+			},
+		},
+		{
+			desc:        "a file without tokens is invalid",
+			name:        "tokens",
+			data:        "# nothing yet\n",
+			expectedErr: "no static tokens found",
+		},
+		{
+			desc:        "broken entries are reported",
+			name:        "tokens",
+			data:        "suWsnKCXYjz12hQO",
+			expectedErr: "invalid static token : suWsnKCXYjz12hQO",
+		},
+		{
+			desc:        "yaml scopes should be lists",
+			name:        "tokens.yml",
+			data:        "suWsnKCXYjz12hQO: [read.icecream]\nkfcmUYgqxzM0ZTAs: read.icecream\n",
+			expectedErr: "line 2: the scopes of a token should be a list, like `[scope, scope]`",
+		},
+		{
+			desc:        "yaml tokens need scopes",
+			name:        "tokens.yaml",
+			data:        "suWsnKCXYjz12hQO:\n",
+			expectedErr: "no scopes for token : suWsnKCXYjz12hQO",
+		},
+		{
+			desc:        "yaml tokens are listed once",
+			name:        "tokens.yaml",
+			data:        "suWsnKCXYjz12hQO: [read.icecream]\nsuWsnKCXYjz12hQO: [post.icecream]\n",
+			expectedErr: "line 2: duplicate or empty bearer token : suWsnKCXYjz12hQO",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			dir, err := ioutil.TempDir("", "tokens")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			tokens, err := LoadStaticTokenFile(writeTokenFile(t, dir, test.name, test.data))
+			if test.expectedErr != "" {
+				assert.EqualError(err, test.expectedErr)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(test.expected, tokens)
+		})
+	}
+}
+
+func Test_WatchStaticTokenFile(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeTokenFile(t, dir, "tokens", "suWsnKCXYjz12hQO=read.icecream")
+
+	loaded := make(chan StaticTokens, 1)
+	reload := make(chan os.Signal)
+	stop := make(chan struct{})
+	defer close(stop)
+	//the interval is long enough for reloads to only happen on signal
+	err = WatchStaticTokenFile(path, time.Hour, reload, stop, func(tokens StaticTokens) {
+		loaded <- tokens
+	})
+	assert.NoError(err)
+	assert.Equal(StaticTokens{"suWsnKCXYjz12hQO": {"read.icecream"}}, <-loaded)
+
+	//an invalid file keeps the previous tokens
+	writeTokenFile(t, dir, "tokens", "suWsnKCXYjz12hQO")
+	reload <- os.Interrupt
+	//the second signal is only received once the first one is handled
+	reload <- os.Interrupt
+	assert.Empty(loaded)
+	writeTokenFile(t, dir, "tokens", "kfcmUYgqxzM0ZTAs=post.icecream")
+	reload <- os.Interrupt
+	select {
+	case tokens := <-loaded:
+		assert.Equal(StaticTokens{"kfcmUYgqxzM0ZTAs": {"post.icecream"}}, tokens)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the tokens were not reloaded")
+	}
+
+	assert.Error(WatchStaticTokenFile(filepath.Join(dir, "missing"), time.Hour, reload, stop,
+		func(StaticTokens) {}))
+}
+
+func Test_WatchStaticTokenFileChange(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeTokenFile(t, dir, "tokens", "suWsnKCXYjz12hQO=read.icecream")
+
+	loaded := make(chan StaticTokens, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	err = WatchStaticTokenFile(path, 10*time.Millisecond, nil, stop, func(tokens StaticTokens) {
+		loaded <- tokens
+	})
+	assert.NoError(err)
+	<-loaded
+
+	writeTokenFile(t, dir, "tokens", "kfcmUYgqxzM0ZTAs=post.icecream,read.icecream")
+	select {
+	case tokens := <-loaded:
+		assert.Equal(StaticTokens{"kfcmUYgqxzM0ZTAs": {"post.icecream", "read.icecream"}}, tokens)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the change was not noticed")
+	}
+}
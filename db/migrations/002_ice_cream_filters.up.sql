@@ -0,0 +1,3 @@
+CREATE INDEX ice_cream_sourcing_values_idx ON ice_cream USING GIN (sourcing_values);
+CREATE INDEX ice_cream_ingredients_idx ON ice_cream USING GIN (ingredients);
+CREATE INDEX ice_cream_dietary_certification_idx ON ice_cream (dietary_certification);
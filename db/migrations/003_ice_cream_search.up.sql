@@ -0,0 +1,19 @@
+ALTER TABLE ice_cream ADD COLUMN search_vector tsvector;
+
+CREATE FUNCTION ice_cream_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('english', coalesce(NEW.description, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(NEW.story, '')), 'B');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ice_cream_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF story, description ON ice_cream
+    FOR EACH ROW EXECUTE PROCEDURE ice_cream_search_vector_update();
+
+-- fire the trigger for the rows that already exist
+UPDATE ice_cream SET story = story;
+
+CREATE INDEX ice_cream_search_vector_idx ON ice_cream USING GIN (search_vector);
@@ -0,0 +1,2 @@
+-- version is bumped on every update and exposed as the ETag of the row
+ALTER TABLE ice_cream ADD COLUMN version bigint NOT NULL DEFAULT 1;
@@ -0,0 +1,4 @@
+-- deleted rows are kept in the table as trash until they are purged
+ALTER TABLE ice_cream ADD COLUMN deleted_at timestamptz;
+ALTER TABLE ice_cream ADD COLUMN deleted_by text;
+CREATE INDEX ice_cream_deleted_at_idx ON ice_cream (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,15 @@
+-- every write to ice_cream is recorded here. Rows outlive the ice cream
+-- they describe so purged ice creams keep their history
+CREATE TABLE ice_cream_history(
+    id bigserial PRIMARY KEY,
+    name text NOT NULL,
+    version bigint NOT NULL,
+    action text NOT NULL,
+    actor text NOT NULL,
+    request_id text NOT NULL,
+    -- json rather than jsonb keeps the values exactly as they were written
+    changes json NOT NULL,
+    snapshot json NOT NULL,
+    changed_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX ice_cream_history_name_idx ON ice_cream_history (name, id);
@@ -0,0 +1,18 @@
+-- every ingredient is named once and shared by the ice creams using it
+CREATE TABLE ingredient(
+    id bigserial PRIMARY KEY,
+    name text NOT NULL UNIQUE
+);
+-- the ingredient tree of every ice cream, in preorder. Compound
+-- ingredients, like "liquid sugar (sugar, water)", are the parent of the
+-- ones they are made of. ingredients of ice_cream keeps the flat form
+CREATE TABLE ice_cream_ingredient(
+    ice_cream_name text NOT NULL REFERENCES ice_cream(name) ON DELETE CASCADE,
+    position int NOT NULL,
+    parent_position int,
+    ingredient_id bigint NOT NULL REFERENCES ingredient(id),
+    PRIMARY KEY (ice_cream_name, position),
+    FOREIGN KEY (ice_cream_name, parent_position)
+        REFERENCES ice_cream_ingredient(ice_cream_name, position) ON DELETE CASCADE
+);
+CREATE INDEX ice_cream_ingredient_ingredient_id_idx ON ice_cream_ingredient (ingredient_id);
@@ -0,0 +1,16 @@
+-- the ingredient registry. Ice creams listing an ingredient under one
+-- of its synonyms are stored with its name instead
+CREATE TABLE registered_ingredient(
+    name text PRIMARY KEY,
+    synonyms text[] NOT NULL DEFAULT '{}',
+    category text NOT NULL DEFAULT '',
+    e_number text NOT NULL DEFAULT ''
+);
+-- every name and synonym of the registry, lowercased with its spaces
+-- collapsed, so that no two ingredients can be known by the same one
+CREATE TABLE registered_ingredient_key(
+    key text PRIMARY KEY,
+    ingredient_name text NOT NULL
+        REFERENCES registered_ingredient(name) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX registered_ingredient_key_ingredient_name_idx ON registered_ingredient_key (ingredient_name);
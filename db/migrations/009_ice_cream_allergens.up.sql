@@ -0,0 +1,7 @@
+-- the allergens derived from allergy_info and the ingredients. They are
+-- NULL for rows stored before they were derived, which free_from
+-- listings leave out as their allergens are unknown
+ALTER TABLE ice_cream ADD COLUMN contains_allergens text[];
+ALTER TABLE ice_cream ADD COLUMN may_contain_allergens text[];
+CREATE INDEX ice_cream_contains_allergens_idx ON ice_cream USING GIN (contains_allergens);
+CREATE INDEX ice_cream_may_contain_allergens_idx ON ice_cream USING GIN (may_contain_allergens);
@@ -0,0 +1,12 @@
+-- bearer tokens minted through the api. Only the SHA-256 of their
+-- secret is kept, the token itself is shown once when minted
+CREATE TABLE api_token(
+    id text PRIMARY KEY,
+    owner text NOT NULL,
+    scopes text[] NOT NULL DEFAULT '{}',
+    secret_hash bytea NOT NULL,
+    created_at timestamptz NOT NULL,
+    expires_at timestamptz,
+    last_used_at timestamptz,
+    revoked_at timestamptz
+);
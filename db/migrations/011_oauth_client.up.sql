@@ -0,0 +1,3 @@
+-- oauth clients are only accepted by the oauth server, never as bearer
+-- tokens of the api. Tokens minted before are api tokens
+ALTER TABLE api_token ADD COLUMN kind text NOT NULL DEFAULT 'api';
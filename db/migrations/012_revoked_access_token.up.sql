@@ -0,0 +1,6 @@
+-- the access tokens of the oauth server revoked before they expire.
+-- Rows are only needed until then, later revocations drop them
+CREATE TABLE revoked_access_token(
+    jti text PRIMARY KEY,
+    expires_at timestamptz NOT NULL
+);
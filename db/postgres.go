@@ -40,10 +40,16 @@ type DB struct {
 	*sql.DB
 }
 
-//WithTxContext wraps the contextcallers for ease of use
+//WithTxContext wraps the contextcallers for ease of use.
+//When ctx already holds a transaction f joins it, leaving the commit
+//to the outermost caller
 func (t *DB) WithTxContext(ctx context.Context, f func(context.Context) error) error {
+	if _, ok := ctx.Value(contextKeyTx).(*sql.Tx); ok {
+		return f(ctx)
+	}
 
-	tx, err := t.Begin()
+	//the transaction is rolled back if ctx is done before it commits
+	tx, err := t.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"github.com/sudarshan-reddy/benjerry/httputils"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+const ndjsonMediaType = "application/x-ndjson"
+
+//statuses of a single item of a bulk import
+const (
+	bulkCreated  = "created"
+	bulkConflict = "conflict"
+	bulkInvalid  = "invalid"
+	bulkFailed   = "failed"
+)
+
+//errBulkAborted rolls back an atomic bulk import
+var errBulkAborted = errors.New("bulk import aborted")
+
+//bulkResult is the line of the report of a bulk import telling how a
+//single item went. Index is the position of the item in the body
+type bulkResult struct {
+	Index  int                   `json:"index"`
+	Name   string                `json:"name,omitempty"`
+	Status string                `json:"status"`
+	Errors []*httputils.SubError `json:"errors,omitempty"`
+}
+
+//bulkSummary is the last line of the report of a bulk import.
+//Committed tells whether the created items were kept, which an atomic
+//import only does when every item was created
+type bulkSummary struct {
+	Created   int                   `json:"created"`
+	Conflicts int                   `json:"conflicts"`
+	Invalid   int                   `json:"invalid"`
+	Failed    int                   `json:"failed"`
+	Committed bool                  `json:"committed"`
+	Errors    []*httputils.SubError `json:"errors,omitempty"`
+}
+
+//bulkReport streams the report of a bulk import as NDJSON, one line
+//per item as soon as it is processed
+type bulkReport struct {
+	controller *http.ResponseController
+	encoder    *json.Encoder
+	summary    bulkSummary
+}
+
+func newBulkReport(w http.ResponseWriter) *bulkReport {
+	controller := http.NewResponseController(w)
+	//HTTP/1 servers close the body once the response starts unless
+	//told otherwise, HTTP/2 ones do not support or need being told.
+	//It takes go 1.21, which the Dockerfile builds with
+	controller.EnableFullDuplex()
+
+	w.Header().Set("Content-Type", ndjsonMediaType)
+	w.WriteHeader(http.StatusOK)
+	return &bulkReport{controller: controller, encoder: json.NewEncoder(w)}
+}
+
+func (b *bulkReport) add(result bulkResult) {
+	switch result.Status {
+	case bulkCreated:
+		b.summary.Created++
+	case bulkConflict:
+		b.summary.Conflicts++
+	case bulkInvalid:
+		b.summary.Invalid++
+	case bulkFailed:
+		b.summary.Failed++
+	}
+	b.write(result)
+}
+
+func (b *bulkReport) close() {
+	b.write(struct {
+		Summary bulkSummary `json:"summary"`
+	}{b.summary})
+}
+
+func (b *bulkReport) write(line interface{}) {
+	//the client only misses the rest of the report when it is gone
+	b.encoder.Encode(line)
+	b.controller.Flush()
+}
+
+//bulkDecoder reads the items of a bulk import one at a time so bodies
+//never have to fit in memory, out of either a json array or NDJSON
+type bulkDecoder struct {
+	decoder *json.Decoder
+	array   bool
+}
+
+//newBulkDecoder starts reading body, before anything is written back as
+//a body that is unread by then is closed when the client waits for a
+//100 Continue
+func newBulkDecoder(body io.Reader, mediaType string) (*bulkDecoder, error) {
+	decoder := json.NewDecoder(body)
+	if mediaType == ndjsonMediaType {
+		decoder.More()
+		return &bulkDecoder{decoder: decoder}, nil
+	}
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, errors.New("body should be a json array")
+	}
+	return &bulkDecoder{decoder: decoder, array: true}, nil
+}
+
+//next returns the next item, or io.EOF once there are none left
+func (b *bulkDecoder) next() (json.RawMessage, error) {
+	if b.array && !b.decoder.More() {
+		if _, err := b.decoder.Token(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	var item json.RawMessage
+	if err := b.decoder.Decode(&item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+//bulkModeParam reads the `mode` query parameter. It returns true for
+//atomic imports and false for best effort ones, the default
+func bulkModeParam(query url.Values) (bool, *httputils.HandlerError) {
+	switch query.Get("mode") {
+	case "", "best_effort":
+		return false, nil
+	case "atomic":
+		return true, nil
+	default:
+		return false, httputils.NewInvalidParameterError("mode should be atomic or best_effort")
+	}
+}
+
+//BulkImportIceCreams creates every ice cream of the body, a json array
+//or an NDJSON stream, and streams back an NDJSON report with a line per
+//item followed by a summary. Atomic imports, `mode=atomic`, are all or
+//nothing and stop at the first item that is not created. Best effort
+//ones keep the items that could be created and go on past conflicts and
+//invalid items. Both stop when the store fails
+func (i *IceCreamHandler) BulkImportIceCreams(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	atomic, handlerErr := bulkModeParam(r.URL.Query())
+	if handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "application/json"
+	}
+	if mediaType != "application/json" && mediaType != ndjsonMediaType {
+		msg := fmt.Sprintf("Content-Type should be application/json or %s", ndjsonMediaType)
+		httputils.WriteHandlerError(httputils.NewUnsupportedMediaTypeError(msg), r, w)
+		return
+	}
+
+	items, err := newBulkDecoder(r.Body, mediaType)
+	if err != nil {
+		msg := fmt.Sprintf("invalid input format. error: %s", err)
+		httputils.WriteHandlerError(httputils.NewFormatError(msg), r, w)
+		return
+	}
+
+	report := newBulkReport(w)
+	defer report.close()
+
+	if !atomic {
+		i.importIceCreams(r.Context(), items, report, false)
+		report.summary.Committed = true
+		return
+	}
+
+	err = i.iceCreamStore.WithTxContext(r.Context(), func(ctx context.Context) error {
+		if !i.importIceCreams(ctx, items, report, true) {
+			return errBulkAborted
+		}
+		return nil
+	})
+	report.summary.Committed = err == nil
+	if err != nil && err != errBulkAborted {
+		report.summary.Errors = publicSubErrors(storeError(err))
+	}
+}
+
+//importIceCreams stores the items one at a time and reports them. It
+//returns whether every item was created, stopping at the first one
+//that was not when stopOnError is set
+func (i *IceCreamHandler) importIceCreams(ctx context.Context, items *bulkDecoder,
+	report *bulkReport, stopOnError bool) bool {
+	allCreated := true
+	for index := 0; ; index++ {
+		item, err := items.next()
+		if err == io.EOF {
+			return allCreated
+		}
+		if err != nil {
+			//the rest of a malformed body cannot be told apart
+			msg := fmt.Sprintf("invalid input format. error: %s", err)
+			report.add(bulkResult{Index: index, Status: bulkInvalid,
+				Errors: httputils.NewFormatError(msg).SubErrors})
+			return false
+		}
+
+		result := i.importIceCream(ctx, index, item)
+		report.add(result)
+		if result.Status == bulkFailed {
+			return false
+		}
+		if result.Status != bulkCreated {
+			allCreated = false
+			if stopOnError {
+				return false
+			}
+		}
+	}
+}
+
+func (i *IceCreamHandler) importIceCream(ctx context.Context, index int, item json.RawMessage) bulkResult {
+	var iceCream models.IceCream
+	if err := json.Unmarshal(item, &iceCream); err != nil {
+		msg := fmt.Sprintf("invalid input format. error: %s", err)
+		return bulkResult{Index: index, Status: bulkInvalid, Errors: httputils.NewFormatError(msg).SubErrors}
+	}
+
+	result := bulkResult{Index: index, Name: iceCream.Name}
+	if handlerErr := validationError(iceCream.Validate()); handlerErr != nil {
+		result.Status = bulkInvalid
+		result.Errors = handlerErr.SubErrors
+		return result
+	}
+
+	switch err := i.iceCreamStore.StoreContext(ctx, iceCream); err {
+	case nil:
+		result.Status = bulkCreated
+	case models.ErrRowAlreadyExists:
+		result.Status = bulkConflict
+		result.Errors = httputils.NewInvalidOperation(
+			fmt.Sprintf("Icecream: %s already exists", iceCream.Name)).SubErrors
+	default:
+		result.Status = bulkFailed
+		result.Errors = publicSubErrors(storeError(err))
+	}
+	return result
+}
+
+//publicSubErrors returns the details of handlerErr that can be shown to
+//clients. Like httputils.WriteHandlerError it hides internal errors
+func publicSubErrors(handlerErr *httputils.HandlerError) []*httputils.SubError {
+	if handlerErr.HTTPStatusCode == http.StatusInternalServerError {
+		return nil
+	}
+	return handlerErr.SubErrors
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+func Test_BulkImportIceCreams(t *testing.T) {
+	var tests = []struct {
+		desc               string
+		query              string
+		contentType        string
+		reqBody            string
+		storeErrs          map[string]error
+		expectedStatusCode int
+		expectedResponse   string
+	}{
+		{
+			desc:    "best effort imports go on past conflicts and invalid items",
+			reqBody: `[{"name":"a"},{"name":"b"},{"story":"nameless"},{"name":1},{"name":"c"}]`,
+			storeErrs: map[string]error{
+				"b": models.ErrRowAlreadyExists,
+			},
+			expectedStatusCode: 200,
+			expectedResponse: `{"index":0,"name":"a","status":"created"}` + "\n" +
+				`{"index":1,"name":"b","status":"conflict","errors":[{"code":"invalid_operation",` +
+				`"message":"Icecream: b already exists"}]}` + "\n" +
+				`{"index":2,"status":"invalid","errors":[{"code":"invalid_parameter",` +
+				`"message":"name is required","pointer":"/name"}]}` + "\n" +
+				`{"index":3,"status":"invalid","errors":[{"code":"format_error",` +
+				`"message":"invalid input format. error: json: cannot unmarshal number into ` +
+				`Go struct field IceCream.name of type string"}]}` + "\n" +
+				`{"index":4,"name":"c","status":"created"}` + "\n" +
+				`{"summary":{"created":2,"conflicts":1,"invalid":2,"failed":0,"committed":true}}` + "\n",
+		},
+		{
+			desc:               "NDJSON bodies are read a line at a time",
+			contentType:        "application/x-ndjson",
+			reqBody:            "{\"name\":\"a\"}\n{\"name\":\"b\"}\n",
+			expectedStatusCode: 200,
+			expectedResponse: `{"index":0,"name":"a","status":"created"}` + "\n" +
+				`{"index":1,"name":"b","status":"created"}` + "\n" +
+				`{"summary":{"created":2,"conflicts":0,"invalid":0,"failed":0,"committed":true}}` + "\n",
+		},
+		{
+			desc:    "atomic imports stop and roll back at the first item that is not created",
+			query:   "?mode=atomic",
+			reqBody: `[{"name":"a"},{"name":"b"},{"name":"c"}]`,
+			storeErrs: map[string]error{
+				"b": models.ErrRowAlreadyExists,
+			},
+			expectedStatusCode: 200,
+			expectedResponse: `{"index":0,"name":"a","status":"created"}` + "\n" +
+				`{"index":1,"name":"b","status":"conflict","errors":[{"code":"invalid_operation",` +
+				`"message":"Icecream: b already exists"}]}` + "\n" +
+				`{"summary":{"created":1,"conflicts":1,"invalid":0,"failed":0,"committed":false}}` + "\n",
+		},
+		{
+			desc:    "store failures stop the import without exposing the error",
+			reqBody: `[{"name":"a"},{"name":"b"}]`,
+			storeErrs: map[string]error{
+				"a": errors.New("pg error: error connecting to db"),
+			},
+			expectedStatusCode: 200,
+			expectedResponse: `{"index":0,"name":"a","status":"failed"}` + "\n" +
+				`{"summary":{"created":0,"conflicts":0,"invalid":0,"failed":1,"committed":true}}` + "\n",
+		},
+		{
+			desc:               "a malformed body stops the import where it breaks",
+			reqBody:            `[{"name":"a"},{"name":`,
+			expectedStatusCode: 200,
+			expectedResponse: `{"index":0,"name":"a","status":"created"}` + "\n" +
+				`{"index":1,"status":"invalid","errors":[{"code":"format_error",` +
+				`"message":"invalid input format. error: unexpected EOF"}]}` + "\n" +
+				`{"summary":{"created":1,"conflicts":0,"invalid":1,"failed":0,"committed":true}}` + "\n",
+		},
+		{
+			desc:               "a body that is not an array returns a 400 error",
+			reqBody:            `{"name":"a"}`,
+			expectedStatusCode: 400,
+			expectedResponse: "{\"httpStatus\":400,\"httpCode\":\"bad_request\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"format_error\"," +
+				"\"message\":\"invalid input format. error: body should be a json array\"}]}\n",
+		},
+		{
+			desc:               "an unknown mode returns a 400 error",
+			query:              "?mode=eventually",
+			reqBody:            `[]`,
+			expectedStatusCode: 400,
+			expectedResponse: "{\"httpStatus\":400,\"httpCode\":\"bad_request\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"invalid_parameter\"," +
+				"\"message\":\"mode should be atomic or best_effort\"}]}\n",
+		},
+		{
+			desc:               "an unsupported Content-Type returns a 415 error",
+			contentType:        "text/csv",
+			reqBody:            "name\na\n",
+			expectedStatusCode: 415,
+			expectedResponse: "{\"httpStatus\":415,\"httpCode\":\"unsupported_media_type\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"unsupported_media_type\"," +
+				"\"message\":\"Content-Type should be application/json or application/x-ndjson\"}]}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			iceCreamStore := &fakeIceCreamStore{storeErrs: test.storeErrs}
+			ich := NewIceCreamHandler(iceCreamStore, Config{})
+
+			req, err := http.NewRequest("POST", "/url"+test.query, bytes.NewReader([]byte(test.reqBody)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+			}
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(ich.BulkImportIceCreams)
+			handler.ServeHTTP(rr, req)
+			assert.Equal(test.expectedResponse, rr.Body.String())
+			assert.Equal(test.expectedStatusCode, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/sudarshan-reddy/benjerry/httputils"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//storeError converts an error of the store that the handler has no
+//specific answer for. Calls cut short by a deadline are answered with a
+//504 and the ones given up on with a 503, anything else is unexpected
+func storeError(err error) *httputils.HandlerError {
+	switch err {
+	case models.ErrQueryTimeout:
+		return httputils.NewGatewayTimeoutError("the store did not answer in time")
+	case context.DeadlineExceeded:
+		return httputils.NewGatewayTimeoutError("the request did not complete in time")
+	case context.Canceled:
+		return httputils.NewServiceUnavailableError("the request was cancelled")
+	default:
+		return httputils.NewUnexpectedError(err)
+	}
+}
+
+//validationError reports every constraint broken by an ice cream, an
+//ingredient or a token at once, each with the json pointer of its
+//field. It is nil when there are none
+func validationError(fieldErrs []models.FieldError) *httputils.HandlerError {
+	if len(fieldErrs) == 0 {
+		return nil
+	}
+	subErrors := make([]*httputils.SubError, 0, len(fieldErrs))
+	for _, fieldErr := range fieldErrs {
+		subErrors = append(subErrors, httputils.NewFieldError(fieldErr.Pointer, fieldErr.Error()))
+	}
+	return httputils.NewHandlerError(http.StatusBadRequest, subErrors...)
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+func Test_storeError(t *testing.T) {
+	var tests = []struct {
+		desc               string
+		err                error
+		expectedStatusCode int
+	}{
+		{
+			desc:               "a query timeout is a gateway timeout",
+			err:                models.ErrQueryTimeout,
+			expectedStatusCode: http.StatusGatewayTimeout,
+		},
+		{
+			desc:               "an expired request is a gateway timeout",
+			err:                context.DeadlineExceeded,
+			expectedStatusCode: http.StatusGatewayTimeout,
+		},
+		{
+			desc:               "a cancelled request is unavailable",
+			err:                context.Canceled,
+			expectedStatusCode: http.StatusServiceUnavailable,
+		},
+		{
+			desc:               "anything else is unexpected",
+			err:                errors.New("pg error: error connecting to db"),
+			expectedStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert.Equal(t, test.expectedStatusCode, storeError(test.err).HTTPStatusCode)
+		})
+	}
+}
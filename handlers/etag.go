@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sudarshan-reddy/benjerry/httputils"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//etag formats the version of a row as a strong entity tag
+func etag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+//parseETags reads the versions out of a list of entity tags. Weak and
+//malformed tags are dropped since they can never match strongly
+func parseETags(header string) []int64 {
+	var versions []int64
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+		if err != nil || version < 1 {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+//expectedVersion evaluates the If-Match header of r against the ice
+//cream called name. It returns the version the write should be
+//conditional on, 0 meaning unconditional
+func (i *IceCreamHandler) expectedVersion(r *http.Request, name string) (int64, *httputils.HandlerError) {
+	return i.matchVersion(r, name, func(ctx context.Context) (int64, error) {
+		current, err := i.iceCreamStore.Get(ctx, name)
+		if err != nil {
+			return 0, err
+		}
+		return current.Version, nil
+	})
+}
+
+//expectedTrashedVersion is expectedVersion for the ice cream called
+//name in the trash
+func (i *IceCreamHandler) expectedTrashedVersion(r *http.Request, name string) (int64, *httputils.HandlerError) {
+	return i.matchVersion(r, name, func(ctx context.Context) (int64, error) {
+		trashed, err := i.iceCreamStore.GetTrashed(ctx, name)
+		if err != nil {
+			return 0, err
+		}
+		return trashed.Version, nil
+	})
+}
+
+//matchVersion evaluates the If-Match header of r, reading the version
+//the ice cream called name is at from currentVersion only when the
+//header cannot be evaluated without it
+func (i *IceCreamHandler) matchVersion(r *http.Request, name string,
+	currentVersion func(context.Context) (int64, error)) (int64, *httputils.HandlerError) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if i.cfg.RequireIfMatch {
+			return 0, httputils.NewPreconditionRequiredError("If-Match header is required")
+		}
+		return 0, nil
+	}
+
+	//* only requires the ice cream to exist, the write is then
+	//conditional on the version it exists at
+	if strings.TrimSpace(header) == "*" {
+		current, err := currentVersion(r.Context())
+		if err == models.ErrNoRows {
+			return 0, httputils.NewPreconditionFailedError(
+				fmt.Sprintf("Icecream: %s does not exist to match If-Match: *", name))
+		}
+		if err != nil {
+			return 0, storeError(err)
+		}
+		return current, nil
+	}
+
+	mismatch := httputils.NewPreconditionFailedError(
+		fmt.Sprintf("Icecream: %s does not match If-Match: %s", name, header))
+	versions := parseETags(header)
+	switch len(versions) {
+	case 0:
+		return 0, mismatch
+	case 1:
+		return versions[0], nil
+	}
+
+	//the store can only be conditional on a single version so pick
+	//the one the row is currently at, if it is listed
+	current, err := currentVersion(r.Context())
+	if err == models.ErrNoRows {
+		return 0, mismatch
+	}
+	if err != nil {
+		return 0, storeError(err)
+	}
+	for _, version := range versions {
+		if version == current {
+			return version, nil
+		}
+	}
+	return 0, mismatch
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+func Test_parseETags(t *testing.T) {
+	assert.Equal(t, []int64{3, 5}, parseETags(`"3", W/"4" ,"5", "abc", 6`))
+	assert.Nil(t, parseETags(`W/"1"`))
+}
+
+func Test_ConditionalWrites(t *testing.T) {
+	var tests = []struct {
+		desc               string
+		cfg                Config
+		ifMatch            string
+		current            *models.IceCream
+		dbError            error
+		expectedStatusCode int
+		expectedVersion    int64
+		expectedResponse   string
+	}{
+		{
+			desc:               "without If-Match writes are unconditional",
+			expectedStatusCode: 200,
+		},
+		{
+			desc:               "without If-Match writes are rejected when it is required",
+			cfg:                Config{RequireIfMatch: true},
+			expectedStatusCode: 428,
+			expectedResponse: "{\"httpStatus\":428,\"httpCode\":\"precondition_required\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"precondition_required\"," +
+				"\"message\":\"If-Match header is required\"}]}\n",
+		},
+		{
+			desc:               "a wildcard If-Match satisfies the requirement and matches the current version",
+			cfg:                Config{RequireIfMatch: true},
+			ifMatch:            "*",
+			current:            &models.IceCream{Name: "chocobar", Version: 3},
+			expectedStatusCode: 200,
+			expectedVersion:    3,
+		},
+		{
+			desc:               "a wildcard If-Match returns 412 when the ice cream does not exist",
+			ifMatch:            "*",
+			dbError:            models.ErrNoRows,
+			expectedStatusCode: 412,
+			expectedResponse: "{\"httpStatus\":412,\"httpCode\":\"precondition_failed\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"precondition_failed\"," +
+				"\"message\":\"Icecream: chocobar does not exist to match If-Match: *\"}]}\n",
+		},
+		{
+			desc:               "a single etag makes the write conditional on its version",
+			ifMatch:            `"4"`,
+			expectedStatusCode: 200,
+			expectedVersion:    4,
+		},
+		{
+			desc:               "a version mismatch in the store returns 412",
+			ifMatch:            `"4"`,
+			dbError:            models.ErrVersionMismatch,
+			expectedStatusCode: 412,
+			expectedVersion:    4,
+			expectedResponse: "{\"httpStatus\":412,\"httpCode\":\"precondition_failed\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"precondition_failed\"," +
+				"\"message\":\"Icecream: chocobar has changed\"}]}\n",
+		},
+		{
+			desc:               "weak etags never match",
+			ifMatch:            `W/"4"`,
+			expectedStatusCode: 412,
+			expectedResponse: "{\"httpStatus\":412,\"httpCode\":\"precondition_failed\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"precondition_failed\"," +
+				"\"message\":\"Icecream: chocobar does not match If-Match: W/\\\"4\\\"\"}]}\n",
+		},
+		{
+			desc:               "a list of etags is matched against the current version",
+			ifMatch:            `"2", "7"`,
+			current:            &models.IceCream{Name: "chocobar", Version: 7},
+			expectedStatusCode: 200,
+			expectedVersion:    7,
+		},
+	}
+
+	//success is the status a write answers with in place of a 200
+	writes := []struct {
+		name    string
+		method  string
+		body    string
+		success int
+		handler func(*IceCreamHandler) http.HandlerFunc
+	}{
+		{"update", "PUT", `{"name": "chocobar"}`, http.StatusOK, func(i *IceCreamHandler) http.HandlerFunc {
+			return i.UpdateIceCreamData
+		}},
+		{"delete", "DELETE", "", http.StatusNoContent, func(i *IceCreamHandler) http.HandlerFunc {
+			return i.DeleteIceCreamData
+		}},
+		{"restore", "POST", "", http.StatusOK, func(i *IceCreamHandler) http.HandlerFunc {
+			return i.RestoreIceCream
+		}},
+	}
+
+	for _, write := range writes {
+		for _, test := range tests {
+			t.Run(write.name+": "+test.desc, func(t *testing.T) {
+				assert := assert.New(t)
+				iceCreamStore := &fakeIceCreamStore{iceCream: test.current, err: test.dbError}
+				ich := NewIceCreamHandler(iceCreamStore, test.cfg)
+
+				req, err := http.NewRequest(write.method, "/url", bytes.NewReader([]byte(write.body)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if test.ifMatch != "" {
+					req.Header.Set("If-Match", test.ifMatch)
+				}
+
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("ice-cream-name", "chocobar")
+				ctx := context.WithValue(context.Background(), chi.RouteCtxKey, rctx)
+
+				rr := httptest.NewRecorder()
+				write.handler(ich).ServeHTTP(rr, req.WithContext(ctx))
+				expectedStatusCode := test.expectedStatusCode
+				if expectedStatusCode == http.StatusOK {
+					expectedStatusCode = write.success
+				}
+				assert.Equal(expectedStatusCode, rr.Code)
+				assert.Equal(test.expectedVersion, iceCreamStore.version)
+				if test.expectedResponse != "" {
+					assert.Equal(test.expectedResponse, rr.Body.String())
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sudarshan-reddy/benjerry/httputils"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//exportWriter writes an export of the catalog one ice cream at a time
+type exportWriter interface {
+	begin() error
+	write(iceCream models.IceCream) error
+	end() error
+}
+
+//exportFormat is a format the catalog can be exported in
+type exportFormat struct {
+	contentType string
+	extension   string
+	newWriter   func(w io.Writer) exportWriter
+}
+
+var exportFormats = map[string]exportFormat{
+	"json": {"application/json; charset=UTF-8", "json", func(w io.Writer) exportWriter {
+		return &jsonExport{w: w}
+	}},
+	"ndjson": {ndjsonMediaType, "ndjson", func(w io.Writer) exportWriter {
+		return &jsonExport{w: w, lines: true}
+	}},
+	"csv": {"text/csv; charset=UTF-8", "csv", func(w io.Writer) exportWriter {
+		return &csvExport{w: csv.NewWriter(w)}
+	}},
+}
+
+//jsonExport writes a json array of ice creams, which scripts.LoadData
+//reads, or NDJSON when lines is set. Both can be bulk imported
+type jsonExport struct {
+	w       io.Writer
+	lines   bool
+	written int
+}
+
+func (j *jsonExport) begin() error {
+	if j.lines {
+		return nil
+	}
+	_, err := io.WriteString(j.w, "[")
+	return err
+}
+
+func (j *jsonExport) write(iceCream models.IceCream) error {
+	data, err := json.Marshal(iceCream)
+	if err != nil {
+		return err
+	}
+
+	separator := ""
+	switch {
+	case j.lines:
+		data = append(data, '\n')
+	case j.written > 0:
+		separator = ",\n"
+	default:
+		separator = "\n"
+	}
+	j.written++
+
+	if _, err := io.WriteString(j.w, separator); err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonExport) end() error {
+	if j.lines {
+		return nil
+	}
+	_, err := io.WriteString(j.w, "\n]\n")
+	return err
+}
+
+//csvColumns are the columns of a csv export, named after the json
+//fields of IceCream
+var csvColumns = []string{"name", "image_open", "image_closed", "story", "description",
+	"sourcing_values", "ingredients", "allergy_info", "dietary_certification", "product_id"}
+
+//csvExport writes ice creams as csv with a header row. Lists are
+//written as json arrays so their values may hold commas, a missing
+//list is left empty while an empty one is written as []
+type csvExport struct {
+	w *csv.Writer
+}
+
+func (c *csvExport) begin() error {
+	return c.w.Write(csvColumns)
+}
+
+func (c *csvExport) write(iceCream models.IceCream) error {
+	sourcingValues, err := csvList(iceCream.SourcingValues)
+	if err != nil {
+		return err
+	}
+	ingredients, err := csvList(iceCream.Ingredients)
+	if err != nil {
+		return err
+	}
+
+	return c.w.Write([]string{iceCream.Name, iceCream.ImageOpen, iceCream.ImageClosed,
+		iceCream.Story, iceCream.Description, sourcingValues, ingredients,
+		iceCream.AllergyInfo, iceCream.DietaryCertification, iceCream.ProductID})
+}
+
+func (c *csvExport) end() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func csvList(values []string) (string, error) {
+	if values == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(values)
+	return string(data), err
+}
+
+//ExportIceCreams streams the whole catalog in the `format` query
+//parameter, json by default. The store is read a page at a time so the
+//catalog never has to fit in memory
+func (i *IceCreamHandler) ExportIceCreams(w http.ResponseWriter, r *http.Request) {
+	formatName := r.URL.Query().Get("format")
+	if formatName == "" {
+		formatName = "json"
+	}
+	format, ok := exportFormats[formatName]
+	if !ok {
+		httputils.WriteHandlerError(httputils.NewInvalidParameterError("format should be json, ndjson or csv"), r, w)
+		return
+	}
+
+	//failures on the first page can still be answered with an error
+	page, err := i.iceCreamStore.GetAll(r.Context(), models.IceCreamFilter{}, models.MaxPageSize, "")
+	if err != nil {
+		httputils.WriteHandlerError(storeError(err), r, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="icecreams.%s"`, format.extension))
+	w.WriteHeader(http.StatusOK)
+
+	//a failure past this point can only cut the export short, which
+	//leaves the json formats unparseable
+	if err := exportPages(r, page, format.newWriter(w), i.iceCreamStore); err != nil {
+		log.WithField("requestURI", r.RequestURI).Errorf("export cut short: %s", err)
+	}
+}
+
+func exportPages(r *http.Request, page *models.IceCreamPage, export exportWriter,
+	store models.IceCreamStore) error {
+	if err := export.begin(); err != nil {
+		return err
+	}
+	for {
+		for _, iceCream := range page.IceCreams {
+			if err := export.write(iceCream); err != nil {
+				return err
+			}
+		}
+		if page.NextCursor == "" {
+			return export.end()
+		}
+
+		var err error
+		page, err = store.GetAll(r.Context(), models.IceCreamFilter{}, models.MaxPageSize, page.NextCursor)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+	"github.com/sudarshan-reddy/benjerry/models/memory"
+	"github.com/sudarshan-reddy/benjerry/scripts"
+)
+
+func Test_ExportIceCreams(t *testing.T) {
+	twoPages := map[string]*models.IceCreamPage{
+		"": {
+			IceCreams:  []models.IceCream{{Name: "a", Ingredients: []string{"milk, cream", "sugar"}}},
+			NextCursor: "next",
+		},
+		"next": {
+			IceCreams: []models.IceCream{{Name: "b", Story: "a \"quoted\"\nstory", SourcingValues: []string{}}},
+		},
+	}
+
+	var tests = []struct {
+		desc                string
+		query               string
+		pages               map[string]*models.IceCreamPage
+		err                 error
+		expectedStatusCode  int
+		expectedContentType string
+		expectedResponse    string
+	}{
+		{
+			desc:                "json exports are an array of every page",
+			pages:               twoPages,
+			expectedStatusCode:  200,
+			expectedContentType: "application/json; charset=UTF-8",
+			expectedResponse: "[\n" +
+				`{"name":"a","image_open":"","image_closed":"","story":"","description":"",` +
+				`"sourcing_values":null,"ingredients":["milk, cream","sugar"],"allergy_info":"",` +
+				`"dietary_certification":"","product_id":""},` + "\n" +
+				`{"name":"b","image_open":"","image_closed":"","story":"a \"quoted\"\nstory",` +
+				`"description":"","sourcing_values":[],"ingredients":null,"allergy_info":"",` +
+				`"dietary_certification":"","product_id":""}` + "\n]\n",
+		},
+		{
+			desc:                "ndjson exports have a line per ice cream",
+			query:               "?format=ndjson",
+			pages:               twoPages,
+			expectedStatusCode:  200,
+			expectedContentType: "application/x-ndjson",
+			expectedResponse: `{"name":"a","image_open":"","image_closed":"","story":"","description":"",` +
+				`"sourcing_values":null,"ingredients":["milk, cream","sugar"],"allergy_info":"",` +
+				`"dietary_certification":"","product_id":""}` + "\n" +
+				`{"name":"b","image_open":"","image_closed":"","story":"a \"quoted\"\nstory",` +
+				`"description":"","sourcing_values":[],"ingredients":null,"allergy_info":"",` +
+				`"dietary_certification":"","product_id":""}` + "\n",
+		},
+		{
+			desc:                "csv exports write lists as json arrays",
+			query:               "?format=csv",
+			pages:               twoPages,
+			expectedStatusCode:  200,
+			expectedContentType: "text/csv; charset=UTF-8",
+			expectedResponse: "name,image_open,image_closed,story,description,sourcing_values," +
+				"ingredients,allergy_info,dietary_certification,product_id\n" +
+				"a,,,,,,\"[\"\"milk, cream\"\",\"\"sugar\"\"]\",,,\n" +
+				"b,,,\"a \"\"quoted\"\"\nstory\",,[],,,,\n",
+		},
+		{
+			desc:                "an empty catalog is an empty array",
+			pages:               map[string]*models.IceCreamPage{"": {}},
+			expectedStatusCode:  200,
+			expectedContentType: "application/json; charset=UTF-8",
+			expectedResponse:    "[\n]\n",
+		},
+		{
+			desc:                "an unknown format returns a 400 error",
+			query:               "?format=xml",
+			expectedStatusCode:  400,
+			expectedContentType: "application/json; charset=UTF-8",
+			expectedResponse: "{\"httpStatus\":400,\"httpCode\":\"bad_request\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"invalid_parameter\"," +
+				"\"message\":\"format should be json, ndjson or csv\"}]}\n",
+		},
+		{
+			desc:                "a store failure before the export starts returns a 500 error",
+			pages:               map[string]*models.IceCreamPage{},
+			err:                 errors.New("pg error: error connecting to db"),
+			expectedStatusCode:  500,
+			expectedContentType: "application/json; charset=UTF-8",
+			expectedResponse: "{\"httpStatus\":500,\"httpCode\":\"internal_server_error\"," +
+				"\"requestId\":\"\",\"errors\":[]}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			iceCreamStore := &fakeIceCreamStore{pages: test.pages, err: test.err}
+			ich := NewIceCreamHandler(iceCreamStore, Config{})
+
+			req, err := http.NewRequest("GET", "/url"+test.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(ich.ExportIceCreams)
+			handler.ServeHTTP(rr, req)
+			assert.Equal(test.expectedResponse, rr.Body.String())
+			assert.Equal(test.expectedStatusCode, rr.Code)
+			assert.Equal(test.expectedContentType, rr.Header().Get("Content-Type"))
+		})
+	}
+}
+
+func Test_ExportIceCreamsRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	iceCreams := []models.IceCream{
+		{Name: "Crème Brûlée", Story: "made with ❤ & <care> 🍦", Ingredients: []string{"crème"}},
+		{Name: "plain", SourcingValues: []string{}},
+	}
+	iceCreamStore := &fakeIceCreamStore{page: &models.IceCreamPage{IceCreams: iceCreams}}
+	ich := NewIceCreamHandler(iceCreamStore, Config{})
+
+	req, err := http.NewRequest("GET", "/url", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(ich.ExportIceCreams).ServeHTTP(rr, req)
+
+	//the export is read back by the loader of the seed data
+	path := filepath.Join(t.TempDir(), "icecreams.json")
+	if err := ioutil.WriteFile(path, rr.Body.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loadedStore := memory.NewIceCreamStore()
+	summary, err := scripts.LoadData(context.Background(), loadedStore, scripts.Config{Path: path})
+	assert.NoError(err)
+	assert.Len(summary.Inserted, len(iceCreams))
+	for _, iceCream := range iceCreams {
+		loaded, err := loadedStore.Get(context.Background(), iceCream.Name)
+		assert.NoError(err)
+		loaded.Version = 0
+		assert.Equal(iceCream.NormalizeIngredients().DeriveAllergens(), *loaded)
+	}
+}
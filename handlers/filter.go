@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/sudarshan-reddy/benjerry/httputils"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//listValues collects every value of key. Values can either be repeated
+//(`?key=a&key=b`) or comma separated (`?key=a,b`)
+func listValues(query url.Values, key string) ([]string, *httputils.HandlerError) {
+	var values []string
+	for _, param := range query[key] {
+		for _, value := range strings.Split(param, ",") {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				msg := fmt.Sprintf("%s should not contain empty values", key)
+				return nil, httputils.NewInvalidParameterError(msg)
+			}
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
+
+//singleValue returns the value of key making sure it is not repeated
+func singleValue(query url.Values, key string) (string, *httputils.HandlerError) {
+	switch len(query[key]) {
+	case 0:
+		return "", nil
+	case 1:
+		value := strings.TrimSpace(query.Get(key))
+		if value == "" {
+			msg := fmt.Sprintf("%s should not be empty", key)
+			return "", httputils.NewInvalidParameterError(msg)
+		}
+		return value, nil
+	default:
+		msg := fmt.Sprintf("%s should only be specified once", key)
+		return "", httputils.NewInvalidParameterError(msg)
+	}
+}
+
+//parseArrayFilter reads the `<key>`, `<key>_any` and `<key>_exclude`
+//query parameters into an ArrayFilter
+func parseArrayFilter(query url.Values, key string) (models.ArrayFilter, *httputils.HandlerError) {
+	var filter models.ArrayFilter
+	var handlerErr *httputils.HandlerError
+
+	if filter.ContainsAll, handlerErr = listValues(query, key); handlerErr != nil {
+		return filter, handlerErr
+	}
+	if filter.ContainsAny, handlerErr = listValues(query, key+"_any"); handlerErr != nil {
+		return filter, handlerErr
+	}
+	if filter.Excludes, handlerErr = listValues(query, key+"_exclude"); handlerErr != nil {
+		return filter, handlerErr
+	}
+
+	included := append(append([]string{}, filter.ContainsAll...), filter.ContainsAny...)
+	for _, exclude := range filter.Excludes {
+		for _, include := range included {
+			if exclude == include {
+				msg := fmt.Sprintf("%s: %s cannot be both included and excluded", key, exclude)
+				return filter, httputils.NewInvalidParameterError(msg)
+			}
+		}
+	}
+	return filter, nil
+}
+
+//parseAllergens reads the allergens listed by key, making sure they are
+//all known
+func parseAllergens(query url.Values, key string) ([]string, *httputils.HandlerError) {
+	allergens, handlerErr := listValues(query, key)
+	if handlerErr != nil {
+		return nil, handlerErr
+	}
+	for _, allergen := range allergens {
+		if !models.IsAllergen(allergen) {
+			msg := fmt.Sprintf("%s: %s is not an allergen, expected one of %s", key, allergen,
+				strings.Join(models.AllergenNames(), ", "))
+			return nil, httputils.NewInvalidParameterError(msg)
+		}
+	}
+	return allergens, nil
+}
+
+//parseIceCreamFilter builds an IceCreamFilter out of the query parameters
+//of a listing request
+func parseIceCreamFilter(query url.Values) (models.IceCreamFilter, *httputils.HandlerError) {
+	var filter models.IceCreamFilter
+	var handlerErr *httputils.HandlerError
+
+	if filter.SourcingValues, handlerErr = parseArrayFilter(query, "sourcing_values"); handlerErr != nil {
+		return filter, handlerErr
+	}
+	if filter.Ingredients, handlerErr = parseArrayFilter(query, "ingredients"); handlerErr != nil {
+		return filter, handlerErr
+	}
+	if filter.DietaryCertification, handlerErr = singleValue(query, "dietary_certification"); handlerErr != nil {
+		return filter, handlerErr
+	}
+	if filter.AllergyInfo, handlerErr = singleValue(query, "allergy_info"); handlerErr != nil {
+		return filter, handlerErr
+	}
+	if filter.FreeFrom, handlerErr = parseAllergens(query, "free_from"); handlerErr != nil {
+		return filter, handlerErr
+	}
+	return filter, nil
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/httputils"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+func Test_parseIceCreamFilter(t *testing.T) {
+	var tests = []struct {
+		desc           string
+		query          string
+		expectedFilter models.IceCreamFilter
+		expectedErr    *httputils.HandlerError
+	}{
+		{
+			desc: "no query parameters should not filter anything",
+		},
+		{
+			desc: "repeated and comma separated values should be merged",
+			query: "sourcing_values=Fairtrade&sourcing_values=Non-GMO,Caring Dairy" +
+				"&ingredients_exclude=peanuts&dietary_certification=Kosher&allergy_info=soy",
+			expectedFilter: models.IceCreamFilter{
+				SourcingValues: models.ArrayFilter{
+					ContainsAll: []string{"Fairtrade", "Non-GMO", "Caring Dairy"},
+				},
+				Ingredients: models.ArrayFilter{
+					Excludes: []string{"peanuts"},
+				},
+				DietaryCertification: "Kosher",
+				AllergyInfo:          "soy",
+			},
+		},
+		{
+			desc:  "any filters should be read from the _any suffix",
+			query: "ingredients_any=cocoa,honey",
+			expectedFilter: models.IceCreamFilter{
+				Ingredients: models.ArrayFilter{
+					ContainsAny: []string{"cocoa", "honey"},
+				},
+			},
+		},
+		{
+			desc:  "free from should list allergens",
+			query: "free_from=peanuts,tree_nuts",
+			expectedFilter: models.IceCreamFilter{
+				FreeFrom: []string{"peanuts", "tree_nuts"},
+			},
+		},
+		{
+			desc:  "free from should reject unknown allergens",
+			query: "free_from=nuts",
+			expectedErr: httputils.NewInvalidParameterError("free_from: nuts is not an allergen, expected one of " +
+				"milk, eggs, fish, shellfish, tree_nuts, peanuts, wheat, soy, sesame"),
+		},
+		{
+			desc:        "empty list values are invalid",
+			query:       "sourcing_values=Fairtrade,",
+			expectedErr: httputils.NewInvalidParameterError("sourcing_values should not contain empty values"),
+		},
+		{
+			desc:  "a value cannot be both included and excluded",
+			query: "ingredients_any=cocoa&ingredients_exclude=cocoa",
+			expectedErr: httputils.NewInvalidParameterError(
+				"ingredients: cocoa cannot be both included and excluded"),
+		},
+		{
+			desc:        "single valued filters cannot be repeated",
+			query:       "dietary_certification=Kosher&dietary_certification=Vegan",
+			expectedErr: httputils.NewInvalidParameterError("dietary_certification should only be specified once"),
+		},
+		{
+			desc:        "single valued filters cannot be empty",
+			query:       "allergy_info=",
+			expectedErr: httputils.NewInvalidParameterError("allergy_info should not be empty"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			query, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filter, handlerErr := parseIceCreamFilter(query)
+			assert.Equal(test.expectedErr, handlerErr)
+			if test.expectedErr == nil {
+				assert.Equal(test.expectedFilter, filter)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/sudarshan-reddy/benjerry/httputils"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//errUnknownVersion aborts a revert to a version missing from the history
+var errUnknownVersion = errors.New("unknown version")
+
+//iceCreamHistory is the response body of a history listing
+type iceCreamHistory struct {
+	History []models.HistoryEntry `json:"history"`
+}
+
+//GetIceCreamHistory lists every change done to an ice cream, newest
+//first, along with who made it and the fields it changed
+func (i *IceCreamHandler) GetIceCreamHistory(w http.ResponseWriter, r *http.Request) {
+	iceCreamName := chi.URLParam(r, "ice-cream-name")
+
+	history, err := i.iceCreamStore.History(r.Context(), iceCreamName)
+	if err != nil {
+		httputils.WriteHandlerError(storeError(err), r, w)
+		return
+	}
+
+	if history == nil {
+		history = []models.HistoryEntry{}
+	}
+
+	if err := httputils.WriteJSON(http.StatusOK, iceCreamHistory{History: history}, w); err != nil {
+		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		return
+	}
+}
+
+//RevertIceCream puts an ice cream back in the state a past version left
+//it in and responds with the reverted ice cream and its ETag. The
+//revert is recorded in the history as a replace and is conditional on
+//the If-Match header when it is sent
+func (i *IceCreamHandler) RevertIceCream(w http.ResponseWriter, r *http.Request) {
+	iceCreamName := chi.URLParam(r, "ice-cream-name")
+
+	version, err := strconv.ParseInt(chi.URLParam(r, "version"), 10, 64)
+	if err != nil || version < 1 {
+		httputils.WriteHandlerError(httputils.NewInvalidParameterError("version should be a positive number"), r, w)
+		return
+	}
+
+	expected, handlerErr := i.expectedVersion(r, iceCreamName)
+	if handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
+		return
+	}
+
+	var reverted *models.IceCream
+	err = i.iceCreamStore.WithTxContext(r.Context(), func(ctx context.Context) error {
+		history, err := i.iceCreamStore.History(ctx, iceCreamName)
+		if err != nil {
+			return err
+		}
+		entry, ok := models.HistoryVersion(history, version)
+		if !ok {
+			return errUnknownVersion
+		}
+		snapshot := entry.Snapshot
+		snapshot.Version = expected
+		if err := i.iceCreamStore.Replace(ctx, snapshot); err != nil {
+			return err
+		}
+		reverted, err = i.iceCreamStore.Get(ctx, iceCreamName)
+		return err
+	})
+
+	switch err {
+	case nil:
+	case errUnknownVersion:
+		httputils.WriteHandlerError(httputils.
+			NewNotFoundError(fmt.Sprintf("Icecream: %s has no version %d", iceCreamName, version)), r, w)
+		return
+	case models.ErrNoRows:
+		httputils.WriteHandlerError(httputils.
+			NewNotFoundError(fmt.Sprintf("Icecream: %s Not Found", iceCreamName)), r, w)
+		return
+	case models.ErrVersionMismatch:
+		httputils.WriteHandlerError(httputils.NewPreconditionFailedError(
+			fmt.Sprintf("Icecream: %s has changed", iceCreamName)), r, w)
+		return
+	default:
+		httputils.WriteHandlerError(storeError(err), r, w)
+		return
+	}
+
+	w.Header().Set("ETag", etag(reverted.Version))
+	if err := httputils.WriteJSON(http.StatusOK, reverted, w); err != nil {
+		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		return
+	}
+}
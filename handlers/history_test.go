@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+func Test_GetIceCreamHistory(t *testing.T) {
+	changedAt := time.Date(2018, 4, 1, 10, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		desc               string
+		dbResponse         []models.HistoryEntry
+		dbError            error
+		expectedResponse   string
+		expectedStatusCode int
+	}{
+		{
+			desc: "changes are listed with their actor and changed fields",
+			dbResponse: []models.HistoryEntry{{
+				Name:      "Chocobar",
+				Version:   2,
+				Action:    models.HistoryUpdate,
+				Actor:     "token ced85b42",
+				RequestID: "host/abc-000001",
+				ChangedAt: changedAt,
+				Changes: []models.FieldChange{{
+					Field:  "story",
+					Before: json.RawMessage(`"old"`),
+					After:  json.RawMessage(`"new"`),
+				}},
+			}},
+			expectedResponse: "{\"history\":[{\"name\":\"Chocobar\",\"version\":2,\"action\":\"update\"," +
+				"\"actor\":\"token ced85b42\",\"request_id\":\"host/abc-000001\"," +
+				"\"changed_at\":\"2018-04-01T10:00:00Z\",\"changes\":[{\"field\":\"story\"," +
+				"\"before\":\"old\",\"after\":\"new\"}]}]}\n",
+			expectedStatusCode: 200,
+		},
+		{
+			desc:               "an ice cream without history returns an empty list",
+			expectedResponse:   "{\"history\":[]}\n",
+			expectedStatusCode: 200,
+		},
+		{
+			desc:               "if database returns an error, return 500 in response",
+			dbError:            errors.New("pg error: error connecting to db"),
+			expectedStatusCode: 500,
+			expectedResponse: "{\"httpStatus\":500," +
+				"\"httpCode\":\"internal_server_error\"," +
+				"\"requestId\":\"\",\"errors\":[]}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			iceCreamStore := &fakeIceCreamStore{history: test.dbResponse, err: test.dbError}
+			ich := NewIceCreamHandler(iceCreamStore, Config{})
+
+			req, err := http.NewRequest("GET", "/url", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("ice-cream-name", "Chocobar")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(ich.GetIceCreamHistory)
+			handler.ServeHTTP(rr, req)
+			assert.Equal(test.expectedResponse, rr.Body.String())
+			assert.Equal(test.expectedStatusCode, rr.Code)
+		})
+	}
+}
+
+func Test_RevertIceCream(t *testing.T) {
+	history := []models.HistoryEntry{
+		{Version: 3, Snapshot: models.IceCream{Name: "Chocobar", Story: "latest", Version: 3}},
+		{Version: 2, Snapshot: models.IceCream{Name: "Chocobar", Story: "older", Version: 2}},
+	}
+
+	var tests = []struct {
+		desc               string
+		version            string
+		ifMatch            string
+		replaceErr         error
+		expectedResponse   string
+		expectedStatusCode int
+		expectedETag       string
+		expectedReplace    *models.IceCream
+	}{
+		{
+			desc:    "the snapshot of the version is written back",
+			version: "2",
+			expectedResponse: "{\"name\":\"Chocobar\",\"image_open\":\"\",\"image_closed\":\"\",\"story\":\"older\"," +
+				"\"description\":\"\",\"sourcing_values\":null,\"ingredients\":null,\"allergy_info\":\"\"," +
+				"\"dietary_certification\":\"\",\"product_id\":\"\"}\n",
+			expectedStatusCode: 200,
+			expectedETag:       `"4"`,
+			expectedReplace:    &models.IceCream{Name: "Chocobar", Story: "older"},
+		},
+		{
+			desc:    "the revert is conditional on If-Match",
+			version: "2",
+			ifMatch: `"3"`,
+			expectedResponse: "{\"name\":\"Chocobar\",\"image_open\":\"\",\"image_closed\":\"\",\"story\":\"older\"," +
+				"\"description\":\"\",\"sourcing_values\":null,\"ingredients\":null,\"allergy_info\":\"\"," +
+				"\"dietary_certification\":\"\",\"product_id\":\"\"}\n",
+			expectedStatusCode: 200,
+			expectedETag:       `"4"`,
+			expectedReplace:    &models.IceCream{Name: "Chocobar", Story: "older", Version: 3},
+		},
+		{
+			desc:               "a stale If-Match returns 412",
+			version:            "2",
+			ifMatch:            `"2"`,
+			replaceErr:         models.ErrVersionMismatch,
+			expectedStatusCode: 412,
+			expectedReplace:    &models.IceCream{Name: "Chocobar", Story: "older", Version: 2},
+		},
+		{
+			desc:               "a version missing from the history returns 404",
+			version:            "1",
+			expectedStatusCode: 404,
+			expectedResponse: "{\"httpStatus\":404,\"httpCode\":\"not_found\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"not_found\"," +
+				"\"message\":\"Icecream: Chocobar has no version 1\"}]}\n",
+		},
+		{
+			desc:               "a deleted ice cream returns 404",
+			version:            "2",
+			replaceErr:         models.ErrNoRows,
+			expectedStatusCode: 404,
+			expectedReplace:    &models.IceCream{Name: "Chocobar", Story: "older"},
+		},
+		{
+			desc:               "an invalid version returns 400",
+			version:            "latest",
+			expectedStatusCode: 400,
+			expectedResponse: "{\"httpStatus\":400,\"httpCode\":\"bad_request\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"invalid_parameter\"," +
+				"\"message\":\"version should be a positive number\"}]}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			iceCreamStore := &fakeIceCreamStore{
+				history:    history,
+				replaceErr: test.replaceErr,
+				iceCream:   &models.IceCream{Name: "Chocobar", Story: "older", Version: 4},
+			}
+			ich := NewIceCreamHandler(iceCreamStore, Config{})
+
+			req, err := http.NewRequest("POST", "/url", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.ifMatch != "" {
+				req.Header.Set("If-Match", test.ifMatch)
+			}
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("ice-cream-name", "Chocobar")
+			rctx.URLParams.Add("version", test.version)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(ich.RevertIceCream)
+			handler.ServeHTTP(rr, req)
+			assert.Equal(test.expectedStatusCode, rr.Code)
+			assert.Equal(test.expectedReplace, iceCreamStore.replaced)
+			assert.Equal(test.expectedETag, rr.Header().Get("ETag"))
+			if test.expectedResponse != "" {
+				assert.Equal(test.expectedResponse, rr.Body.String())
+			}
+		})
+	}
+}
@@ -1,28 +1,75 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/sudarshan-reddy/benjerry/httputils"
 	"github.com/sudarshan-reddy/benjerry/models"
 )
 
+//iceCreamList is the response body of a paginated listing
+type iceCreamList struct {
+	IceCreams  []models.IceCream `json:"ice_creams"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+	PrevCursor string            `json:"prev_cursor,omitempty"`
+}
+
+//Config holds the settings of the handlers
+type Config struct {
+	//RequireIfMatch rejects updates and deletes that are not
+	//conditional on an ETag with 428 Precondition Required
+	RequireIfMatch bool
+	//TrashRetention is how long deleted ice creams are kept in the
+	//trash before PurgeTrash removes them
+	TrashRetention time.Duration
+}
+
 //IceCreamHandler holds handler related data
 type IceCreamHandler struct {
 	iceCreamStore models.IceCreamStore
+	cfg           Config
 }
 
 //NewIceCreamHandler returns a new instance of IceCreamHandler
-func NewIceCreamHandler(iceCreamStore models.IceCreamStore) *IceCreamHandler {
+func NewIceCreamHandler(iceCreamStore models.IceCreamStore, cfg Config) *IceCreamHandler {
 	return &IceCreamHandler{
 		iceCreamStore: iceCreamStore,
+		cfg:           cfg,
+	}
+}
+
+//readPath is where a single ice cream can be read from
+const readPath = "/api/v1/read/"
+
+//iceCreamLocation gives the url the ice cream called name is read from
+func iceCreamLocation(name string) string {
+	return readPath + url.PathEscape(name)
+}
+
+//writeIceCream responds with iceCream and its ETag. A created ice cream
+//is also pointed to through the Location header
+func writeIceCream(status int, iceCream *models.IceCream, r *http.Request, w http.ResponseWriter) {
+	if status == http.StatusCreated {
+		w.Header().Set("Location", iceCreamLocation(iceCream.Name))
+	}
+	w.Header().Set("ETag", etag(iceCream.Version))
+	if err := httputils.WriteJSON(status, iceCream, w); err != nil {
+		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		return
 	}
 }
 
-//PostIceCreamData creates ice cream data
+//PostIceCreamData creates ice cream data and responds with it.
+//Creating a name that is already taken fails with a 409 pointing to
+//the existing ice cream through the Location header
 func (i *IceCreamHandler) PostIceCreamData(w http.ResponseWriter, r *http.Request) {
 	var iceCreamTask models.IceCream
 	defer r.Body.Close()
@@ -32,24 +79,39 @@ func (i *IceCreamHandler) PostIceCreamData(w http.ResponseWriter, r *http.Reques
 		httputils.WriteHandlerError(httputils.NewFormatError(msg), r, w)
 		return
 	}
-
-	ctx := r.Context()
-	if err := i.iceCreamStore.StoreContext(ctx, iceCreamTask); err != nil {
-		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+	if handlerErr := validationError(iceCreamTask.Validate()); handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
 		return
 	}
 
-	if err := httputils.WriteJSON(http.StatusCreated, "", w); err != nil {
-		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+	var created *models.IceCream
+	err := i.iceCreamStore.WithTxContext(r.Context(), func(ctx context.Context) error {
+		err := i.iceCreamStore.StoreContext(ctx, iceCreamTask)
+		if err != nil {
+			return err
+		}
+		created, err = i.iceCreamStore.Get(ctx, iceCreamTask.Name)
+		return err
+	})
+	if err != nil {
+		if err == models.ErrRowAlreadyExists {
+			w.Header().Set("Location", iceCreamLocation(iceCreamTask.Name))
+			httputils.WriteHandlerError(httputils.NewInvalidOperation(
+				fmt.Sprintf("Icecream: %s already exists", iceCreamTask.Name)), r, w)
+			return
+		}
+		httputils.WriteHandlerError(storeError(err), r, w)
 		return
 	}
+
+	writeIceCream(http.StatusCreated, created, r, w)
 }
 
 //GetIceCreamData gets ice cream data for a particular name
 func (i *IceCreamHandler) GetIceCreamData(w http.ResponseWriter, r *http.Request) {
 	iceCreamName := chi.URLParam(r, "ice-cream-name")
 
-	iceCreamData, err := i.iceCreamStore.Get(iceCreamName)
+	iceCreamData, err := i.iceCreamStore.Get(r.Context(), iceCreamName)
 
 	if err != nil {
 		if err == models.ErrNoRows {
@@ -57,18 +119,107 @@ func (i *IceCreamHandler) GetIceCreamData(w http.ResponseWriter, r *http.Request
 				NewNotFoundError(fmt.Sprintf("Icecream: %s Not Found", iceCreamName)), r, w)
 			return
 		}
-		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		httputils.WriteHandlerError(storeError(err), r, w)
 		return
 	}
 
+	w.Header().Set("ETag", etag(iceCreamData.Version))
 	if err := httputils.WriteJSON(http.StatusOK, iceCreamData, w); err != nil {
 		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
 		return
 	}
 }
 
-//UpdateIceCreamData updates records based on change
-//This would not update primary key
+//ListIceCreamData lists ice cream data a page at a time.
+//The page is selected through the `limit` and `cursor` query parameters
+//and the neighbouring pages are advertised through the Link header.
+//Results can be narrowed down with the filters read by parseIceCreamFilter
+func (i *IceCreamHandler) ListIceCreamData(w http.ResponseWriter, r *http.Request) {
+	pageSize, handlerErr := pageSizeParam(r.URL.Query())
+	if handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
+		return
+	}
+
+	filter, handlerErr := parseIceCreamFilter(r.URL.Query())
+	if handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
+		return
+	}
+
+	page, err := i.iceCreamStore.GetAll(r.Context(), filter, pageSize, r.URL.Query().Get("cursor"))
+	if err != nil {
+		if err == models.ErrInvalidCursor {
+			httputils.WriteHandlerError(httputils.NewInvalidParameterError("invalid cursor"), r, w)
+			return
+		}
+		httputils.WriteHandlerError(storeError(err), r, w)
+		return
+	}
+
+	if link := pageLinks(r.URL, pageSize, page.NextCursor, page.PrevCursor); link != "" {
+		w.Header().Set("Link", link)
+	}
+
+	response := iceCreamList{
+		IceCreams:  page.IceCreams,
+		NextCursor: page.NextCursor,
+		PrevCursor: page.PrevCursor,
+	}
+	if response.IceCreams == nil {
+		response.IceCreams = []models.IceCream{}
+	}
+
+	if err := httputils.WriteJSON(http.StatusOK, response, w); err != nil {
+		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		return
+	}
+}
+
+//pageSizeParam reads the `limit` query parameter falling back to
+//models.DefaultPageSize when it is absent
+func pageSizeParam(query url.Values) (int, *httputils.HandlerError) {
+	limit := query.Get("limit")
+	if limit == "" {
+		return models.DefaultPageSize, nil
+	}
+
+	size, err := strconv.Atoi(limit)
+	if err != nil || size < 1 || size > models.MaxPageSize {
+		msg := fmt.Sprintf("limit should be a number between 1 and %d", models.MaxPageSize)
+		return 0, httputils.NewInvalidParameterError(msg)
+	}
+	return size, nil
+}
+
+//pageLinks builds an RFC 5988 Link header value pointing to the pages
+//behind the given cursors. All other query parameters of the request
+//are preserved
+func pageLinks(requestURL *url.URL, pageSize int, nextCursor, prevCursor string) string {
+	var links []string
+	for _, link := range []struct {
+		rel    string
+		cursor string
+	}{
+		{"next", nextCursor},
+		{"prev", prevCursor},
+	} {
+		if link.cursor == "" {
+			continue
+		}
+		query := requestURL.Query()
+		query.Set("cursor", link.cursor)
+		query.Set("limit", strconv.Itoa(pageSize))
+		linkURL := url.URL{Path: requestURL.Path, RawQuery: query.Encode()}
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, linkURL.String(), link.rel))
+	}
+	return strings.Join(links, ", ")
+}
+
+//UpdateIceCreamData updates records based on change and responds with
+//the updated ice cream.
+//This would not update primary key. The update is conditional on the
+//If-Match header when it is sent
 func (i *IceCreamHandler) UpdateIceCreamData(w http.ResponseWriter, r *http.Request) {
 	var iceCreamTask models.IceCream
 	defer r.Body.Close()
@@ -78,33 +229,67 @@ func (i *IceCreamHandler) UpdateIceCreamData(w http.ResponseWriter, r *http.Requ
 		httputils.WriteHandlerError(httputils.NewFormatError(msg), r, w)
 		return
 	}
+	if handlerErr := validationError(iceCreamTask.Validate()); handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
+		return
+	}
 
-	err := i.iceCreamStore.Update(iceCreamTask)
+	version, handlerErr := i.expectedVersion(r, iceCreamTask.Name)
+	if handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
+		return
+	}
+	iceCreamTask.Version = version
+
+	iceCream, err := i.iceCreamStore.Update(r.Context(), iceCreamTask)
 	if err != nil {
-		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		switch err {
+		case models.ErrNoRows:
+			httputils.WriteHandlerError(httputils.
+				NewNotFoundError(fmt.Sprintf("Icecream: %s Not Found", iceCreamTask.Name)), r, w)
+		case models.ErrVersionMismatch:
+			httputils.WriteHandlerError(httputils.NewPreconditionFailedError(
+				fmt.Sprintf("Icecream: %s has changed", iceCreamTask.Name)), r, w)
+		default:
+			httputils.WriteHandlerError(storeError(err), r, w)
+		}
 		return
 	}
 
-	if err := httputils.WriteJSON(http.StatusOK, "", w); err != nil {
+	w.Header().Set("ETag", etag(iceCream.Version))
+	if err := httputils.WriteJSON(http.StatusOK, iceCream, w); err != nil {
 		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
 		return
 	}
 }
 
-//DeleteIceCreamData delete records based on primary key
+//DeleteIceCreamData delete records based on primary key and responds
+//with a 204. The delete is conditional on the If-Match header when it
+//is sent
 func (i *IceCreamHandler) DeleteIceCreamData(w http.ResponseWriter, r *http.Request) {
 	iceCreamName := chi.URLParam(r, "ice-cream-name")
 
-	fmt.Println(iceCreamName)
-	err := i.iceCreamStore.Delete(iceCreamName)
-
-	if err != nil {
-		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+	version, handlerErr := i.expectedVersion(r, iceCreamName)
+	if handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
 		return
 	}
 
-	if err := httputils.WriteJSON(http.StatusOK, "", w); err != nil {
-		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+	err := i.iceCreamStore.Delete(r.Context(), iceCreamName, version)
+
+	if err != nil {
+		switch err {
+		case models.ErrNoRows:
+			httputils.WriteHandlerError(httputils.
+				NewNotFoundError(fmt.Sprintf("Icecream: %s Not Found", iceCreamName)), r, w)
+		case models.ErrVersionMismatch:
+			httputils.WriteHandlerError(httputils.NewPreconditionFailedError(
+				fmt.Sprintf("Icecream: %s has changed", iceCreamName)), r, w)
+		default:
+			httputils.WriteHandlerError(storeError(err), r, w)
+		}
 		return
 	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
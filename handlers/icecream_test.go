@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/stretchr/testify/assert"
@@ -17,9 +18,33 @@ import (
 
 type fakeIceCreamStore struct {
 	models.IceCreamStore
-	iceCream        *models.IceCream
+	iceCream *models.IceCream
+	page     *models.IceCreamPage
+	//pages, when set, are returned by GetAll for their cursor
+	pages           map[string]*models.IceCreamPage
+	trash           *models.TrashPage
+	history         []models.HistoryEntry
+	replaced        *models.IceCream
+	replaceErr      error
+	patch           *models.IceCreamPatch
+	upserted        *models.IceCream
+	created         bool
+	patchErr        error
+	olderThan       time.Time
+	filter          models.IceCreamFilter
+	searchQuery     models.SearchQuery
+	searchResults   []models.SearchResult
+	pageSize        int
+	cursor          string
 	serializedStore string
-	err             error
+	version         int64
+	//storeErrs fails StoreContext for the names it holds
+	storeErrs map[string]error
+	err       error
+}
+
+func (i *fakeIceCreamStore) WithTxContext(ctx context.Context, f func(context.Context) error) error {
+	return f(ctx)
 }
 
 func (i *fakeIceCreamStore) StoreContext(ctx context.Context, iceCreamInput models.IceCream) error {
@@ -28,38 +53,134 @@ func (i *fakeIceCreamStore) StoreContext(ctx context.Context, iceCreamInput mode
 		return err
 	}
 	i.serializedStore += string(bdy)
+	if err, ok := i.storeErrs[iceCreamInput.Name]; ok {
+		return err
+	}
 	return i.err
 }
 
-func (i *fakeIceCreamStore) Get(name string) (*models.IceCream, error) {
+func (i *fakeIceCreamStore) Get(ctx context.Context, name string) (*models.IceCream, error) {
 	return i.iceCream, i.err
 }
 
-func (i *fakeIceCreamStore) Update(iceCreamInput models.IceCream) error {
+func (i *fakeIceCreamStore) GetAll(ctx context.Context, filter models.IceCreamFilter, pageSize int,
+	cursor string) (*models.IceCreamPage, error) {
+	i.filter = filter
+	i.pageSize = pageSize
+	i.cursor = cursor
+	if i.pages != nil {
+		return i.pages[cursor], i.err
+	}
+	return i.page, i.err
+}
+
+func (i *fakeIceCreamStore) Search(ctx context.Context, query models.SearchQuery, limit int) ([]models.SearchResult, error) {
+	i.searchQuery = query
+	return i.searchResults, i.err
+}
+
+func (i *fakeIceCreamStore) Update(ctx context.Context, iceCreamInput models.IceCream) (*models.IceCream, error) {
+	i.version = iceCreamInput.Version
 	bdy, err := json.Marshal(iceCreamInput)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	i.serializedStore += string(bdy)
+	if i.err != nil {
+		return nil, i.err
+	}
+	updated := iceCreamInput
+	updated.Version++
+	return &updated, nil
+}
+
+func (i *fakeIceCreamStore) Replace(ctx context.Context, iceCreamInput models.IceCream) error {
+	i.replaced = &iceCreamInput
+	return i.replaceErr
+}
+
+func (i *fakeIceCreamStore) Upsert(ctx context.Context,
+	iceCreamInput models.IceCream) (*models.IceCream, bool, error) {
+	i.upserted = &iceCreamInput
+	if i.err != nil {
+		return nil, false, i.err
+	}
+	stored := iceCreamInput
+	stored.Version++
+	return &stored, i.created, nil
+}
+
+func (i *fakeIceCreamStore) Patch(ctx context.Context, name string,
+	patch models.IceCreamPatch) (*models.IceCream, error) {
+	i.patch = &patch
+	if i.patchErr != nil {
+		return nil, i.patchErr
+	}
+	patched := patch.Apply(*i.iceCream)
+	patched.Version++
+	return &patched, nil
+}
+
+func (i *fakeIceCreamStore) Delete(ctx context.Context, name string, version int64) error {
+	i.serializedStore += name
+	i.version = version
 	return i.err
 }
 
-func (i *fakeIceCreamStore) Delete(name string) error {
+func (i *fakeIceCreamStore) GetTrash(ctx context.Context, pageSize int, cursor string) (*models.TrashPage, error) {
+	i.pageSize = pageSize
+	i.cursor = cursor
+	return i.trash, i.err
+}
+
+func (i *fakeIceCreamStore) GetTrashed(ctx context.Context, name string) (*models.TrashedIceCream, error) {
+	if i.err != nil {
+		return nil, i.err
+	}
+	if i.iceCream == nil {
+		return nil, models.ErrNoRows
+	}
+	return &models.TrashedIceCream{IceCream: *i.iceCream}, nil
+}
+
+func (i *fakeIceCreamStore) Restore(ctx context.Context, name string, version int64) error {
 	i.serializedStore += name
+	i.version = version
+	if i.err != nil {
+		return i.err
+	}
+	restored := models.IceCream{Name: name}
+	if i.iceCream != nil {
+		restored = *i.iceCream
+	}
+	restored.Version++
+	i.iceCream = &restored
 	return nil
 }
 
+func (i *fakeIceCreamStore) History(ctx context.Context, name string) ([]models.HistoryEntry, error) {
+	return i.history, i.err
+}
+
+func (i *fakeIceCreamStore) Purge(ctx context.Context, olderThan time.Time) (int64, error) {
+	i.olderThan = olderThan
+	return 2, i.err
+}
+
 func Test_PostIceCreamData(t *testing.T) {
 	var tests = []struct {
 		desc               string
 		reqBody            io.Reader
 		expectedResponse   string
 		dbError            error
+		stored             *models.IceCream
 		expectedStatusCode int
 		expectedDataStore  string
+		expectedLocation   string
+		expectedETag       string
 	}{
 		{
-			desc: "successful create should return a 201",
+			desc: "successful create should return a 201 with the created ice cream",
 			reqBody: bytes.NewReader([]byte(`
 				{
 				    "name": "Chocobar",
@@ -95,8 +216,14 @@ func Test_PostIceCreamData(t *testing.T) {
 				    "product_id": "1111"
 				}
 			`)),
-			expectedResponse:   "\"\"\n",
+			stored: &models.IceCream{Name: "Chocobar", Story: "cheap and best", Version: 1},
+			expectedResponse: "{\"name\":\"Chocobar\",\"image_open\":\"\"," +
+				"\"image_closed\":\"\",\"story\":\"cheap and best\",\"description\":\"\"," +
+				"\"sourcing_values\":null,\"ingredients\":null,\"allergy_info\":\"\"," +
+				"\"dietary_certification\":\"\",\"product_id\":\"\"}\n",
 			expectedStatusCode: 201,
+			expectedLocation:   "/api/v1/read/Chocobar",
+			expectedETag:       `"1"`,
 			expectedDataStore: "{\"name\":\"Chocobar\",\"image_open\":\"\"," +
 				"\"image_closed\":\"\",\"story\":\"cheap and best\"," +
 				"\"description\":\"Some new stuff\",\"sourcing_values\":" +
@@ -113,13 +240,43 @@ func Test_PostIceCreamData(t *testing.T) {
 		},
 		{
 			desc:               "if database returns error, throw unexpected error response",
-			reqBody:            bytes.NewReader([]byte("{}")),
+			reqBody:            bytes.NewReader([]byte(`{"name":"a"}`)),
 			dbError:            errors.New("pg error : error in db"),
 			expectedStatusCode: 500,
 			expectedResponse: "{\"httpStatus\":500," +
 				"\"httpCode\":\"internal_server_error\"," +
 				"\"requestId\":\"\",\"errors\":[]}\n",
-			expectedDataStore: "{\"name\":\"\",\"image_open\":\"\"," +
+			expectedDataStore: "{\"name\":\"a\",\"image_open\":\"\"," +
+				"\"image_closed\":\"\",\"story\":\"\",\"description\":\"\"," +
+				"\"sourcing_values\":null,\"ingredients\":null," +
+				"\"allergy_info\":\"\",\"dietary_certification\":\"\"," +
+				"\"product_id\":\"\"}",
+		},
+		{
+			desc: "every invalid field is reported at once and nothing is stored",
+			reqBody: bytes.NewReader([]byte(`{"image_open":"not a path","product_id":"12345678901",` +
+				`"ingredients":["cream","","cream","liquid sugar (sugar","water)"]}`)),
+			expectedStatusCode: 400,
+			expectedResponse: "{\"httpStatus\":400,\"httpCode\":\"bad_request\"," +
+				"\"requestId\":\"\",\"errors\":[" +
+				"{\"code\":\"invalid_parameter\",\"message\":\"name is required\",\"pointer\":\"/name\"}," +
+				"{\"code\":\"invalid_parameter\",\"message\":\"image_open should be an absolute path or an " +
+				"http(s) url\",\"pointer\":\"/image_open\"}," +
+				"{\"code\":\"invalid_parameter\",\"message\":\"product_id should be at most 10 characters " +
+				"long\",\"pointer\":\"/product_id\"}," +
+				"{\"code\":\"invalid_parameter\",\"message\":\"ingredients/1 repeats /ingredients/0\"," +
+				"\"pointer\":\"/ingredients/1\"}]}\n",
+		},
+		{
+			desc:               "a name that is already taken returns a 409 pointing to it",
+			reqBody:            bytes.NewReader([]byte(`{"name":"Chocobar"}`)),
+			dbError:            models.ErrRowAlreadyExists,
+			expectedStatusCode: 409,
+			expectedLocation:   "/api/v1/read/Chocobar",
+			expectedResponse: "{\"httpStatus\":409,\"httpCode\":\"conflict\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"invalid_operation\"," +
+				"\"message\":\"Icecream: Chocobar already exists\"}]}\n",
+			expectedDataStore: "{\"name\":\"Chocobar\",\"image_open\":\"\"," +
 				"\"image_closed\":\"\",\"story\":\"\",\"description\":\"\"," +
 				"\"sourcing_values\":null,\"ingredients\":null," +
 				"\"allergy_info\":\"\",\"dietary_certification\":\"\"," +
@@ -138,8 +295,8 @@ func Test_PostIceCreamData(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.desc, func(t *testing.T) {
 			assert := assert.New(t)
-			iceCreamStore := &fakeIceCreamStore{err: test.dbError}
-			ich := NewIceCreamHandler(iceCreamStore)
+			iceCreamStore := &fakeIceCreamStore{iceCream: test.stored, err: test.dbError}
+			ich := NewIceCreamHandler(iceCreamStore, Config{})
 
 			req, err := http.NewRequest("POST", "/url", test.reqBody)
 			if err != nil {
@@ -152,6 +309,8 @@ func Test_PostIceCreamData(t *testing.T) {
 			assert.Equal(test.expectedResponse, rr.Body.String())
 			assert.Equal(test.expectedStatusCode, rr.Code)
 			assert.Equal(test.expectedDataStore, iceCreamStore.serializedStore)
+			assert.Equal(test.expectedLocation, rr.Header().Get("Location"))
+			assert.Equal(test.expectedETag, rr.Header().Get("ETag"))
 		})
 	}
 }
@@ -163,6 +322,7 @@ func Test_GetIceCreamData(t *testing.T) {
 		dbError            error
 		expectedResponse   string
 		expectedStatusCode int
+		expectedETag       string
 	}{
 		{
 			desc: "if the database returns a successful response, show that in response to get",
@@ -172,6 +332,7 @@ func Test_GetIceCreamData(t *testing.T) {
 				ImageClosed: "imageClose",
 				Story:       "some story",
 				Description: "some description",
+				Version:     3,
 			},
 			expectedResponse: "{\"name\":\"chocobar\",\"image_open\":\"imageOpen\"," +
 				"\"image_closed\":\"imageClose\",\"story\":\"some story\"," +
@@ -179,6 +340,7 @@ func Test_GetIceCreamData(t *testing.T) {
 				"\"ingredients\":null,\"allergy_info\":\"\"," +
 				"\"dietary_certification\":\"\",\"product_id\":\"\"}\n",
 			expectedStatusCode: 200,
+			expectedETag:       `"3"`,
 		},
 		{
 			desc:    "if database returns ErrNoRows, return 404 in response",
@@ -202,7 +364,7 @@ func Test_GetIceCreamData(t *testing.T) {
 		t.Run(test.desc, func(t *testing.T) {
 			assert := assert.New(t)
 			iceCreamStore := &fakeIceCreamStore{iceCream: test.dbResponse, err: test.dbError}
-			ich := NewIceCreamHandler(iceCreamStore)
+			ich := NewIceCreamHandler(iceCreamStore, Config{})
 
 			req, err := http.NewRequest("GET", "/url", nil)
 			if err != nil {
@@ -218,6 +380,7 @@ func Test_GetIceCreamData(t *testing.T) {
 			handler.ServeHTTP(rr, req.WithContext(ctx))
 			assert.Equal(test.expectedResponse, rr.Body.String())
 			assert.Equal(test.expectedStatusCode, rr.Code)
+			assert.Equal(test.expectedETag, rr.Header().Get("ETag"))
 		})
 	}
 
@@ -231,6 +394,7 @@ func Test_UpdateIceCreamData(t *testing.T) {
 		dbError            error
 		expectedStatusCode int
 		expectedDataStore  string
+		expectedETag       string
 	}{
 		{
 			desc: "successful update should return a 200",
@@ -269,8 +433,21 @@ func Test_UpdateIceCreamData(t *testing.T) {
 				    "product_id": "1111"
 				}
 			`)),
-			expectedResponse:   "\"\"\n",
+			expectedResponse: "{\"name\":\"Chocobar\",\"image_open\":\"\"," +
+				"\"image_closed\":\"\",\"story\":\"cheap and best\"," +
+				"\"description\":\"Some new stuff\",\"sourcing_values\":" +
+				"[\"Responsibly Sourced Packaging\",\"Caring Dairy\"]," +
+				"\"ingredients\":" +
+				"[\"cream\",\"skim milk\",\"cocoa (processed with alkali)\"," +
+				"\"natural flavors\",\"cocoa\",\"guar gum\",\"butteroil\"," +
+				"\"milk protein concentrate\",\"corn starch\",\"salt\"," +
+				"\"soy lecithin\",\"tapioca starch\",\"pectin\"," +
+				"\"caramelized sugar syrup\",\"baking soda\",\"molasses\"," +
+				"\"honey\",\"carrageenan\",\"vanilla extract\"]," +
+				"\"allergy_info\":\"contains milk, eggs, wheat and soy\"," +
+				"\"dietary_certification\":\"\",\"product_id\":\"1111\"}\n",
 			expectedStatusCode: 200,
+			expectedETag:       `"1"`,
 			expectedDataStore: "{\"name\":\"Chocobar\",\"image_open\":\"\"," +
 				"\"image_closed\":\"\",\"story\":\"cheap and best\"," +
 				"\"description\":\"Some new stuff\",\"sourcing_values\":" +
@@ -287,13 +464,27 @@ func Test_UpdateIceCreamData(t *testing.T) {
 		},
 		{
 			desc:               "if database returns error, throw unexpected error response",
-			reqBody:            bytes.NewReader([]byte("{}")),
+			reqBody:            bytes.NewReader([]byte(`{"name":"a"}`)),
 			dbError:            errors.New("pg error : error in db"),
 			expectedStatusCode: 500,
 			expectedResponse: "{\"httpStatus\":500," +
 				"\"httpCode\":\"internal_server_error\"," +
 				"\"requestId\":\"\",\"errors\":[]}\n",
-			expectedDataStore: "{\"name\":\"\",\"image_open\":\"\"," +
+			expectedDataStore: "{\"name\":\"a\",\"image_open\":\"\"," +
+				"\"image_closed\":\"\",\"story\":\"\",\"description\":\"\"," +
+				"\"sourcing_values\":null,\"ingredients\":null," +
+				"\"allergy_info\":\"\",\"dietary_certification\":\"\"," +
+				"\"product_id\":\"\"}",
+		},
+		{
+			desc:               "if there is nothing to update, return 404 in response",
+			reqBody:            bytes.NewReader([]byte(`{"name":"Chocobar"}`)),
+			dbError:            models.ErrNoRows,
+			expectedStatusCode: 404,
+			expectedResponse: "{\"httpStatus\":404,\"httpCode\":\"not_found\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"not_found\"," +
+				"\"message\":\"Icecream: Chocobar Not Found\"}]}\n",
+			expectedDataStore: "{\"name\":\"Chocobar\",\"image_open\":\"\"," +
 				"\"image_closed\":\"\",\"story\":\"\",\"description\":\"\"," +
 				"\"sourcing_values\":null,\"ingredients\":null," +
 				"\"allergy_info\":\"\",\"dietary_certification\":\"\"," +
@@ -313,7 +504,7 @@ func Test_UpdateIceCreamData(t *testing.T) {
 		t.Run(test.desc, func(t *testing.T) {
 			assert := assert.New(t)
 			iceCreamStore := &fakeIceCreamStore{err: test.dbError}
-			ich := NewIceCreamHandler(iceCreamStore)
+			ich := NewIceCreamHandler(iceCreamStore, Config{})
 
 			req, err := http.NewRequest("POST", "/url", test.reqBody)
 			if err != nil {
@@ -330,6 +521,177 @@ func Test_UpdateIceCreamData(t *testing.T) {
 			assert.Equal(test.expectedResponse, rr.Body.String())
 			assert.Equal(test.expectedStatusCode, rr.Code)
 			assert.Equal(test.expectedDataStore, iceCreamStore.serializedStore)
+			assert.Equal(test.expectedETag, rr.Header().Get("ETag"))
+		})
+	}
+}
+
+func Test_DeleteIceCreamData(t *testing.T) {
+	var tests = []struct {
+		desc               string
+		dbError            error
+		expectedResponse   string
+		expectedStatusCode int
+	}{
+		{
+			desc:               "successful delete should return a 204 without a body",
+			expectedStatusCode: 204,
+		},
+		{
+			desc:               "if there is nothing to delete, return 404 in response",
+			dbError:            models.ErrNoRows,
+			expectedStatusCode: 404,
+			expectedResponse: "{\"httpStatus\":404,\"httpCode\":\"not_found\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"not_found\"," +
+				"\"message\":\"Icecream: chocobar Not Found\"}]}\n",
+		},
+		{
+			desc:               "if database returns a different error, return 500 in response",
+			dbError:            errors.New("pg error: error connecting to db"),
+			expectedStatusCode: 500,
+			expectedResponse: "{\"httpStatus\":500," +
+				"\"httpCode\":\"internal_server_error\"," +
+				"\"requestId\":\"\",\"errors\":[]}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			iceCreamStore := &fakeIceCreamStore{err: test.dbError}
+			ich := NewIceCreamHandler(iceCreamStore, Config{})
+
+			req, err := http.NewRequest("DELETE", "/url", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("ice-cream-name", "chocobar")
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, rctx)
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(ich.DeleteIceCreamData)
+			handler.ServeHTTP(rr, req.WithContext(ctx))
+			assert.Equal(test.expectedResponse, rr.Body.String())
+			assert.Equal(test.expectedStatusCode, rr.Code)
+			assert.Equal("chocobar", iceCreamStore.serializedStore)
+		})
+	}
+}
+
+func Test_ListIceCreamData(t *testing.T) {
+	var tests = []struct {
+		desc               string
+		query              string
+		dbResponse         *models.IceCreamPage
+		dbError            error
+		expectedResponse   string
+		expectedLink       string
+		expectedStatusCode int
+		expectedPageSize   int
+		expectedCursor     string
+		expectedFilter     models.IceCreamFilter
+	}{
+		{
+			desc:  "a page with neighbours should advertise them through the Link header",
+			query: "?limit=1&cursor=bjo1",
+			dbResponse: &models.IceCreamPage{
+				IceCreams:  []models.IceCream{{Name: "chocobar"}},
+				NextCursor: "bjo2",
+				PrevCursor: "cDo2",
+			},
+			expectedResponse: "{\"ice_creams\":[{\"name\":\"chocobar\",\"image_open\":\"\"," +
+				"\"image_closed\":\"\",\"story\":\"\",\"description\":\"\"," +
+				"\"sourcing_values\":null,\"ingredients\":null,\"allergy_info\":\"\"," +
+				"\"dietary_certification\":\"\",\"product_id\":\"\"}]," +
+				"\"next_cursor\":\"bjo2\",\"prev_cursor\":\"cDo2\"}\n",
+			expectedLink: "</api/v1/icecreams?cursor=bjo2&limit=1>; rel=\"next\", " +
+				"</api/v1/icecreams?cursor=cDo2&limit=1>; rel=\"prev\"",
+			expectedStatusCode: 200,
+			expectedPageSize:   1,
+			expectedCursor:     "bjo1",
+		},
+		{
+			desc:  "filters should be handed to the store and kept in the Link header",
+			query: "?ingredients_exclude=peanuts",
+			dbResponse: &models.IceCreamPage{
+				NextCursor: "bjo2",
+			},
+			expectedResponse: "{\"ice_creams\":[],\"next_cursor\":\"bjo2\"}\n",
+			expectedLink: "</api/v1/icecreams?cursor=bjo2&ingredients_exclude=peanuts" +
+				"&limit=20>; rel=\"next\"",
+			expectedStatusCode: 200,
+			expectedPageSize:   models.DefaultPageSize,
+			expectedFilter: models.IceCreamFilter{
+				Ingredients: models.ArrayFilter{Excludes: []string{"peanuts"}},
+			},
+		},
+		{
+			desc:               "an invalid filter returns a 400 error",
+			query:              "?sourcing_values=,",
+			expectedStatusCode: 400,
+			expectedResponse: "{\"httpStatus\":400,\"httpCode\":\"bad_request\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"invalid_parameter\"," +
+				"\"message\":\"sourcing_values should not contain empty values\"}]}\n",
+		},
+		{
+			desc:               "an empty page should return an empty list and the default page size",
+			dbResponse:         &models.IceCreamPage{},
+			expectedResponse:   "{\"ice_creams\":[]}\n",
+			expectedStatusCode: 200,
+			expectedPageSize:   models.DefaultPageSize,
+		},
+		{
+			desc:               "a limit above the maximum page size returns a 400 error",
+			query:              "?limit=1000",
+			expectedStatusCode: 400,
+			expectedResponse: "{\"httpStatus\":400,\"httpCode\":\"bad_request\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"invalid_parameter\"," +
+				"\"message\":\"limit should be a number between 1 and 100\"}]}\n",
+		},
+		{
+			desc:               "an invalid cursor returns a 400 error",
+			query:              "?cursor=garbage",
+			dbError:            models.ErrInvalidCursor,
+			expectedStatusCode: 400,
+			expectedResponse: "{\"httpStatus\":400,\"httpCode\":\"bad_request\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"invalid_parameter\"," +
+				"\"message\":\"invalid cursor\"}]}\n",
+			expectedPageSize: models.DefaultPageSize,
+			expectedCursor:   "garbage",
+		},
+		{
+			desc:               "if database returns a different error, return 500 in response",
+			dbError:            errors.New("pg error: error connecting to db"),
+			expectedStatusCode: 500,
+			expectedResponse: "{\"httpStatus\":500," +
+				"\"httpCode\":\"internal_server_error\"," +
+				"\"requestId\":\"\",\"errors\":[]}\n",
+			expectedPageSize: models.DefaultPageSize,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			iceCreamStore := &fakeIceCreamStore{page: test.dbResponse, err: test.dbError}
+			ich := NewIceCreamHandler(iceCreamStore, Config{})
+
+			req, err := http.NewRequest("GET", "/api/v1/icecreams"+test.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(ich.ListIceCreamData)
+			handler.ServeHTTP(rr, req)
+			assert.Equal(test.expectedResponse, rr.Body.String())
+			assert.Equal(test.expectedStatusCode, rr.Code)
+			assert.Equal(test.expectedLink, rr.Header().Get("Link"))
+			assert.Equal(test.expectedPageSize, iceCreamStore.pageSize)
+			assert.Equal(test.expectedCursor, iceCreamStore.cursor)
+			assert.Equal(test.expectedFilter, iceCreamStore.filter)
 		})
 	}
 }
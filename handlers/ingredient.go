@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/go-chi/chi"
+	"github.com/sudarshan-reddy/benjerry/httputils"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//ingredientsPath is where the registered ingredients are read from
+const ingredientsPath = "/api/v1/ingredients/"
+
+//ingredientLocation gives the url the ingredient called name is read from
+func ingredientLocation(name string) string {
+	return ingredientsPath + url.PathEscape(name)
+}
+
+//ingredientList is the response body of the registry listing
+type ingredientList struct {
+	Ingredients []models.RegisteredIngredient `json:"ingredients"`
+}
+
+//unrecognizedIngredient is an ingredient of the catalog missing from
+//the registry along with the ice creams listing it
+type unrecognizedIngredient struct {
+	Name      string   `json:"name"`
+	IceCreams []string `json:"ice_creams"`
+}
+
+//unrecognizedReport is the response body of UnrecognizedIngredients
+type unrecognizedReport struct {
+	Ingredients []unrecognizedIngredient `json:"ingredients"`
+}
+
+//IngredientHandler holds the handlers of the ingredient registry
+type IngredientHandler struct {
+	ingredientStore models.IngredientStore
+	iceCreamStore   models.IceCreamStore
+}
+
+//NewIngredientHandler returns a new instance of IngredientHandler
+func NewIngredientHandler(ingredientStore models.IngredientStore,
+	iceCreamStore models.IceCreamStore) *IngredientHandler {
+	return &IngredientHandler{
+		ingredientStore: ingredientStore,
+		iceCreamStore:   iceCreamStore,
+	}
+}
+
+//decodeIngredient reads the ingredient in the body of r
+func decodeIngredient(r *http.Request) (models.RegisteredIngredient, *httputils.HandlerError) {
+	var ingredient models.RegisteredIngredient
+	defer r.Body.Close()
+
+	if err := json.NewDecoder(r.Body).Decode(&ingredient); err != nil {
+		msg := fmt.Sprintf("invalid input format. error: %s", err)
+		return ingredient, httputils.NewFormatError(msg)
+	}
+	if ingredient.Synonyms == nil {
+		ingredient.Synonyms = []string{}
+	}
+	return ingredient, nil
+}
+
+//takenError answers writes taking a name or synonym of another ingredient
+func takenError(ingredient models.RegisteredIngredient) *httputils.HandlerError {
+	return httputils.NewInvalidOperation(
+		fmt.Sprintf("Ingredient: %s or one of its synonyms is already registered", ingredient.Name))
+}
+
+//PostIngredient registers an ingredient
+func (i *IngredientHandler) PostIngredient(w http.ResponseWriter, r *http.Request) {
+	ingredient, handlerErr := decodeIngredient(r)
+	if handlerErr == nil {
+		handlerErr = validationError(ingredient.Validate())
+	}
+	if handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
+		return
+	}
+
+	if err := i.ingredientStore.StoreIngredient(r.Context(), ingredient); err != nil {
+		if err == models.ErrRowAlreadyExists {
+			httputils.WriteHandlerError(takenError(ingredient), r, w)
+			return
+		}
+		httputils.WriteHandlerError(storeError(err), r, w)
+		return
+	}
+
+	w.Header().Set("Location", ingredientLocation(ingredient.Name))
+	if err := httputils.WriteJSON(http.StatusCreated, ingredient, w); err != nil {
+		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		return
+	}
+}
+
+//ListIngredients lists the whole registry ordered by name
+func (i *IngredientHandler) ListIngredients(w http.ResponseWriter, r *http.Request) {
+	ingredients, err := i.ingredientStore.ListIngredients(r.Context())
+	if err != nil {
+		httputils.WriteHandlerError(storeError(err), r, w)
+		return
+	}
+
+	if err := httputils.WriteJSON(http.StatusOK, ingredientList{Ingredients: ingredients}, w); err != nil {
+		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		return
+	}
+}
+
+//GetIngredient gets the registered ingredient for a particular name
+func (i *IngredientHandler) GetIngredient(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "ingredient-name")
+
+	ingredient, err := i.ingredientStore.GetIngredient(r.Context(), name)
+	if err != nil {
+		if err == models.ErrNoRows {
+			httputils.WriteHandlerError(httputils.
+				NewNotFoundError(fmt.Sprintf("Ingredient: %s Not Found", name)), r, w)
+			return
+		}
+		httputils.WriteHandlerError(storeError(err), r, w)
+		return
+	}
+
+	if err := httputils.WriteJSON(http.StatusOK, ingredient, w); err != nil {
+		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		return
+	}
+}
+
+//PutIngredient replaces a registered ingredient. A body naming it
+//differently renames it, in which case its new url is given through
+//the Location header
+func (i *IngredientHandler) PutIngredient(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "ingredient-name")
+	ingredient, handlerErr := decodeIngredient(r)
+	if handlerErr == nil {
+		if ingredient.Name == "" {
+			ingredient.Name = name
+		}
+		handlerErr = validationError(ingredient.Validate())
+	}
+	if handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
+		return
+	}
+
+	if err := i.ingredientStore.UpdateIngredient(r.Context(), name, ingredient); err != nil {
+		switch err {
+		case models.ErrNoRows:
+			httputils.WriteHandlerError(httputils.
+				NewNotFoundError(fmt.Sprintf("Ingredient: %s Not Found", name)), r, w)
+		case models.ErrRowAlreadyExists:
+			httputils.WriteHandlerError(takenError(ingredient), r, w)
+		default:
+			httputils.WriteHandlerError(storeError(err), r, w)
+		}
+		return
+	}
+
+	if ingredient.Name != name {
+		w.Header().Set("Location", ingredientLocation(ingredient.Name))
+	}
+	if err := httputils.WriteJSON(http.StatusOK, ingredient, w); err != nil {
+		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		return
+	}
+}
+
+//DeleteIngredient removes an ingredient from the registry. Ice creams
+//listing it keep it under its canonical name
+func (i *IngredientHandler) DeleteIngredient(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "ingredient-name")
+
+	if err := i.ingredientStore.DeleteIngredient(r.Context(), name); err != nil {
+		if err == models.ErrNoRows {
+			httputils.WriteHandlerError(httputils.
+				NewNotFoundError(fmt.Sprintf("Ingredient: %s Not Found", name)), r, w)
+			return
+		}
+		httputils.WriteHandlerError(storeError(err), r, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//UnrecognizedIngredients reports the ingredients of the catalog that
+//are registered neither as a name nor as a synonym, the ones listed by
+//the most ice creams first, then in catalog order. Compound ingredients
+//and the ones they are made of are reported alike
+func (i *IngredientHandler) UnrecognizedIngredients(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var names []string
+	iceCreams := map[string][]string{}
+	cursor := ""
+	for {
+		page, err := i.iceCreamStore.GetAll(ctx, models.IceCreamFilter{}, models.MaxPageSize, cursor)
+		if err != nil {
+			httputils.WriteHandlerError(storeError(err), r, w)
+			return
+		}
+		for _, iceCream := range page.IceCreams {
+			for _, name := range models.IngredientNames(iceCream.IngredientTree) {
+				if _, ok := iceCreams[name]; !ok {
+					names = append(names, name)
+				}
+				iceCreams[name] = append(iceCreams[name], iceCream.Name)
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	canonical, err := i.ingredientStore.CanonicalNames(ctx, names)
+	if err != nil {
+		httputils.WriteHandlerError(storeError(err), r, w)
+		return
+	}
+
+	report := unrecognizedReport{Ingredients: []unrecognizedIngredient{}}
+	for _, name := range names {
+		if _, ok := canonical[name]; !ok {
+			report.Ingredients = append(report.Ingredients,
+				unrecognizedIngredient{Name: name, IceCreams: iceCreams[name]})
+		}
+	}
+	sort.SliceStable(report.Ingredients, func(a, b int) bool {
+		return len(report.Ingredients[a].IceCreams) > len(report.Ingredients[b].IceCreams)
+	})
+
+	if err := httputils.WriteJSON(http.StatusOK, report, w); err != nil {
+		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		return
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+	"github.com/sudarshan-reddy/benjerry/models/memory"
+)
+
+//newRegistry returns an ingredient store holding skim milk
+func newRegistry(t *testing.T) models.IngredientStore {
+	ingredientStore := memory.NewIngredientStore()
+	err := ingredientStore.StoreIngredient(context.Background(), models.RegisteredIngredient{
+		Name:     "skim milk",
+		Synonyms: []string{"nonfat milk"},
+		Category: "dairy",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ingredientStore
+}
+
+//serveIngredient runs handler on a request for the ingredient called name
+func serveIngredient(handler http.HandlerFunc, method, name, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/url", strings.NewReader(body))
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("ingredient-name", name)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func Test_PostIngredient(t *testing.T) {
+	var tests = []struct {
+		desc               string
+		reqBody            string
+		expectedResponse   string
+		expectedLocation   string
+		expectedStatusCode int
+	}{
+		{
+			desc:    "a new ingredient is registered",
+			reqBody: `{"name":"mono and diglycerides","category":"emulsifier","e_number":"E471"}`,
+			expectedResponse: "{\"name\":\"mono and diglycerides\",\"synonyms\":[]," +
+				"\"category\":\"emulsifier\",\"e_number\":\"E471\"}\n",
+			expectedLocation:   "/api/v1/ingredients/mono%20and%20diglycerides",
+			expectedStatusCode: 201,
+		},
+		{
+			desc:    "a synonym of another ingredient returns a 409 error",
+			reqBody: `{"name":"milk","synonyms":["Nonfat Milk"]}`,
+			expectedResponse: "{\"httpStatus\":409,\"httpCode\":\"conflict\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"invalid_operation\"," +
+				"\"message\":\"Ingredient: milk or one of its synonyms is already registered\"}]}\n",
+			expectedStatusCode: 409,
+		},
+		{
+			desc:    "an invalid ingredient returns every broken constraint",
+			reqBody: `{"name":"sugar (cane)","synonyms":[""],"e_number":"471"}`,
+			expectedResponse: "{\"httpStatus\":400,\"httpCode\":\"bad_request\",\"requestId\":\"\",\"errors\":[" +
+				"{\"code\":\"invalid_parameter\",\"message\":\"name should not contain brackets or commas\"," +
+				"\"pointer\":\"/name\"}," +
+				"{\"code\":\"invalid_parameter\",\"message\":\"synonyms/0 is required\",\"pointer\":\"/synonyms/0\"}," +
+				"{\"code\":\"invalid_parameter\",\"message\":\"e_number should be an E number, like E471\"," +
+				"\"pointer\":\"/e_number\"}]}\n",
+			expectedStatusCode: 400,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			ih := NewIngredientHandler(newRegistry(t), nil)
+
+			rr := serveIngredient(ih.PostIngredient, "POST", "", test.reqBody)
+			assert.Equal(test.expectedResponse, rr.Body.String())
+			assert.Equal(test.expectedStatusCode, rr.Code)
+			assert.Equal(test.expectedLocation, rr.Header().Get("Location"))
+		})
+	}
+}
+
+func Test_PutIngredient(t *testing.T) {
+	var tests = []struct {
+		desc               string
+		name               string
+		reqBody            string
+		expectedResponse   string
+		expectedLocation   string
+		expectedStatusCode int
+	}{
+		{
+			desc:    "the ingredient is replaced, keeping the name of the path",
+			name:    "skim milk",
+			reqBody: `{"synonyms":["skimmed milk"],"category":"dairy"}`,
+			expectedResponse: "{\"name\":\"skim milk\",\"synonyms\":[\"skimmed milk\"]," +
+				"\"category\":\"dairy\"}\n",
+			expectedStatusCode: 200,
+		},
+		{
+			desc:    "another name renames the ingredient",
+			name:    "skim milk",
+			reqBody: `{"name":"nonfat milk","synonyms":["skim milk"],"category":"dairy"}`,
+			expectedResponse: "{\"name\":\"nonfat milk\",\"synonyms\":[\"skim milk\"]," +
+				"\"category\":\"dairy\"}\n",
+			expectedLocation:   "/api/v1/ingredients/nonfat%20milk",
+			expectedStatusCode: 200,
+		},
+		{
+			desc:    "a missing ingredient returns a 404 error",
+			name:    "cream",
+			reqBody: `{"category":"dairy"}`,
+			expectedResponse: "{\"httpStatus\":404,\"httpCode\":\"not_found\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"not_found\"," +
+				"\"message\":\"Ingredient: cream Not Found\"}]}\n",
+			expectedStatusCode: 404,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			ih := NewIngredientHandler(newRegistry(t), nil)
+
+			rr := serveIngredient(ih.PutIngredient, "PUT", test.name, test.reqBody)
+			assert.Equal(test.expectedResponse, rr.Body.String())
+			assert.Equal(test.expectedStatusCode, rr.Code)
+			assert.Equal(test.expectedLocation, rr.Header().Get("Location"))
+		})
+	}
+}
+
+func Test_GetAndDeleteIngredient(t *testing.T) {
+	assert := assert.New(t)
+	ih := NewIngredientHandler(newRegistry(t), nil)
+
+	rr := serveIngredient(ih.GetIngredient, "GET", "skim milk", "")
+	assert.Equal(200, rr.Code)
+	assert.Equal("{\"name\":\"skim milk\",\"synonyms\":[\"nonfat milk\"],\"category\":\"dairy\"}\n",
+		rr.Body.String())
+
+	rr = serveIngredient(ih.DeleteIngredient, "DELETE", "skim milk", "")
+	assert.Equal(204, rr.Code)
+	assert.Equal("", rr.Body.String())
+
+	rr = serveIngredient(ih.GetIngredient, "GET", "skim milk", "")
+	assert.Equal(404, rr.Code)
+	rr = serveIngredient(ih.DeleteIngredient, "DELETE", "skim milk", "")
+	assert.Equal(404, rr.Code)
+	rr = serveIngredient(ih.ListIngredients, "GET", "", "")
+	assert.Equal("{\"ingredients\":[]}\n", rr.Body.String())
+}
+
+func Test_UnrecognizedIngredients(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	iceCreamStore := memory.NewIceCreamStore()
+	for _, iceCream := range []models.IceCream{
+		{Name: "a", Ingredients: []string{"cream", "nonfat milk", "fudge (sugar", "cocoa)"}},
+		{Name: "b", Ingredients: []string{"cream", "Skim Milk", "sugar"}},
+		{Name: "c"},
+	} {
+		assert.NoError(iceCreamStore.StoreContext(ctx, iceCream))
+	}
+	ih := NewIngredientHandler(newRegistry(t), iceCreamStore)
+
+	rr := serveIngredient(ih.UnrecognizedIngredients, "GET", "", "")
+	assert.Equal(200, rr.Code)
+	assert.Equal("{\"ingredients\":["+
+		"{\"name\":\"cream\",\"ice_creams\":[\"a\",\"b\"]},"+
+		"{\"name\":\"sugar\",\"ice_creams\":[\"a\",\"b\"]},"+
+		"{\"name\":\"fudge\",\"ice_creams\":[\"a\"]},"+
+		"{\"name\":\"cocoa\",\"ice_creams\":[\"a\"]}]}\n", rr.Body.String())
+}
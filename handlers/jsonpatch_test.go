@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_applyJSONPatch(t *testing.T) {
+	const document = `{"story":"old","ingredients":["cream","sugar"],"a/b":{"c~d":1}}`
+
+	var tests = []struct {
+		desc          string
+		patch         string
+		expected      string
+		expectedError string
+	}{
+		{
+			desc:     "replace a member",
+			patch:    `[{"op":"replace","path":"/story","value":"new"}]`,
+			expected: `{"story":"new","ingredients":["cream","sugar"],"a/b":{"c~d":1}}`,
+		},
+		{
+			desc:     "add to the end of an array and in the middle",
+			patch:    `[{"op":"add","path":"/ingredients/-","value":"nuts"},{"op":"add","path":"/ingredients/1","value":"milk"}]`,
+			expected: `{"story":"old","ingredients":["cream","milk","sugar","nuts"],"a/b":{"c~d":1}}`,
+		},
+		{
+			desc:     "remove array items and escaped members",
+			patch:    `[{"op":"remove","path":"/ingredients/0"},{"op":"remove","path":"/a~1b/c~0d"}]`,
+			expected: `{"story":"old","ingredients":["sugar"],"a/b":{}}`,
+		},
+		{
+			desc:     "move and copy values",
+			patch:    `[{"op":"copy","from":"/ingredients/1","path":"/story"},{"op":"move","from":"/ingredients/0","path":"/ingredients/-"}]`,
+			expected: `{"story":"sugar","ingredients":["sugar","cream"],"a/b":{"c~d":1}}`,
+		},
+		{
+			desc:     "a passing test changes nothing",
+			patch:    `[{"op":"test","path":"/ingredients","value":["cream","sugar"]}]`,
+			expected: document,
+		},
+		{
+			desc:          "a failing test aborts the patch",
+			patch:         `[{"op":"replace","path":"/story","value":"new"},{"op":"test","path":"/story","value":"old"}]`,
+			expectedError: "json patch operation 1: test failed at /story",
+		},
+		{
+			desc:          "removing a missing member fails",
+			patch:         `[{"op":"remove","path":"/description"}]`,
+			expectedError: "json patch operation 0: member \"description\" not found",
+		},
+		{
+			desc:          "array indexes are bounded",
+			patch:         `[{"op":"add","path":"/ingredients/3","value":"nuts"}]`,
+			expectedError: "json patch operation 0: array index 3 out of bounds",
+		},
+		{
+			desc:          "a value cannot be moved into itself",
+			patch:         `[{"op":"move","from":"/a~1b","path":"/a~1b/e"}]`,
+			expectedError: "json patch operation 0: cannot move /a~1b into itself",
+		},
+		{
+			desc:          "unknown operations fail",
+			patch:         `[{"op":"merge","path":"/story"}]`,
+			expectedError: "json patch operation 0: unknown op \"merge\"",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			var doc interface{}
+			assert.NoError(json.Unmarshal([]byte(document), &doc))
+			var operations []jsonPatchOperation
+			assert.NoError(json.Unmarshal([]byte(test.patch), &operations))
+
+			patched, err := applyJSONPatch(doc, operations)
+			if test.expectedError != "" {
+				assert.EqualError(err, test.expectedError)
+				return
+			}
+			assert.NoError(err)
+			actual, err := json.Marshal(patched)
+			assert.NoError(err)
+			assert.JSONEq(test.expected, string(actual))
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/sudarshan-reddy/benjerry/httputils"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+const (
+	mergePatchMediaType = "application/merge-patch+json"
+	jsonPatchMediaType  = "application/json-patch+json"
+)
+
+//mergePatchFields maps the json keys of an IceCream to the IceCreamPatch
+//field they set. name is left out as it cannot be patched
+func mergePatchFields(patch *models.IceCreamPatch) map[string]func(json.RawMessage) error {
+	return map[string]func(json.RawMessage) error{
+		"image_open":            patchString(&patch.ImageOpen),
+		"image_closed":          patchString(&patch.ImageClosed),
+		"story":                 patchString(&patch.Story),
+		"description":           patchString(&patch.Description),
+		"sourcing_values":       patchStrings(&patch.SourcingValues),
+		"ingredients":           patchStrings(&patch.Ingredients),
+		"allergy_info":          patchString(&patch.AllergyInfo),
+		"dietary_certification": patchString(&patch.DietaryCertification),
+		"product_id":            patchString(&patch.ProductID),
+	}
+}
+
+//patchString sets field out of a json string. null clears it
+func patchString(field **string) func(json.RawMessage) error {
+	return func(raw json.RawMessage) error {
+		var value string
+		if !isJSONNull(raw) {
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return fmt.Errorf("should be a string")
+			}
+		}
+		*field = &value
+		return nil
+	}
+}
+
+//patchStrings sets field out of a json array of strings. null clears
+//it while [] leaves an empty array
+func patchStrings(field **[]string) func(json.RawMessage) error {
+	return func(raw json.RawMessage) error {
+		var values []string
+		if !isJSONNull(raw) {
+			values = []string{}
+			if err := json.Unmarshal(raw, &values); err != nil {
+				return fmt.Errorf("should be an array of strings")
+			}
+		}
+		*field = &values
+		return nil
+	}
+}
+
+func isJSONNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+//parseMergePatch reads an RFC 7396 merge patch of the ice cream called
+//name. Absent fields are left untouched and null ones are cleared
+func parseMergePatch(name string, data []byte) (models.IceCreamPatch, *httputils.HandlerError) {
+	var patch models.IceCreamPatch
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(data, &document); err != nil || document == nil {
+		return patch, httputils.NewFormatError("merge patch should be a json object")
+	}
+
+	fields := mergePatchFields(&patch)
+	for key, raw := range document {
+		if key == "name" {
+			var patchedName string
+			if json.Unmarshal(raw, &patchedName) != nil || patchedName != name {
+				return patch, httputils.NewInvalidParameterError("name cannot be changed")
+			}
+			continue
+		}
+
+		setField, ok := fields[key]
+		if !ok {
+			return patch, httputils.NewInvalidParameterError(fmt.Sprintf("unknown field %s", key))
+		}
+		if err := setField(raw); err != nil {
+			return patch, httputils.NewInvalidParameterError(fmt.Sprintf("%s %s", key, err))
+		}
+	}
+	return patch, nil
+}
+
+//PatchIceCreamData changes only the fields of an ice cream sent in the
+//body, which is either an RFC 7396 merge patch or an RFC 6902 json patch
+//depending on its Content-Type. The patch is conditional on the
+//If-Match header when it is sent, json patches are always applied to
+//the version they were evaluated against
+func (i *IceCreamHandler) PatchIceCreamData(w http.ResponseWriter, r *http.Request) {
+	iceCreamName := chi.URLParam(r, "ice-cream-name")
+	defer r.Body.Close()
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = ""
+	}
+	if mediaType != mergePatchMediaType && mediaType != jsonPatchMediaType && mediaType != "application/json" {
+		msg := fmt.Sprintf("Content-Type should be %s or %s", mergePatchMediaType, jsonPatchMediaType)
+		httputils.WriteHandlerError(httputils.NewUnsupportedMediaTypeError(msg), r, w)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		msg := fmt.Sprintf("invalid input format. error: %s", err)
+		httputils.WriteHandlerError(httputils.NewFormatError(msg), r, w)
+		return
+	}
+
+	version, handlerErr := i.expectedVersion(r, iceCreamName)
+	if handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
+		return
+	}
+
+	if mediaType == jsonPatchMediaType {
+		body, version, handlerErr = i.jsonPatchToMergePatch(r.Context(), iceCreamName, body, version)
+		if handlerErr != nil {
+			httputils.WriteHandlerError(handlerErr, r, w)
+			return
+		}
+	}
+
+	patch, handlerErr := parseMergePatch(iceCreamName, body)
+	if handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
+		return
+	}
+	if handlerErr := validationError(patch.Validate()); handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
+		return
+	}
+	patch.Version = version
+
+	iceCream, err := i.iceCreamStore.Patch(r.Context(), iceCreamName, patch)
+	if err != nil {
+		switch err {
+		case models.ErrNoRows:
+			httputils.WriteHandlerError(httputils.
+				NewNotFoundError(fmt.Sprintf("Icecream: %s Not Found", iceCreamName)), r, w)
+		case models.ErrVersionMismatch:
+			httputils.WriteHandlerError(httputils.NewPreconditionFailedError(
+				fmt.Sprintf("Icecream: %s has changed", iceCreamName)), r, w)
+		default:
+			httputils.WriteHandlerError(storeError(err), r, w)
+		}
+		return
+	}
+
+	w.Header().Set("ETag", etag(iceCream.Version))
+	if err := httputils.WriteJSON(http.StatusOK, iceCream, w); err != nil {
+		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		return
+	}
+}
+
+//jsonPatchToMergePatch applies the json patch in body to the current
+//ice cream and returns the changes as a merge patch along with the
+//version they were made against. version is the one expected by the
+//request, if any
+func (i *IceCreamHandler) jsonPatchToMergePatch(ctx context.Context, name string, body []byte,
+	version int64) ([]byte, int64, *httputils.HandlerError) {
+	var operations []jsonPatchOperation
+	if err := json.Unmarshal(body, &operations); err != nil {
+		return nil, 0, httputils.NewFormatError("json patch should be an array of operations")
+	}
+
+	current, err := i.iceCreamStore.Get(ctx, name)
+	if err == models.ErrNoRows {
+		return nil, 0, httputils.NewNotFoundError(fmt.Sprintf("Icecream: %s Not Found", name))
+	}
+	if err != nil {
+		return nil, 0, storeError(err)
+	}
+	if version != 0 && version != current.Version {
+		return nil, 0, httputils.NewPreconditionFailedError(fmt.Sprintf("Icecream: %s has changed", name))
+	}
+
+	var original map[string]interface{}
+	if err := remarshal(current, &original); err != nil {
+		return nil, 0, httputils.NewUnexpectedError(err)
+	}
+	var document interface{}
+	if err := remarshal(original, &document); err != nil {
+		return nil, 0, httputils.NewUnexpectedError(err)
+	}
+
+	document, err = applyJSONPatch(document, operations)
+	if err != nil {
+		return nil, 0, httputils.NewInvalidOperation(err.Error())
+	}
+	patched, ok := document.(map[string]interface{})
+	if !ok {
+		return nil, 0, httputils.NewInvalidOperation("json patch should leave an object")
+	}
+
+	mergePatch := map[string]interface{}{}
+	for key, value := range patched {
+		if !jsonEqual(original[key], value) {
+			mergePatch[key] = value
+		}
+	}
+	for key := range original {
+		if _, ok := patched[key]; !ok {
+			mergePatch[key] = nil
+		}
+	}
+
+	data, err := json.Marshal(mergePatch)
+	if err != nil {
+		return nil, 0, httputils.NewUnexpectedError(err)
+	}
+	return data, current.Version, nil
+}
+
+//remarshal converts from into to through their json form
+func remarshal(from interface{}, to interface{}) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, to)
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+func Test_parseMergePatch(t *testing.T) {
+	empty := ""
+	story := "new story"
+	var cleared []string
+
+	var tests = []struct {
+		desc          string
+		body          string
+		expected      models.IceCreamPatch
+		expectedError string
+	}{
+		{
+			desc:     "absent fields are left untouched",
+			body:     `{"story":"new story"}`,
+			expected: models.IceCreamPatch{Story: &story},
+		},
+		{
+			desc:     "null clears a field",
+			body:     `{"story":null,"sourcing_values":null}`,
+			expected: models.IceCreamPatch{Story: &empty, SourcingValues: &cleared},
+		},
+		{
+			desc:     "empty values are kept apart from null",
+			body:     `{"story":"","ingredients":[]}`,
+			expected: models.IceCreamPatch{Story: &empty, Ingredients: &[]string{}},
+		},
+		{
+			desc:     "the name can be repeated",
+			body:     `{"name":"Chocobar"}`,
+			expected: models.IceCreamPatch{},
+		},
+		{
+			desc:          "the name cannot be changed",
+			body:          `{"name":"Vanilla"}`,
+			expectedError: "name cannot be changed",
+		},
+		{
+			desc:          "unknown fields are rejected",
+			body:          `{"flavour":"vanilla"}`,
+			expectedError: "unknown field flavour",
+		},
+		{
+			desc:          "fields are type checked",
+			body:          `{"ingredients":"cream"}`,
+			expectedError: "ingredients should be an array of strings",
+		},
+		{
+			desc:          "the patch should be an object",
+			body:          `null`,
+			expectedError: "merge patch should be a json object",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			patch, handlerErr := parseMergePatch("Chocobar", []byte(test.body))
+			if test.expectedError != "" {
+				if assert.NotNil(handlerErr) {
+					assert.Equal(test.expectedError, handlerErr.SubErrors[0].Details["message"])
+				}
+				return
+			}
+			assert.Nil(handlerErr)
+			assert.Equal(test.expected, patch)
+		})
+	}
+}
+
+func Test_PatchIceCreamData(t *testing.T) {
+	current := &models.IceCream{
+		Name:           "Chocobar",
+		Story:          "old story",
+		SourcingValues: []string{"Fairtrade"},
+		Ingredients:    []string{"cream", "sugar"},
+		Version:        3,
+	}
+
+	var tests = []struct {
+		desc               string
+		contentType        string
+		ifMatch            string
+		body               string
+		dbError            error
+		expectedStatusCode int
+		expectedResponse   string
+		expectedETag       string
+		expectedVersion    int64
+	}{
+		{
+			desc:               "a merge patch returns the patched ice cream",
+			contentType:        "application/merge-patch+json",
+			body:               `{"story":null,"sourcing_values":[]}`,
+			expectedStatusCode: 200,
+			expectedResponse: "{\"name\":\"Chocobar\",\"image_open\":\"\",\"image_closed\":\"\"," +
+				"\"story\":\"\",\"description\":\"\",\"sourcing_values\":[]," +
+				"\"ingredients\":[\"cream\",\"sugar\"],\"allergy_info\":\"\"," +
+				"\"dietary_certification\":\"\",\"product_id\":\"\"}\n",
+			expectedETag: `"4"`,
+		},
+		{
+			desc:               "a merge patch is conditional on If-Match",
+			contentType:        "application/merge-patch+json; charset=utf-8",
+			ifMatch:            `"3"`,
+			body:               `{"story":"new"}`,
+			expectedStatusCode: 200,
+			expectedETag:       `"4"`,
+			expectedVersion:    3,
+		},
+		{
+			desc:               "a json patch is applied to the current version",
+			contentType:        "application/json-patch+json",
+			body:               `[{"op":"add","path":"/ingredients/-","value":"nuts"},{"op":"remove","path":"/story"}]`,
+			expectedStatusCode: 200,
+			expectedResponse: "{\"name\":\"Chocobar\",\"image_open\":\"\",\"image_closed\":\"\"," +
+				"\"story\":\"\",\"description\":\"\",\"sourcing_values\":[\"Fairtrade\"]," +
+				"\"ingredients\":[\"cream\",\"sugar\",\"nuts\"],\"allergy_info\":\"\"," +
+				"\"dietary_certification\":\"\",\"product_id\":\"\"}\n",
+			expectedETag:    `"4"`,
+			expectedVersion: 3,
+		},
+		{
+			desc:               "a json patch leaving invalid fields returns a 400",
+			contentType:        "application/json-patch+json",
+			body:               `[{"op":"add","path":"/ingredients/-","value":"cream"}]`,
+			expectedStatusCode: 400,
+			expectedResponse: "{\"httpStatus\":400,\"httpCode\":\"bad_request\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"invalid_parameter\"," +
+				"\"message\":\"ingredients/2 repeats /ingredients/0\",\"pointer\":\"/ingredients/2\"}]}\n",
+		},
+		{
+			desc:               "a json patch evaluated against a stale If-Match returns 412",
+			contentType:        "application/json-patch+json",
+			ifMatch:            `"2"`,
+			body:               `[{"op":"replace","path":"/story","value":"new"}]`,
+			expectedStatusCode: 412,
+		},
+		{
+			desc:               "a failing json patch test returns 409",
+			contentType:        "application/json-patch+json",
+			body:               `[{"op":"test","path":"/story","value":"new"}]`,
+			expectedStatusCode: 409,
+		},
+		{
+			desc:               "other content types return 415",
+			contentType:        "text/plain",
+			body:               `{"story":"new"}`,
+			expectedStatusCode: 415,
+			expectedResponse: "{\"httpStatus\":415,\"httpCode\":\"unsupported_media_type\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"unsupported_media_type\"," +
+				"\"message\":\"Content-Type should be application/merge-patch+json or " +
+				"application/json-patch+json\"}]}\n",
+		},
+		{
+			desc:               "an invalid merge patch returns 400",
+			contentType:        "application/merge-patch+json",
+			body:               `{"story":1}`,
+			expectedStatusCode: 400,
+		},
+		{
+			desc:               "a missing ice cream returns 404",
+			contentType:        "application/merge-patch+json",
+			body:               `{"story":"new"}`,
+			dbError:            models.ErrNoRows,
+			expectedStatusCode: 404,
+		},
+		{
+			desc:               "a version mismatch returns 412",
+			contentType:        "application/merge-patch+json",
+			ifMatch:            `"3"`,
+			body:               `{"story":"new"}`,
+			dbError:            models.ErrVersionMismatch,
+			expectedStatusCode: 412,
+			expectedVersion:    3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			iceCreamStore := &fakeIceCreamStore{iceCream: current, patchErr: test.dbError}
+			ich := NewIceCreamHandler(iceCreamStore, Config{})
+
+			req, err := http.NewRequest("PATCH", "/url", bytes.NewReader([]byte(test.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", test.contentType)
+			if test.ifMatch != "" {
+				req.Header.Set("If-Match", test.ifMatch)
+			}
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("ice-cream-name", "Chocobar")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(ich.PatchIceCreamData)
+			handler.ServeHTTP(rr, req)
+			assert.Equal(test.expectedStatusCode, rr.Code)
+			assert.Equal(test.expectedETag, rr.Header().Get("ETag"))
+			if test.expectedResponse != "" {
+				assert.Equal(test.expectedResponse, rr.Body.String())
+			}
+			if iceCreamStore.patch != nil {
+				assert.Equal(test.expectedVersion, iceCreamStore.patch.Version)
+			}
+		})
+	}
+}
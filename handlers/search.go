@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/sudarshan-reddy/benjerry/httputils"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//searchResults is the response body of a search
+type searchResults struct {
+	Results []models.SearchResult `json:"results"`
+}
+
+//SearchIceCreamData searches the story and description of ice creams
+//for the `q` query parameter and returns the hits ranked by relevance.
+//See models.ParseSearchQuery for the supported query syntax
+func (i *IceCreamHandler) SearchIceCreamData(w http.ResponseWriter, r *http.Request) {
+	limit, handlerErr := pageSizeParam(r.URL.Query())
+	if handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
+		return
+	}
+
+	query, err := models.ParseSearchQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		httputils.WriteHandlerError(httputils.NewInvalidParameterError("q should hold at least one word"), r, w)
+		return
+	}
+
+	results, err := i.iceCreamStore.Search(r.Context(), query, limit)
+	if err != nil {
+		httputils.WriteHandlerError(storeError(err), r, w)
+		return
+	}
+
+	if results == nil {
+		results = []models.SearchResult{}
+	}
+
+	if err := httputils.WriteJSON(http.StatusOK, searchResults{Results: results}, w); err != nil {
+		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		return
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+func Test_SearchIceCreamData(t *testing.T) {
+	var tests = []struct {
+		desc               string
+		query              string
+		dbResponse         []models.SearchResult
+		dbError            error
+		expectedResponse   string
+		expectedStatusCode int
+		expectedQuery      models.SearchQuery
+	}{
+		{
+			desc:  "hits should be returned along with their rank and highlights",
+			query: "?q=coffee",
+			dbResponse: []models.SearchResult{
+				{
+					IceCream: models.IceCream{Name: "Coffee Toffee"},
+					Rank:     0.5,
+					Highlights: models.SearchHighlights{
+						Description: "<mark>Coffee</mark> Ice Cream",
+					},
+				},
+			},
+			expectedResponse: "{\"results\":[{\"ice_cream\":{\"name\":\"Coffee Toffee\"," +
+				"\"image_open\":\"\",\"image_closed\":\"\",\"story\":\"\",\"description\":\"\"," +
+				"\"sourcing_values\":null,\"ingredients\":null,\"allergy_info\":\"\"," +
+				"\"dietary_certification\":\"\",\"product_id\":\"\"},\"rank\":0.5," +
+				"\"highlights\":{\"story\":\"\",\"description\":\"\\u003cmark\\u003eCoffee" +
+				"\\u003c/mark\\u003e Ice Cream\"}}]}\n",
+			expectedStatusCode: 200,
+			expectedQuery:      models.SearchQuery{{Words: []string{"coffee"}}},
+		},
+		{
+			desc:               "no hits should return an empty list",
+			query:              "?q=%22cookie+swirl%22",
+			expectedResponse:   "{\"results\":[]}\n",
+			expectedStatusCode: 200,
+			expectedQuery:      models.SearchQuery{{Words: []string{"cookie", "swirl"}}},
+		},
+		{
+			desc:               "a missing query returns a 400 error",
+			expectedStatusCode: 400,
+			expectedResponse: "{\"httpStatus\":400,\"httpCode\":\"bad_request\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"invalid_parameter\"," +
+				"\"message\":\"q should hold at least one word\"}]}\n",
+		},
+		{
+			desc:               "if database returns an error, return 500 in response",
+			query:              "?q=coffee",
+			dbError:            errors.New("pg error: error connecting to db"),
+			expectedStatusCode: 500,
+			expectedResponse: "{\"httpStatus\":500," +
+				"\"httpCode\":\"internal_server_error\"," +
+				"\"requestId\":\"\",\"errors\":[]}\n",
+			expectedQuery: models.SearchQuery{{Words: []string{"coffee"}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			iceCreamStore := &fakeIceCreamStore{searchResults: test.dbResponse, err: test.dbError}
+			ich := NewIceCreamHandler(iceCreamStore, Config{})
+
+			req, err := http.NewRequest("GET", "/api/v1/search"+test.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(ich.SearchIceCreamData)
+			handler.ServeHTTP(rr, req)
+			assert.Equal(test.expectedResponse, rr.Body.String())
+			assert.Equal(test.expectedStatusCode, rr.Code)
+			assert.Equal(test.expectedQuery, iceCreamStore.searchQuery)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/sudarshan-reddy/benjerry/httputils"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//tokenRequest is the request body of PostToken
+type tokenRequest struct {
+	Owner     string     `json:"owner"`
+	Kind      string     `json:"kind"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+//mintedToken is the response body of PostToken, the only one holding
+//the token itself
+type mintedToken struct {
+	models.APIToken
+	Token string `json:"token"`
+}
+
+//tokenList is the response body of ListTokens
+type tokenList struct {
+	Tokens []models.APIToken `json:"tokens"`
+}
+
+//TokenHandler holds the handlers minting and revoking API tokens
+type TokenHandler struct {
+	tokenStore models.TokenStore
+	//callerScopes returns the scopes of the token a request was
+	//authenticated with
+	callerScopes func(r *http.Request) []string
+}
+
+//NewTokenHandler returns a new instance of TokenHandler
+func NewTokenHandler(tokenStore models.TokenStore, callerScopes func(r *http.Request) []string) *TokenHandler {
+	return &TokenHandler{
+		tokenStore:   tokenStore,
+		callerScopes: callerScopes,
+	}
+}
+
+//PostToken mints a token, an API token unless the kind of the request
+//says otherwise. The token is only ever shown in the response. Callers
+//can only mint scopes they are granted themselves
+func (t *TokenHandler) PostToken(w http.ResponseWriter, r *http.Request) {
+	var request tokenRequest
+	defer r.Body.Close()
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		msg := fmt.Sprintf("invalid input format. error: %s", err)
+		httputils.WriteHandlerError(httputils.NewFormatError(msg), r, w)
+		return
+	}
+
+	now := time.Now()
+	token, bearer, err := models.MintToken(request.Owner, request.Scopes, request.ExpiresAt, now)
+	if err != nil {
+		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		return
+	}
+	if request.Kind != "" {
+		token.Kind = request.Kind
+	}
+	if handlerErr := validationError(token.Validate(now)); handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
+		return
+	}
+	if handlerErr := t.ungrantedScopes(r, token.Scopes); handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
+		return
+	}
+
+	if err := t.tokenStore.StoreToken(r.Context(), token); err != nil {
+		httputils.WriteHandlerError(storeError(err), r, w)
+		return
+	}
+
+	if err := httputils.WriteJSON(http.StatusCreated, mintedToken{APIToken: token, Token: bearer}, w); err != nil {
+		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		return
+	}
+}
+
+//ungrantedScopes forbids the scopes the caller of r is not granted
+func (t *TokenHandler) ungrantedScopes(r *http.Request, scopes []string) *httputils.HandlerError {
+	callerScopes := t.callerScopes(r)
+	var subErrors []*httputils.SubError
+	for index, scope := range scopes {
+		if !models.GrantsScope(callerScopes, scope) {
+			subError := httputils.NewSubError(httputils.InvalidScope, "message",
+				fmt.Sprintf("scope %s is not granted to the caller", scope))
+			subError.Details["pointer"] = fmt.Sprintf("/scopes/%d", index)
+			subErrors = append(subErrors, subError)
+		}
+	}
+	if subErrors == nil {
+		return nil
+	}
+	return httputils.NewHandlerError(http.StatusForbidden, subErrors...)
+}
+
+//ListTokens lists every token, revoked ones included, oldest first
+func (t *TokenHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := t.tokenStore.ListTokens(r.Context())
+	if err != nil {
+		httputils.WriteHandlerError(storeError(err), r, w)
+		return
+	}
+
+	if err := httputils.WriteJSON(http.StatusOK, tokenList{Tokens: tokens}, w); err != nil {
+		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		return
+	}
+}
+
+//RevokeToken revokes a token for good. Servers keep accepting it for
+//as long as they cache tokens
+func (t *TokenHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "token-id")
+
+	token, err := t.tokenStore.RevokeToken(r.Context(), id, models.TokenTime(time.Now()))
+	if err != nil {
+		if err == models.ErrNoRows {
+			httputils.WriteHandlerError(httputils.
+				NewNotFoundError(fmt.Sprintf("Token: %s Not Found", id)), r, w)
+			return
+		}
+		httputils.WriteHandlerError(storeError(err), r, w)
+		return
+	}
+
+	if err := httputils.WriteJSON(http.StatusOK, token, w); err != nil {
+		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		return
+	}
+}
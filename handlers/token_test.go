@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+	"github.com/sudarshan-reddy/benjerry/models/memory"
+)
+
+//serveToken runs handler on a request for the token of id
+func serveToken(handler http.HandlerFunc, method, id, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/url", strings.NewReader(body))
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("token-id", id)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+//callerScopes returns a func handing scopes to TokenHandler as the ones
+//of the caller
+func callerScopes(scopes ...string) func(r *http.Request) []string {
+	return func(r *http.Request) []string {
+		return scopes
+	}
+}
+
+func Test_PostToken(t *testing.T) {
+	var tests = []struct {
+		desc               string
+		callerScopes       []string
+		reqBody            string
+		expectedResponse   string
+		expectedStatusCode int
+	}{
+		{
+			desc:         "callers cannot mint scopes they are not granted",
+			callerScopes: []string{"admin.token", "read.icecream"},
+			reqBody:      `{"owner":"catalog team","scopes":["read.icecream","*","*.icecream"]}`,
+			//the scopes that are not granted are only logged, like for every 403
+			expectedResponse:   "{\"httpStatus\":403,\"httpCode\":\"forbidden\",\"requestId\":\"\",\"errors\":[]}\n",
+			expectedStatusCode: 403,
+		},
+		{
+			desc:    "an invalid token returns every broken constraint",
+			reqBody: `{"owner":"","scopes":["read.icecream",""],"expires_at":"2018-04-01T10:00:00Z"}`,
+			expectedResponse: "{\"httpStatus\":400,\"httpCode\":\"bad_request\",\"requestId\":\"\",\"errors\":[" +
+				"{\"code\":\"invalid_parameter\",\"message\":\"owner is required\",\"pointer\":\"/owner\"}," +
+				"{\"code\":\"invalid_parameter\",\"message\":\"scopes/1 should not be empty\"," +
+				"\"pointer\":\"/scopes/1\"}," +
+				"{\"code\":\"invalid_parameter\",\"message\":\"expires_at should be in the future\"," +
+				"\"pointer\":\"/expires_at\"}]}\n",
+			expectedStatusCode: 400,
+		},
+		{
+			desc:         "tokens are api tokens or oauth clients",
+			callerScopes: []string{"read.icecream"},
+			reqBody:      `{"owner":"partner","kind":"partner","scopes":["read.icecream"]}`,
+			expectedResponse: "{\"httpStatus\":400,\"httpCode\":\"bad_request\",\"requestId\":\"\",\"errors\":[" +
+				"{\"code\":\"invalid_parameter\",\"message\":\"kind should be api or oauth_client\"," +
+				"\"pointer\":\"/kind\"}]}\n",
+			expectedStatusCode: 400,
+		},
+		{
+			desc:    "a body that is not json returns a 400 error",
+			reqBody: `{"owner":`,
+			expectedResponse: "{\"httpStatus\":400,\"httpCode\":\"bad_request\",\"requestId\":\"\"," +
+				"\"errors\":[{\"code\":\"format_error\"," +
+				"\"message\":\"invalid input format. error: unexpected EOF\"}]}\n",
+			expectedStatusCode: 400,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			th := NewTokenHandler(memory.NewTokenStore(), callerScopes(test.callerScopes...))
+
+			rr := serveToken(th.PostToken, "POST", "", test.reqBody)
+			assert.Equal(test.expectedResponse, rr.Body.String())
+			assert.Equal(test.expectedStatusCode, rr.Code)
+		})
+	}
+}
+
+func Test_MintListAndRevokeToken(t *testing.T) {
+	assert := assert.New(t)
+	tokenStore := memory.NewTokenStore()
+	th := NewTokenHandler(tokenStore, callerScopes(models.ScopeAll))
+
+	rr := serveToken(th.PostToken, "POST", "", `{"owner":"catalog team","kind":"oauth_client",`+
+		`"scopes":["read.icecream"],"expires_at":"2100-01-01T00:00:00Z"}`)
+	assert.Equal(201, rr.Code)
+	var minted struct {
+		models.APIToken
+		Token string `json:"token"`
+	}
+	assert.NoError(json.Unmarshal(rr.Body.Bytes(), &minted))
+	assert.Equal("catalog team", minted.Owner)
+	assert.Equal(models.TokenKindOAuthClient, minted.Kind)
+	assert.Equal([]string{"read.icecream"}, minted.Scopes)
+	id, secret, ok := models.ParseToken(minted.Token)
+	assert.True(ok)
+	assert.Equal(minted.ID, id)
+	stored, err := tokenStore.GetToken(context.Background(), id)
+	assert.NoError(err)
+	assert.True(stored.Matches(secret))
+
+	//the token is never shown again
+	rr = serveToken(th.ListTokens, "GET", "", "")
+	assert.Equal(200, rr.Code)
+	assert.NotContains(rr.Body.String(), secret)
+	assert.NotContains(rr.Body.String(), "revoked_at")
+	assert.Contains(rr.Body.String(), "\"id\":\""+id+"\"")
+
+	rr = serveToken(th.RevokeToken, "DELETE", id, "")
+	assert.Equal(200, rr.Code)
+	assert.Contains(rr.Body.String(), "revoked_at")
+	assert.NotContains(rr.Body.String(), secret)
+
+	rr = serveToken(th.RevokeToken, "DELETE", "missing", "")
+	assert.Equal(404, rr.Code)
+	assert.Equal("{\"httpStatus\":404,\"httpCode\":\"not_found\",\"requestId\":\"\",\"errors\":[{"+
+		"\"code\":\"not_found\",\"message\":\"Token: missing Not Found\"}]}\n", rr.Body.String())
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/sudarshan-reddy/benjerry/httputils"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//trashList is the response body of a paginated trash listing
+type trashList struct {
+	IceCreams  []models.TrashedIceCream `json:"ice_creams"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+	PrevCursor string                   `json:"prev_cursor,omitempty"`
+}
+
+//purgeResult is the response body of a purge
+type purgeResult struct {
+	Purged int64 `json:"purged"`
+}
+
+//ListTrash lists deleted ice creams a page at a time along with when
+//and by whom they were deleted. Paging works as in ListIceCreamData
+func (i *IceCreamHandler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	pageSize, handlerErr := pageSizeParam(r.URL.Query())
+	if handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
+		return
+	}
+
+	page, err := i.iceCreamStore.GetTrash(r.Context(), pageSize, r.URL.Query().Get("cursor"))
+	if err != nil {
+		if err == models.ErrInvalidCursor {
+			httputils.WriteHandlerError(httputils.NewInvalidParameterError("invalid cursor"), r, w)
+			return
+		}
+		httputils.WriteHandlerError(storeError(err), r, w)
+		return
+	}
+
+	if link := pageLinks(r.URL, pageSize, page.NextCursor, page.PrevCursor); link != "" {
+		w.Header().Set("Link", link)
+	}
+
+	response := trashList{
+		IceCreams:  page.IceCreams,
+		NextCursor: page.NextCursor,
+		PrevCursor: page.PrevCursor,
+	}
+	if response.IceCreams == nil {
+		response.IceCreams = []models.TrashedIceCream{}
+	}
+
+	if err := httputils.WriteJSON(http.StatusOK, response, w); err != nil {
+		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		return
+	}
+}
+
+//RestoreIceCream moves a deleted ice cream out of the trash and responds
+//with it. If-Match is evaluated against the ice cream in the trash
+func (i *IceCreamHandler) RestoreIceCream(w http.ResponseWriter, r *http.Request) {
+	iceCreamName := chi.URLParam(r, "ice-cream-name")
+
+	expected, handlerErr := i.expectedTrashedVersion(r, iceCreamName)
+	if handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
+		return
+	}
+
+	var restored *models.IceCream
+	err := i.iceCreamStore.WithTxContext(r.Context(), func(ctx context.Context) error {
+		err := i.iceCreamStore.Restore(ctx, iceCreamName, expected)
+		if err != nil {
+			return err
+		}
+		restored, err = i.iceCreamStore.Get(ctx, iceCreamName)
+		return err
+	})
+
+	switch err {
+	case nil:
+	case models.ErrNoRows:
+		httputils.WriteHandlerError(httputils.
+			NewNotFoundError(fmt.Sprintf("Icecream: %s Not Found in trash", iceCreamName)), r, w)
+		return
+	case models.ErrVersionMismatch:
+		httputils.WriteHandlerError(httputils.NewPreconditionFailedError(
+			fmt.Sprintf("Icecream: %s has changed", iceCreamName)), r, w)
+		return
+	default:
+		httputils.WriteHandlerError(storeError(err), r, w)
+		return
+	}
+
+	w.Header().Set("ETag", etag(restored.Version))
+	if err := httputils.WriteJSON(http.StatusOK, restored, w); err != nil {
+		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		return
+	}
+}
+
+//PurgeTrash permanently removes the ice creams that have been in the
+//trash for longer than the configured retention
+func (i *IceCreamHandler) PurgeTrash(w http.ResponseWriter, r *http.Request) {
+	purged, err := i.iceCreamStore.Purge(r.Context(), time.Now().Add(-i.cfg.TrashRetention))
+	if err != nil {
+		httputils.WriteHandlerError(storeError(err), r, w)
+		return
+	}
+
+	if err := httputils.WriteJSON(http.StatusOK, purgeResult{Purged: purged}, w); err != nil {
+		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		return
+	}
+}
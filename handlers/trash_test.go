@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+func Test_ListTrash(t *testing.T) {
+	deletedAt := time.Date(2018, 4, 1, 10, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		desc               string
+		query              string
+		dbResponse         *models.TrashPage
+		dbError            error
+		expectedResponse   string
+		expectedLink       string
+		expectedStatusCode int
+	}{
+		{
+			desc:  "trashed ice creams are listed along with who deleted them",
+			query: "?limit=1",
+			dbResponse: &models.TrashPage{
+				IceCreams: []models.TrashedIceCream{{
+					IceCream:  models.IceCream{Name: "Chocobar"},
+					DeletedAt: deletedAt,
+					DeletedBy: "token ced85b42",
+				}},
+				NextCursor: "bjox",
+			},
+			expectedResponse: "{\"ice_creams\":[{\"name\":\"Chocobar\",\"image_open\":\"\"," +
+				"\"image_closed\":\"\",\"story\":\"\",\"description\":\"\",\"sourcing_values\":null," +
+				"\"ingredients\":null,\"allergy_info\":\"\",\"dietary_certification\":\"\"," +
+				"\"product_id\":\"\",\"deleted_at\":\"2018-04-01T10:00:00Z\",\"deleted_by\":\"token ced85b42\"}]," +
+				"\"next_cursor\":\"bjox\"}\n",
+			expectedLink:       "</api/v1/trash?cursor=bjox&limit=1>; rel=\"next\"",
+			expectedStatusCode: 200,
+		},
+		{
+			desc:               "an empty trash returns an empty list",
+			dbResponse:         &models.TrashPage{},
+			expectedResponse:   "{\"ice_creams\":[]}\n",
+			expectedStatusCode: 200,
+		},
+		{
+			desc:               "an invalid cursor returns a 400 error",
+			query:              "?cursor=garbage",
+			dbError:            models.ErrInvalidCursor,
+			expectedStatusCode: 400,
+			expectedResponse: "{\"httpStatus\":400,\"httpCode\":\"bad_request\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"invalid_parameter\"," +
+				"\"message\":\"invalid cursor\"}]}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			iceCreamStore := &fakeIceCreamStore{trash: test.dbResponse, err: test.dbError}
+			ich := NewIceCreamHandler(iceCreamStore, Config{})
+
+			req, err := http.NewRequest("GET", "/api/v1/trash"+test.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(ich.ListTrash)
+			handler.ServeHTTP(rr, req)
+			assert.Equal(test.expectedResponse, rr.Body.String())
+			assert.Equal(test.expectedStatusCode, rr.Code)
+			assert.Equal(test.expectedLink, rr.Header().Get("Link"))
+		})
+	}
+}
+
+func Test_RestoreIceCream(t *testing.T) {
+	var tests = []struct {
+		desc               string
+		dbError            error
+		expectedResponse   string
+		expectedStatusCode int
+		expectedETag       string
+	}{
+		{
+			desc: "a trashed ice cream is restored and returned with its etag",
+			expectedResponse: "{\"name\":\"Chocobar\",\"image_open\":\"\"," +
+				"\"image_closed\":\"\",\"story\":\"\",\"description\":\"\"," +
+				"\"sourcing_values\":null,\"ingredients\":null,\"allergy_info\":\"\"," +
+				"\"dietary_certification\":\"\",\"product_id\":\"\"}\n",
+			expectedStatusCode: 200,
+			expectedETag:       `"3"`,
+		},
+		{
+			desc:               "an ice cream missing from the trash returns 404",
+			dbError:            models.ErrNoRows,
+			expectedStatusCode: 404,
+			expectedResponse: "{\"httpStatus\":404,\"httpCode\":\"not_found\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"not_found\"," +
+				"\"message\":\"Icecream: Chocobar Not Found in trash\"}]}\n",
+		},
+		{
+			desc:               "if database returns a different error, return 500 in response",
+			dbError:            errors.New("pg error: error connecting to db"),
+			expectedStatusCode: 500,
+			expectedResponse: "{\"httpStatus\":500," +
+				"\"httpCode\":\"internal_server_error\"," +
+				"\"requestId\":\"\",\"errors\":[]}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			iceCreamStore := &fakeIceCreamStore{
+				iceCream: &models.IceCream{Name: "Chocobar", Version: 2},
+				err:      test.dbError,
+			}
+			ich := NewIceCreamHandler(iceCreamStore, Config{})
+
+			req, err := http.NewRequest("POST", "/url", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("ice-cream-name", "Chocobar")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(ich.RestoreIceCream)
+			handler.ServeHTTP(rr, req)
+			assert.Equal(test.expectedResponse, rr.Body.String())
+			assert.Equal(test.expectedStatusCode, rr.Code)
+			assert.Equal(test.expectedETag, rr.Header().Get("ETag"))
+			assert.Equal("Chocobar", iceCreamStore.serializedStore)
+		})
+	}
+}
+
+func Test_PurgeTrash(t *testing.T) {
+	assert := assert.New(t)
+	iceCreamStore := &fakeIceCreamStore{}
+	ich := NewIceCreamHandler(iceCreamStore, Config{TrashRetention: 24 * time.Hour})
+
+	req, err := http.NewRequest("DELETE", "/api/v1/trash", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(ich.PurgeTrash)
+	handler.ServeHTTP(rr, req)
+	assert.Equal("{\"purged\":2}\n", rr.Body.String())
+	assert.Equal(200, rr.Code)
+	assert.WithinDuration(time.Now().Add(-24*time.Hour), iceCreamStore.olderThan, time.Minute)
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/sudarshan-reddy/benjerry/httputils"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//PutIceCreamData creates or replaces the ice cream named in the path
+//with the body. It is idempotent: a new ice cream is answered with a
+//201 and its Location while a replaced one is answered with a 200.
+//The replace is conditional on the If-Match header when it is sent
+func (i *IceCreamHandler) PutIceCreamData(w http.ResponseWriter, r *http.Request) {
+	iceCreamName := chi.URLParam(r, "ice-cream-name")
+	var iceCreamTask models.IceCream
+	defer r.Body.Close()
+
+	if err := json.NewDecoder(r.Body).Decode(&iceCreamTask); err != nil {
+		msg := fmt.Sprintf("invalid input format. error: %s", err)
+		httputils.WriteHandlerError(httputils.NewFormatError(msg), r, w)
+		return
+	}
+
+	if iceCreamTask.Name == "" {
+		iceCreamTask.Name = iceCreamName
+	}
+	if iceCreamTask.Name != iceCreamName {
+		httputils.WriteHandlerError(httputils.
+			NewInvalidParameterError("name should match the one in the path"), r, w)
+		return
+	}
+	if handlerErr := validationError(iceCreamTask.Validate()); handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
+		return
+	}
+
+	version, handlerErr := i.expectedVersion(r, iceCreamName)
+	if handlerErr != nil {
+		httputils.WriteHandlerError(handlerErr, r, w)
+		return
+	}
+	iceCreamTask.Version = version
+
+	iceCream, created, err := i.iceCreamStore.Upsert(r.Context(), iceCreamTask)
+	if err != nil {
+		if err == models.ErrVersionMismatch {
+			httputils.WriteHandlerError(httputils.NewPreconditionFailedError(
+				fmt.Sprintf("Icecream: %s has changed", iceCreamName)), r, w)
+			return
+		}
+		httputils.WriteHandlerError(storeError(err), r, w)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeIceCream(status, iceCream, r, w)
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+func Test_PutIceCreamData(t *testing.T) {
+	var tests = []struct {
+		desc               string
+		reqBody            string
+		ifMatch            string
+		created            bool
+		dbError            error
+		expectedStatusCode int
+		expectedResponse   string
+		expectedLocation   string
+		expectedETag       string
+		expectedUpsert     *models.IceCream
+	}{
+		{
+			desc:               "a new ice cream returns a 201 with its location",
+			reqBody:            `{"name":"chocobar","story":"new"}`,
+			created:            true,
+			expectedStatusCode: 201,
+			expectedLocation:   "/api/v1/read/chocobar",
+			expectedETag:       `"1"`,
+			expectedResponse: "{\"name\":\"chocobar\",\"image_open\":\"\"," +
+				"\"image_closed\":\"\",\"story\":\"new\",\"description\":\"\"," +
+				"\"sourcing_values\":null,\"ingredients\":null,\"allergy_info\":\"\"," +
+				"\"dietary_certification\":\"\",\"product_id\":\"\"}\n",
+			expectedUpsert: &models.IceCream{Name: "chocobar", Story: "new"},
+		},
+		{
+			desc:               "a replaced ice cream returns a 200 and the name can be left out",
+			reqBody:            `{"story":"new"}`,
+			ifMatch:            `"3"`,
+			expectedStatusCode: 200,
+			expectedETag:       `"4"`,
+			expectedResponse: "{\"name\":\"chocobar\",\"image_open\":\"\"," +
+				"\"image_closed\":\"\",\"story\":\"new\",\"description\":\"\"," +
+				"\"sourcing_values\":null,\"ingredients\":null,\"allergy_info\":\"\"," +
+				"\"dietary_certification\":\"\",\"product_id\":\"\"}\n",
+			expectedUpsert: &models.IceCream{Name: "chocobar", Story: "new", Version: 3},
+		},
+		{
+			desc:               "a different name in the body returns a 400",
+			reqBody:            `{"name":"vanilla"}`,
+			expectedStatusCode: 400,
+			expectedResponse: "{\"httpStatus\":400,\"httpCode\":\"bad_request\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"invalid_parameter\"," +
+				"\"message\":\"name should match the one in the path\"}]}\n",
+		},
+		{
+			desc:               "a stale If-Match returns a 412",
+			reqBody:            `{"name":"chocobar"}`,
+			ifMatch:            `"2"`,
+			dbError:            models.ErrVersionMismatch,
+			expectedStatusCode: 412,
+			expectedResponse: "{\"httpStatus\":412,\"httpCode\":\"precondition_failed\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"precondition_failed\"," +
+				"\"message\":\"Icecream: chocobar has changed\"}]}\n",
+			expectedUpsert: &models.IceCream{Name: "chocobar", Version: 2},
+		},
+		{
+			desc:               "a wildcard If-Match does not create a missing ice cream",
+			reqBody:            `{"name":"chocobar"}`,
+			ifMatch:            "*",
+			dbError:            models.ErrNoRows,
+			expectedStatusCode: 412,
+			expectedResponse: "{\"httpStatus\":412,\"httpCode\":\"precondition_failed\"," +
+				"\"requestId\":\"\",\"errors\":[{\"code\":\"precondition_failed\"," +
+				"\"message\":\"Icecream: chocobar does not exist to match If-Match: *\"}]}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			iceCreamStore := &fakeIceCreamStore{created: test.created, err: test.dbError}
+			ich := NewIceCreamHandler(iceCreamStore, Config{})
+
+			req, err := http.NewRequest("PUT", "/url", bytes.NewReader([]byte(test.reqBody)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.ifMatch != "" {
+				req.Header.Set("If-Match", test.ifMatch)
+			}
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("ice-cream-name", "chocobar")
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, rctx)
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(ich.PutIceCreamData)
+			handler.ServeHTTP(rr, req.WithContext(ctx))
+			assert.Equal(test.expectedResponse, rr.Body.String())
+			assert.Equal(test.expectedStatusCode, rr.Code)
+			assert.Equal(test.expectedLocation, rr.Header().Get("Location"))
+			assert.Equal(test.expectedETag, rr.Header().Get("ETag"))
+			assert.Equal(test.expectedUpsert, iceCreamStore.upserted)
+		})
+	}
+}
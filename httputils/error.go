@@ -18,6 +18,12 @@ var ErrorCodeStrings = map[ErrorCode]string{
 	InvalidOperation: "invalid_operation",
 	InvalidParameter: "invalid_parameter",
 	Deprecated:       "deprecated",
+
+	PreconditionFailed:   "precondition_failed",
+	PreconditionRequired: "precondition_required",
+	UnsupportedMediaType: "unsupported_media_type",
+	Timeout:              "timeout",
+	Unavailable:          "unavailable",
 }
 
 //ErrorCode int typecast for enum below
@@ -35,6 +41,11 @@ const (
 	InvalidOperation
 	InvalidParameter
 	Deprecated
+	PreconditionFailed
+	PreconditionRequired
+	UnsupportedMediaType
+	Timeout
+	Unavailable
 )
 
 //ErrorDetails is useful to parse error details
@@ -118,6 +129,14 @@ func NewInvalidParameterError(message string) *HandlerError {
 	return NewHandlerError(http.StatusBadRequest, subError)
 }
 
+//NewFieldError returns an invalid_parameter SubError about the field at
+//the json pointer
+func NewFieldError(pointer, message string) *SubError {
+	subError := NewSubError(InvalidParameter, "message", message)
+	subError.Details["pointer"] = pointer
+	return subError
+}
+
 //NewUnexpectedError ...
 func NewUnexpectedError(err error) *HandlerError {
 	subError := NewSubError(UnexpectedError, "error", err.Error())
@@ -130,6 +149,36 @@ func NewDeprecatedError(message string) *HandlerError {
 	return NewHandlerError(http.StatusGone, subError)
 }
 
+//NewPreconditionFailedError ...
+func NewPreconditionFailedError(message string) *HandlerError {
+	subError := NewSubError(PreconditionFailed, "message", message)
+	return NewHandlerError(http.StatusPreconditionFailed, subError)
+}
+
+//NewPreconditionRequiredError ...
+func NewPreconditionRequiredError(message string) *HandlerError {
+	subError := NewSubError(PreconditionRequired, "message", message)
+	return NewHandlerError(http.StatusPreconditionRequired, subError)
+}
+
+//NewUnsupportedMediaTypeError ...
+func NewUnsupportedMediaTypeError(message string) *HandlerError {
+	subError := NewSubError(UnsupportedMediaType, "message", message)
+	return NewHandlerError(http.StatusUnsupportedMediaType, subError)
+}
+
+//NewGatewayTimeoutError ...
+func NewGatewayTimeoutError(message string) *HandlerError {
+	subError := NewSubError(Timeout, "message", message)
+	return NewHandlerError(http.StatusGatewayTimeout, subError)
+}
+
+//NewServiceUnavailableError ...
+func NewServiceUnavailableError(message string) *HandlerError {
+	subError := NewSubError(Unavailable, "message", message)
+	return NewHandlerError(http.StatusServiceUnavailable, subError)
+}
+
 //NewCustomError ...
 func NewCustomError(httpStatus int, code, message string) *HandlerError {
 	subError := NewSubError(Custom, "code", code)
@@ -15,12 +15,17 @@ import (
 var ContextRequestIDKey interface{} = "requestId"
 
 var httpStatusCodes = map[int]string{
-	http.StatusInternalServerError: "internal_server_error",
-	http.StatusConflict:            "conflict",
-	http.StatusNotFound:            "not_found",
-	http.StatusBadRequest:          "bad_request",
-	http.StatusUnauthorized:        "unauthorized",
-	http.StatusForbidden:           "forbidden",
+	http.StatusInternalServerError:  "internal_server_error",
+	http.StatusConflict:             "conflict",
+	http.StatusNotFound:             "not_found",
+	http.StatusBadRequest:           "bad_request",
+	http.StatusUnauthorized:         "unauthorized",
+	http.StatusForbidden:            "forbidden",
+	http.StatusPreconditionFailed:   "precondition_failed",
+	http.StatusPreconditionRequired: "precondition_required",
+	http.StatusUnsupportedMediaType: "unsupported_media_type",
+	http.StatusServiceUnavailable:   "service_unavailable",
+	http.StatusGatewayTimeout:       "gateway_timeout",
 }
 
 //AbbreAuthToken helps abbreviate the auth token to prevent showing
@@ -1,12 +1,22 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/go-redis/redis"
 	log "github.com/sirupsen/logrus"
 	"github.com/sudarshan-reddy/benjerry/configs"
 	"github.com/sudarshan-reddy/benjerry/db"
+	"github.com/sudarshan-reddy/benjerry/models"
+	"github.com/sudarshan-reddy/benjerry/models/cache"
+	"github.com/sudarshan-reddy/benjerry/models/canonical"
+	"github.com/sudarshan-reddy/benjerry/models/memory"
 	"github.com/sudarshan-reddy/benjerry/models/postgres"
+	"github.com/sudarshan-reddy/benjerry/models/timeout"
 	"github.com/sudarshan-reddy/benjerry/router"
 	"github.com/sudarshan-reddy/benjerry/scripts"
 )
@@ -32,28 +42,209 @@ func main() {
 	setupLog(config.LogLevel, config.LogFormat)
 	log.Infof("%s built on %s from commit %s", serviceName, buildTimestamp, commitID)
 
-	db.RunMigrateScripts(config.PostgresDBURL, ".")
-	postgresDB, err := db.NewPostgresDB(config.PostgresDBURL, config.PostgresDBMaxConnections)
-	failOnError(err, "error while connecting to postgresDB")
+	iceCreamStore, ingredientStore, tokenStore := newStores(config)
+	iceCreamStore = timeout.NewIceCreamStore(iceCreamStore, timeout.Config{
+		QueryTimeout: config.QueryTimeout,
+	})
+	iceCreamStore = canonical.NewIceCreamStore(iceCreamStore, ingredientStore)
+	if config.RedisURL != "" {
+		iceCreamStore = newCachedIceCreamStore(config, iceCreamStore)
+	}
 
-	iceCreamStore := postgres.NewIceCreamStore(postgresDB)
+	if config.BackfillIngredients {
+		summary, err := scripts.BackfillIngredients(context.Background(), iceCreamStore)
+		failOnError(err, "error while backfilling ingredients")
+		log.Infof("backfilled ingredients : %s", summary)
+	}
 
 	if config.LoadData {
-		err := scripts.MoveData(iceCreamStore)
-		failOnError(err, "error while moving ice cream initial data")
+		loadData(config, iceCreamStore, ingredientStore)
 	}
 
 	routerCfg := router.Config{
-		IceCreamStore: iceCreamStore,
+		IceCreamStore:   iceCreamStore,
+		IngredientStore: ingredientStore,
+		TokenStore:      tokenStore,
+		RequireIfMatch:  config.RequireIfMatch,
+		TrashRetention:  config.TrashRetention,
+		RequestTimeout:  config.RequestTimeout,
+		RouteTimeouts:   config.RouteTimeouts,
+	}
+	if config.PolicyFile != "" {
+		policy, err := router.LoadPolicy(config.PolicyFile)
+		failOnError(err, "error while loading the authorization policy")
+		routerCfg.Policy = policy
 	}
 
-	apiRouter := router.NewRouter(config.StaticTokens, routerCfg)
+	routerCfg.OAuthServer = newOAuthServer(config, tokenStore)
+
+	apiRouter := router.NewRouter(newAuthHandlers(config, tokenStore, routerCfg.OAuthServer), routerCfg)
 	apiRouter.AddRoutes()
 
 	log.Infof("%s running on port %s", serviceName, config.ListenPort)
 	http.ListenAndServe(":"+config.ListenPort, apiRouter)
 }
 
+func newStores(config *configs.Config) (models.IceCreamStore, models.IngredientStore, models.TokenStore) {
+	if config.StoreDriver == configs.StoreDriverMemory {
+		log.Warn("using the in memory store, data will be lost on restart")
+		return memory.NewIceCreamStore(), memory.NewIngredientStore(), memory.NewTokenStore()
+	}
+
+	db.RunMigrateScripts(config.PostgresDBURL, config.MigrationsPath)
+	postgresDB, err := db.NewPostgresDB(config.PostgresDBURL, config.PostgresDBMaxConnections)
+	failOnError(err, "error while connecting to postgresDB")
+
+	return postgres.NewIceCreamStore(postgresDB), postgres.NewIngredientStore(postgresDB),
+		postgres.NewTokenStore(postgresDB)
+}
+
+//newAuthHandlers builds the auth handlers of config in the order they
+//are listed in, after the one of the admin token when it is set
+func newAuthHandlers(config *configs.Config, tokenStore models.TokenStore,
+	oauthServer *router.OAuthServer) []router.AuthHandler {
+	authHandlers := make([]router.AuthHandler, 0, len(config.AuthHandlers)+1)
+	if config.AdminToken != "" {
+		authHandlers = append(authHandlers, router.NewStaticTokenAuthenticator(map[string][]string{
+			config.AdminToken: {models.ScopeAll},
+		}))
+	}
+	for _, authHandler := range config.AuthHandlers {
+		switch authHandler {
+		case configs.AuthHandlerStatic:
+			authHandlers = append(authHandlers, router.NewStaticTokenSetAuthenticator(newStaticTokenSet(config)))
+		case configs.AuthHandlerJWT:
+			authHandlers = append(authHandlers, router.NewJWTAuthenticator(loadJWTKeys(config), router.JWTConfig{
+				Audience:    config.JWTAudience,
+				Issuer:      config.JWTIssuer,
+				ScopesClaim: config.JWTScopesClaim,
+				Leeway:      config.JWTLeeway,
+			}))
+		case configs.AuthHandlerStored:
+			authHandlers = append(authHandlers, router.NewStoredTokenAuthenticator(tokenStore, config.TokenCacheTTL))
+		case configs.AuthHandlerOAuth:
+			authHandlers = append(authHandlers, router.NewOAuthAuthenticator(oauthServer))
+		}
+	}
+	return authHandlers
+}
+
+//newOAuthServer returns the OAuth server issuing access tokens to the
+//clients of tokenStore, or nil when config does not list the oauth
+//auth handler
+func newOAuthServer(config *configs.Config, tokenStore models.TokenStore) *router.OAuthServer {
+	for _, authHandler := range config.AuthHandlers {
+		if authHandler == configs.AuthHandlerOAuth {
+			return router.NewOAuthServer(tokenStore, router.OAuthConfig{
+				SigningKey:     []byte(config.OAuthSigningKey),
+				Issuer:         config.OAuthIssuer,
+				TokenTTL:       config.OAuthTokenTTL,
+				ClientCacheTTL: config.TokenCacheTTL,
+			})
+		}
+	}
+	return nil
+}
+
+//newStaticTokenSet returns the static tokens of config. Tokens read
+//from a file are swapped whenever the file changes or on SIGHUP
+func newStaticTokenSet(config *configs.Config) *router.StaticTokenSet {
+	if config.StaticTokenFile == "" {
+		return router.NewStaticTokenSet(config.StaticTokens)
+	}
+
+	set := router.NewStaticTokenSet(map[string][]string{})
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	err := configs.WatchStaticTokenFile(config.StaticTokenFile, config.StaticTokenFileInterval, reload, nil,
+		func(tokens configs.StaticTokens) {
+			set.Store(tokens)
+		})
+	failOnError(err, "error while loading static tokens")
+	log.Infof("loaded %d static tokens from %s", len(set.Load()), config.StaticTokenFile)
+	return set
+}
+
+//loadJWTKeys loads the keys of the JWKS file and of the PEM directory
+//of config
+func loadJWTKeys(config *configs.Config) []router.JWTKey {
+	var keys []router.JWTKey
+	if config.JWTJWKSPath != "" {
+		jwksKeys, err := router.LoadJWKS(config.JWTJWKSPath)
+		failOnError(err, "error while loading JWKS")
+		keys = append(keys, jwksKeys...)
+	}
+	if config.JWTPEMDir != "" {
+		pemKeys, err := router.LoadPEMKeys(config.JWTPEMDir)
+		failOnError(err, "error while loading PEM keys")
+		keys = append(keys, pemKeys...)
+	}
+	if len(keys) == 0 {
+		log.Warn("no JWT keys were loaded, every JWT will be rejected")
+		return keys
+	}
+	log.Infof("loaded %d JWT keys", len(keys))
+	return keys
+}
+
+func loadData(config *configs.Config, iceCreamStore models.IceCreamStore,
+	ingredientStore models.IngredientStore) {
+	fieldMapping := config.LoadDataFieldMapping
+	if fieldMapping == nil {
+		fieldMapping = scripts.DefaultFieldMapping
+	}
+
+	summary, err := scripts.LoadData(context.Background(), iceCreamStore, scripts.Config{
+		Path:            config.LoadDataPath,
+		FieldMapping:    fieldMapping,
+		DryRun:          config.LoadDataDryRun,
+		IngredientStore: ingredientStore,
+	})
+	failOnError(err, "error while loading ice cream initial data")
+
+	for _, name := range summary.Inserted {
+		log.WithField("name", name).Debug("ice cream inserted")
+	}
+	for _, row := range summary.Updated {
+		for _, field := range row.Fields {
+			log.WithField("name", row.Name).Infof("%s changed from %v to %v", field.Field, field.Old, field.New)
+		}
+	}
+	for _, row := range summary.Skipped {
+		entry := log.WithFields(log.Fields{"index": row.Index, "name": row.Name})
+		if row.Reason == scripts.ReasonUnchanged {
+			entry.Debug("ice cream unchanged")
+			continue
+		}
+		entry.Warnf("ice cream skipped : %s", row.Reason)
+	}
+
+	if summary.DryRun {
+		log.Infof("dry run of loading %s : %s", config.LoadDataPath, summary)
+		return
+	}
+	log.Infof("loaded %s : %s", config.LoadDataPath, summary)
+}
+
+func newCachedIceCreamStore(config *configs.Config, store models.IceCreamStore) models.IceCreamStore {
+	redisOptions, err := redis.ParseURL(config.RedisURL)
+	failOnError(err, "error while parsing redis url")
+	redisOptions.DialTimeout = config.RedisTimeout
+	redisOptions.ReadTimeout = config.RedisTimeout
+	redisOptions.WriteTimeout = config.RedisTimeout
+
+	redisClient := redis.NewClient(redisOptions)
+	if err := redisClient.Ping().Err(); err != nil {
+		log.Warnf("redis is unreachable, reads will go to the store until it is back : %s", err)
+	}
+
+	return cache.NewIceCreamStore(store, cache.NewRedisClient(redisClient), cache.Config{
+		KeyPrefix: serviceName + ":",
+		TTL:       config.CacheTTL,
+		ListTTL:   config.CacheListTTL,
+	})
+}
+
 func setupLog(logLevel, logFormat string) {
 	setLogLevel(logLevel)
 	setLogFormat(logFormat)
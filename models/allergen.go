@@ -0,0 +1,244 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+)
+
+//The major food allergens, named as they are in free_from queries
+const (
+	AllergenMilk      = "milk"
+	AllergenEggs      = "eggs"
+	AllergenFish      = "fish"
+	AllergenShellfish = "shellfish"
+	AllergenTreeNuts  = "tree_nuts"
+	AllergenPeanuts   = "peanuts"
+	AllergenWheat     = "wheat"
+	AllergenSoy       = "soy"
+	AllergenSesame    = "sesame"
+)
+
+//The inconsistencies between the allergy info and the ingredients of an
+//ice cream
+const (
+	//IssueUndeclared is an allergen of the ingredients that the
+	//allergy info does not mention
+	IssueUndeclared = "undeclared"
+	//IssueDeclaredMayContain is an allergen of the ingredients that the
+	//allergy info only says the ice cream may contain
+	IssueDeclaredMayContain = "declared_as_may_contain"
+	//IssueNotInIngredients is an allergen the allergy info says the ice
+	//cream contains while none of its ingredients does
+	IssueNotInIngredients = "not_in_ingredients"
+)
+
+//Allergens is the structured form of the allergy info of an ice cream.
+//Contains and MayContain hold allergen names, in the order of
+//allergenRules
+type Allergens struct {
+	Contains        []string                `json:"contains"`
+	MayContain      []string                `json:"may_contain"`
+	Inconsistencies []AllergenInconsistency `json:"inconsistencies,omitempty"`
+}
+
+//AllergenInconsistency flags an allergen on which the allergy info and
+//the ingredients of an ice cream disagree
+type AllergenInconsistency struct {
+	Allergen string `json:"allergen"`
+	Issue    string `json:"issue"`
+}
+
+//allergenRule tells the words an allergen is recognized by, in allergy
+//info as well as in ingredient names. Plurals are matched as well.
+//Phrases in excludes never count, like cocoa butter for milk
+type allergenRule struct {
+	allergen string
+	words    []string
+	excludes []string
+}
+
+//allergenRules is the dictionary allergens are derived with, in the
+//order allergens are listed in
+var allergenRules = []allergenRule{
+	{
+		allergen: AllergenMilk,
+		words: []string{"milk", "cream", "butter", "buttermilk", "butteroil", "milkfat", "whey", "cheese",
+			"casein", "caseinate", "lactose", "yogurt", "dairy"},
+		excludes: []string{"cocoa butter", "peanut butter", "nut butter", "shea butter", "coconut milk",
+			"coconut cream", "almond milk", "oat milk", "rice milk", "soy milk", "cream of tartar", "ice cream"},
+	},
+	{allergen: AllergenEggs, words: []string{"egg"}},
+	{allergen: AllergenFish, words: []string{"fish", "anchovy", "anchovies", "cod", "salmon", "tuna"}},
+	{allergen: AllergenShellfish, words: []string{"shellfish", "shrimp", "prawn", "crab", "lobster", "crayfish"}},
+	{
+		allergen: AllergenTreeNuts,
+		words: []string{"tree nut", "almond", "pecan", "walnut", "cashew", "hazelnut", "pistachio",
+			"macadamia", "brazil nut", "pine nut", "praline"},
+	},
+	{allergen: AllergenPeanuts, words: []string{"peanut"}},
+	{allergen: AllergenWheat, words: []string{"wheat", "graham", "spelt", "semolina", "durum", "farro"}},
+	{allergen: AllergenSoy, words: []string{"soy", "soya", "soybean"}},
+	{allergen: AllergenSesame, words: []string{"sesame", "tahini"}},
+}
+
+//allergenMatcher is the compiled form of an allergenRule. The first
+//group of words tells whether the allergen was preceded by "other"
+type allergenMatcher struct {
+	allergen string
+	words    *regexp.Regexp
+	excludes []string
+}
+
+var allergenMatchers = compileAllergenRules(allergenRules)
+
+func compileAllergenRules(rules []allergenRule) []allergenMatcher {
+	matchers := make([]allergenMatcher, 0, len(rules))
+	for _, rule := range rules {
+		words := make([]string, 0, len(rule.words))
+		for _, word := range rule.words {
+			words = append(words, regexp.QuoteMeta(word))
+		}
+		matchers = append(matchers, allergenMatcher{
+			allergen: rule.allergen,
+			words:    regexp.MustCompile(`\b(other\s+)?(?:` + strings.Join(words, "|") + `)(?:s|es)?\b`),
+			excludes: rule.excludes,
+		})
+	}
+	return matchers
+}
+
+//IsAllergen reports whether name is one of the allergens of the
+//dictionary
+func IsAllergen(name string) bool {
+	for _, rule := range allergenRules {
+		if rule.allergen == name {
+			return true
+		}
+	}
+	return false
+}
+
+//AllergenNames lists the allergens of the dictionary
+func AllergenNames() []string {
+	names := make([]string, 0, len(allergenRules))
+	for _, rule := range allergenRules {
+		names = append(names, rule.allergen)
+	}
+	return names
+}
+
+//allergenSet is a set of allergen names
+type allergenSet map[string]bool
+
+//match adds the allergens mentioned in text to the set. Allergens
+//preceded by "other", like "may contain other tree nuts", say the ice
+//cream holds some of them and are added to others too. Negated
+//mentions, like "peanut free" or "non-dairy", are left out
+func (a allergenSet) match(text string, others allergenSet) {
+	text = strings.ToLower(text)
+	for _, matcher := range allergenMatchers {
+		cleaned := text
+		for _, exclude := range matcher.excludes {
+			cleaned = strings.Replace(cleaned, exclude, " ", -1)
+		}
+		for _, match := range matcher.words.FindAllStringSubmatchIndex(cleaned, -1) {
+			before, after := cleaned[:match[0]], cleaned[match[1]:]
+			if strings.HasSuffix(before, "non-") || strings.HasSuffix(before, "non ") ||
+				strings.HasPrefix(after, "-free") || strings.HasPrefix(after, " free") {
+				continue
+			}
+			a[matcher.allergen] = true
+			if match[2] >= 0 && others != nil {
+				others[matcher.allergen] = true
+			}
+		}
+	}
+}
+
+//list returns the allergens of the set in dictionary order
+func (a allergenSet) list() []string {
+	names := []string{}
+	for _, rule := range allergenRules {
+		if a[rule.allergen] {
+			names = append(names, rule.allergen)
+		}
+	}
+	return names
+}
+
+//parseAllergyInfo reads the allergens allergy info says an ice cream
+//contains and may contain. Text is read a sentence at a time: what
+//follows "may contain" is only possibly there, the rest is contained,
+//and explanations after "because" are left out
+func parseAllergyInfo(allergyInfo string) (contains, mayContain allergenSet) {
+	contains, mayContain = allergenSet{}, allergenSet{}
+	sentences := strings.FieldsFunc(strings.ToLower(allergyInfo), func(r rune) bool {
+		return r == '.' || r == ';' || r == '\n'
+	})
+	for _, sentence := range sentences {
+		if index := strings.Index(sentence, "because"); index >= 0 {
+			sentence = sentence[:index]
+		}
+		if index := strings.Index(sentence, "may contain"); index >= 0 {
+			mayContain.match(sentence[index:], contains)
+			sentence = sentence[:index]
+		}
+		contains.match(sentence, nil)
+	}
+	return contains, mayContain
+}
+
+//DeriveAllergens returns a copy of the ice cream with its Allergens
+//derived from AllergyInfo and the ingredients of its IngredientTree,
+//which should be normalized first. Stores derive the allergens of every
+//ice cream they write
+func (i IceCream) DeriveAllergens() IceCream {
+	contains, mayContain := parseAllergyInfo(i.AllergyInfo)
+	inIngredients := allergenSet{}
+	for _, name := range IngredientNames(i.IngredientTree) {
+		inIngredients.match(name, nil)
+	}
+
+	allergens := &Allergens{}
+	for _, rule := range allergenRules {
+		allergen := rule.allergen
+		switch {
+		case inIngredients[allergen] && !contains[allergen] && !mayContain[allergen]:
+			allergens.Inconsistencies = append(allergens.Inconsistencies,
+				AllergenInconsistency{Allergen: allergen, Issue: IssueUndeclared})
+		case inIngredients[allergen] && !contains[allergen]:
+			allergens.Inconsistencies = append(allergens.Inconsistencies,
+				AllergenInconsistency{Allergen: allergen, Issue: IssueDeclaredMayContain})
+		//without ingredients there is nothing to hold the allergy info against
+		case contains[allergen] && !inIngredients[allergen] && len(i.IngredientTree) > 0:
+			allergens.Inconsistencies = append(allergens.Inconsistencies,
+				AllergenInconsistency{Allergen: allergen, Issue: IssueNotInIngredients})
+		}
+		if inIngredients[allergen] {
+			contains[allergen] = true
+		}
+		if contains[allergen] {
+			delete(mayContain, allergen)
+		}
+	}
+	allergens.Contains = contains.list()
+	allergens.MayContain = mayContain.list()
+	i.Allergens = allergens
+	return i
+}
+
+//FreeFrom reports whether the allergens are known and hold none of
+//names, neither as contained nor as possibly contained
+func (a *Allergens) FreeFrom(names []string) bool {
+	if a == nil {
+		return false
+	}
+	for _, name := range names {
+		for _, allergen := range append(append([]string{}, a.Contains...), a.MayContain...) {
+			if allergen == name {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DeriveAllergens(t *testing.T) {
+	var tests = []struct {
+		desc        string
+		allergyInfo string
+		ingredients []string
+		expected    *Allergens
+	}{
+		{
+			desc:     "an ice cream without allergy info nor ingredients holds no allergens",
+			expected: &Allergens{Contains: []string{}, MayContain: []string{}},
+		},
+		{
+			desc:        "declared allergens are listed in dictionary order",
+			allergyInfo: "contains soy, wheat, eggs and milk",
+			expected:    &Allergens{Contains: []string{"milk", "eggs", "wheat", "soy"}, MayContain: []string{}},
+		},
+		{
+			desc: "explanations after because are left out",
+			allergyInfo: "may contain wheat and tree nuts because the peanut butter cups are made on " +
+				"equipment that also processes wheat and tree nuts",
+			expected: &Allergens{Contains: []string{}, MayContain: []string{"tree_nuts", "wheat"}},
+		},
+		{
+			desc:        "other allergens are contained as well",
+			allergyInfo: "may contain peanuts and other tree nuts",
+			ingredients: []string{"cream", "almonds"},
+			expected: &Allergens{
+				Contains:   []string{"milk", "tree_nuts"},
+				MayContain: []string{"peanuts"},
+				Inconsistencies: []AllergenInconsistency{
+					{Allergen: AllergenMilk, Issue: IssueUndeclared},
+				},
+			},
+		},
+		{
+			desc:        "allergens of the ingredients are checked against the allergy info",
+			allergyInfo: "contains milk and soy. may contain peanuts",
+			ingredients: []string{"skim milk", "fudge (sugar", "cocoa butter", "egg yolks)", "peanut butter"},
+			expected: &Allergens{
+				Contains:   []string{"milk", "eggs", "peanuts", "soy"},
+				MayContain: []string{},
+				Inconsistencies: []AllergenInconsistency{
+					{Allergen: AllergenEggs, Issue: IssueUndeclared},
+					{Allergen: AllergenPeanuts, Issue: IssueDeclaredMayContain},
+					{Allergen: AllergenSoy, Issue: IssueNotInIngredients},
+				},
+			},
+		},
+		{
+			desc:        "negated mentions are left out",
+			allergyInfo: "peanut free",
+			ingredients: []string{"coconut milk", "non-dairy creamer", "sugar"},
+			expected:    &Allergens{Contains: []string{}, MayContain: []string{}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			iceCream := IceCream{AllergyInfo: test.allergyInfo, Ingredients: test.ingredients}
+			assert.Equal(t, test.expected, iceCream.NormalizeIngredients().DeriveAllergens().Allergens)
+		})
+	}
+}
+
+func Test_AllergensFreeFrom(t *testing.T) {
+	allergens := &Allergens{Contains: []string{"milk"}, MayContain: []string{"peanuts"}}
+	assert.True(t, allergens.FreeFrom([]string{"eggs", "tree_nuts"}))
+	assert.False(t, allergens.FreeFrom([]string{"eggs", "milk"}))
+	assert.False(t, allergens.FreeFrom([]string{"peanuts"}))
+
+	var underived *Allergens
+	assert.False(t, underived.FreeFrom([]string{"eggs"}))
+}
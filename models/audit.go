@@ -0,0 +1,33 @@
+package models
+
+import "context"
+
+type actorKey struct{}
+
+type requestIDKey struct{}
+
+//ContextWithActor returns a copy of ctx recording who is making the
+//changes, stores use it to audit writes
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+//ActorFromContext returns the actor recorded by ContextWithActor or
+//an empty string if there is none
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+//ContextWithRequestID returns a copy of ctx recording the id of the
+//request the changes are made for
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+//RequestIDFromContext returns the id recorded by ContextWithRequestID
+//or an empty string if there is none
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+//ErrMiss is returned by Client.Get when the key is not cached
+var ErrMiss = errors.New("cache miss")
+
+//Client is the subset of redis commands the cache relies on.
+//It lets the cache run against anything that speaks the same semantics
+type Client interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Del(keys ...string) error
+	Incr(key string) (int64, error)
+}
+
+type redisClient struct {
+	client *redis.Client
+}
+
+//NewRedisClient adapts a redis client to Client
+func NewRedisClient(client *redis.Client) Client {
+	return &redisClient{client: client}
+}
+
+func (r *redisClient) Get(key string) ([]byte, error) {
+	value, err := r.client.Get(key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrMiss
+	}
+	return value, err
+}
+
+func (r *redisClient) Set(key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(key, value, ttl).Err()
+}
+
+func (r *redisClient) Del(keys ...string) error {
+	return r.client.Del(keys...).Err()
+}
+
+func (r *redisClient) Incr(key string) (int64, error) {
+	return r.client.Incr(key).Result()
+}
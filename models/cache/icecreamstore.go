@@ -0,0 +1,322 @@
+//Package cache holds read-through caching decorators for the models stores.
+//Caching is best effort: whenever the cache cannot be reached the
+//decorators log the error and fall back to the store they wrap
+package cache
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+const (
+	iceCreamKeyPrefix = "icecream:"
+	//listings are keyed by a generation that is bumped on every write
+	//so a single INCR invalidates every cached page at once
+	listGenerationKey = "icecreams:generation"
+	listKeyPrefix     = "icecreams:"
+)
+
+//Config holds the settings of the caching decorators
+type Config struct {
+	//KeyPrefix namespaces every key written by the cache
+	KeyPrefix string
+	//TTL is how long a single IceCream is cached for
+	TTL time.Duration
+	//ListTTL is how long a page of a listing is cached for
+	ListTTL time.Duration
+}
+
+//pendingKey is the context key under which a transaction keeps the
+//names it changed, to invalidate them once it commits
+type pendingKey struct{}
+
+type pending struct {
+	mu    sync.Mutex
+	names []string
+}
+
+//entry is the cached form of an IceCream. It carries the fields
+//that are left out of the json form of IceCream
+type entry struct {
+	IceCream models.IceCream
+	Version  int64
+}
+
+func newEntry(iceCream models.IceCream) entry {
+	return entry{IceCream: iceCream, Version: iceCream.Version}
+}
+
+func (e entry) iceCream() *models.IceCream {
+	iceCream := e.IceCream
+	iceCream.Version = e.Version
+	return &iceCream
+}
+
+//pageEntry is the cached form of an IceCreamPage
+type pageEntry struct {
+	Entries    []entry
+	NextCursor string
+	PrevCursor string
+}
+
+func newPageEntry(page *models.IceCreamPage) pageEntry {
+	cached := pageEntry{
+		Entries:    make([]entry, 0, len(page.IceCreams)),
+		NextCursor: page.NextCursor,
+		PrevCursor: page.PrevCursor,
+	}
+	for _, iceCream := range page.IceCreams {
+		cached.Entries = append(cached.Entries, newEntry(iceCream))
+	}
+	return cached
+}
+
+func (p pageEntry) page() *models.IceCreamPage {
+	page := &models.IceCreamPage{
+		IceCreams:  make([]models.IceCream, 0, len(p.Entries)),
+		NextCursor: p.NextCursor,
+		PrevCursor: p.PrevCursor,
+	}
+	for _, cached := range p.Entries {
+		page.IceCreams = append(page.IceCreams, *cached.iceCream())
+	}
+	return page
+}
+
+type iceCreamStore struct {
+	models.IceCreamStore
+	client Client
+	cfg    Config
+}
+
+//NewIceCreamStore wraps store with a read-through cache of Get and
+//GetAll results kept in client
+func NewIceCreamStore(store models.IceCreamStore, client Client, cfg Config) models.IceCreamStore {
+	return &iceCreamStore{
+		IceCreamStore: store,
+		client:        client,
+		cfg:           cfg,
+	}
+}
+
+//WithTxContext defers the invalidations of writes done within the
+//transaction until it commits. Nothing is invalidated on rollback. When
+//ctx already holds a transaction f joins it, and its writes are
+//invalidated once that one commits
+func (i *iceCreamStore) WithTxContext(ctx context.Context, f func(context.Context) error) error {
+	if inTransaction(ctx) {
+		return i.IceCreamStore.WithTxContext(ctx, f)
+	}
+	changes := &pending{}
+	err := i.IceCreamStore.WithTxContext(context.WithValue(ctx, pendingKey{}, changes), f)
+	if err != nil {
+		return err
+	}
+	i.invalidate(changes.names...)
+	return nil
+}
+
+func (i *iceCreamStore) StoreContext(ctx context.Context, iceCreamInput models.IceCream) error {
+	if err := i.IceCreamStore.StoreContext(ctx, iceCreamInput); err != nil {
+		return err
+	}
+	i.changed(ctx, iceCreamInput.Name)
+	return nil
+}
+
+//Get reads through the cache, unless ctx holds a transaction whose
+//uncommitted changes must neither be hidden nor cached
+func (i *iceCreamStore) Get(ctx context.Context, name string) (*models.IceCream, error) {
+	if inTransaction(ctx) {
+		return i.IceCreamStore.Get(ctx, name)
+	}
+	key := i.cfg.KeyPrefix + iceCreamKeyPrefix + name
+
+	var cached entry
+	if i.load(key, &cached) {
+		return cached.iceCream(), nil
+	}
+
+	iceCream, err := i.IceCreamStore.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	i.save(key, newEntry(*iceCream), i.cfg.TTL)
+	return iceCream, nil
+}
+
+//GetAll reads through the cache like Get
+func (i *iceCreamStore) GetAll(ctx context.Context, filter models.IceCreamFilter, pageSize int,
+	cursor string) (*models.IceCreamPage, error) {
+	if inTransaction(ctx) {
+		return i.IceCreamStore.GetAll(ctx, filter, pageSize, cursor)
+	}
+	key, cacheable := i.listKey(filter, pageSize, cursor)
+
+	var cached pageEntry
+	if cacheable && i.load(key, &cached) {
+		return cached.page(), nil
+	}
+
+	page, err := i.IceCreamStore.GetAll(ctx, filter, pageSize, cursor)
+	if err != nil {
+		return nil, err
+	}
+	if cacheable {
+		i.save(key, newPageEntry(page), i.cfg.ListTTL)
+	}
+	return page, nil
+}
+
+func (i *iceCreamStore) Update(ctx context.Context, iceCreamInput models.IceCream) (*models.IceCream, error) {
+	iceCream, err := i.IceCreamStore.Update(ctx, iceCreamInput)
+	if err != nil {
+		return nil, err
+	}
+	i.changed(ctx, iceCreamInput.Name)
+	return iceCream, nil
+}
+
+func (i *iceCreamStore) Upsert(ctx context.Context,
+	iceCreamInput models.IceCream) (*models.IceCream, bool, error) {
+	iceCream, created, err := i.IceCreamStore.Upsert(ctx, iceCreamInput)
+	if err != nil {
+		return nil, false, err
+	}
+	i.changed(ctx, iceCreamInput.Name)
+	return iceCream, created, nil
+}
+
+func (i *iceCreamStore) Patch(ctx context.Context, name string,
+	patch models.IceCreamPatch) (*models.IceCream, error) {
+	iceCream, err := i.IceCreamStore.Patch(ctx, name, patch)
+	if err != nil {
+		return nil, err
+	}
+	i.changed(ctx, name)
+	return iceCream, nil
+}
+
+func (i *iceCreamStore) Replace(ctx context.Context, iceCreamInput models.IceCream) error {
+	if err := i.IceCreamStore.Replace(ctx, iceCreamInput); err != nil {
+		return err
+	}
+	i.changed(ctx, iceCreamInput.Name)
+	return nil
+}
+
+func (i *iceCreamStore) Delete(ctx context.Context, name string, version int64) error {
+	if err := i.IceCreamStore.Delete(ctx, name, version); err != nil {
+		return err
+	}
+	i.changed(ctx, name)
+	return nil
+}
+
+//Restore invalidates name as it becomes visible again. The trash
+//itself is never cached so GetTrash, GetTrashed and Purge need no
+//invalidation
+func (i *iceCreamStore) Restore(ctx context.Context, name string, version int64) error {
+	if err := i.IceCreamStore.Restore(ctx, name, version); err != nil {
+		return err
+	}
+	i.changed(ctx, name)
+	return nil
+}
+
+func inTransaction(ctx context.Context) bool {
+	_, ok := ctx.Value(pendingKey{}).(*pending)
+	return ok
+}
+
+//changed invalidates name right away, or once the transaction in ctx
+//commits
+func (i *iceCreamStore) changed(ctx context.Context, name string) {
+	if changes, ok := ctx.Value(pendingKey{}).(*pending); ok {
+		changes.mu.Lock()
+		changes.names = append(changes.names, name)
+		changes.mu.Unlock()
+		return
+	}
+	i.invalidate(name)
+}
+
+//invalidate drops the cached ice creams of names along with every
+//cached listing
+func (i *iceCreamStore) invalidate(names ...string) {
+	if len(names) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		keys = append(keys, i.cfg.KeyPrefix+iceCreamKeyPrefix+name)
+	}
+	if err := i.client.Del(keys...); err != nil {
+		log.WithField("keys", keys).Errorf("error invalidating cache: %s", err)
+	}
+	if _, err := i.client.Incr(i.cfg.KeyPrefix + listGenerationKey); err != nil {
+		log.Errorf("error invalidating cached listings: %s", err)
+	}
+}
+
+//listKey builds the key of a listing page out of the current list
+//generation. It returns false when the generation cannot be read
+func (i *iceCreamStore) listKey(filter models.IceCreamFilter, pageSize int, cursor string) (string, bool) {
+	generation := "0"
+	value, err := i.client.Get(i.cfg.KeyPrefix + listGenerationKey)
+	switch err {
+	case nil:
+		generation = string(value)
+	case ErrMiss:
+	default:
+		log.Errorf("error reading cached listings generation: %s", err)
+		return "", false
+	}
+
+	params, err := json.Marshal(filter)
+	if err != nil {
+		return "", false
+	}
+	hash := sha1.Sum([]byte(strings.Join([]string{string(params), strconv.Itoa(pageSize), cursor}, "|")))
+	return fmt.Sprintf("%s%s%s:%s", i.cfg.KeyPrefix, listKeyPrefix, generation, hex.EncodeToString(hash[:])), true
+}
+
+//load reads key into value. It returns false on a miss or when the
+//cache is unreachable
+func (i *iceCreamStore) load(key string, value interface{}) bool {
+	data, err := i.client.Get(key)
+	if err != nil {
+		if err != ErrMiss {
+			log.WithField("key", key).Errorf("error reading from cache: %s", err)
+		}
+		return false
+	}
+
+	if err := json.Unmarshal(data, value); err != nil {
+		log.WithField("key", key).Errorf("error decoding cached value: %s", err)
+		return false
+	}
+	return true
+}
+
+func (i *iceCreamStore) save(key string, value interface{}, ttl time.Duration) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.WithField("key", key).Errorf("error encoding value to cache: %s", err)
+		return
+	}
+	if err := i.client.Set(key, data, ttl); err != nil {
+		log.WithField("key", key).Errorf("error writing to cache: %s", err)
+	}
+}
@@ -0,0 +1,205 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+	"github.com/sudarshan-reddy/benjerry/models/memory"
+	"github.com/sudarshan-reddy/benjerry/models/storetest"
+)
+
+//fakeClient is a local stand-in for redis. TTLs are ignored
+type fakeClient struct {
+	mu      sync.Mutex
+	values  map[string][]byte
+	deleted []string
+	err     error
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{values: map[string][]byte{}}
+}
+
+func (f *fakeClient) Get(key string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	value, ok := f.values[key]
+	if !ok {
+		return nil, ErrMiss
+	}
+	return value, nil
+}
+
+func (f *fakeClient) Set(key string, value []byte, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.values[key] = value
+	return nil
+}
+
+func (f *fakeClient) Del(keys ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	for _, key := range keys {
+		delete(f.values, key)
+		f.deleted = append(f.deleted, key)
+	}
+	return nil
+}
+
+func (f *fakeClient) Incr(key string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return 0, f.err
+	}
+	value, _ := strconv.ParseInt(string(f.values[key]), 10, 64)
+	value++
+	f.values[key] = []byte(strconv.FormatInt(value, 10))
+	return value, nil
+}
+
+//countingStore counts the reads that reach the wrapped store
+type countingStore struct {
+	models.IceCreamStore
+	gets, lists int
+}
+
+func (c *countingStore) Get(ctx context.Context, name string) (*models.IceCream, error) {
+	c.gets++
+	return c.IceCreamStore.Get(ctx, name)
+}
+
+func (c *countingStore) GetAll(ctx context.Context, filter models.IceCreamFilter, pageSize int,
+	cursor string) (*models.IceCreamPage, error) {
+	c.lists++
+	return c.IceCreamStore.GetAll(ctx, filter, pageSize, cursor)
+}
+
+var testConfig = Config{KeyPrefix: "test:", TTL: time.Minute, ListTTL: time.Minute}
+
+func Test_IceCreamStoreConformance(t *testing.T) {
+	storetest.RunIceCreamStoreTests(t, func(t *testing.T) models.IceCreamStore {
+		return NewIceCreamStore(memory.NewIceCreamStore(), newFakeClient(), testConfig)
+	})
+}
+
+func Test_IceCreamStoreConformanceWithUnreachableCache(t *testing.T) {
+	storetest.RunIceCreamStoreTests(t, func(t *testing.T) models.IceCreamStore {
+		client := &fakeClient{err: errors.New("dial tcp: connection refused")}
+		return NewIceCreamStore(memory.NewIceCreamStore(), client, testConfig)
+	})
+}
+
+func Test_ReadThrough(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	underlying := &countingStore{IceCreamStore: memory.NewIceCreamStore()}
+	store := NewIceCreamStore(underlying, newFakeClient(), testConfig)
+	assert.NoError(store.StoreContext(ctx, models.IceCream{Name: "Chocobar", Story: "old"}))
+
+	for i := 0; i < 3; i++ {
+		iceCream, err := store.Get(ctx, "Chocobar")
+		assert.NoError(err)
+		assert.Equal("old", iceCream.Story)
+		assert.Equal(int64(1), iceCream.Version)
+		page, err := store.GetAll(ctx, models.IceCreamFilter{}, 10, "")
+		assert.NoError(err)
+		assert.Equal(int64(1), page.IceCreams[0].Version)
+	}
+	assert.Equal(1, underlying.gets)
+	assert.Equal(1, underlying.lists)
+
+	_, err := store.Update(context.Background(), models.IceCream{Name: "Chocobar", Story: "new"})
+	assert.NoError(err)
+	iceCream, err := store.Get(ctx, "Chocobar")
+	assert.NoError(err)
+	assert.Equal("new", iceCream.Story)
+	page, err := store.GetAll(ctx, models.IceCreamFilter{}, 10, "")
+	assert.NoError(err)
+	assert.Equal("new", page.IceCreams[0].Story)
+	assert.Equal(2, underlying.gets)
+	assert.Equal(2, underlying.lists)
+
+	//different filters are cached separately
+	_, err = store.GetAll(ctx, models.IceCreamFilter{DietaryCertification: "Kosher"}, 10, "")
+	assert.NoError(err)
+	assert.Equal(3, underlying.lists)
+
+	assert.NoError(store.Delete(context.Background(), "Chocobar", 0))
+	_, err = store.Get(ctx, "Chocobar")
+	assert.Equal(models.ErrNoRows, err)
+}
+
+func Test_TransactionInvalidation(t *testing.T) {
+	var tests = []struct {
+		desc            string
+		txErr           error
+		expectedDeleted []string
+	}{
+		{
+			desc:            "a committed transaction invalidates what it changed",
+			expectedDeleted: []string{"test:icecream:Chocobar", "test:icecream:Vanilla"},
+		},
+		{
+			desc:  "a rolled back transaction invalidates nothing",
+			txErr: errors.New("failed midway"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			client := newFakeClient()
+			store := NewIceCreamStore(memory.NewIceCreamStore(), client, testConfig)
+
+			err := store.WithTxContext(context.Background(), func(ctx context.Context) error {
+				for _, name := range []string{"Chocobar", "Vanilla"} {
+					if err := store.StoreContext(ctx, models.IceCream{Name: name}); err != nil {
+						return err
+					}
+				}
+				assert.Empty(client.deleted, "nothing is invalidated before commit")
+				return test.txErr
+			})
+			assert.Equal(test.txErr, err)
+			assert.Equal(test.expectedDeleted, client.deleted)
+		})
+	}
+}
+
+func Test_NestedTransactionInvalidation(t *testing.T) {
+	assert := assert.New(t)
+	client := newFakeClient()
+	store := NewIceCreamStore(memory.NewIceCreamStore(), client, testConfig)
+
+	err := store.WithTxContext(context.Background(), func(ctx context.Context) error {
+		err := store.WithTxContext(ctx, func(ctx context.Context) error {
+			return store.StoreContext(ctx, models.IceCream{Name: "Chocobar"})
+		})
+		if err != nil {
+			return err
+		}
+		//a read now would cache the row the outer transaction has yet
+		//to commit if the nested one had invalidated it
+		assert.Empty(client.deleted, "nothing is invalidated before the outer transaction commits")
+		return store.StoreContext(ctx, models.IceCream{Name: "Vanilla"})
+	})
+	assert.NoError(err)
+	assert.Equal([]string{"test:icecream:Chocobar", "test:icecream:Vanilla"}, client.deleted)
+}
@@ -0,0 +1,84 @@
+//Package canonical holds decorators writing the ingredients of ice
+//creams under the names they are registered with, so an ingredient
+//listed under any of its synonyms is only ever stored one way
+package canonical
+
+import (
+	"context"
+
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+type iceCreamStore struct {
+	models.IceCreamStore
+	ingredientStore models.IngredientStore
+}
+
+//NewIceCreamStore wraps store so the ingredients of every ice cream
+//written are renamed after the ingredients of ingredientStore. Ice
+//creams already stored are left as they are until they are written
+func NewIceCreamStore(store models.IceCreamStore, ingredientStore models.IngredientStore) models.IceCreamStore {
+	return &iceCreamStore{
+		IceCreamStore:   store,
+		ingredientStore: ingredientStore,
+	}
+}
+
+//canonicalize renames the ingredients of iceCream. An ice cream without
+//ingredients, which partial updates leave untouched, is returned as is
+func (i *iceCreamStore) canonicalize(ctx context.Context, iceCream models.IceCream) (models.IceCream, error) {
+	if iceCream.Ingredients == nil {
+		return iceCream, nil
+	}
+	iceCream = iceCream.NormalizeIngredients()
+	canonical, err := i.ingredientStore.CanonicalNames(ctx, models.IngredientNames(iceCream.IngredientTree))
+	if err != nil {
+		return iceCream, err
+	}
+	return iceCream.CanonicalizeIngredients(canonical), nil
+}
+
+func (i *iceCreamStore) StoreContext(ctx context.Context, iceCreamInput models.IceCream) error {
+	iceCreamInput, err := i.canonicalize(ctx, iceCreamInput)
+	if err != nil {
+		return err
+	}
+	return i.IceCreamStore.StoreContext(ctx, iceCreamInput)
+}
+
+func (i *iceCreamStore) Update(ctx context.Context, iceCreamInput models.IceCream) (*models.IceCream, error) {
+	iceCreamInput, err := i.canonicalize(ctx, iceCreamInput)
+	if err != nil {
+		return nil, err
+	}
+	return i.IceCreamStore.Update(ctx, iceCreamInput)
+}
+
+func (i *iceCreamStore) Replace(ctx context.Context, iceCreamInput models.IceCream) error {
+	iceCreamInput, err := i.canonicalize(ctx, iceCreamInput)
+	if err != nil {
+		return err
+	}
+	return i.IceCreamStore.Replace(ctx, iceCreamInput)
+}
+
+func (i *iceCreamStore) Upsert(ctx context.Context,
+	iceCreamInput models.IceCream) (*models.IceCream, bool, error) {
+	iceCreamInput, err := i.canonicalize(ctx, iceCreamInput)
+	if err != nil {
+		return nil, false, err
+	}
+	return i.IceCreamStore.Upsert(ctx, iceCreamInput)
+}
+
+func (i *iceCreamStore) Patch(ctx context.Context, name string,
+	patch models.IceCreamPatch) (*models.IceCream, error) {
+	if patch.Ingredients != nil {
+		iceCream, err := i.canonicalize(ctx, models.IceCream{Ingredients: *patch.Ingredients})
+		if err != nil {
+			return nil, err
+		}
+		patch.Ingredients = &iceCream.Ingredients
+	}
+	return i.IceCreamStore.Patch(ctx, name, patch)
+}
@@ -0,0 +1,121 @@
+package canonical
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+	"github.com/sudarshan-reddy/benjerry/models/memory"
+	"github.com/sudarshan-reddy/benjerry/models/storetest"
+)
+
+//failingRegistry fails every lookup
+type failingRegistry struct {
+	models.IngredientStore
+}
+
+func (failingRegistry) CanonicalNames(ctx context.Context, names []string) (map[string]string, error) {
+	return nil, errors.New("registry unreachable")
+}
+
+func newStores(t *testing.T) (models.IceCreamStore, models.IngredientStore) {
+	ingredientStore := memory.NewIngredientStore()
+	err := ingredientStore.StoreIngredient(context.Background(), models.RegisteredIngredient{
+		Name:     "skim milk",
+		Synonyms: []string{"nonfat milk", "skimmed milk"},
+	})
+	if err != nil {
+		t.Fatalf("registering skim milk: %s", err)
+	}
+	return NewIceCreamStore(memory.NewIceCreamStore(), ingredientStore), ingredientStore
+}
+
+func Test_IceCreamStoreWrites(t *testing.T) {
+	expected := []string{"cream", "skim milk", "fudge (skim milk, cocoa)"}
+	var tests = []struct {
+		desc     string
+		existing bool
+		write    func(ctx context.Context, store models.IceCreamStore, ingredients []string) error
+	}{
+		{
+			desc: "stored ice creams use canonical names",
+			write: func(ctx context.Context, store models.IceCreamStore, ingredients []string) error {
+				return store.StoreContext(ctx, models.IceCream{Name: "a", Ingredients: ingredients})
+			},
+		},
+		{
+			desc:     "updated ice creams use canonical names",
+			existing: true,
+			write: func(ctx context.Context, store models.IceCreamStore, ingredients []string) error {
+				_, err := store.Update(ctx, models.IceCream{Name: "a", Ingredients: ingredients})
+				return err
+			},
+		},
+		{
+			desc:     "replaced ice creams use canonical names",
+			existing: true,
+			write: func(ctx context.Context, store models.IceCreamStore, ingredients []string) error {
+				return store.Replace(ctx, models.IceCream{Name: "a", Ingredients: ingredients})
+			},
+		},
+		{
+			desc:     "upserted ice creams use canonical names",
+			existing: true,
+			write: func(ctx context.Context, store models.IceCreamStore, ingredients []string) error {
+				_, _, err := store.Upsert(ctx, models.IceCream{Name: "a", Ingredients: ingredients})
+				return err
+			},
+		},
+		{
+			desc:     "patched ice creams use canonical names",
+			existing: true,
+			write: func(ctx context.Context, store models.IceCreamStore, ingredients []string) error {
+				_, err := store.Patch(ctx, "a", models.IceCreamPatch{Ingredients: &ingredients})
+				return err
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			ctx := context.Background()
+			store, _ := newStores(t)
+			if test.existing {
+				assert.NoError(store.StoreContext(ctx, models.IceCream{Name: "a"}))
+			}
+
+			err := test.write(ctx, store, []string{"cream", "Nonfat Milk", "fudge (skimmed milk", "cocoa)"})
+			assert.NoError(err)
+			iceCream, err := store.Get(ctx, "a")
+			assert.NoError(err)
+			assert.Equal(expected, iceCream.Ingredients)
+			assert.Equal(models.ParseIngredients(expected), iceCream.IngredientTree)
+		})
+	}
+}
+
+func Test_IceCreamStoreRegistryError(t *testing.T) {
+	assert := assert.New(t)
+	store := NewIceCreamStore(memory.NewIceCreamStore(), failingRegistry{})
+	ctx := context.Background()
+
+	err := store.StoreContext(ctx, models.IceCream{Name: "a", Ingredients: []string{"cream"}})
+	assert.EqualError(err, "registry unreachable")
+	_, err = store.Get(ctx, "a")
+	assert.Equal(models.ErrNoRows, err)
+
+	//writes leaving the ingredients alone do not need the registry
+	assert.NoError(store.StoreContext(ctx, models.IceCream{Name: "a"}))
+	_, err = store.Update(ctx, models.IceCream{Name: "a", Story: "updated"})
+	assert.NoError(err)
+}
+
+func Test_IceCreamStoreConformance(t *testing.T) {
+	storetest.RunIceCreamStoreTests(t, func(t *testing.T) models.IceCreamStore {
+		store, _ := newStores(t)
+		return store
+	})
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	//DefaultPageSize is the page size used when the caller does not ask for one
+	DefaultPageSize = 20
+	//MaxPageSize caps the number of rows a single page can hold
+	MaxPageSize = 100
+
+	cursorForward  = "n"
+	cursorBackward = "p"
+)
+
+//Cursor is the decoded form of the opaque pagination cursor.
+//Position is the value of the `cursor` column the page starts after
+//(or before, when Backward is set)
+type Cursor struct {
+	Position int64
+	Backward bool
+}
+
+//Encode returns the opaque string form of the cursor
+func (c Cursor) Encode() string {
+	direction := cursorForward
+	if c.Backward {
+		direction = cursorBackward
+	}
+	raw := fmt.Sprintf("%s:%d", direction, c.Position)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+//DecodeCursor parses an opaque cursor. An empty string yields the
+//cursor for the first page
+func DecodeCursor(cursor string) (Cursor, error) {
+	if cursor == "" {
+		return Cursor{}, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	position, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || position < 0 {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	switch parts[0] {
+	case cursorForward:
+		return Cursor{Position: position}, nil
+	case cursorBackward:
+		return Cursor{Position: position, Backward: true}, nil
+	default:
+		return Cursor{}, ErrInvalidCursor
+	}
+}
+
+//paginate trims rows fetched in the direction of cursor down to
+//pageSize, puts them back in ascending order through swap and returns
+//the number of rows to keep along with the cursors of the neighbouring
+//pages. positions holds the `cursor` value of each row and is
+//reordered along with the rows
+func paginate(cursor Cursor, pageSize int, positions []int64, swap func(l, r int)) (int, string, string) {
+	hasMore := len(positions) > pageSize
+	if hasMore {
+		positions = positions[:pageSize]
+	}
+
+	if cursor.Backward {
+		for l, r := 0, len(positions)-1; l < r; l, r = l+1, r-1 {
+			positions[l], positions[r] = positions[r], positions[l]
+			swap(l, r)
+		}
+	}
+
+	if len(positions) == 0 {
+		return 0, "", ""
+	}
+
+	var next, prev string
+	first, last := positions[0], positions[len(positions)-1]
+	if cursor.Backward {
+		//we came from a later page, so there is always a next one
+		next = Cursor{Position: last}.Encode()
+		if hasMore {
+			prev = Cursor{Position: first, Backward: true}.Encode()
+		}
+		return len(positions), next, prev
+	}
+
+	if hasMore {
+		next = Cursor{Position: last}.Encode()
+	}
+	if cursor.Position > 0 {
+		prev = Cursor{Position: first, Backward: true}.Encode()
+	}
+	return len(positions), next, prev
+}
+
+//NewIceCreamPage builds a page out of rows fetched in the direction of
+//the cursor. Implementations are expected to fetch up to pageSize+1 rows
+//so that the presence of a neighbouring page can be detected.
+//positions holds the `cursor` value of each row in iceCreams
+func NewIceCreamPage(cursor Cursor, pageSize int, positions []int64, iceCreams []IceCream) *IceCreamPage {
+	if len(iceCreams) > pageSize {
+		iceCreams = iceCreams[:pageSize]
+	}
+	size, next, prev := paginate(cursor, pageSize, positions, func(l, r int) {
+		iceCreams[l], iceCreams[r] = iceCreams[r], iceCreams[l]
+	})
+	return &IceCreamPage{IceCreams: iceCreams[:size], NextCursor: next, PrevCursor: prev}
+}
+
+//NewTrashPage is the equivalent of NewIceCreamPage for trashed rows
+func NewTrashPage(cursor Cursor, pageSize int, positions []int64, trashed []TrashedIceCream) *TrashPage {
+	if len(trashed) > pageSize {
+		trashed = trashed[:pageSize]
+	}
+	size, next, prev := paginate(cursor, pageSize, positions, func(l, r int) {
+		trashed[l], trashed[r] = trashed[r], trashed[l]
+	})
+	return &TrashPage{IceCreams: trashed[:size], NextCursor: next, PrevCursor: prev}
+}
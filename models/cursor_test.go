@@ -0,0 +1,107 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DecodeCursor(t *testing.T) {
+	var tests = []struct {
+		desc           string
+		cursor         string
+		expectedCursor Cursor
+		expectedErr    error
+	}{
+		{
+			desc:   "an empty cursor points to the first page",
+			cursor: "",
+		},
+		{
+			desc:           "an encoded forward cursor should round trip",
+			cursor:         Cursor{Position: 42}.Encode(),
+			expectedCursor: Cursor{Position: 42},
+		},
+		{
+			desc:           "an encoded backward cursor should round trip",
+			cursor:         Cursor{Position: 7, Backward: true}.Encode(),
+			expectedCursor: Cursor{Position: 7, Backward: true},
+		},
+		{
+			desc:        "a cursor that is not base64 is invalid",
+			cursor:      "!!!",
+			expectedErr: ErrInvalidCursor,
+		},
+		{
+			desc:        "a cursor with an unknown direction is invalid",
+			cursor:      "eDox",
+			expectedErr: ErrInvalidCursor,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			cursor, err := DecodeCursor(test.cursor)
+			assert.Equal(test.expectedErr, err)
+			assert.Equal(test.expectedCursor, cursor)
+		})
+	}
+}
+
+func Test_NewIceCreamPage(t *testing.T) {
+	var tests = []struct {
+		desc         string
+		cursor       Cursor
+		positions    []int64
+		names        []string
+		expectedPage *IceCreamPage
+	}{
+		{
+			desc:      "first page with more rows should only have a next cursor",
+			positions: []int64{1, 2, 3},
+			names:     []string{"a", "b", "c"},
+			expectedPage: &IceCreamPage{
+				IceCreams:  []IceCream{{Name: "a"}, {Name: "b"}},
+				NextCursor: Cursor{Position: 2}.Encode(),
+			},
+		},
+		{
+			desc:      "last page reached going forward should only have a prev cursor",
+			cursor:    Cursor{Position: 2},
+			positions: []int64{3},
+			names:     []string{"c"},
+			expectedPage: &IceCreamPage{
+				IceCreams:  []IceCream{{Name: "c"}},
+				PrevCursor: Cursor{Position: 3, Backward: true}.Encode(),
+			},
+		},
+		{
+			desc:      "going backward should restore the ascending order",
+			cursor:    Cursor{Position: 5, Backward: true},
+			positions: []int64{4, 3, 2},
+			names:     []string{"d", "c", "b"},
+			expectedPage: &IceCreamPage{
+				IceCreams:  []IceCream{{Name: "c"}, {Name: "d"}},
+				NextCursor: Cursor{Position: 4}.Encode(),
+				PrevCursor: Cursor{Position: 3, Backward: true}.Encode(),
+			},
+		},
+		{
+			desc:         "an empty page has no cursors",
+			cursor:       Cursor{Position: 9},
+			expectedPage: &IceCreamPage{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			var iceCreams []IceCream
+			for _, name := range test.names {
+				iceCreams = append(iceCreams, IceCream{Name: name})
+			}
+			page := NewIceCreamPage(test.cursor, 2, test.positions, iceCreams)
+			assert.Equal(t, test.expectedPage, page)
+		})
+	}
+}
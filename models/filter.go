@@ -0,0 +1,84 @@
+package models
+
+import "strings"
+
+//ArrayFilter holds the conditions applied on an array column.
+//Every non empty condition has to hold for a row to match
+type ArrayFilter struct {
+	//ContainsAll matches rows holding every one of the values
+	ContainsAll []string
+	//ContainsAny matches rows holding at least one of the values
+	ContainsAny []string
+	//Excludes matches rows holding none of the values
+	Excludes []string
+}
+
+//Matches reports whether values satisfies all the conditions of the filter
+func (a ArrayFilter) Matches(values []string) bool {
+	present := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		present[value] = struct{}{}
+	}
+
+	for _, value := range a.ContainsAll {
+		if _, ok := present[value]; !ok {
+			return false
+		}
+	}
+
+	if len(a.ContainsAny) > 0 {
+		var found bool
+		for _, value := range a.ContainsAny {
+			if _, ok := present[value]; ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for _, value := range a.Excludes {
+		if _, ok := present[value]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+//IceCreamFilter narrows down the IceCreams returned by a listing.
+//The zero value matches everything
+type IceCreamFilter struct {
+	SourcingValues ArrayFilter
+	Ingredients    ArrayFilter
+	//DietaryCertification has to be equal to the certification of the row
+	DietaryCertification string
+	//AllergyInfo is a case insensitive substring of the allergy info of the row
+	AllergyInfo string
+	//FreeFrom lists allergens the row neither contains nor may contain.
+	//Rows whose allergens were never derived never match
+	FreeFrom []string
+}
+
+//Matches reports whether iceCream satisfies all the conditions of the filter
+func (f IceCreamFilter) Matches(iceCream IceCream) bool {
+	if !f.SourcingValues.Matches(iceCream.SourcingValues) ||
+		!f.Ingredients.Matches(iceCream.Ingredients) {
+		return false
+	}
+
+	if f.DietaryCertification != "" && f.DietaryCertification != iceCream.DietaryCertification {
+		return false
+	}
+
+	if f.AllergyInfo != "" &&
+		!strings.Contains(strings.ToLower(iceCream.AllergyInfo), strings.ToLower(f.AllergyInfo)) {
+		return false
+	}
+
+	if len(f.FreeFrom) > 0 && !iceCream.Allergens.FreeFrom(f.FreeFrom) {
+		return false
+	}
+	return true
+}
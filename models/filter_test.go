@@ -0,0 +1,70 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_IceCreamFilterMatches(t *testing.T) {
+	iceCream := IceCream{
+		SourcingValues:       []string{"Fairtrade", "Non-GMO"},
+		Ingredients:          []string{"cream", "sugar", "peanuts"},
+		AllergyInfo:          "contains milk and Peanuts",
+		DietaryCertification: "Kosher",
+	}.NormalizeIngredients().DeriveAllergens()
+
+	var tests = []struct {
+		desc     string
+		filter   IceCreamFilter
+		expected bool
+	}{
+		{
+			desc:     "the zero filter matches everything",
+			expected: true,
+		},
+		{
+			desc: "contains all should require every value",
+			filter: IceCreamFilter{
+				SourcingValues: ArrayFilter{ContainsAll: []string{"Fairtrade", "Caring Dairy"}},
+			},
+		},
+		{
+			desc: "contains any should require a single value",
+			filter: IceCreamFilter{
+				SourcingValues: ArrayFilter{ContainsAny: []string{"Fairtrade", "Caring Dairy"}},
+			},
+			expected: true,
+		},
+		{
+			desc: "excludes should reject rows holding the value",
+			filter: IceCreamFilter{
+				Ingredients: ArrayFilter{Excludes: []string{"peanuts"}},
+			},
+		},
+		{
+			desc:     "allergy info should be a case insensitive substring",
+			filter:   IceCreamFilter{AllergyInfo: "peanuts", DietaryCertification: "Kosher"},
+			expected: true,
+		},
+		{
+			desc:   "dietary certification should be equal",
+			filter: IceCreamFilter{DietaryCertification: "Vegan"},
+		},
+		{
+			desc:     "free from should accept rows without the allergens",
+			filter:   IceCreamFilter{FreeFrom: []string{"tree_nuts", "eggs"}},
+			expected: true,
+		},
+		{
+			desc:   "free from should reject rows containing one of the allergens",
+			filter: IceCreamFilter{FreeFrom: []string{"tree_nuts", "peanuts"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.filter.Matches(iceCream))
+		})
+	}
+}
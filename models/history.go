@@ -0,0 +1,90 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+//Actions recorded in the history of an IceCream
+const (
+	HistoryCreate  = "create"
+	HistoryUpdate  = "update"
+	HistoryReplace = "replace"
+	HistoryDelete  = "delete"
+	HistoryRestore = "restore"
+)
+
+//FieldChange is the value of a single field before and after a change.
+//Values are kept in their json form
+type FieldChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+//HistoryEntry is a single change done to an IceCream
+type HistoryEntry struct {
+	Name string `json:"name"`
+	//Version is the version of the IceCream after the change
+	Version   int64         `json:"version"`
+	Action    string        `json:"action"`
+	Actor     string        `json:"actor"`
+	RequestID string        `json:"request_id"`
+	ChangedAt time.Time     `json:"changed_at"`
+	Changes   []FieldChange `json:"changes"`
+	//Snapshot is the IceCream as it was left by the change
+	Snapshot IceCream `json:"-"`
+}
+
+//NewHistoryEntry describes the change of before into after done on
+//behalf of the actor and request recorded in ctx. Creations are
+//described as a change from the zero IceCream
+func NewHistoryEntry(ctx context.Context, action string, before, after IceCream) HistoryEntry {
+	return HistoryEntry{
+		Name:      after.Name,
+		Version:   after.Version,
+		Action:    action,
+		Actor:     ActorFromContext(ctx),
+		RequestID: RequestIDFromContext(ctx),
+		ChangedAt: time.Now(),
+		Changes:   DiffIceCream(before, after),
+		Snapshot:  after,
+	}
+}
+
+//HistoryVersion returns the latest entry of history that left the
+//IceCream at version. history is expected newest first
+func HistoryVersion(history []HistoryEntry, version int64) (HistoryEntry, bool) {
+	for _, entry := range history {
+		if entry.Version == version {
+			return entry, true
+		}
+	}
+	return HistoryEntry{}, false
+}
+
+//DiffIceCream lists the fields that differ between before and after,
+//named after their json keys. Fields left out of json are ignored
+func DiffIceCream(before, after IceCream) []FieldChange {
+	changes := []FieldChange{}
+	beforeValue, afterValue := reflect.ValueOf(before), reflect.ValueOf(after)
+	for index := 0; index < beforeValue.NumField(); index++ {
+		field := strings.Split(beforeValue.Type().Field(index).Tag.Get("json"), ",")[0]
+		if field == "-" || field == "" {
+			continue
+		}
+
+		//marshalling values of a struct cannot fail
+		beforeJSON, _ := json.Marshal(beforeValue.Field(index).Interface())
+		afterJSON, _ := json.Marshal(afterValue.Field(index).Interface())
+		if bytes.Equal(beforeJSON, afterJSON) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: field, Before: beforeJSON, After: afterJSON})
+	}
+	return changes
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DiffIceCream(t *testing.T) {
+	before := IceCream{
+		Name:        "Chocobar",
+		Story:       "old story",
+		Ingredients: []string{"cream"},
+		Version:     1,
+	}
+
+	var tests = []struct {
+		desc     string
+		after    IceCream
+		expected []FieldChange
+	}{
+		{
+			desc:     "identical ice creams have no changes",
+			after:    before,
+			expected: []FieldChange{},
+		},
+		{
+			desc:     "the version is not a field of its own",
+			after:    IceCream{Name: "Chocobar", Story: "old story", Ingredients: []string{"cream"}, Version: 2},
+			expected: []FieldChange{},
+		},
+		{
+			desc:  "changed fields are named after their json keys",
+			after: IceCream{Name: "Chocobar", Story: "new story", Ingredients: []string{"cream", "nuts"}},
+			expected: []FieldChange{
+				{Field: "story", Before: json.RawMessage(`"old story"`), After: json.RawMessage(`"new story"`)},
+				{Field: "ingredients", Before: json.RawMessage(`["cream"]`), After: json.RawMessage(`["cream","nuts"]`)},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert.Equal(t, test.expected, DiffIceCream(before, test.after))
+		})
+	}
+}
+
+func Test_NewHistoryEntry(t *testing.T) {
+	assert := assert.New(t)
+	ctx := ContextWithRequestID(ContextWithActor(context.Background(), "token ced85b42"), "host/abc-000001")
+
+	after := IceCream{Name: "Chocobar", Story: "story", Version: 1}
+	entry := NewHistoryEntry(ctx, HistoryCreate, IceCream{}, after)
+	assert.Equal("Chocobar", entry.Name)
+	assert.Equal(int64(1), entry.Version)
+	assert.Equal("token ced85b42", entry.Actor)
+	assert.Equal("host/abc-000001", entry.RequestID)
+	assert.Equal([]FieldChange{
+		{Field: "name", Before: json.RawMessage(`""`), After: json.RawMessage(`"Chocobar"`)},
+		{Field: "story", Before: json.RawMessage(`""`), After: json.RawMessage(`"story"`)},
+	}, entry.Changes)
+	assert.Equal(after, entry.Snapshot)
+
+	found, ok := HistoryVersion([]HistoryEntry{entry}, 1)
+	assert.True(ok)
+	assert.Equal(entry, found)
+	_, ok = HistoryVersion([]HistoryEntry{entry}, 2)
+	assert.False(ok)
+}
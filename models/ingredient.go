@@ -0,0 +1,98 @@
+package models
+
+import "strings"
+
+//Ingredient is an entry of the ingredient list of an ice cream.
+//Compound ingredients, like "liquid sugar (sugar, water)", hold the
+//ingredients they are made of
+type Ingredient struct {
+	Name        string       `json:"name"`
+	Ingredients []Ingredient `json:"ingredients,omitempty"`
+}
+
+//ParseIngredients rebuilds the ingredient tree out of a flat list of
+//ingredients. Entries are joined back together before being parsed so
+//compound ingredients split on their commas, like "liquid sugar (sugar"
+//followed by "water)", are read as one. Unbalanced brackets are
+//tolerated: stray closing ones are dropped and open ones are closed at
+//the end of the list
+func ParseIngredients(entries []string) []Ingredient {
+	parser := ingredientParser{list: strings.Join(entries, ",")}
+	return parser.parse(false)
+}
+
+//FormatIngredients flattens tree into the list of its top level
+//ingredients, compound ones listing theirs in parentheses
+func FormatIngredients(tree []Ingredient) []string {
+	entries := make([]string, 0, len(tree))
+	for _, ingredient := range tree {
+		entries = append(entries, ingredient.format())
+	}
+	return entries
+}
+
+func (i Ingredient) format() string {
+	if len(i.Ingredients) == 0 {
+		return i.Name
+	}
+	return i.Name + " (" + strings.Join(FormatIngredients(i.Ingredients), ", ") + ")"
+}
+
+//NormalizeIngredients returns a copy of the ice cream with its
+//IngredientTree parsed out of Ingredients, which are rewritten from the
+//tree. Stores normalize every ice cream they write. A nil Ingredients,
+//which partial updates leave untouched, stays nil
+func (i IceCream) NormalizeIngredients() IceCream {
+	if i.Ingredients == nil {
+		i.IngredientTree = nil
+		return i
+	}
+	i.IngredientTree = ParseIngredients(i.Ingredients)
+	i.Ingredients = FormatIngredients(i.IngredientTree)
+	return i
+}
+
+type ingredientParser struct {
+	list     string
+	position int
+}
+
+//parse reads ingredients up to the end of the list or, when nested, up
+//to the bracket closing the compound ingredient they are part of
+func (p *ingredientParser) parse(nested bool) []Ingredient {
+	var ingredients []Ingredient
+	var name strings.Builder
+	var parts []Ingredient
+	add := func() {
+		ingredientName := strings.Join(strings.Fields(name.String()), " ")
+		switch {
+		case ingredientName != "":
+			ingredients = append(ingredients, Ingredient{Name: ingredientName, Ingredients: parts})
+		case len(parts) > 0:
+			//brackets without a name only group their ingredients
+			ingredients = append(ingredients, parts...)
+		}
+		name.Reset()
+		parts = nil
+	}
+
+	for p.position < len(p.list) {
+		c := p.list[p.position]
+		p.position++
+		switch c {
+		case '(', '[':
+			parts = append(parts, p.parse(true)...)
+		case ')', ']':
+			if nested {
+				add()
+				return ingredients
+			}
+		case ',':
+			add()
+		default:
+			name.WriteByte(c)
+		}
+	}
+	add()
+	return ingredients
+}
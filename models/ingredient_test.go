@@ -0,0 +1,80 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseIngredients(t *testing.T) {
+	var tests = []struct {
+		desc     string
+		entries  []string
+		expected []Ingredient
+	}{
+		{
+			desc:     "plain entries are kept as they are",
+			entries:  []string{"cream", "skim milk"},
+			expected: []Ingredient{{Name: "cream"}, {Name: "skim milk"}},
+		},
+		{
+			desc:    "compound ingredients split on their commas are put back together",
+			entries: []string{"liquid sugar (sugar", "water)", "vegetable oil (canola", "and/or sunflower oil)"},
+			expected: []Ingredient{
+				{Name: "liquid sugar", Ingredients: []Ingredient{{Name: "sugar"}, {Name: "water"}}},
+				{Name: "vegetable oil", Ingredients: []Ingredient{{Name: "canola"}, {Name: "and/or sunflower oil"}}},
+			},
+		},
+		{
+			desc:    "compound ingredients nest and may use square brackets",
+			entries: []string{"fudge [sugar", "cocoa (processed with alkali)", "salt]"},
+			expected: []Ingredient{{Name: "fudge", Ingredients: []Ingredient{
+				{Name: "sugar"},
+				{Name: "cocoa", Ingredients: []Ingredient{{Name: "processed with alkali"}}},
+				{Name: "salt"},
+			}}},
+		},
+		{
+			desc:    "odd spacing, empty entries and unnamed groups are cleaned up",
+			entries: []string{" annatto( color)", "", "(milk", "eggs)", "Crème  fraîche "},
+			expected: []Ingredient{
+				{Name: "annatto", Ingredients: []Ingredient{{Name: "color"}}},
+				{Name: "milk"}, {Name: "eggs"}, {Name: "Crème fraîche"},
+			},
+		},
+		{
+			desc:    "stray closing brackets are dropped and open ones closed at the end",
+			entries: []string{"salt)", "butter (cream", "salt"},
+			expected: []Ingredient{
+				{Name: "salt"},
+				{Name: "butter", Ingredients: []Ingredient{{Name: "cream"}, {Name: "salt"}}},
+			},
+		},
+		{
+			desc: "an empty list has no ingredients",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			tree := ParseIngredients(test.entries)
+			assert.Equal(test.expected, tree)
+			//formatted trees parse back to themselves
+			assert.Equal(tree, ParseIngredients(FormatIngredients(tree)))
+		})
+	}
+}
+
+func Test_NormalizeIngredients(t *testing.T) {
+	assert := assert.New(t)
+
+	normalized := IceCream{Ingredients: []string{"cream", "butter (cream", "salt)"}}.NormalizeIngredients()
+	assert.Equal([]string{"cream", "butter (cream, salt)"}, normalized.Ingredients)
+	assert.Equal([]Ingredient{{Name: "cream"},
+		{Name: "butter", Ingredients: []Ingredient{{Name: "cream"}, {Name: "salt"}}}}, normalized.IngredientTree)
+	assert.Equal(normalized, normalized.NormalizeIngredients())
+
+	assert.Equal(IceCream{}, IceCream{IngredientTree: []Ingredient{{Name: "sent"}}}.NormalizeIngredients())
+	assert.Equal(IceCream{Ingredients: []string{}}, IceCream{Ingredients: []string{" "}}.NormalizeIngredients())
+}
@@ -0,0 +1,25 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//History returns every change recorded for the IceCream called name,
+//newest first
+func (i *iceCreamStore) History(ctx context.Context, name string) ([]models.HistoryEntry, error) {
+	history := []models.HistoryEntry{}
+	err := i.read(ctx, func(s *state) {
+		entries := s.history[name]
+		for index := len(entries) - 1; index >= 0; index-- {
+			entry := entries[index]
+			entry.Snapshot = copyIceCream(entry.Snapshot)
+			history = append(history, entry)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
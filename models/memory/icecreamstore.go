@@ -0,0 +1,448 @@
+//Package memory holds implementations of the models stores that keep
+//all their data in process. They need no external dependencies which
+//makes them handy for development and tests
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//record is a stored IceCream along with its position in the
+//insertion order, the equivalent of the `cursor` column.
+//deletedAt is set once the record has been moved to the trash
+type record struct {
+	position  int64
+	iceCream  models.IceCream
+	deletedAt time.Time
+	deletedBy string
+}
+
+func (r record) trashed() bool {
+	return !r.deletedAt.IsZero()
+}
+
+//state is the complete data held by a store
+type state struct {
+	records      map[string]record
+	history      map[string][]models.HistoryEntry
+	lastPosition int64
+}
+
+func (s *state) clone() *state {
+	records := make(map[string]record, len(s.records))
+	for name, rec := range s.records {
+		records[name] = rec
+	}
+	history := make(map[string][]models.HistoryEntry, len(s.history))
+	for name, entries := range s.history {
+		history[name] = entries
+	}
+	return &state{records: records, history: history, lastPosition: s.lastPosition}
+}
+
+//addHistory appends entry to the history of its IceCream
+func (s *state) addHistory(entry models.HistoryEntry) {
+	entries := s.history[entry.Name]
+	//cap the slice so appending copies it, clones share their slices
+	s.history[entry.Name] = append(entries[:len(entries):len(entries)], entry)
+}
+
+//operation is a change applied to a state. Operations done within a
+//transaction are replayed on the live state when it commits
+type operation func(s *state) error
+
+//tx is a transaction in progress. Its operations are applied on a
+//private copy of the state so they stay invisible until commit
+type tx struct {
+	mu    sync.Mutex
+	state *state
+	ops   []operation
+}
+
+//txKey is the context key transactions are stored under. It holds the
+//store so transactions of different stores never mix
+type txKey struct {
+	store *iceCreamStore
+}
+
+type iceCreamStore struct {
+	mu    sync.RWMutex
+	state *state
+}
+
+//NewIceCreamStore returns a new, empty instance of IceCreamStore that
+//keeps its data in memory
+func NewIceCreamStore() models.IceCreamStore {
+	return &iceCreamStore{
+		state: &state{
+			records: map[string]record{},
+			history: map[string][]models.HistoryEntry{},
+		},
+	}
+}
+
+//WithTxContext runs f within a transaction. Changes done through the
+//context handed to f are only applied to the store if f returns no error.
+//When ctx already holds a transaction f joins it
+func (i *iceCreamStore) WithTxContext(ctx context.Context, f func(context.Context) error) error {
+	if _, ok := ctx.Value(txKey{i}).(*tx); ok {
+		return f(ctx)
+	}
+
+	i.mu.RLock()
+	transaction := &tx{state: i.state.clone()}
+	i.mu.RUnlock()
+
+	if err := f(context.WithValue(ctx, txKey{i}, transaction)); err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	committed := i.state.clone()
+	for _, op := range transaction.ops {
+		if err := op(committed); err != nil {
+			return err
+		}
+	}
+	i.state = committed
+	return nil
+}
+
+//apply runs op on the transaction in ctx, or directly on the store when
+//there is none. Nothing is applied once ctx is done
+func (i *iceCreamStore) apply(ctx context.Context, op operation) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if transaction, ok := ctx.Value(txKey{i}).(*tx); ok {
+		transaction.mu.Lock()
+		defer transaction.mu.Unlock()
+		if err := op(transaction.state); err != nil {
+			return err
+		}
+		transaction.ops = append(transaction.ops, op)
+		return nil
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return op(i.state)
+}
+
+//read runs f on the state of the transaction in ctx, or on the live
+//state when there is none. f is not run once ctx is done
+func (i *iceCreamStore) read(ctx context.Context, f func(s *state)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if transaction, ok := ctx.Value(txKey{i}).(*tx); ok {
+		transaction.mu.Lock()
+		defer transaction.mu.Unlock()
+		f(transaction.state)
+		return nil
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	f(i.state)
+	return nil
+}
+
+//StoreContext inserts iceCreamInput, failing with
+//models.ErrRowAlreadyExists if a live record holds its name
+func (i *iceCreamStore) StoreContext(ctx context.Context, iceCreamInput models.IceCream) error {
+	iceCreamInput = copyIceCream(iceCreamInput)
+	return i.apply(ctx, func(s *state) error {
+		rec, ok := s.records[iceCreamInput.Name]
+		if ok && !rec.trashed() {
+			return models.ErrRowAlreadyExists
+		}
+		s.insert(ctx, rec, iceCreamInput)
+		return nil
+	})
+}
+
+//insert stores iceCreamInput over rec, the trashed or zero record of
+//its name, see the postgres store
+func (s *state) insert(ctx context.Context, rec record, iceCreamInput models.IceCream) models.IceCream {
+	s.lastPosition++
+	iceCreamInput = iceCreamInput.NormalizeIngredients().DeriveAllergens()
+	iceCreamInput.Version = rec.iceCream.Version + 1
+	s.records[iceCreamInput.Name] = record{position: s.lastPosition, iceCream: iceCreamInput}
+	s.addHistory(models.NewHistoryEntry(ctx, models.HistoryCreate, models.IceCream{}, iceCreamInput))
+	return iceCreamInput
+}
+
+//replace overwrites every field of the live record rec
+func (s *state) replace(ctx context.Context, rec record, iceCreamInput models.IceCream) models.IceCream {
+	before := rec.iceCream
+	rec.iceCream = iceCreamInput.NormalizeIngredients().DeriveAllergens()
+	rec.iceCream.Name = before.Name
+	rec.iceCream.Version = before.Version + 1
+	s.records[before.Name] = rec
+	s.addHistory(models.NewHistoryEntry(ctx, models.HistoryReplace, before, rec.iceCream))
+	return rec.iceCream
+}
+
+func (i *iceCreamStore) Get(ctx context.Context, name string) (*models.IceCream, error) {
+	var iceCream *models.IceCream
+	err := i.read(ctx, func(s *state) {
+		if rec, ok := s.records[name]; ok && !rec.trashed() {
+			found := copyIceCream(rec.iceCream)
+			iceCream = &found
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if iceCream == nil {
+		return nil, models.ErrNoRows
+	}
+	return iceCream, nil
+}
+
+func (i *iceCreamStore) GetAll(ctx context.Context, filter models.IceCreamFilter, pageSize int,
+	cursor string) (*models.IceCreamPage, error) {
+	pageCursor, err := models.DecodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []record
+	err = i.read(ctx, func(s *state) {
+		for _, rec := range s.records {
+			if rec.trashed() {
+				continue
+			}
+			if pageCursor.Backward && rec.position >= pageCursor.Position ||
+				!pageCursor.Backward && rec.position <= pageCursor.Position {
+				continue
+			}
+			if filter.Matches(rec.iceCream) {
+				matches = append(matches, record{position: rec.position, iceCream: copyIceCream(rec.iceCream)})
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(matches, func(l, r int) bool {
+		if pageCursor.Backward {
+			return matches[l].position > matches[r].position
+		}
+		return matches[l].position < matches[r].position
+	})
+
+	//keep one extra row to know if there is a page beyond this one
+	if len(matches) > pageSize+1 {
+		matches = matches[:pageSize+1]
+	}
+
+	positions := make([]int64, 0, len(matches))
+	iceCreams := make([]models.IceCream, 0, len(matches))
+	for _, match := range matches {
+		positions = append(positions, match.position)
+		iceCreams = append(iceCreams, match.iceCream)
+	}
+	return models.NewIceCreamPage(pageCursor, pageSize, positions, iceCreams), nil
+}
+
+//Update mirrors the postgres store: empty strings and nil slices leave
+//the stored value untouched. A non zero version makes the update
+//conditional
+func (i *iceCreamStore) Update(ctx context.Context, iceCreamInput models.IceCream) (*models.IceCream, error) {
+	iceCreamInput = copyIceCream(iceCreamInput)
+	var after models.IceCream
+	err := i.apply(ctx, func(s *state) error {
+		rec, ok := s.records[iceCreamInput.Name]
+		ok = ok && !rec.trashed()
+		if err := checkVersion(ok, rec, iceCreamInput.Version); err != nil {
+			return err
+		}
+		if !ok {
+			return models.ErrNoRows
+		}
+		before := rec.iceCream
+		stored := &rec.iceCream
+		updateString(&stored.ImageOpen, iceCreamInput.ImageOpen)
+		updateString(&stored.ImageClosed, iceCreamInput.ImageClosed)
+		updateString(&stored.Story, iceCreamInput.Story)
+		updateString(&stored.Description, iceCreamInput.Description)
+		if iceCreamInput.SourcingValues != nil {
+			stored.SourcingValues = iceCreamInput.SourcingValues
+		}
+		if iceCreamInput.Ingredients != nil {
+			updated := iceCreamInput.NormalizeIngredients()
+			stored.Ingredients, stored.IngredientTree = updated.Ingredients, updated.IngredientTree
+		}
+		updateString(&stored.AllergyInfo, iceCreamInput.AllergyInfo)
+		updateString(&stored.DietaryCertification, iceCreamInput.DietaryCertification)
+		updateString(&stored.ProductID, iceCreamInput.ProductID)
+		*stored = stored.DeriveAllergens()
+		stored.Version++
+		s.records[iceCreamInput.Name] = rec
+		s.addHistory(models.NewHistoryEntry(ctx, models.HistoryUpdate, before, *stored))
+		after = copyIceCream(*stored)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &after, nil
+}
+
+//Replace overwrites every field of the record called iceCreamInput.Name,
+//see the postgres store
+func (i *iceCreamStore) Replace(ctx context.Context, iceCreamInput models.IceCream) error {
+	iceCreamInput = copyIceCream(iceCreamInput)
+	return i.apply(ctx, func(s *state) error {
+		rec, ok := s.records[iceCreamInput.Name]
+		ok = ok && !rec.trashed()
+		if err := checkVersion(ok, rec, iceCreamInput.Version); err != nil {
+			return err
+		}
+		if !ok {
+			return models.ErrNoRows
+		}
+		s.replace(ctx, rec, iceCreamInput)
+		return nil
+	})
+}
+
+//Upsert replaces the record called iceCreamInput.Name or creates it,
+//see the postgres store
+func (i *iceCreamStore) Upsert(ctx context.Context,
+	iceCreamInput models.IceCream) (*models.IceCream, bool, error) {
+	iceCreamInput = copyIceCream(iceCreamInput)
+	var iceCream models.IceCream
+	var created bool
+	err := i.apply(ctx, func(s *state) error {
+		rec, ok := s.records[iceCreamInput.Name]
+		ok = ok && !rec.trashed()
+		if err := checkVersion(ok, rec, iceCreamInput.Version); err != nil {
+			return err
+		}
+		created = !ok
+		if created {
+			iceCream = s.insert(ctx, rec, iceCreamInput)
+		} else {
+			iceCream = s.replace(ctx, rec, iceCreamInput)
+		}
+		iceCream = copyIceCream(iceCream)
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &iceCream, created, nil
+}
+
+//Patch changes only the fields set in patch, see the postgres store
+func (i *iceCreamStore) Patch(ctx context.Context, name string,
+	patch models.IceCreamPatch) (*models.IceCream, error) {
+	var after models.IceCream
+	err := i.apply(ctx, func(s *state) error {
+		rec, ok := s.records[name]
+		ok = ok && !rec.trashed()
+		if err := checkVersion(ok, rec, patch.Version); err != nil {
+			return err
+		}
+		if !ok {
+			return models.ErrNoRows
+		}
+		if patch.IsEmpty() {
+			after = copyIceCream(rec.iceCream)
+			return nil
+		}
+		before := rec.iceCream
+		rec.iceCream = patch.Apply(before).NormalizeIngredients().DeriveAllergens()
+		rec.iceCream.Version++
+		s.records[name] = rec
+		s.addHistory(models.NewHistoryEntry(ctx, models.HistoryUpdate, before, rec.iceCream))
+		after = copyIceCream(rec.iceCream)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &after, nil
+}
+
+//Delete moves the record called name to the trash, recording the
+//actor found in ctx
+func (i *iceCreamStore) Delete(ctx context.Context, name string, version int64) error {
+	actor := models.ActorFromContext(ctx)
+	return i.apply(ctx, func(s *state) error {
+		rec, ok := s.records[name]
+		ok = ok && !rec.trashed()
+		if err := checkVersion(ok, rec, version); err != nil {
+			return err
+		}
+		if !ok {
+			return models.ErrNoRows
+		}
+		rec.deletedAt = time.Now()
+		rec.deletedBy = actor
+		rec.iceCream.Version++
+		s.records[name] = rec
+		s.addHistory(models.NewHistoryEntry(ctx, models.HistoryDelete, rec.iceCream, rec.iceCream))
+		return nil
+	})
+}
+
+//checkVersion fails conditional writes, the ones with a non zero
+//version, when the record is missing or at another version
+func checkVersion(found bool, rec record, version int64) error {
+	if version != 0 && (!found || rec.iceCream.Version != version) {
+		return models.ErrVersionMismatch
+	}
+	return nil
+}
+
+func updateString(stored *string, value string) {
+	if value != "" {
+		*stored = value
+	}
+}
+
+//copyIceCream deep copies iceCream so that callers cannot change
+//stored data through shared slices
+func copyIceCream(iceCream models.IceCream) models.IceCream {
+	iceCream.SourcingValues = copyStrings(iceCream.SourcingValues)
+	iceCream.Ingredients = copyStrings(iceCream.Ingredients)
+	iceCream.IngredientTree = copyIngredients(iceCream.IngredientTree)
+	if iceCream.Allergens != nil {
+		allergens := *iceCream.Allergens
+		allergens.Contains = copyStrings(allergens.Contains)
+		allergens.MayContain = copyStrings(allergens.MayContain)
+		allergens.Inconsistencies = append([]models.AllergenInconsistency(nil), allergens.Inconsistencies...)
+		iceCream.Allergens = &allergens
+	}
+	return iceCream
+}
+
+func copyIngredients(ingredients []models.Ingredient) []models.Ingredient {
+	if ingredients == nil {
+		return nil
+	}
+	copied := make([]models.Ingredient, len(ingredients))
+	for index, ingredient := range ingredients {
+		copied[index] = models.Ingredient{Name: ingredient.Name, Ingredients: copyIngredients(ingredient.Ingredients)}
+	}
+	return copied
+}
+
+func copyStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append([]string{}, values...)
+}
@@ -0,0 +1,137 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+	"github.com/sudarshan-reddy/benjerry/models/storetest"
+)
+
+func Test_WithTxContext(t *testing.T) {
+	var tests = []struct {
+		desc          string
+		txErr         error
+		expectedNames []string
+	}{
+		{
+			desc:          "a successful transaction should commit its changes",
+			expectedNames: []string{"existing", "first", "second"},
+		},
+		{
+			desc:          "a failed transaction should roll back its changes",
+			txErr:         errors.New("failed midway"),
+			expectedNames: []string{"existing"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			store := NewIceCreamStore()
+			ctx := context.Background()
+			assert.NoError(store.StoreContext(ctx, models.IceCream{Name: "existing"}))
+
+			err := store.WithTxContext(ctx, func(ctx context.Context) error {
+				for _, name := range []string{"first", "second"} {
+					if err := store.StoreContext(ctx, models.IceCream{Name: name}); err != nil {
+						return err
+					}
+				}
+				//changes are only visible within the transaction before commit
+				_, err := store.Get(ctx, "first")
+				assert.NoError(err)
+				_, err = store.Get(context.Background(), "first")
+				assert.Equal(models.ErrNoRows, err)
+				return test.txErr
+			})
+			assert.Equal(test.txErr, err)
+
+			page, err := store.GetAll(ctx, models.IceCreamFilter{}, models.MaxPageSize, "")
+			assert.NoError(err)
+			var names []string
+			for _, iceCream := range page.IceCreams {
+				names = append(names, iceCream.Name)
+			}
+			assert.Equal(test.expectedNames, names)
+		})
+	}
+}
+
+func Test_ConcurrentAccess(t *testing.T) {
+	store := NewIceCreamStore()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("flavor-%d", i)
+			store.WithTxContext(ctx, func(ctx context.Context) error {
+				return store.StoreContext(ctx, models.IceCream{Name: name})
+			})
+			store.Update(ctx, models.IceCream{Name: name, Story: "updated"})
+			store.Get(ctx, name)
+			store.GetAll(ctx, models.IceCreamFilter{}, 5, "")
+		}(i)
+	}
+	wg.Wait()
+
+	page, err := store.GetAll(ctx, models.IceCreamFilter{}, models.MaxPageSize, "")
+	assert.NoError(t, err)
+	assert.Len(t, page.IceCreams, 20)
+}
+
+func Test_Search(t *testing.T) {
+	assert := assert.New(t)
+	store := NewIceCreamStore()
+	ctx := context.Background()
+	for _, iceCream := range []models.IceCream{
+		{Name: "a", Description: "Coffee Ice Cream", Story: "Coffee, coffee everywhere"},
+		{Name: "b", Description: "Cheesecake with Chocolate Cookie swirls"},
+		{Name: "c", Story: "a little coffee"},
+	} {
+		assert.NoError(store.StoreContext(ctx, iceCream))
+	}
+
+	query, err := models.ParseSearchQuery("coffee")
+	assert.NoError(err)
+	results, err := store.Search(ctx, query, 10)
+	assert.NoError(err)
+	assert.Len(results, 2)
+	assert.Equal("a", results[0].IceCream.Name)
+	assert.Equal("<mark>Coffee</mark> Ice Cream", results[0].Highlights.Description)
+	assert.Equal("<mark>Coffee</mark>, <mark>coffee</mark> everywhere", results[0].Highlights.Story)
+	assert.Equal("c", results[1].IceCream.Name)
+
+	query, err = models.ParseSearchQuery(`"chocolate cook*" swirl*`)
+	assert.NoError(err)
+	results, err = store.Search(ctx, query, 10)
+	assert.NoError(err)
+	assert.Len(results, 1)
+	assert.Equal("Cheesecake with <mark>Chocolate</mark> <mark>Cookie</mark> <mark>swirls</mark>",
+		results[0].Highlights.Description)
+}
+
+func Test_IceCreamStoreConformance(t *testing.T) {
+	storetest.RunIceCreamStoreTests(t, func(t *testing.T) models.IceCreamStore {
+		return NewIceCreamStore()
+	})
+}
+
+func Test_IngredientStoreConformance(t *testing.T) {
+	storetest.RunIngredientStoreTests(t, func(t *testing.T) models.IngredientStore {
+		return NewIngredientStore()
+	})
+}
+
+func Test_TokenStoreConformance(t *testing.T) {
+	storetest.RunTokenStoreTests(t, func(t *testing.T) models.TokenStore {
+		return NewTokenStore()
+	})
+}
@@ -0,0 +1,140 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+type ingredientStore struct {
+	mu          sync.RWMutex
+	ingredients map[string]models.RegisteredIngredient
+	//names maps the keys of every name and synonym to the name of
+	//their ingredient
+	names map[string]string
+}
+
+//NewIngredientStore returns a new, empty instance of IngredientStore
+//that keeps its data in memory
+func NewIngredientStore() models.IngredientStore {
+	return &ingredientStore{
+		ingredients: map[string]models.RegisteredIngredient{},
+		names:       map[string]string{},
+	}
+}
+
+//copyIngredient copies ingredient, giving it an empty list of synonyms
+//when it has none
+func copyIngredient(ingredient models.RegisteredIngredient) models.RegisteredIngredient {
+	ingredient.Synonyms = append([]string{}, ingredient.Synonyms...)
+	return ingredient
+}
+
+//add registers ingredient unless one of its keys is taken by an
+//ingredient other than the one called replacing
+func (i *ingredientStore) add(ingredient models.RegisteredIngredient, replacing string) error {
+	for _, key := range ingredient.Keys() {
+		if name, ok := i.names[key]; ok && name != replacing {
+			return models.ErrRowAlreadyExists
+		}
+	}
+	i.remove(replacing)
+	for _, key := range ingredient.Keys() {
+		i.names[key] = ingredient.Name
+	}
+	i.ingredients[ingredient.Name] = copyIngredient(ingredient)
+	return nil
+}
+
+func (i *ingredientStore) remove(name string) {
+	ingredient, ok := i.ingredients[name]
+	if !ok {
+		return
+	}
+	for _, key := range ingredient.Keys() {
+		delete(i.names, key)
+	}
+	delete(i.ingredients, name)
+}
+
+func (i *ingredientStore) StoreIngredient(ctx context.Context, ingredient models.RegisteredIngredient) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.add(ingredient, "")
+}
+
+func (i *ingredientStore) GetIngredient(ctx context.Context, name string) (*models.RegisteredIngredient, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	ingredient, ok := i.ingredients[name]
+	if !ok {
+		return nil, models.ErrNoRows
+	}
+	ingredient = copyIngredient(ingredient)
+	return &ingredient, nil
+}
+
+func (i *ingredientStore) ListIngredients(ctx context.Context) ([]models.RegisteredIngredient, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	ingredients := make([]models.RegisteredIngredient, 0, len(i.ingredients))
+	for _, ingredient := range i.ingredients {
+		ingredients = append(ingredients, copyIngredient(ingredient))
+	}
+	sort.Slice(ingredients, func(a, b int) bool {
+		return ingredients[a].Name < ingredients[b].Name
+	})
+	return ingredients, nil
+}
+
+func (i *ingredientStore) UpdateIngredient(ctx context.Context, name string,
+	ingredient models.RegisteredIngredient) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if _, ok := i.ingredients[name]; !ok {
+		return models.ErrNoRows
+	}
+	return i.add(ingredient, name)
+}
+
+func (i *ingredientStore) DeleteIngredient(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if _, ok := i.ingredients[name]; !ok {
+		return models.ErrNoRows
+	}
+	i.remove(name)
+	return nil
+}
+
+func (i *ingredientStore) CanonicalNames(ctx context.Context, names []string) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	canonical := map[string]string{}
+	for _, name := range names {
+		if ingredientName, ok := i.names[models.IngredientKey(name)]; ok {
+			canonical[name] = ingredientName
+		}
+	}
+	return canonical, nil
+}
@@ -0,0 +1,151 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+const (
+	descriptionWeight = 1.0
+	storyWeight       = 0.4
+)
+
+//span is a word of a text along with its byte offsets
+type span struct {
+	word       string
+	start, end int
+}
+
+//spans splits text into words the same way models.SearchWords does
+//while remembering where each word came from
+func spans(text string) []span {
+	var words []span
+	start := -1
+	for index, r := range text {
+		isWordRune := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWordRune && start < 0 {
+			start = index
+		}
+		if !isWordRune && start >= 0 {
+			words = append(words, span{strings.ToLower(text[start:index]), start, index})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		words = append(words, span{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return words
+}
+
+//matchTerm returns the indexes of the words of text matched by term
+func matchTerm(term models.SearchTerm, words []span) []int {
+	var matched []int
+	for start := 0; start+len(term.Words) <= len(words); start++ {
+		found := true
+		for offset, word := range term.Words {
+			candidate := words[start+offset].word
+			isLast := offset == len(term.Words)-1
+			if candidate != word && !(isLast && term.Prefix && strings.HasPrefix(candidate, word)) {
+				found = false
+				break
+			}
+		}
+		if found {
+			for offset := range term.Words {
+				matched = append(matched, start+offset)
+			}
+		}
+	}
+	return matched
+}
+
+//highlight wraps the matched words of text in <mark></mark>
+func highlight(text string, words []span, matched map[int]struct{}) string {
+	if len(matched) == 0 {
+		return text
+	}
+	var builder strings.Builder
+	previous := 0
+	for index, word := range words {
+		if _, ok := matched[index]; !ok {
+			continue
+		}
+		builder.WriteString(text[previous:word.start])
+		builder.WriteString("<mark>" + text[word.start:word.end] + "</mark>")
+		previous = word.end
+	}
+	builder.WriteString(text[previous:])
+	return builder.String()
+}
+
+//searchField matches every term of query against text and returns the
+//number of matched words along with the matches of each term
+func searchField(query models.SearchQuery, text string) ([]span, map[int]struct{}, []bool) {
+	words := spans(text)
+	matched := map[int]struct{}{}
+	termFound := make([]bool, len(query))
+	for termIndex, term := range query {
+		for _, wordIndex := range matchTerm(term, words) {
+			matched[wordIndex] = struct{}{}
+			termFound[termIndex] = true
+		}
+	}
+	return words, matched, termFound
+}
+
+//Search is a naive, unindexed implementation of the postgres full text
+//search. Every term has to be found in either the story or description
+func (i *iceCreamStore) Search(ctx context.Context, query models.SearchQuery,
+	limit int) ([]models.SearchResult, error) {
+	results := []models.SearchResult{}
+	err := i.read(ctx, func(s *state) {
+		for _, rec := range s.records {
+			if rec.trashed() {
+				continue
+			}
+			iceCream := rec.iceCream
+			storyWords, storyMatches, storyFound := searchField(query, iceCream.Story)
+			descriptionWords, descriptionMatches, descriptionFound := searchField(query, iceCream.Description)
+
+			isHit := true
+			for termIndex := range query {
+				if !storyFound[termIndex] && !descriptionFound[termIndex] {
+					isHit = false
+					break
+				}
+			}
+			if !isHit {
+				continue
+			}
+
+			results = append(results, models.SearchResult{
+				IceCream: copyIceCream(iceCream),
+				Rank: descriptionWeight*float64(len(descriptionMatches)) +
+					storyWeight*float64(len(storyMatches)),
+				Highlights: models.SearchHighlights{
+					Story:       highlight(iceCream.Story, storyWords, storyMatches),
+					Description: highlight(iceCream.Description, descriptionWords, descriptionMatches),
+				},
+			})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(results, func(l, r int) bool {
+		if results[l].Rank != results[r].Rank {
+			return results[l].Rank > results[r].Rank
+		}
+		return results[l].IceCream.Name < results[r].IceCream.Name
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
@@ -0,0 +1,145 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+type tokenStore struct {
+	mu     sync.RWMutex
+	tokens map[string]models.APIToken
+	//revoked maps the jti of revoked access tokens to their expiry
+	revoked map[string]time.Time
+}
+
+//NewTokenStore returns a new, empty instance of TokenStore that keeps
+//its data in memory
+func NewTokenStore() models.TokenStore {
+	return &tokenStore{
+		tokens:  map[string]models.APIToken{},
+		revoked: map[string]time.Time{},
+	}
+}
+
+//copyToken copies token so that callers never share its slices and
+//times with the store
+func copyToken(token models.APIToken) models.APIToken {
+	token.Scopes = append([]string{}, token.Scopes...)
+	token.SecretHash = append([]byte{}, token.SecretHash...)
+	for _, at := range []**time.Time{&token.ExpiresAt, &token.LastUsedAt, &token.RevokedAt} {
+		if *at != nil {
+			copied := **at
+			*at = &copied
+		}
+	}
+	return token
+}
+
+func (t *tokenStore) StoreToken(ctx context.Context, token models.APIToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.tokens[token.ID]; ok {
+		return models.ErrRowAlreadyExists
+	}
+	t.tokens[token.ID] = copyToken(token)
+	return nil
+}
+
+func (t *tokenStore) GetToken(ctx context.Context, id string) (*models.APIToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	token, ok := t.tokens[id]
+	if !ok {
+		return nil, models.ErrNoRows
+	}
+	token = copyToken(token)
+	return &token, nil
+}
+
+func (t *tokenStore) ListTokens(ctx context.Context) ([]models.APIToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	tokens := make([]models.APIToken, 0, len(t.tokens))
+	for _, token := range t.tokens {
+		tokens = append(tokens, copyToken(token))
+	}
+	sort.Slice(tokens, func(a, b int) bool {
+		if !tokens[a].CreatedAt.Equal(tokens[b].CreatedAt) {
+			return tokens[a].CreatedAt.Before(tokens[b].CreatedAt)
+		}
+		return tokens[a].ID < tokens[b].ID
+	})
+	return tokens, nil
+}
+
+func (t *tokenStore) RevokeToken(ctx context.Context, id string, at time.Time) (*models.APIToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	token, ok := t.tokens[id]
+	if !ok {
+		return nil, models.ErrNoRows
+	}
+	if token.RevokedAt == nil {
+		token.RevokedAt = &at
+		t.tokens[id] = copyToken(token)
+	}
+	token = copyToken(t.tokens[id])
+	return &token, nil
+}
+
+func (t *tokenStore) TouchToken(ctx context.Context, id string, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	token, ok := t.tokens[id]
+	if !ok {
+		return models.ErrNoRows
+	}
+	token.LastUsedAt = &at
+	t.tokens[id] = copyToken(token)
+	return nil
+}
+
+func (t *tokenStore) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for revokedJTI, expiry := range t.revoked {
+		if !now.Before(expiry) {
+			delete(t.revoked, revokedJTI)
+		}
+	}
+	t.revoked[jti] = expiresAt
+	return nil
+}
+
+func (t *tokenStore) AccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	_, ok := t.revoked[jti]
+	return ok, nil
+}
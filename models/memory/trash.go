@@ -0,0 +1,117 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+func (i *iceCreamStore) GetTrash(ctx context.Context, pageSize int, cursor string) (*models.TrashPage, error) {
+	pageCursor, err := models.DecodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []record
+	err = i.read(ctx, func(s *state) {
+		for _, rec := range s.records {
+			if !rec.trashed() {
+				continue
+			}
+			if pageCursor.Backward && rec.position >= pageCursor.Position ||
+				!pageCursor.Backward && rec.position <= pageCursor.Position {
+				continue
+			}
+			rec.iceCream = copyIceCream(rec.iceCream)
+			matches = append(matches, rec)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(matches, func(l, r int) bool {
+		if pageCursor.Backward {
+			return matches[l].position > matches[r].position
+		}
+		return matches[l].position < matches[r].position
+	})
+
+	//keep one extra row to know if there is a page beyond this one
+	if len(matches) > pageSize+1 {
+		matches = matches[:pageSize+1]
+	}
+
+	positions := make([]int64, 0, len(matches))
+	trashed := make([]models.TrashedIceCream, 0, len(matches))
+	for _, match := range matches {
+		positions = append(positions, match.position)
+		trashed = append(trashed, models.TrashedIceCream{
+			IceCream:  match.iceCream,
+			DeletedAt: match.deletedAt,
+			DeletedBy: match.deletedBy,
+		})
+	}
+	return models.NewTrashPage(pageCursor, pageSize, positions, trashed), nil
+}
+
+//GetTrashed reads the record called name if it is in the trash
+func (i *iceCreamStore) GetTrashed(ctx context.Context, name string) (*models.TrashedIceCream, error) {
+	var trashed *models.TrashedIceCream
+	err := i.read(ctx, func(s *state) {
+		if rec, ok := s.records[name]; ok && rec.trashed() {
+			trashed = &models.TrashedIceCream{
+				IceCream:  copyIceCream(rec.iceCream),
+				DeletedAt: rec.deletedAt,
+				DeletedBy: rec.deletedBy,
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if trashed == nil {
+		return nil, models.ErrNoRows
+	}
+	return trashed, nil
+}
+
+//Restore moves the record called name out of the trash
+func (i *iceCreamStore) Restore(ctx context.Context, name string, version int64) error {
+	return i.apply(ctx, func(s *state) error {
+		rec, ok := s.records[name]
+		ok = ok && rec.trashed()
+		if err := checkVersion(ok, rec, version); err != nil {
+			return err
+		}
+		if !ok {
+			return models.ErrNoRows
+		}
+		rec.deletedAt = time.Time{}
+		rec.deletedBy = ""
+		rec.iceCream.Version++
+		s.records[name] = rec
+		s.addHistory(models.NewHistoryEntry(ctx, models.HistoryRestore, rec.iceCream, rec.iceCream))
+		return nil
+	})
+}
+
+//Purge permanently removes the records moved to the trash before
+//olderThan
+func (i *iceCreamStore) Purge(ctx context.Context, olderThan time.Time) (int64, error) {
+	var purged int64
+	err := i.apply(ctx, func(s *state) error {
+		purged = 0
+		for name, rec := range s.records {
+			if rec.trashed() && rec.deletedAt.Before(olderThan) {
+				delete(s.records, name)
+				purged++
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
@@ -0,0 +1,55 @@
+package models
+
+//IceCreamPatch lists the fields of an IceCream to change. nil fields are
+//left untouched. A slice field pointing to a nil slice clears the column
+//while one pointing to an empty slice sets it to an empty array
+type IceCreamPatch struct {
+	ImageOpen            *string
+	ImageClosed          *string
+	Story                *string
+	Description          *string
+	SourcingValues       *[]string
+	Ingredients          *[]string
+	AllergyInfo          *string
+	DietaryCertification *string
+	ProductID            *string
+	//Version makes the patch conditional when set, see ErrVersionMismatch
+	Version int64
+}
+
+//Apply returns a copy of iceCream with the fields of the patch set
+func (p IceCreamPatch) Apply(iceCream IceCream) IceCream {
+	applyString(&iceCream.ImageOpen, p.ImageOpen)
+	applyString(&iceCream.ImageClosed, p.ImageClosed)
+	applyString(&iceCream.Story, p.Story)
+	applyString(&iceCream.Description, p.Description)
+	applyStrings(&iceCream.SourcingValues, p.SourcingValues)
+	applyStrings(&iceCream.Ingredients, p.Ingredients)
+	applyString(&iceCream.AllergyInfo, p.AllergyInfo)
+	applyString(&iceCream.DietaryCertification, p.DietaryCertification)
+	applyString(&iceCream.ProductID, p.ProductID)
+	return iceCream
+}
+
+//IsEmpty reports whether the patch changes no field
+func (p IceCreamPatch) IsEmpty() bool {
+	p.Version = 0
+	return p == IceCreamPatch{}
+}
+
+func applyString(field *string, value *string) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+func applyStrings(field *[]string, values *[]string) {
+	if values == nil {
+		return
+	}
+	if *values == nil {
+		*field = nil
+		return
+	}
+	*field = append([]string{}, *values...)
+}
@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/lib/pq"
+	"github.com/sudarshan-reddy/benjerry/db"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//storeAllergens derives the allergens of the stored iceCream, which
+//needs its ingredient tree, and stores them along with it
+func storeAllergens(ctx context.Context, db db.ContextDB, iceCream *models.IceCream) error {
+	*iceCream = iceCream.DeriveAllergens()
+	_, err := db.ExecContext(ctx, `
+	UPDATE ice_cream
+    SET contains_allergens = $2,
+    may_contain_allergens = $3
+    WHERE name = $1`,
+		iceCream.Name, pq.Array(iceCream.Allergens.Contains), pq.Array(iceCream.Allergens.MayContain))
+	return err
+}
+
+//loadAllergens derives the allergens of iceCreams, which need their
+//ingredient trees, unless they were stored before allergens were
+func loadAllergens(ctx context.Context, db db.ContextDB, iceCreams []models.IceCream) error {
+	if len(iceCreams) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(iceCreams))
+	for _, iceCream := range iceCreams {
+		names = append(names, iceCream.Name)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+	SELECT name
+    FROM ice_cream
+    WHERE name = ANY($1)
+    AND contains_allergens IS NOT NULL`, pq.Array(names))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	derived := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		derived[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for index := range iceCreams {
+		if derived[iceCreams[index].Name] {
+			iceCreams[index] = iceCreams[index].DeriveAllergens()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//whereBuilder accumulates sql conditions along with their positional
+//arguments so they can be joined into a single WHERE clause
+type whereBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+//add appends a condition. Every `?` in condition is replaced with the
+//positional placeholder of the matching arg
+func (w *whereBuilder) add(condition string, args ...interface{}) {
+	for _, arg := range args {
+		w.args = append(w.args, arg)
+		condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(w.args)), 1)
+	}
+	w.conditions = append(w.conditions, condition)
+}
+
+func (w *whereBuilder) addArrayFilter(column string, filter models.ArrayFilter) {
+	if len(filter.ContainsAll) > 0 {
+		w.add(column+" @> ?", pq.Array(filter.ContainsAll))
+	}
+	if len(filter.ContainsAny) > 0 {
+		w.add(column+" && ?", pq.Array(filter.ContainsAny))
+	}
+	if len(filter.Excludes) > 0 {
+		w.add("NOT (COALESCE("+column+", '{}') && ?)", pq.Array(filter.Excludes))
+	}
+}
+
+func (w *whereBuilder) addIceCreamFilter(filter models.IceCreamFilter) {
+	w.addArrayFilter("sourcing_values", filter.SourcingValues)
+	w.addArrayFilter("ingredients", filter.Ingredients)
+	if filter.DietaryCertification != "" {
+		w.add("dietary_certification = ?", filter.DietaryCertification)
+	}
+	if filter.AllergyInfo != "" {
+		w.add("strpos(lower(allergy_info), lower(?)) > 0", filter.AllergyInfo)
+	}
+	if len(filter.FreeFrom) > 0 {
+		w.add("contains_allergens IS NOT NULL AND NOT (contains_allergens && ?)", pq.Array(filter.FreeFrom))
+		w.add("NOT (may_contain_allergens && ?)", pq.Array(filter.FreeFrom))
+	}
+}
+
+//clause returns the conditions joined as a WHERE clause
+func (w *whereBuilder) clause() string {
+	if len(w.conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(w.conditions, " AND ")
+}
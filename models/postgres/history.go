@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/sudarshan-reddy/benjerry/db"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//recordHistory appends entry to the history of its ice cream. It is
+//meant to run in the transaction of the change it describes
+func recordHistory(ctx context.Context, db db.ContextDB, entry models.HistoryEntry) error {
+	query := `
+	INSERT INTO ice_cream_history (name,
+    version,
+    action,
+    actor,
+    request_id,
+    changes,
+    snapshot,
+    changed_at)
+    VALUES($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+	snapshot, err := json.Marshal(entry.Snapshot)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, query, entry.Name, entry.Version, entry.Action,
+		entry.Actor, entry.RequestID, string(changes), string(snapshot), entry.ChangedAt)
+	return err
+}
+
+//History returns every change recorded for the ice cream called name,
+//newest first
+func (i *iceCreamStore) History(ctx context.Context, name string) ([]models.HistoryEntry, error) {
+	query := `
+	SELECT name,
+    version,
+    action,
+    actor,
+    request_id,
+    changed_at,
+    changes,
+    snapshot
+    FROM ice_cream_history
+    WHERE name = $1
+    ORDER BY id DESC
+    `
+
+	db, err := i.GetContextDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, query, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []models.HistoryEntry{}
+	for rows.Next() {
+		var entry models.HistoryEntry
+		var changes, snapshot []byte
+		err := rows.Scan(&entry.Name, &entry.Version, &entry.Action, &entry.Actor,
+			&entry.RequestID, &entry.ChangedAt, &changes, &snapshot)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(snapshot, &entry.Snapshot); err != nil {
+			return nil, err
+		}
+		entry.Snapshot.Version = entry.Version
+		history = append(history, entry)
+	}
+
+	return history, rows.Err()
+}
@@ -3,14 +3,36 @@ package postgres
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/lib/pq"
 	"github.com/sudarshan-reddy/benjerry/db"
 	"github.com/sudarshan-reddy/benjerry/models"
 )
 
+//iceCreamColumns are the columns read into an IceCream, in the
+//order of the destinations returned by iceCreamFields
+const iceCreamColumns = `name,
+    image_open, 
+    image_closed,
+    story,
+    description,
+    sourcing_values,
+    ingredients,
+    allergy_info, 
+    dietary_certification,
+    product_id,
+    version`
+
+//iceCreamFields returns the scan destinations of iceCreamColumns
+func iceCreamFields(iceCream *models.IceCream) []interface{} {
+	return []interface{}{&iceCream.Name, &iceCream.ImageOpen,
+		&iceCream.ImageClosed, &iceCream.Story, &iceCream.Description,
+		pq.Array(&iceCream.SourcingValues), pq.Array(&iceCream.Ingredients), &iceCream.AllergyInfo,
+		&iceCream.DietaryCertification, &iceCream.ProductID, &iceCream.Version}
+}
+
 type iceCreamStore struct {
 	*db.DB
 }
@@ -21,7 +43,25 @@ func NewIceCreamStore(db *db.DB) models.IceCreamStore {
 	return &iceCreamStore{db}
 }
 
+//StoreContext inserts iceCreamInput, failing with
+//models.ErrRowAlreadyExists if a live row holds its name
 func (i *iceCreamStore) StoreContext(ctx context.Context, iceCreamInput models.IceCream) error {
+	return i.WithTxContext(ctx, func(ctx context.Context) error {
+		db, err := i.GetContextDB(ctx)
+		if err != nil {
+			return fmt.Errorf("error preparing context: %s", err)
+		}
+
+		_, err = insert(ctx, db, iceCreamInput)
+		return err
+	})
+}
+
+//insert stores iceCreamInput and returns the stored row. A trashed row
+//is replaced, moving it to the end of the listing and bumping its
+//version so stale ETags are not honoured
+func insert(ctx context.Context, db db.ContextDB, iceCreamInput models.IceCream) (*models.IceCream, error) {
+	iceCreamInput = iceCreamInput.NormalizeIngredients()
 	query := `
 	INSERT INTO ice_cream (name,
     image_open, 
@@ -34,44 +74,63 @@ func (i *iceCreamStore) StoreContext(ctx context.Context, iceCreamInput models.I
     dietary_certification,
     product_id)
     VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-    ON CONFLICT DO NOTHING
-	`
-
-	db, err := i.GetContextDB(ctx)
-	if err != nil {
-		return fmt.Errorf("error preparing context: %s", err)
-	}
+    ON CONFLICT (name) DO UPDATE SET
+    cursor = DEFAULT,
+    image_open = EXCLUDED.image_open,
+    image_closed = EXCLUDED.image_closed,
+    story = EXCLUDED.story,
+    description = EXCLUDED.description,
+    sourcing_values = EXCLUDED.sourcing_values,
+    ingredients = EXCLUDED.ingredients,
+    allergy_info = EXCLUDED.allergy_info,
+    dietary_certification = EXCLUDED.dietary_certification,
+    product_id = EXCLUDED.product_id,
+    version = ice_cream.version + 1,
+    deleted_at = NULL,
+    deleted_by = NULL
+    WHERE ice_cream.deleted_at IS NOT NULL
+    RETURNING ` + iceCreamColumns
 
-	_, err = db.ExecContext(ctx, query, iceCreamInput.Name, iceCreamInput.ImageOpen,
+	var stored models.IceCream
+	err := db.QueryRowContext(ctx, query, iceCreamInput.Name, iceCreamInput.ImageOpen,
 		iceCreamInput.ImageClosed, iceCreamInput.Story, iceCreamInput.Description,
 		pq.Array(iceCreamInput.SourcingValues), pq.Array(iceCreamInput.Ingredients),
 		iceCreamInput.AllergyInfo, iceCreamInput.DietaryCertification,
-		iceCreamInput.ProductID)
+		iceCreamInput.ProductID).Scan(iceCreamFields(&stored)...)
+	//nothing is returned when a live row already holds the name
+	if err == sql.ErrNoRows {
+		return nil, models.ErrRowAlreadyExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := storeIngredientTree(ctx, db, stored.Name, iceCreamInput.IngredientTree); err != nil {
+		return nil, err
+	}
+	stored.IngredientTree = iceCreamInput.IngredientTree
+	if err := storeAllergens(ctx, db, &stored); err != nil {
+		return nil, err
+	}
 
-	return err
+	entry := models.NewHistoryEntry(ctx, models.HistoryCreate, models.IceCream{}, stored)
+	return &stored, recordHistory(ctx, db, entry)
 }
 
-func (i *iceCreamStore) Get(name string) (*models.IceCream, error) {
+func (i *iceCreamStore) Get(ctx context.Context, name string) (*models.IceCream, error) {
 	query := `
-	SELECT name,
-    image_open, 
-    image_closed,
-    story,
-    description,
-    sourcing_values,
-    ingredients,
-    allergy_info, 
-    dietary_certification,
-    product_id 
+	SELECT ` + iceCreamColumns + `
     FROM ice_cream 
     WHERE name = $1
+    AND deleted_at IS NULL
     `
 
+	db, err := i.GetContextDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing context: %s", err)
+	}
+
 	var iceCream models.IceCream
-	err := i.QueryRow(query, name).Scan(&iceCream.Name, &iceCream.ImageOpen,
-		&iceCream.ImageClosed, &iceCream.Story, &iceCream.Description,
-		pq.Array(&iceCream.SourcingValues), pq.Array(&iceCream.Ingredients), &iceCream.AllergyInfo,
-		&iceCream.DietaryCertification, &iceCream.ProductID)
+	err = db.QueryRowContext(ctx, query, name).Scan(iceCreamFields(&iceCream)...)
 
 	if err == sql.ErrNoRows {
 		return nil, models.ErrNoRows
@@ -81,14 +140,86 @@ func (i *iceCreamStore) Get(name string) (*models.IceCream, error) {
 		return nil, err
 	}
 
-	return &iceCream, nil
+	iceCreams := []models.IceCream{iceCream}
+	if err := loadIngredientTrees(ctx, db, iceCreams); err != nil {
+		return nil, err
+	}
+	if err := loadAllergens(ctx, db, iceCreams); err != nil {
+		return nil, err
+	}
+	return &iceCreams[0], nil
 }
 
-func (i *iceCreamStore) GetAll() ([]models.IceCream, error) {
-	return nil, errors.New("not implemented")
+func (i *iceCreamStore) GetAll(ctx context.Context, filter models.IceCreamFilter, pageSize int,
+	cursor string) (*models.IceCreamPage, error) {
+	pageCursor, err := models.DecodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison, order := ">", "ASC"
+	if pageCursor.Backward {
+		comparison, order = "<", "DESC"
+	}
+
+	var where whereBuilder
+	where.add("cursor "+comparison+" ?", pageCursor.Position)
+	where.add("deleted_at IS NULL")
+	where.addIceCreamFilter(filter)
+	//fetch one extra row to know if there is a page beyond this one
+	args := append(where.args, pageSize+1)
+
+	query := fmt.Sprintf(`
+	SELECT cursor,
+    %s
+    FROM ice_cream 
+    %s
+    ORDER BY cursor %s
+    LIMIT $%d
+    `, iceCreamColumns, where.clause(), order, len(args))
+
+	db, err := i.GetContextDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing context: %s", err)
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var positions []int64
+	iceCreams := []models.IceCream{}
+	for rows.Next() {
+		var position int64
+		var iceCream models.IceCream
+		err := rows.Scan(append([]interface{}{&position}, iceCreamFields(&iceCream)...)...)
+		if err != nil {
+			return nil, err
+		}
+		positions = append(positions, position)
+		iceCreams = append(iceCreams, iceCream)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := loadIngredientTrees(ctx, db, iceCreams); err != nil {
+		return nil, err
+	}
+	if err := loadAllergens(ctx, db, iceCreams); err != nil {
+		return nil, err
+	}
+
+	return models.NewIceCreamPage(pageCursor, pageSize, positions, iceCreams), nil
 }
 
-func (i *iceCreamStore) Update(iceCreamInput models.IceCream) error {
+//Update changes the non empty fields of iceCreamInput and returns the
+//updated row. When iceCreamInput.Version is set the row is only updated
+//if it still is at that version, models.ErrVersionMismatch is returned
+//otherwise
+func (i *iceCreamStore) Update(ctx context.Context, iceCreamInput models.IceCream) (*models.IceCream, error) {
 	query := `
 		UPDATE ice_cream
 		SET  
@@ -98,27 +229,311 @@ func (i *iceCreamStore) Update(iceCreamInput models.IceCream) error {
     	description = COALESCE(NULLIF($5,''), description),
     	sourcing_values = COALESCE($6, sourcing_values),
     	ingredients = COALESCE($7, ingredients),
-    	allergy_info = COALESCE($8, allergy_info), 
+    	allergy_info = COALESCE(NULLIF($8,''), allergy_info), 
     	dietary_certification = COALESCE(NULLIF($9,''), dietary_certification),
-    	product_id = COALESCE(NULLIF($10,''), product_id)
+    	product_id = COALESCE(NULLIF($10,''), product_id),
+    	version = version + 1
     	WHERE name = $1
-    `
+    	RETURNING ` + iceCreamColumns
+
+	iceCreamInput = iceCreamInput.NormalizeIngredients()
+	var after models.IceCream
+	err := i.WithTxContext(ctx, func(ctx context.Context) error {
+		db, err := i.GetContextDB(ctx)
+		if err != nil {
+			return fmt.Errorf("error preparing context: %s", err)
+		}
+
+		before, err := selectForUpdate(ctx, db, iceCreamInput.Name, iceCreamInput.Version)
+		if err != nil {
+			return err
+		}
+
+		err = db.QueryRowContext(ctx, query, iceCreamInput.Name, iceCreamInput.ImageOpen,
+			iceCreamInput.ImageClosed, iceCreamInput.Story, iceCreamInput.Description,
+			pq.Array(iceCreamInput.SourcingValues), pq.Array(iceCreamInput.Ingredients),
+			iceCreamInput.AllergyInfo, iceCreamInput.DietaryCertification,
+			iceCreamInput.ProductID).Scan(iceCreamFields(&after)...)
+		if err != nil {
+			return err
+		}
+		after.IngredientTree = before.IngredientTree
+		if iceCreamInput.Ingredients != nil {
+			if err := storeIngredientTree(ctx, db, after.Name, iceCreamInput.IngredientTree); err != nil {
+				return err
+			}
+			after.IngredientTree = iceCreamInput.IngredientTree
+		}
+		if err := storeAllergens(ctx, db, &after); err != nil {
+			return err
+		}
+
+		return recordHistory(ctx, db, models.NewHistoryEntry(ctx, models.HistoryUpdate, *before, after))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &after, nil
+}
+
+//Replace overwrites every field of the row called iceCreamInput.Name.
+//It is conditional on iceCreamInput.Version like Update, but returns
+//models.ErrNoRows when an unconditional replace finds no row
+func (i *iceCreamStore) Replace(ctx context.Context, iceCreamInput models.IceCream) error {
+	return i.WithTxContext(ctx, func(ctx context.Context) error {
+		db, err := i.GetContextDB(ctx)
+		if err != nil {
+			return fmt.Errorf("error preparing context: %s", err)
+		}
 
-	_, err := i.Exec(query, iceCreamInput.Name, iceCreamInput.ImageOpen,
+		before, err := selectForUpdate(ctx, db, iceCreamInput.Name, iceCreamInput.Version)
+		if err != nil {
+			return err
+		}
+
+		_, err = replace(ctx, db, *before, iceCreamInput)
+		return err
+	})
+}
+
+//Upsert replaces the row called iceCreamInput.Name or creates it when
+//there is none. A set iceCreamInput.Version requires the row to exist
+//at that version
+func (i *iceCreamStore) Upsert(ctx context.Context,
+	iceCreamInput models.IceCream) (*models.IceCream, bool, error) {
+	var iceCream *models.IceCream
+	var created bool
+	err := i.WithTxContext(ctx, func(ctx context.Context) error {
+		db, err := i.GetContextDB(ctx)
+		if err != nil {
+			return fmt.Errorf("error preparing context: %s", err)
+		}
+
+		before, err := selectForUpdate(ctx, db, iceCreamInput.Name, iceCreamInput.Version)
+		if err == models.ErrNoRows {
+			iceCream, err = insert(ctx, db, iceCreamInput)
+			if err != models.ErrRowAlreadyExists {
+				created = true
+				return err
+			}
+			//a concurrent create won the race, replace what it stored
+			before, err = selectForUpdate(ctx, db, iceCreamInput.Name, 0)
+		}
+		if err != nil {
+			return err
+		}
+
+		iceCream, err = replace(ctx, db, *before, iceCreamInput)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return iceCream, created, nil
+}
+
+//replace overwrites every field of before, a row locked by
+//selectForUpdate, with those of iceCreamInput
+func replace(ctx context.Context, db db.ContextDB, before models.IceCream,
+	iceCreamInput models.IceCream) (*models.IceCream, error) {
+	iceCreamInput = iceCreamInput.NormalizeIngredients()
+	query := `
+	UPDATE ice_cream
+	SET image_open = $2,
+    image_closed = $3,
+    story = $4,
+    description = $5,
+    sourcing_values = $6,
+    ingredients = $7,
+    allergy_info = $8,
+    dietary_certification = $9,
+    product_id = $10,
+    version = version + 1
+    WHERE name = $1
+    RETURNING ` + iceCreamColumns
+
+	var after models.IceCream
+	err := db.QueryRowContext(ctx, query, before.Name, iceCreamInput.ImageOpen,
 		iceCreamInput.ImageClosed, iceCreamInput.Story, iceCreamInput.Description,
 		pq.Array(iceCreamInput.SourcingValues), pq.Array(iceCreamInput.Ingredients),
 		iceCreamInput.AllergyInfo, iceCreamInput.DietaryCertification,
-		iceCreamInput.ProductID)
+		iceCreamInput.ProductID).Scan(iceCreamFields(&after)...)
+	if err != nil {
+		return nil, err
+	}
+	if err := storeIngredientTree(ctx, db, after.Name, iceCreamInput.IngredientTree); err != nil {
+		return nil, err
+	}
+	after.IngredientTree = iceCreamInput.IngredientTree
+	if err := storeAllergens(ctx, db, &after); err != nil {
+		return nil, err
+	}
+
+	entry := models.NewHistoryEntry(ctx, models.HistoryReplace, before, after)
+	return &after, recordHistory(ctx, db, entry)
+}
+
+//Patch changes only the columns set in patch and returns the patched
+//row. It is conditional on patch.Version like Update, but returns
+//models.ErrNoRows when an unconditional patch finds no row
+func (i *iceCreamStore) Patch(ctx context.Context, name string,
+	patch models.IceCreamPatch) (*models.IceCream, error) {
+	args := []interface{}{name}
+	var assignments []string
+	assign := func(column string, value interface{}) {
+		args = append(args, value)
+		assignments = append(assignments, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	for _, field := range []struct {
+		column string
+		value  *string
+	}{
+		{"image_open", patch.ImageOpen},
+		{"image_closed", patch.ImageClosed},
+		{"story", patch.Story},
+		{"description", patch.Description},
+		{"allergy_info", patch.AllergyInfo},
+		{"dietary_certification", patch.DietaryCertification},
+		{"product_id", patch.ProductID},
+	} {
+		if field.value != nil {
+			assign(field.column, *field.value)
+		}
+	}
+	if patch.SourcingValues != nil {
+		assign("sourcing_values", pq.Array(*patch.SourcingValues))
+	}
+	var ingredients models.IceCream
+	if patch.Ingredients != nil {
+		ingredients = models.IceCream{Ingredients: *patch.Ingredients}.NormalizeIngredients()
+		assign("ingredients", pq.Array(ingredients.Ingredients))
+	}
+
+	query := `
+	UPDATE ice_cream
+	SET ` + strings.Join(assignments, ", ") + `,
+    version = version + 1
+    WHERE name = $1
+    RETURNING ` + iceCreamColumns
+
+	var after models.IceCream
+	err := i.WithTxContext(ctx, func(ctx context.Context) error {
+		db, err := i.GetContextDB(ctx)
+		if err != nil {
+			return fmt.Errorf("error preparing context: %s", err)
+		}
+
+		before, err := selectForUpdate(ctx, db, name, patch.Version)
+		if err != nil {
+			return err
+		}
+		if patch.IsEmpty() {
+			after = *before
+			return nil
+		}
+
+		err = db.QueryRowContext(ctx, query, args...).Scan(iceCreamFields(&after)...)
+		if err != nil {
+			return err
+		}
+		after.IngredientTree = before.IngredientTree
+		if patch.Ingredients != nil {
+			if err := storeIngredientTree(ctx, db, name, ingredients.IngredientTree); err != nil {
+				return err
+			}
+			after.IngredientTree = ingredients.IngredientTree
+		}
+		if err := storeAllergens(ctx, db, &after); err != nil {
+			return err
+		}
 
-	return err
+		return recordHistory(ctx, db, models.NewHistoryEntry(ctx, models.HistoryUpdate, *before, after))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &after, nil
 }
 
-func (i *iceCreamStore) Delete(name string) error {
+//Delete moves the row called name to the trash, recording the actor
+//found in ctx. When version is set the row is only removed if it still
+//is at that version, models.ErrVersionMismatch is returned otherwise
+func (i *iceCreamStore) Delete(ctx context.Context, name string, version int64) error {
 	query := `
-	DELETE FROM ice_cream
+	UPDATE ice_cream
+	SET deleted_at = now(),
+	deleted_by = $3,
+	version = version + 1
 	WHERE name = $1
-	`
+	AND deleted_at IS NULL
+	AND ($2::bigint = 0 OR version = $2)
+	RETURNING ` + iceCreamColumns
+
+	return i.WithTxContext(ctx, func(ctx context.Context) error {
+		db, err := i.GetContextDB(ctx)
+		if err != nil {
+			return fmt.Errorf("error preparing context: %s", err)
+		}
+
+		var deleted models.IceCream
+		err = db.QueryRowContext(ctx, query, name, version, models.ActorFromContext(ctx)).
+			Scan(iceCreamFields(&deleted)...)
+		if err == sql.ErrNoRows {
+			if version != 0 {
+				return models.ErrVersionMismatch
+			}
+			return models.ErrNoRows
+		}
+		if err != nil {
+			return err
+		}
 
-	_, err := i.Exec(query, name)
-	return err
+		iceCreams := []models.IceCream{deleted}
+		if err := loadIngredientTrees(ctx, db, iceCreams); err != nil {
+			return err
+		}
+		if err := loadAllergens(ctx, db, iceCreams); err != nil {
+			return err
+		}
+		return recordHistory(ctx, db, models.NewHistoryEntry(ctx, models.HistoryDelete, iceCreams[0], iceCreams[0]))
+	})
+}
+
+//selectForUpdate reads and locks the live row called name for the rest
+//of the transaction. A missing row is reported as models.ErrNoRows,
+//unless version is set in which case it is a models.ErrVersionMismatch
+//as is a row at any other version
+func selectForUpdate(ctx context.Context, db db.ContextDB, name string, version int64) (*models.IceCream, error) {
+	query := `
+	SELECT ` + iceCreamColumns + `
+    FROM ice_cream 
+    WHERE name = $1
+    AND deleted_at IS NULL
+    FOR UPDATE
+    `
+
+	var iceCream models.IceCream
+	err := db.QueryRowContext(ctx, query, name).Scan(iceCreamFields(&iceCream)...)
+	if err == sql.ErrNoRows {
+		if version != 0 {
+			return nil, models.ErrVersionMismatch
+		}
+		return nil, models.ErrNoRows
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if version != 0 && iceCream.Version != version {
+		return nil, models.ErrVersionMismatch
+	}
+
+	iceCreams := []models.IceCream{iceCream}
+	if err := loadIngredientTrees(ctx, db, iceCreams); err != nil {
+		return nil, err
+	}
+	if err := loadAllergens(ctx, db, iceCreams); err != nil {
+		return nil, err
+	}
+	return &iceCreams[0], nil
 }
@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/sudarshan-reddy/benjerry/db"
+	"github.com/sudarshan-reddy/benjerry/models"
+	"github.com/sudarshan-reddy/benjerry/models/storetest"
+)
+
+//testDBURLEnv points the tests at a postgres db they are free to wipe
+const testDBURLEnv = "BENJERRY_TEST_POSTGRES_DB_URL"
+
+var (
+	connectOnce sync.Once
+	testDB      *db.DB
+	connectErr  error
+)
+
+//newTestDB connects to the db in testDBURLEnv and empties every table.
+//The test is skipped when the env variable is not set
+func newTestDB(t *testing.T) *db.DB {
+	dbURL := os.Getenv(testDBURLEnv)
+	if dbURL == "" {
+		t.Skipf("%s is not set", testDBURLEnv)
+	}
+
+	connectOnce.Do(func() {
+		db.RunMigrateScripts(dbURL, "../../db/migrations")
+		testDB, connectErr = db.NewPostgresDB(dbURL, 2)
+	})
+	if connectErr != nil {
+		t.Fatalf("connecting to %s: %s", dbURL, connectErr)
+	}
+
+	if _, err := testDB.Exec("TRUNCATE ice_cream, ingredient, registered_ingredient, api_token RESTART IDENTITY CASCADE"); err != nil {
+		t.Fatalf("emptying tables: %s", err)
+	}
+	return testDB
+}
+
+func Test_IceCreamStoreConformance(t *testing.T) {
+	storetest.RunIceCreamStoreTests(t, func(t *testing.T) models.IceCreamStore {
+		return NewIceCreamStore(newTestDB(t))
+	})
+}
+
+func Test_IngredientStoreConformance(t *testing.T) {
+	storetest.RunIngredientStoreTests(t, func(t *testing.T) models.IngredientStore {
+		return NewIngredientStore(newTestDB(t))
+	})
+}
+
+func Test_TokenStoreConformance(t *testing.T) {
+	storetest.RunTokenStoreTests(t, func(t *testing.T) models.TokenStore {
+		return NewTokenStore(newTestDB(t))
+	})
+}
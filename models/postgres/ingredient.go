@@ -0,0 +1,132 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/lib/pq"
+	"github.com/sudarshan-reddy/benjerry/db"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//ingredientNode is a row of ice_cream_ingredient, an ingredient of an
+//ingredient tree flattened in preorder. parent is the position of the
+//compound ingredient it is part of, -1 for top level ones
+type ingredientNode struct {
+	position int64
+	parent   int64
+	name     string
+}
+
+func flattenIngredientTree(tree []models.Ingredient) []ingredientNode {
+	var nodes []ingredientNode
+	var flatten func(ingredients []models.Ingredient, parent int64)
+	flatten = func(ingredients []models.Ingredient, parent int64) {
+		for _, ingredient := range ingredients {
+			position := int64(len(nodes))
+			nodes = append(nodes, ingredientNode{position: position, parent: parent, name: ingredient.Name})
+			flatten(ingredient.Ingredients, position)
+		}
+	}
+	flatten(tree, -1)
+	return nodes
+}
+
+//buildIngredientTree is the reverse of flattenIngredientTree, nodes
+//have to be ordered by position
+func buildIngredientTree(nodes []ingredientNode) []models.Ingredient {
+	children := map[int64][]ingredientNode{}
+	for _, node := range nodes {
+		children[node.parent] = append(children[node.parent], node)
+	}
+
+	var build func(parent int64) []models.Ingredient
+	build = func(parent int64) []models.Ingredient {
+		var ingredients []models.Ingredient
+		for _, node := range children[parent] {
+			ingredients = append(ingredients, models.Ingredient{Name: node.name, Ingredients: build(node.position)})
+		}
+		return ingredients
+	}
+	return build(-1)
+}
+
+//storeIngredientTree replaces the ingredient tree stored for the ice
+//cream called name with tree
+func storeIngredientTree(ctx context.Context, db db.ContextDB, name string, tree []models.Ingredient) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM ice_cream_ingredient WHERE ice_cream_name = $1`, name)
+	if err != nil {
+		return err
+	}
+
+	nodes := flattenIngredientTree(tree)
+	if len(nodes) == 0 {
+		return nil
+	}
+	positions := make([]int64, 0, len(nodes))
+	parents := make([]int64, 0, len(nodes))
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		positions = append(positions, node.position)
+		parents = append(parents, node.parent)
+		names = append(names, node.name)
+	}
+
+	_, err = db.ExecContext(ctx, `
+	INSERT INTO ingredient (name)
+    SELECT DISTINCT unnest($1::text[])
+    ON CONFLICT (name) DO NOTHING`, pq.Array(names))
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `
+	INSERT INTO ice_cream_ingredient (ice_cream_name, position, parent_position, ingredient_id)
+    SELECT $1, node.position, NULLIF(node.parent_position, -1), ingredient.id
+    FROM unnest($2::int[], $3::int[], $4::text[]) AS node(position, parent_position, name)
+    JOIN ingredient ON ingredient.name = node.name`,
+		name, pq.Array(positions), pq.Array(parents), pq.Array(names))
+	return err
+}
+
+//loadIngredientTrees reads the ingredient trees of iceCreams
+func loadIngredientTrees(ctx context.Context, db db.ContextDB, iceCreams []models.IceCream) error {
+	if len(iceCreams) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(iceCreams))
+	for _, iceCream := range iceCreams {
+		names = append(names, iceCream.Name)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+	SELECT ice_cream_ingredient.ice_cream_name,
+    ice_cream_ingredient.position,
+    COALESCE(ice_cream_ingredient.parent_position, -1),
+    ingredient.name
+    FROM ice_cream_ingredient
+    JOIN ingredient ON ingredient.id = ice_cream_ingredient.ingredient_id
+    WHERE ice_cream_ingredient.ice_cream_name = ANY($1)
+    ORDER BY ice_cream_ingredient.ice_cream_name, ice_cream_ingredient.position`, pq.Array(names))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	nodes := map[string][]ingredientNode{}
+	for rows.Next() {
+		var iceCreamName string
+		var node ingredientNode
+		if err := rows.Scan(&iceCreamName, &node.position, &node.parent, &node.name); err != nil {
+			return err
+		}
+		nodes[iceCreamName] = append(nodes[iceCreamName], node)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for index := range iceCreams {
+		iceCreams[index].IngredientTree = buildIngredientTree(nodes[iceCreams[index].Name])
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+func Test_flattenIngredientTree(t *testing.T) {
+	tree := []models.Ingredient{
+		{Name: "cream"},
+		{Name: "fudge", Ingredients: []models.Ingredient{
+			{Name: "cocoa", Ingredients: []models.Ingredient{{Name: "processed with alkali"}}},
+			{Name: "sugar"},
+		}},
+		{Name: "salt"},
+	}
+
+	nodes := flattenIngredientTree(tree)
+	assert.Equal(t, []ingredientNode{
+		{position: 0, parent: -1, name: "cream"},
+		{position: 1, parent: -1, name: "fudge"},
+		{position: 2, parent: 1, name: "cocoa"},
+		{position: 3, parent: 2, name: "processed with alkali"},
+		{position: 4, parent: 1, name: "sugar"},
+		{position: 5, parent: -1, name: "salt"},
+	}, nodes)
+	assert.Equal(t, tree, buildIngredientTree(nodes))
+	assert.Nil(t, buildIngredientTree(nil))
+}
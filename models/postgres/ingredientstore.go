@@ -0,0 +1,207 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/sudarshan-reddy/benjerry/db"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//uniqueViolation is the postgres error code of unique constraints
+const uniqueViolation = "23505"
+
+type ingredientStore struct {
+	*db.DB
+}
+
+//NewIngredientStore returns a new instance of IngredientStore that
+//is coupled to postgresql
+func NewIngredientStore(db *db.DB) models.IngredientStore {
+	return &ingredientStore{db}
+}
+
+//registryError converts the errors of writes to the registry, a taken
+//name or synonym breaking the key of registered_ingredient_key
+func registryError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation {
+		return models.ErrRowAlreadyExists
+	}
+	return err
+}
+
+//storeKeys registers the name and synonyms of ingredient
+func storeKeys(ctx context.Context, db db.ContextDB, ingredient models.RegisteredIngredient) error {
+	_, err := db.ExecContext(ctx, `
+	INSERT INTO registered_ingredient_key (key, ingredient_name)
+    SELECT unnest($1::text[]), $2`, pq.Array(ingredient.Keys()), ingredient.Name)
+	return err
+}
+
+func (i *ingredientStore) StoreIngredient(ctx context.Context, ingredient models.RegisteredIngredient) error {
+	err := i.WithTxContext(ctx, func(ctx context.Context) error {
+		db, err := i.GetContextDB(ctx)
+		if err != nil {
+			return fmt.Errorf("error preparing context: %s", err)
+		}
+
+		_, err = db.ExecContext(ctx, `
+		INSERT INTO registered_ingredient (name, synonyms, category, e_number)
+        VALUES ($1, COALESCE($2::text[], '{}'), $3, $4)`,
+			ingredient.Name, pq.Array(ingredient.Synonyms), ingredient.Category, ingredient.ENumber)
+		if err != nil {
+			return err
+		}
+		return storeKeys(ctx, db, ingredient)
+	})
+	return registryError(err)
+}
+
+func (i *ingredientStore) GetIngredient(ctx context.Context, name string) (*models.RegisteredIngredient, error) {
+	db, err := i.GetContextDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing context: %s", err)
+	}
+
+	var ingredient models.RegisteredIngredient
+	err = db.QueryRowContext(ctx, `
+	SELECT name, synonyms, category, e_number
+    FROM registered_ingredient
+    WHERE name = $1`, name).Scan(&ingredient.Name, pq.Array(&ingredient.Synonyms),
+		&ingredient.Category, &ingredient.ENumber)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNoRows
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ingredient, nil
+}
+
+func (i *ingredientStore) ListIngredients(ctx context.Context) ([]models.RegisteredIngredient, error) {
+	db, err := i.GetContextDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing context: %s", err)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+	SELECT name, synonyms, category, e_number
+    FROM registered_ingredient
+    ORDER BY name COLLATE "C"`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ingredients := []models.RegisteredIngredient{}
+	for rows.Next() {
+		var ingredient models.RegisteredIngredient
+		if err := rows.Scan(&ingredient.Name, pq.Array(&ingredient.Synonyms),
+			&ingredient.Category, &ingredient.ENumber); err != nil {
+			return nil, err
+		}
+		ingredients = append(ingredients, ingredient)
+	}
+	return ingredients, rows.Err()
+}
+
+func (i *ingredientStore) UpdateIngredient(ctx context.Context, name string,
+	ingredient models.RegisteredIngredient) error {
+	err := i.WithTxContext(ctx, func(ctx context.Context) error {
+		db, err := i.GetContextDB(ctx)
+		if err != nil {
+			return fmt.Errorf("error preparing context: %s", err)
+		}
+
+		//renaming carries the keys over to the new name
+		result, err := db.ExecContext(ctx, `
+		UPDATE registered_ingredient
+        SET name = $2, synonyms = COALESCE($3::text[], '{}'), category = $4, e_number = $5
+        WHERE name = $1`,
+			name, ingredient.Name, pq.Array(ingredient.Synonyms), ingredient.Category, ingredient.ENumber)
+		if err != nil {
+			return err
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if updated == 0 {
+			return models.ErrNoRows
+		}
+
+		_, err = db.ExecContext(ctx, `DELETE FROM registered_ingredient_key WHERE ingredient_name = $1`,
+			ingredient.Name)
+		if err != nil {
+			return err
+		}
+		return storeKeys(ctx, db, ingredient)
+	})
+	return registryError(err)
+}
+
+func (i *ingredientStore) DeleteIngredient(ctx context.Context, name string) error {
+	db, err := i.GetContextDB(ctx)
+	if err != nil {
+		return fmt.Errorf("error preparing context: %s", err)
+	}
+
+	result, err := db.ExecContext(ctx, `DELETE FROM registered_ingredient WHERE name = $1`, name)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return models.ErrNoRows
+	}
+	return nil
+}
+
+func (i *ingredientStore) CanonicalNames(ctx context.Context, names []string) (map[string]string, error) {
+	canonical := map[string]string{}
+	if len(names) == 0 {
+		return canonical, nil
+	}
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		keys = append(keys, models.IngredientKey(name))
+	}
+
+	db, err := i.GetContextDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing context: %s", err)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+	SELECT key, ingredient_name
+    FROM registered_ingredient_key
+    WHERE key = ANY($1)`, pq.Array(keys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byKey := map[string]string{}
+	for rows.Next() {
+		var key, ingredientName string
+		if err := rows.Scan(&key, &ingredientName); err != nil {
+			return nil, err
+		}
+		byKey[key] = ingredientName
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for index, name := range names {
+		if ingredientName, ok := byKey[keys[index]]; ok {
+			canonical[name] = ingredientName
+		}
+	}
+	return canonical, nil
+}
@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5"
+
+//tsQuery converts a SearchQuery into the to_tsquery syntax.
+//Words only hold letters and digits so they need no escaping
+func tsQuery(query models.SearchQuery) string {
+	terms := make([]string, 0, len(query))
+	for _, term := range query {
+		words := append([]string{}, term.Words...)
+		if term.Prefix {
+			words[len(words)-1] += ":*"
+		}
+		terms = append(terms, "("+strings.Join(words, " <-> ")+")")
+	}
+	return strings.Join(terms, " & ")
+}
+
+func (i *iceCreamStore) Search(ctx context.Context, query models.SearchQuery,
+	limit int) ([]models.SearchResult, error) {
+	sqlQuery := `
+	SELECT ` + iceCreamColumns + `,
+    ts_rank_cd(search_vector, query) AS rank,
+    ts_headline('english', coalesce(story, ''), query, $3),
+    ts_headline('english', coalesce(description, ''), query, $3)
+    FROM ice_cream, to_tsquery('english', $1) query
+    WHERE search_vector @@ query
+    AND deleted_at IS NULL
+    ORDER BY rank DESC, name ASC
+    LIMIT $2
+    `
+
+	db, err := i.GetContextDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing context: %s", err)
+	}
+
+	rows, err := db.QueryContext(ctx, sqlQuery, tsQuery(query), limit, headlineOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var result models.SearchResult
+		fields := append(iceCreamFields(&result.IceCream), &result.Rank,
+			&result.Highlights.Story, &result.Highlights.Description)
+		err := rows.Scan(fields...)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
@@ -0,0 +1,19 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+func Test_tsQuery(t *testing.T) {
+	query := models.SearchQuery{
+		{Words: []string{"coffee"}},
+		{Words: []string{"chocolate", "cookie"}},
+		{Words: []string{"chees"}, Prefix: true},
+	}
+	assert.Equal(t, "(coffee) & (chocolate <-> cookie) & (chees:*)", tsQuery(query))
+	//the original query should be left untouched
+	assert.Equal(t, []string{"chees"}, query[2].Words)
+}
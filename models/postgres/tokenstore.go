@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sudarshan-reddy/benjerry/db"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//tokenColumns are the columns of api_token read into an APIToken by
+//scanToken
+const tokenColumns = `id, owner, kind, scopes, secret_hash, created_at, expires_at, last_used_at, revoked_at`
+
+type tokenStore struct {
+	*db.DB
+}
+
+//NewTokenStore returns a new instance of TokenStore that is coupled to
+//postgresql
+func NewTokenStore(db *db.DB) models.TokenStore {
+	return &tokenStore{db}
+}
+
+//scanToken reads a row of tokenColumns
+func scanToken(row interface{ Scan(...interface{}) error }) (*models.APIToken, error) {
+	var token models.APIToken
+	err := row.Scan(&token.ID, &token.Owner, &token.Kind, pq.Array(&token.Scopes), &token.SecretHash, &token.CreatedAt,
+		&token.ExpiresAt, &token.LastUsedAt, &token.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (t *tokenStore) StoreToken(ctx context.Context, token models.APIToken) error {
+	db, err := t.GetContextDB(ctx)
+	if err != nil {
+		return fmt.Errorf("error preparing context: %s", err)
+	}
+
+	_, err = db.ExecContext(ctx, `
+	INSERT INTO api_token (`+tokenColumns+`)
+    VALUES ($1, $2, $3, COALESCE($4::text[], '{}'), $5, $6, $7, $8, $9)`,
+		token.ID, token.Owner, token.Kind, pq.Array(token.Scopes), token.SecretHash, token.CreatedAt,
+		token.ExpiresAt, token.LastUsedAt, token.RevokedAt)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation {
+		return models.ErrRowAlreadyExists
+	}
+	return err
+}
+
+func (t *tokenStore) GetToken(ctx context.Context, id string) (*models.APIToken, error) {
+	db, err := t.GetContextDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing context: %s", err)
+	}
+
+	token, err := scanToken(db.QueryRowContext(ctx, `
+	SELECT `+tokenColumns+`
+    FROM api_token
+    WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNoRows
+	}
+	return token, err
+}
+
+func (t *tokenStore) ListTokens(ctx context.Context) ([]models.APIToken, error) {
+	db, err := t.GetContextDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing context: %s", err)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+	SELECT `+tokenColumns+`
+    FROM api_token
+    ORDER BY created_at, id COLLATE "C"`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []models.APIToken{}
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, rows.Err()
+}
+
+func (t *tokenStore) RevokeToken(ctx context.Context, id string, at time.Time) (*models.APIToken, error) {
+	db, err := t.GetContextDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing context: %s", err)
+	}
+
+	token, err := scanToken(db.QueryRowContext(ctx, `
+	UPDATE api_token
+    SET revoked_at = COALESCE(revoked_at, $2)
+    WHERE id = $1
+    RETURNING `+tokenColumns, id, at))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNoRows
+	}
+	return token, err
+}
+
+func (t *tokenStore) TouchToken(ctx context.Context, id string, at time.Time) error {
+	db, err := t.GetContextDB(ctx)
+	if err != nil {
+		return fmt.Errorf("error preparing context: %s", err)
+	}
+
+	result, err := db.ExecContext(ctx, `UPDATE api_token SET last_used_at = $2 WHERE id = $1`, id, at)
+	if err != nil {
+		return err
+	}
+	touched, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if touched == 0 {
+		return models.ErrNoRows
+	}
+	return nil
+}
+
+func (t *tokenStore) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	db, err := t.GetContextDB(ctx)
+	if err != nil {
+		return fmt.Errorf("error preparing context: %s", err)
+	}
+
+	//the access tokens that expired since are dropped along the way
+	_, err = db.ExecContext(ctx, `
+	WITH expired AS (
+        DELETE FROM revoked_access_token WHERE expires_at <= now()
+    )
+	INSERT INTO revoked_access_token (jti, expires_at)
+    VALUES ($1, $2)
+    ON CONFLICT (jti) DO NOTHING`, jti, expiresAt)
+	return err
+}
+
+func (t *tokenStore) AccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	db, err := t.GetContextDB(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error preparing context: %s", err)
+	}
+
+	var revoked bool
+	err = db.QueryRowContext(ctx, `
+	SELECT EXISTS (SELECT 1 FROM revoked_access_token WHERE jti = $1)`, jti).Scan(&revoked)
+	return revoked, err
+}
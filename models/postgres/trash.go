@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+func (i *iceCreamStore) GetTrash(ctx context.Context, pageSize int, cursor string) (*models.TrashPage, error) {
+	pageCursor, err := models.DecodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison, order := ">", "ASC"
+	if pageCursor.Backward {
+		comparison, order = "<", "DESC"
+	}
+
+	query := fmt.Sprintf(`
+	SELECT cursor,
+    %s,
+    deleted_at,
+    deleted_by
+    FROM ice_cream 
+    WHERE cursor %s $1
+    AND deleted_at IS NOT NULL
+    ORDER BY cursor %s
+    LIMIT $2
+    `, iceCreamColumns, comparison, order)
+
+	db, err := i.GetContextDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing context: %s", err)
+	}
+
+	//fetch one extra row to know if there is a page beyond this one
+	rows, err := db.QueryContext(ctx, query, pageCursor.Position, pageSize+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var positions []int64
+	trashed := []models.TrashedIceCream{}
+	for rows.Next() {
+		var position int64
+		var iceCream models.TrashedIceCream
+		fields := append([]interface{}{&position}, iceCreamFields(&iceCream.IceCream)...)
+		err := rows.Scan(append(fields, &iceCream.DeletedAt, &iceCream.DeletedBy)...)
+		if err != nil {
+			return nil, err
+		}
+		positions = append(positions, position)
+		trashed = append(trashed, iceCream)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return models.NewTrashPage(pageCursor, pageSize, positions, trashed), nil
+}
+
+//GetTrashed reads the row called name if it is in the trash
+func (i *iceCreamStore) GetTrashed(ctx context.Context, name string) (*models.TrashedIceCream, error) {
+	query := `
+	SELECT ` + iceCreamColumns + `,
+    deleted_at,
+    deleted_by
+    FROM ice_cream 
+    WHERE name = $1
+    AND deleted_at IS NOT NULL
+    `
+
+	db, err := i.GetContextDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing context: %s", err)
+	}
+
+	var trashed models.TrashedIceCream
+	fields := append(iceCreamFields(&trashed.IceCream), &trashed.DeletedAt, &trashed.DeletedBy)
+	err = db.QueryRowContext(ctx, query, name).Scan(fields...)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNoRows
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	iceCreams := []models.IceCream{trashed.IceCream}
+	if err := loadIngredientTrees(ctx, db, iceCreams); err != nil {
+		return nil, err
+	}
+	if err := loadAllergens(ctx, db, iceCreams); err != nil {
+		return nil, err
+	}
+	trashed.IceCream = iceCreams[0]
+	return &trashed, nil
+}
+
+//Restore moves the row called name out of the trash. models.ErrNoRows
+//is returned if there is no such row in the trash
+func (i *iceCreamStore) Restore(ctx context.Context, name string, version int64) error {
+	query := `
+	UPDATE ice_cream
+	SET deleted_at = NULL,
+	deleted_by = NULL,
+	version = version + 1
+	WHERE name = $1
+	AND deleted_at IS NOT NULL
+	AND ($2::bigint = 0 OR version = $2)
+	RETURNING ` + iceCreamColumns
+
+	return i.WithTxContext(ctx, func(ctx context.Context) error {
+		db, err := i.GetContextDB(ctx)
+		if err != nil {
+			return fmt.Errorf("error preparing context: %s", err)
+		}
+
+		var restored models.IceCream
+		err = db.QueryRowContext(ctx, query, name, version).Scan(iceCreamFields(&restored)...)
+		if err == sql.ErrNoRows {
+			if version != 0 {
+				return models.ErrVersionMismatch
+			}
+			return models.ErrNoRows
+		}
+		if err != nil {
+			return err
+		}
+
+		iceCreams := []models.IceCream{restored}
+		if err := loadIngredientTrees(ctx, db, iceCreams); err != nil {
+			return err
+		}
+		if err := loadAllergens(ctx, db, iceCreams); err != nil {
+			return err
+		}
+		return recordHistory(ctx, db, models.NewHistoryEntry(ctx, models.HistoryRestore, iceCreams[0], iceCreams[0]))
+	})
+}
+
+//Purge permanently removes the rows that were moved to the trash
+//before olderThan and returns how many were removed
+func (i *iceCreamStore) Purge(ctx context.Context, olderThan time.Time) (int64, error) {
+	query := `
+	DELETE FROM ice_cream
+	WHERE deleted_at < $1
+	`
+
+	db, err := i.GetContextDB(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error preparing context: %s", err)
+	}
+
+	result, err := db.ExecContext(ctx, query, olderThan)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
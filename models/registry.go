@@ -0,0 +1,151 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//RegisteredIngredient is an entry of the ingredient registry. Ice creams
+//listing it under any of its synonyms are stored with its Name instead.
+//ENumber is the european food additive number of additives, like E471
+type RegisteredIngredient struct {
+	Name     string   `json:"name"`
+	Synonyms []string `json:"synonyms"`
+	Category string   `json:"category"`
+	ENumber  string   `json:"e_number,omitempty"`
+}
+
+//IngredientStore holds the ingredient registry.
+//Names and synonyms are matched ignoring case and repeated spaces, see
+//IngredientKey, and no two ingredients may be known by the same one:
+//writes taking a name or synonym of another ingredient fail with
+//ErrRowAlreadyExists. Ingredients are addressed by their exact Name,
+//missing ones fail with ErrNoRows
+type IngredientStore interface {
+	StoreIngredient(ctx context.Context, ingredient RegisteredIngredient) error
+	GetIngredient(ctx context.Context, name string) (*RegisteredIngredient, error)
+	//ListIngredients returns the whole registry ordered by name
+	ListIngredients(ctx context.Context) ([]RegisteredIngredient, error)
+	//UpdateIngredient replaces the ingredient called name, which may
+	//rename it
+	UpdateIngredient(ctx context.Context, name string, ingredient RegisteredIngredient) error
+	DeleteIngredient(ctx context.Context, name string) error
+	//CanonicalNames maps every one of names that is registered, as a
+	//name or as a synonym, to the name of its ingredient. Unregistered
+	//names are left out
+	CanonicalNames(ctx context.Context, names []string) (map[string]string, error)
+}
+
+//IngredientKey is the form names and synonyms are matched in
+func IngredientKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+//Keys returns the keys of the name and synonyms of the ingredient
+func (r RegisteredIngredient) Keys() []string {
+	keys := []string{IngredientKey(r.Name)}
+	for _, synonym := range r.Synonyms {
+		keys = append(keys, IngredientKey(synonym))
+	}
+	return keys
+}
+
+//IngredientNames returns the names found anywhere in tree, compound
+//ingredients before the ones they are made of, each name once
+func IngredientNames(tree []Ingredient) []string {
+	var names []string
+	seen := map[string]bool{}
+	var walk func(ingredients []Ingredient)
+	walk = func(ingredients []Ingredient) {
+		for _, ingredient := range ingredients {
+			if !seen[ingredient.Name] {
+				seen[ingredient.Name] = true
+				names = append(names, ingredient.Name)
+			}
+			walk(ingredient.Ingredients)
+		}
+	}
+	walk(tree)
+	return names
+}
+
+//CanonicalizeIngredients returns a normalized copy of the ice cream
+//with every ingredient found in canonical, as returned by
+//IngredientStore.CanonicalNames, renamed. Ingredients that end up
+//repeated within the same list are only kept once
+func (i IceCream) CanonicalizeIngredients(canonical map[string]string) IceCream {
+	i = i.NormalizeIngredients()
+	if i.IngredientTree == nil {
+		return i
+	}
+	var rename func(ingredients []Ingredient) []Ingredient
+	rename = func(ingredients []Ingredient) []Ingredient {
+		if len(ingredients) == 0 {
+			return nil
+		}
+		renamed := make([]Ingredient, 0, len(ingredients))
+		seen := map[string]bool{}
+		for _, ingredient := range ingredients {
+			if name, ok := canonical[ingredient.Name]; ok {
+				ingredient.Name = name
+			}
+			ingredient.Ingredients = rename(ingredient.Ingredients)
+			//synonyms listed side by side collapse into one ingredient
+			if entry := ingredient.format(); !seen[entry] {
+				seen[entry] = true
+				renamed = append(renamed, ingredient)
+			}
+		}
+		return renamed
+	}
+	i.IngredientTree = rename(i.IngredientTree)
+	i.Ingredients = FormatIngredients(i.IngredientTree)
+	return i
+}
+
+//eNumberPattern matches the E numbers of additives, like E330 or E160a
+var eNumberPattern = regexp.MustCompile(`^E[0-9]{3,4}[a-z]?$`)
+
+//ingredientNameField bounds names and synonyms of the registry. They
+//must survive being written in an ingredient list, so they may not
+//hold the separators of the list
+func ingredientNameField(pointer, value string) []FieldError {
+	switch {
+	case strings.TrimSpace(value) == "":
+		return []FieldError{{Pointer: pointer, Message: "is required"}}
+	case strings.ContainsAny(value, "()[],"):
+		return []FieldError{{Pointer: pointer, Message: "should not contain brackets or commas"}}
+	}
+	if msg := (stringField{maxLength: 200}).validate(value); msg != "" {
+		return []FieldError{{Pointer: pointer, Message: msg}}
+	}
+	return nil
+}
+
+//Validate returns every constraint the ingredient breaks, or nothing
+//when it can be registered
+func (r RegisteredIngredient) Validate() []FieldError {
+	errs := ingredientNameField("/name", r.Name)
+	seen := map[string]string{IngredientKey(r.Name): "/name"}
+	for index, synonym := range r.Synonyms {
+		pointer := fmt.Sprintf("/synonyms/%d", index)
+		if synonymErrs := ingredientNameField(pointer, synonym); synonymErrs != nil {
+			errs = append(errs, synonymErrs...)
+			continue
+		}
+		if first, ok := seen[IngredientKey(synonym)]; ok {
+			errs = append(errs, FieldError{Pointer: pointer, Message: "repeats " + first})
+			continue
+		}
+		seen[IngredientKey(synonym)] = pointer
+	}
+	if msg := (stringField{maxLength: 100}).validate(r.Category); msg != "" {
+		errs = append(errs, FieldError{Pointer: "/category", Message: msg})
+	}
+	if r.ENumber != "" && !eNumberPattern.MatchString(r.ENumber) {
+		errs = append(errs, FieldError{Pointer: "/e_number", Message: "should be an E number, like E471"})
+	}
+	return errs
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RegisteredIngredientValidate(t *testing.T) {
+	var tests = []struct {
+		desc       string
+		ingredient RegisteredIngredient
+		expected   []FieldError
+	}{
+		{
+			desc: "a valid ingredient breaks nothing",
+			ingredient: RegisteredIngredient{Name: "mono and diglycerides", Synonyms: []string{"E471 emulsifier"},
+				Category: "emulsifier", ENumber: "E471"},
+		},
+		{
+			desc:       "e numbers may carry a letter",
+			ingredient: RegisteredIngredient{Name: "annatto", ENumber: "E160b"},
+		},
+		{
+			desc: "every broken constraint is returned in field order",
+			ingredient: RegisteredIngredient{
+				Name:     "liquid sugar (sugar, water)",
+				Synonyms: []string{"", "Liquid Sugar (Sugar, Water)", "syrup", "SYRUP", strings.Repeat("a", 201)},
+				Category: strings.Repeat("b", 101),
+				ENumber:  "471",
+			},
+			expected: []FieldError{
+				{Pointer: "/name", Message: "should not contain brackets or commas"},
+				{Pointer: "/synonyms/0", Message: "is required"},
+				{Pointer: "/synonyms/1", Message: "should not contain brackets or commas"},
+				{Pointer: "/synonyms/3", Message: "repeats /synonyms/2"},
+				{Pointer: "/synonyms/4", Message: "should be at most 200 characters long"},
+				{Pointer: "/category", Message: "should be at most 100 characters long"},
+				{Pointer: "/e_number", Message: "should be an E number, like E471"},
+			},
+		},
+		{
+			desc:       "synonyms may not repeat the name",
+			ingredient: RegisteredIngredient{Name: "skim milk", Synonyms: []string{"Skim  Milk"}},
+			expected:   []FieldError{{Pointer: "/synonyms/0", Message: "repeats /name"}},
+		},
+		{
+			desc:     "the name is required",
+			expected: []FieldError{{Pointer: "/name", Message: "is required"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.ingredient.Validate())
+		})
+	}
+}
+
+func Test_CanonicalizeIngredients(t *testing.T) {
+	canonical := map[string]string{
+		"nonfat milk":  "skim milk",
+		"skim milk":    "skim milk",
+		"Soy Lecithin": "soy lecithin",
+	}
+	var tests = []struct {
+		desc     string
+		iceCream IceCream
+		expected []string
+	}{
+		{
+			desc:     "synonyms are renamed at every level of the tree",
+			iceCream: IceCream{Ingredients: []string{"cream", "nonfat milk", "chocolate (cocoa", "Soy Lecithin)"}},
+			expected: []string{"cream", "skim milk", "chocolate (cocoa, soy lecithin)"},
+		},
+		{
+			desc:     "synonyms listed side by side are kept once",
+			iceCream: IceCream{Ingredients: []string{"skim milk", "nonfat milk", "sugar"}},
+			expected: []string{"skim milk", "sugar"},
+		},
+		{
+			desc:     "missing ingredients are left missing",
+			iceCream: IceCream{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			iceCream := test.iceCream.CanonicalizeIngredients(canonical)
+			assert.Equal(test.expected, iceCream.Ingredients)
+			assert.Equal(ParseIngredients(test.expected), iceCream.IngredientTree)
+		})
+	}
+}
+
+func Test_IngredientNames(t *testing.T) {
+	tree := ParseIngredients([]string{"cream", "fudge (sugar", "cream)", "sugar"})
+	assert.Equal(t, []string{"cream", "fudge", "sugar"}, IngredientNames(tree))
+	assert.Equal(t, "skim milk", IngredientKey("  Skim\tMILK "))
+}
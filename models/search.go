@@ -0,0 +1,79 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+//ErrEmptySearchQuery is returned when a search query holds no searchable words
+var ErrEmptySearchQuery = errors.New("search query has no searchable words")
+
+//SearchTerm is a single term of a search query. A term with more than
+//one word is a phrase whose words have to appear next to each other.
+//When Prefix is set the last word matches any word it is a prefix of
+type SearchTerm struct {
+	Words  []string
+	Prefix bool
+}
+
+//SearchQuery is a parsed search query. Every term has to match
+//for an IceCream to be a hit
+type SearchQuery []SearchTerm
+
+//SearchHighlights holds snippets of the searched fields with the
+//matched words wrapped in <mark></mark>
+type SearchHighlights struct {
+	Story       string `json:"story"`
+	Description string `json:"description"`
+}
+
+//SearchResult is a single ranked hit of a search
+type SearchResult struct {
+	IceCream   IceCream         `json:"ice_cream"`
+	Rank       float64          `json:"rank"`
+	Highlights SearchHighlights `json:"highlights"`
+}
+
+//ParseSearchQuery parses a user supplied query. Words separated by
+//spaces are all required, "quoted words" form a phrase and a trailing
+//`*` turns a word into a prefix. Everything but letters and digits
+//is treated as a word separator
+func ParseSearchQuery(query string) (SearchQuery, error) {
+	var searchQuery SearchQuery
+	for i, segment := range strings.Split(query, `"`) {
+		//odd segments were enclosed in quotes
+		if i%2 == 1 {
+			if term, ok := newSearchTerm(segment); ok {
+				searchQuery = append(searchQuery, term)
+			}
+			continue
+		}
+		for _, field := range strings.Fields(segment) {
+			if term, ok := newSearchTerm(field); ok {
+				searchQuery = append(searchQuery, term)
+			}
+		}
+	}
+
+	if len(searchQuery) == 0 {
+		return nil, ErrEmptySearchQuery
+	}
+	return searchQuery, nil
+}
+
+func newSearchTerm(text string) (SearchTerm, bool) {
+	text = strings.TrimSpace(text)
+	term := SearchTerm{
+		Words:  SearchWords(text),
+		Prefix: strings.HasSuffix(text, "*"),
+	}
+	return term, len(term.Words) > 0
+}
+
+//SearchWords splits text into lower cased words made of letters and digits
+func SearchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
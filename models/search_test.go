@@ -0,0 +1,62 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseSearchQuery(t *testing.T) {
+	var tests = []struct {
+		desc          string
+		query         string
+		expectedQuery SearchQuery
+		expectedErr   error
+	}{
+		{
+			desc:  "words separated by spaces should each be a term",
+			query: "Cheesecake  coffee",
+			expectedQuery: SearchQuery{
+				{Words: []string{"cheesecake"}},
+				{Words: []string{"coffee"}},
+			},
+		},
+		{
+			desc:  "quoted words should form a phrase",
+			query: `swirl "chocolate cookie"`,
+			expectedQuery: SearchQuery{
+				{Words: []string{"swirl"}},
+				{Words: []string{"chocolate", "cookie"}},
+			},
+		},
+		{
+			desc:  "a trailing star should make a prefix term",
+			query: `chees* "cookie dou*"`,
+			expectedQuery: SearchQuery{
+				{Words: []string{"chees"}, Prefix: true},
+				{Words: []string{"cookie", "dou"}, Prefix: true},
+			},
+		},
+		{
+			desc:  "punctuation should separate words and keep unicode letters",
+			query: "crème-brûlée!",
+			expectedQuery: SearchQuery{
+				{Words: []string{"crème", "brûlée"}},
+			},
+		},
+		{
+			desc:        "a query without words is invalid",
+			query:       ` "" * !! `,
+			expectedErr: ErrEmptySearchQuery,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			query, err := ParseSearchQuery(test.query)
+			assert.Equal(test.expectedErr, err)
+			assert.Equal(test.expectedQuery, query)
+		})
+	}
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"time"
 
 	"github.com/sudarshan-reddy/benjerry/db"
 )
@@ -10,31 +12,81 @@ import (
 var (
 	//ErrNoRows is a wrapper on sql.ErrNoRows
 	ErrNoRows = sql.ErrNoRows
-	//ErrRowAlreadyExists is thrown when we get pgerr.Code = "23505"
-	ErrRowAlreadyExists = "row already exists"
+	//ErrRowAlreadyExists is returned when creating a row whose name is
+	//already taken by a live row
+	ErrRowAlreadyExists = errors.New("row already exists")
+	//ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+	ErrInvalidCursor = errors.New("invalid cursor")
+	//ErrVersionMismatch is returned when a conditional write finds the
+	//row missing or at a different version than expected
+	ErrVersionMismatch = errors.New("version mismatch")
+	//ErrQueryTimeout is returned when a call to a store outlives its
+	//own deadline, as opposed to the one of the context it was given
+	ErrQueryTimeout = errors.New("query timed out")
 )
 
 //IceCream defines the model for IceCreamStore
 type IceCream struct {
-	Name                 string   `json:"name"`
-	ImageOpen            string   `json:"image_open"`
-	ImageClosed          string   `json:"image_closed"`
-	Story                string   `json:"story"`
-	Description          string   `json:"description"`
-	SourcingValues       []string `json:"sourcing_values"`
-	Ingredients          []string `json:"ingredients"`
-	AllergyInfo          string   `json:"allergy_info"`
-	DietaryCertification string   `json:"dietary_certification"`
-	ProductID            string   `json:"product_id"`
+	Name           string   `json:"name"`
+	ImageOpen      string   `json:"image_open"`
+	ImageClosed    string   `json:"image_closed"`
+	Story          string   `json:"story"`
+	Description    string   `json:"description"`
+	SourcingValues []string `json:"sourcing_values"`
+	Ingredients    []string `json:"ingredients"`
+	//IngredientTree is parsed out of Ingredients by the stores, it is
+	//ignored on writes, see NormalizeIngredients
+	IngredientTree []Ingredient `json:"ingredient_tree,omitempty"`
+	AllergyInfo    string       `json:"allergy_info"`
+	//Allergens are derived by the stores from AllergyInfo and the
+	//ingredients, they are ignored on writes, see DeriveAllergens. They
+	//are nil when they were never derived
+	Allergens            *Allergens `json:"allergens,omitempty"`
+	DietaryCertification string     `json:"dietary_certification"`
+	ProductID            string     `json:"product_id"`
+	//Version is bumped by the store on every update. It is exposed
+	//through the ETag header rather than the body
+	Version int64 `json:"-"`
+}
+
+//IceCreamPage is a single page of IceCream data along with the
+//opaque cursors pointing to its neighbouring pages. A cursor is
+//empty when there is no page in that direction
+type IceCreamPage struct {
+	IceCreams  []IceCream
+	NextCursor string
+	PrevCursor string
 }
 
 //IceCreamStore specifies the operations to be performed
-//for storing IceCream data
+//for storing IceCream data.
+//Update, Delete and Restore are conditional on the version of the row
+//unless they are given version 0, see ErrVersionMismatch. Unconditional
+//ones return ErrNoRows when there is no row to change.
+//Delete only moves the row to the trash, where it is hidden from every
+//read but GetTrash and GetTrashed until it is restored or purged.
+//Storing a new IceCream under the name of a trashed one replaces it,
+//while storing it under the name of a live one fails with
+//ErrRowAlreadyExists. Upsert creates or replaces and reports which one
+//it did.
+//Every write is recorded in the history of the IceCream along with the
+//actor and request id found in its context, see NewHistoryEntry.
+//Every method joins the transaction found in its context, if any, and
+//gives up with the context error once the context is done
 type IceCreamStore interface {
 	db.TransactionalStore
 	StoreContext(ctx context.Context, iceCreamInput IceCream) error
-	Get(name string) (*IceCream, error)
-	GetAll() ([]IceCream, error)
-	Update(iceCreamInput IceCream) error
-	Delete(name string) error
+	Get(ctx context.Context, name string) (*IceCream, error)
+	GetAll(ctx context.Context, filter IceCreamFilter, pageSize int, cursor string) (*IceCreamPage, error)
+	Search(ctx context.Context, query SearchQuery, limit int) ([]SearchResult, error)
+	Update(ctx context.Context, iceCreamInput IceCream) (*IceCream, error)
+	Replace(ctx context.Context, iceCreamInput IceCream) error
+	Upsert(ctx context.Context, iceCreamInput IceCream) (iceCream *IceCream, created bool, err error)
+	Patch(ctx context.Context, name string, patch IceCreamPatch) (*IceCream, error)
+	Delete(ctx context.Context, name string, version int64) error
+	GetTrash(ctx context.Context, pageSize int, cursor string) (*TrashPage, error)
+	GetTrashed(ctx context.Context, name string) (*TrashedIceCream, error)
+	Restore(ctx context.Context, name string, version int64) error
+	Purge(ctx context.Context, olderThan time.Time) (int64, error)
+	History(ctx context.Context, name string) ([]HistoryEntry, error)
 }
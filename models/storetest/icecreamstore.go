@@ -0,0 +1,766 @@
+//Package storetest holds behavioural test suites that every
+//implementation of the models stores is expected to pass.
+//Implementations wire themselves in from their own tests:
+//
+//	func Test_IceCreamStore(t *testing.T) {
+//		storetest.RunIceCreamStoreTests(t, func(t *testing.T) models.IceCreamStore {
+//			return NewIceCreamStore()
+//		})
+//	}
+package storetest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//IceCreamStoreFactory returns a new, empty IceCreamStore on every call.
+//It should register any cleanup it needs on t
+type IceCreamStoreFactory func(t *testing.T) models.IceCreamStore
+
+var iceCreamStoreTests = []struct {
+	desc string
+	run  func(t *testing.T, store models.IceCreamStore)
+}{
+	{"stored ice creams can be read back", testStoreAndGet},
+	{"storing a duplicate name fails and keeps the first ice cream", testDuplicateStore},
+	{"getting a missing ice cream returns ErrNoRows", testGetMissing},
+	{"updates only change the provided fields", testPartialUpdate},
+	{"updating a missing ice cream fails with ErrNoRows and does not create it", testUpdateMissing},
+	{"updates with a version only apply to that version", testConditionalUpdate},
+	{"deletes with a version only apply to that version", testConditionalDelete},
+	{"deleted ice creams cannot be read back", testDelete},
+	{"deleting a missing ice cream fails with ErrNoRows", testDeleteMissing},
+	{"a successful transaction commits all its changes", testTxCommit},
+	{"a failed transaction rolls back all its changes", testTxRollback},
+	{"listing pages through every ice cream in insertion order", testGetAllPages},
+	{"listing can go back to the previous page", testGetAllPrevPage},
+	{"listing only returns ice creams matching the filter", testGetAllFilter},
+	{"listing with an invalid cursor returns ErrInvalidCursor", testGetAllInvalidCursor},
+	{"search finds words, phrases and prefixes", testSearch},
+	{"deleted ice creams are moved to the trash", testTrash},
+	{"trashed ice creams can be restored", testRestore},
+	{"storing over a trashed ice cream replaces it", testStoreOverTrash},
+	{"purging only removes ice creams trashed before the retention", testPurge},
+	{"every write is recorded in the history", testHistory},
+	{"replacing overwrites every field", testReplace},
+	{"upserts create missing ice creams and replace existing ones", testUpsert},
+	{"upserts with a version only replace that version", testConditionalUpsert},
+	{"patches only touch the provided fields, including clearing them", testPatch},
+	{"patches with a version only apply to that version", testConditionalPatch},
+	{"ingredients are stored as a tree of compound ingredients", testIngredientTree},
+}
+
+//RunIceCreamStoreTests runs the IceCreamStore suite against the stores
+//built by newStore. Every test gets a store of its own
+func RunIceCreamStoreTests(t *testing.T, newStore IceCreamStoreFactory) {
+	for _, test := range iceCreamStoreTests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			test.run(t, newStore(t))
+		})
+	}
+}
+
+func sampleIceCream(name string) models.IceCream {
+	return models.IceCream{
+		Name:                 name,
+		ImageOpen:            "/files/" + name + "-open.png",
+		ImageClosed:          "/files/" + name + "-closed.png",
+		Story:                "The story of " + name,
+		Description:          name + " Ice Cream with Fudge Chunks",
+		SourcingValues:       []string{"Fairtrade", "Caring Dairy"},
+		Ingredients:          []string{"cream", "skim milk", "sugar"},
+		AllergyInfo:          "contains milk",
+		DietaryCertification: "Kosher",
+		ProductID:            "1111",
+	}.NormalizeIngredients().DeriveAllergens()
+}
+
+func mustStore(t *testing.T, store models.IceCreamStore, iceCreams ...models.IceCream) {
+	t.Helper()
+	for _, iceCream := range iceCreams {
+		if err := store.StoreContext(context.Background(), iceCream); err != nil {
+			t.Fatalf("storing %s: %s", iceCream.Name, err)
+		}
+	}
+}
+
+func mustGet(t *testing.T, store models.IceCreamStore, name string) models.IceCream {
+	t.Helper()
+	iceCream, err := store.Get(context.Background(), name)
+	if err != nil {
+		t.Fatalf("getting %s: %s", name, err)
+	}
+	return *iceCream
+}
+
+func assertMissing(t *testing.T, store models.IceCreamStore, name string) {
+	t.Helper()
+	if _, err := store.Get(context.Background(), name); err != models.ErrNoRows {
+		t.Errorf("expected %s to be missing, got error %v", name, err)
+	}
+}
+
+func assertEqual(t *testing.T, expected, actual interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected\n\t%#v\ngot\n\t%#v", expected, actual)
+	}
+}
+
+func names(iceCreams []models.IceCream) []string {
+	result := []string{}
+	for _, iceCream := range iceCreams {
+		result = append(result, iceCream.Name)
+	}
+	return result
+}
+
+func testStoreAndGet(t *testing.T, store models.IceCreamStore) {
+	expected := sampleIceCream("Chocobar")
+	mustStore(t, store, expected)
+	expected.Version = 1
+	assertEqual(t, expected, mustGet(t, store, "Chocobar"))
+}
+
+func testDuplicateStore(t *testing.T, store models.IceCreamStore) {
+	first := sampleIceCream("Chocobar")
+	second := sampleIceCream("Chocobar")
+	second.Story = "a different story"
+	mustStore(t, store, first)
+	assertEqual(t, models.ErrRowAlreadyExists, store.StoreContext(context.Background(), second))
+	first.Version = 1
+	assertEqual(t, first, mustGet(t, store, "Chocobar"))
+}
+
+func testGetMissing(t *testing.T, store models.IceCreamStore) {
+	assertMissing(t, store, "Chocobar")
+}
+
+func testPartialUpdate(t *testing.T, store models.IceCreamStore) {
+	original := sampleIceCream("Chocobar")
+	mustStore(t, store, original)
+
+	updated, err := store.Update(context.Background(), models.IceCream{
+		Name:        "Chocobar",
+		Story:       "a new story",
+		Ingredients: []string{"cream", "liquid sugar (sugar", "water)"},
+		AllergyInfo: "contains milk and soy",
+	})
+	if err != nil {
+		t.Fatalf("updating: %s", err)
+	}
+
+	expected := original
+	expected.Story = "a new story"
+	expected.Ingredients = []string{"cream", "liquid sugar (sugar, water)"}
+	expected.IngredientTree = []models.Ingredient{{Name: "cream"},
+		{Name: "liquid sugar", Ingredients: []models.Ingredient{{Name: "sugar"}, {Name: "water"}}}}
+	expected.AllergyInfo = "contains milk and soy"
+	expected = expected.DeriveAllergens()
+	expected.Version = 2
+	assertEqual(t, expected, *updated)
+	assertEqual(t, expected, mustGet(t, store, "Chocobar"))
+
+	//allergy info is left untouched like every other empty field
+	if _, err := store.Update(context.Background(), models.IceCream{Name: "Chocobar", Story: "another"}); err != nil {
+		t.Fatalf("updating: %s", err)
+	}
+	assertEqual(t, "contains milk and soy", mustGet(t, store, "Chocobar").AllergyInfo)
+}
+
+func testConditionalUpdate(t *testing.T, store models.IceCreamStore) {
+	mustStore(t, store, sampleIceCream("Chocobar"))
+
+	stale := models.IceCream{Name: "Chocobar", Story: "stale", Version: 2}
+	_, err := store.Update(context.Background(), stale)
+	assertEqual(t, models.ErrVersionMismatch, err)
+	assertEqual(t, "The story of Chocobar", mustGet(t, store, "Chocobar").Story)
+
+	current := models.IceCream{Name: "Chocobar", Story: "current", Version: 1}
+	if _, err := store.Update(context.Background(), current); err != nil {
+		t.Fatalf("updating: %s", err)
+	}
+	updated := mustGet(t, store, "Chocobar")
+	assertEqual(t, "current", updated.Story)
+	assertEqual(t, int64(2), updated.Version)
+
+	missing := models.IceCream{Name: "Vanilla", Story: "missing", Version: 1}
+	_, err = store.Update(context.Background(), missing)
+	assertEqual(t, models.ErrVersionMismatch, err)
+}
+
+func testConditionalDelete(t *testing.T, store models.IceCreamStore) {
+	mustStore(t, store, sampleIceCream("Chocobar"))
+
+	assertEqual(t, models.ErrVersionMismatch, store.Delete(context.Background(), "Chocobar", 2))
+	mustGet(t, store, "Chocobar")
+
+	if err := store.Delete(context.Background(), "Chocobar", 1); err != nil {
+		t.Fatalf("deleting: %s", err)
+	}
+	assertMissing(t, store, "Chocobar")
+	assertEqual(t, models.ErrVersionMismatch, store.Delete(context.Background(), "Chocobar", 1))
+}
+
+func testUpdateMissing(t *testing.T, store models.IceCreamStore) {
+	_, err := store.Update(context.Background(), sampleIceCream("Chocobar"))
+	assertEqual(t, models.ErrNoRows, err)
+	assertMissing(t, store, "Chocobar")
+}
+
+func testDeleteMissing(t *testing.T, store models.IceCreamStore) {
+	assertEqual(t, models.ErrNoRows, store.Delete(context.Background(), "Chocobar", 0))
+
+	//trashed ice creams cannot be deleted again
+	mustStore(t, store, sampleIceCream("Chocobar"))
+	if err := store.Delete(context.Background(), "Chocobar", 0); err != nil {
+		t.Fatalf("deleting: %s", err)
+	}
+	assertEqual(t, models.ErrNoRows, store.Delete(context.Background(), "Chocobar", 0))
+}
+
+func testDelete(t *testing.T, store models.IceCreamStore) {
+	mustStore(t, store, sampleIceCream("Chocobar"), sampleIceCream("Vanilla"))
+	if err := store.Delete(context.Background(), "Chocobar", 0); err != nil {
+		t.Fatalf("deleting: %s", err)
+	}
+	assertMissing(t, store, "Chocobar")
+	mustGet(t, store, "Vanilla")
+}
+
+func testTxCommit(t *testing.T, store models.IceCreamStore) {
+	err := store.WithTxContext(context.Background(), func(ctx context.Context) error {
+		for _, name := range []string{"Chocobar", "Vanilla"} {
+			if err := store.StoreContext(ctx, sampleIceCream(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("transaction: %s", err)
+	}
+	mustGet(t, store, "Chocobar")
+	mustGet(t, store, "Vanilla")
+}
+
+func testTxRollback(t *testing.T, store models.IceCreamStore) {
+	txErr := errors.New("failed midway")
+	err := store.WithTxContext(context.Background(), func(ctx context.Context) error {
+		if err := store.StoreContext(ctx, sampleIceCream("Chocobar")); err != nil {
+			return err
+		}
+		return txErr
+	})
+	assertEqual(t, txErr, err)
+	assertMissing(t, store, "Chocobar")
+}
+
+func testGetAllPages(t *testing.T, store models.IceCreamStore) {
+	expected := []string{"e", "d", "c", "b", "a"}
+	for _, name := range expected {
+		mustStore(t, store, sampleIceCream(name))
+	}
+
+	var listed []string
+	var cursor string
+	for pages := 0; pages < len(expected); pages++ {
+		page, err := store.GetAll(context.Background(), models.IceCreamFilter{}, 2, cursor)
+		if err != nil {
+			t.Fatalf("listing: %s", err)
+		}
+		listed = append(listed, names(page.IceCreams)...)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	assertEqual(t, expected, listed)
+}
+
+func testGetAllPrevPage(t *testing.T, store models.IceCreamStore) {
+	for _, name := range []string{"a", "b", "c", "d"} {
+		mustStore(t, store, sampleIceCream(name))
+	}
+
+	first, err := store.GetAll(context.Background(), models.IceCreamFilter{}, 2, "")
+	if err != nil {
+		t.Fatalf("listing: %s", err)
+	}
+	assertEqual(t, "", first.PrevCursor)
+
+	second, err := store.GetAll(context.Background(), models.IceCreamFilter{}, 2, first.NextCursor)
+	if err != nil {
+		t.Fatalf("listing: %s", err)
+	}
+	assertEqual(t, []string{"c", "d"}, names(second.IceCreams))
+
+	previous, err := store.GetAll(context.Background(), models.IceCreamFilter{}, 2, second.PrevCursor)
+	if err != nil {
+		t.Fatalf("listing: %s", err)
+	}
+	assertEqual(t, []string{"a", "b"}, names(previous.IceCreams))
+}
+
+func testGetAllFilter(t *testing.T, store models.IceCreamStore) {
+	fairtrade := sampleIceCream("fairtrade")
+	peanuts := sampleIceCream("peanuts")
+	peanuts.Ingredients = append(peanuts.Ingredients, "peanuts")
+	vegan := sampleIceCream("vegan")
+	vegan.SourcingValues = []string{"Non-GMO"}
+	vegan.DietaryCertification = "Vegan"
+	vegan.Ingredients = []string{"coconut milk", "sugar"}
+	vegan.AllergyInfo = "may contain Soy"
+	mustStore(t, store, fairtrade, peanuts, vegan)
+
+	var tests = []struct {
+		filter   models.IceCreamFilter
+		expected []string
+	}{
+		{
+			models.IceCreamFilter{
+				SourcingValues: models.ArrayFilter{ContainsAll: []string{"Fairtrade", "Caring Dairy"}},
+				Ingredients:    models.ArrayFilter{Excludes: []string{"peanuts"}},
+			},
+			[]string{"fairtrade"},
+		},
+		{
+			models.IceCreamFilter{
+				SourcingValues: models.ArrayFilter{ContainsAny: []string{"Non-GMO", "Caring Dairy"}},
+			},
+			[]string{"fairtrade", "peanuts", "vegan"},
+		},
+		{
+			models.IceCreamFilter{DietaryCertification: "Vegan", AllergyInfo: "SOY"},
+			[]string{"vegan"},
+		},
+		{
+			models.IceCreamFilter{FreeFrom: []string{"peanuts", "milk"}},
+			[]string{"vegan"},
+		},
+		{
+			models.IceCreamFilter{FreeFrom: []string{"peanuts", "soy"}},
+			[]string{"fairtrade"},
+		},
+	}
+
+	for _, test := range tests {
+		page, err := store.GetAll(context.Background(), test.filter, models.MaxPageSize, "")
+		if err != nil {
+			t.Fatalf("listing: %s", err)
+		}
+		assertEqual(t, test.expected, names(page.IceCreams))
+	}
+}
+
+func testGetAllInvalidCursor(t *testing.T, store models.IceCreamStore) {
+	_, err := store.GetAll(context.Background(), models.IceCreamFilter{}, 2, "not a cursor")
+	assertEqual(t, models.ErrInvalidCursor, err)
+}
+
+func testSearch(t *testing.T, store models.IceCreamStore) {
+	coffee := sampleIceCream("coffee")
+	coffee.Description = "Coffee Ice Cream with Fudge Chunks"
+	cheesecake := sampleIceCream("cheesecake")
+	cheesecake.Story = "a world of cheesecake swirled with chocolate cookies"
+	mustStore(t, store, coffee, cheesecake)
+
+	var tests = []struct {
+		query    string
+		expected []string
+	}{
+		{"coffee", []string{"coffee"}},
+		{"fudge chunks", []string{"cheesecake", "coffee"}},
+		{`"chocolate cookies"`, []string{"cheesecake"}},
+		{`"cookies chocolate"`, []string{}},
+		{"chees*", []string{"cheesecake"}},
+		{"coffee cheesecake", []string{}},
+	}
+
+	for _, test := range tests {
+		query, err := models.ParseSearchQuery(test.query)
+		if err != nil {
+			t.Fatalf("parsing %s: %s", test.query, err)
+		}
+		results, err := store.Search(context.Background(), query, models.MaxPageSize)
+		if err != nil {
+			t.Fatalf("searching %s: %s", test.query, err)
+		}
+		found := []string{}
+		for _, result := range results {
+			found = append(found, result.IceCream.Name)
+		}
+		if len(test.expected) > 1 {
+			//equally relevant hits have no defined order
+			sort.Strings(found)
+		}
+		assertEqual(t, test.expected, found)
+	}
+}
+
+func testTrash(t *testing.T, store models.IceCreamStore) {
+	chocobar := sampleIceCream("Chocobar")
+	chocobar.Story = "a trashed story"
+	mustStore(t, store, chocobar, sampleIceCream("Vanilla"))
+
+	ctx := models.ContextWithActor(context.Background(), "alice")
+	if err := store.Delete(ctx, "Chocobar", 0); err != nil {
+		t.Fatalf("deleting: %s", err)
+	}
+
+	trash, err := store.GetTrash(context.Background(), models.MaxPageSize, "")
+	if err != nil {
+		t.Fatalf("listing trash: %s", err)
+	}
+	if len(trash.IceCreams) != 1 {
+		t.Fatalf("expected 1 trashed ice cream, got %d", len(trash.IceCreams))
+	}
+	assertEqual(t, "Chocobar", trash.IceCreams[0].Name)
+	assertEqual(t, "alice", trash.IceCreams[0].DeletedBy)
+	if trash.IceCreams[0].DeletedAt.IsZero() {
+		t.Errorf("expected the deletion time to be recorded")
+	}
+
+	page, err := store.GetAll(context.Background(), models.IceCreamFilter{}, models.MaxPageSize, "")
+	if err != nil {
+		t.Fatalf("listing: %s", err)
+	}
+	assertEqual(t, []string{"Vanilla"}, names(page.IceCreams))
+
+	query, _ := models.ParseSearchQuery("trashed")
+	results, err := store.Search(context.Background(), query, models.MaxPageSize)
+	if err != nil {
+		t.Fatalf("searching: %s", err)
+	}
+	assertEqual(t, 0, len(results))
+
+	store.Update(context.Background(), models.IceCream{Name: "Chocobar", Story: "updated"})
+	assertMissing(t, store, "Chocobar")
+	assertEqual(t, models.ErrVersionMismatch, store.Delete(ctx, "Chocobar", 2))
+}
+
+func testRestore(t *testing.T, store models.IceCreamStore) {
+	mustStore(t, store, sampleIceCream("Chocobar"))
+	assertEqual(t, models.ErrNoRows, store.Restore(context.Background(), "Chocobar", 0))
+
+	assertEqual(t, models.ErrVersionMismatch, store.Restore(context.Background(), "Chocobar", 1))
+	_, err := store.GetTrashed(context.Background(), "Chocobar")
+	assertEqual(t, models.ErrNoRows, err)
+
+	ctx := models.ContextWithActor(context.Background(), "alice")
+	if err := store.Delete(ctx, "Chocobar", 0); err != nil {
+		t.Fatalf("deleting: %s", err)
+	}
+	trashed, err := store.GetTrashed(context.Background(), "Chocobar")
+	if err != nil {
+		t.Fatalf("reading the trash: %s", err)
+	}
+	assertEqual(t, "The story of Chocobar", trashed.Story)
+	assertEqual(t, int64(2), trashed.Version)
+	assertEqual(t, "alice", trashed.DeletedBy)
+
+	assertEqual(t, models.ErrVersionMismatch, store.Restore(context.Background(), "Chocobar", 1))
+	if err := store.Restore(context.Background(), "Chocobar", 2); err != nil {
+		t.Fatalf("restoring: %s", err)
+	}
+
+	restored := mustGet(t, store, "Chocobar")
+	assertEqual(t, "The story of Chocobar", restored.Story)
+	//both the delete and the restore invalidate earlier versions
+	assertEqual(t, int64(3), restored.Version)
+
+	trash, err := store.GetTrash(context.Background(), models.MaxPageSize, "")
+	if err != nil {
+		t.Fatalf("listing trash: %s", err)
+	}
+	assertEqual(t, 0, len(trash.IceCreams))
+	_, err = store.GetTrashed(context.Background(), "Chocobar")
+	assertEqual(t, models.ErrNoRows, err)
+	assertEqual(t, models.ErrNoRows, store.Restore(context.Background(), "Vanilla", 0))
+}
+
+func testStoreOverTrash(t *testing.T, store models.IceCreamStore) {
+	mustStore(t, store, sampleIceCream("Chocobar"))
+	if err := store.Delete(context.Background(), "Chocobar", 0); err != nil {
+		t.Fatalf("deleting: %s", err)
+	}
+
+	replacement := sampleIceCream("Chocobar")
+	replacement.Story = "a brand new story"
+	mustStore(t, store, replacement)
+
+	stored := mustGet(t, store, "Chocobar")
+	assertEqual(t, "a brand new story", stored.Story)
+	if stored.Version <= 2 {
+		t.Errorf("expected the version to move past the trashed one, got %d", stored.Version)
+	}
+
+	trash, err := store.GetTrash(context.Background(), models.MaxPageSize, "")
+	if err != nil {
+		t.Fatalf("listing trash: %s", err)
+	}
+	assertEqual(t, 0, len(trash.IceCreams))
+}
+
+func testPurge(t *testing.T, store models.IceCreamStore) {
+	mustStore(t, store, sampleIceCream("Chocobar"), sampleIceCream("Vanilla"))
+	if err := store.Delete(context.Background(), "Chocobar", 0); err != nil {
+		t.Fatalf("deleting: %s", err)
+	}
+
+	purged, err := store.Purge(context.Background(), time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("purging: %s", err)
+	}
+	assertEqual(t, int64(0), purged)
+
+	purged, err = store.Purge(context.Background(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("purging: %s", err)
+	}
+	assertEqual(t, int64(1), purged)
+
+	trash, err := store.GetTrash(context.Background(), models.MaxPageSize, "")
+	if err != nil {
+		t.Fatalf("listing trash: %s", err)
+	}
+	assertEqual(t, 0, len(trash.IceCreams))
+	assertEqual(t, models.ErrNoRows, store.Restore(context.Background(), "Chocobar", 0))
+	mustGet(t, store, "Vanilla")
+}
+
+func testHistory(t *testing.T, store models.IceCreamStore) {
+	ctx := models.ContextWithRequestID(models.ContextWithActor(context.Background(), "alice"), "req-1")
+	if err := store.StoreContext(ctx, sampleIceCream("Chocobar")); err != nil {
+		t.Fatalf("storing: %s", err)
+	}
+	//duplicates change nothing so they are not recorded
+	store.StoreContext(ctx, sampleIceCream("Chocobar"))
+	if _, err := store.Update(ctx, models.IceCream{Name: "Chocobar", Ingredients: []string{"cream", "nuts"}}); err != nil {
+		t.Fatalf("updating: %s", err)
+	}
+	if err := store.Delete(ctx, "Chocobar", 0); err != nil {
+		t.Fatalf("deleting: %s", err)
+	}
+	if err := store.Restore(ctx, "Chocobar", 0); err != nil {
+		t.Fatalf("restoring: %s", err)
+	}
+	mustStore(t, store, sampleIceCream("Vanilla"))
+
+	history, err := store.History(context.Background(), "Chocobar")
+	if err != nil {
+		t.Fatalf("reading history: %s", err)
+	}
+	var actions []string
+	for _, entry := range history {
+		actions = append(actions, entry.Action)
+		assertEqual(t, "alice", entry.Actor)
+		assertEqual(t, "req-1", entry.RequestID)
+		assertEqual(t, entry.Version, entry.Snapshot.Version)
+	}
+	assertEqual(t, []string{models.HistoryRestore, models.HistoryDelete,
+		models.HistoryUpdate, models.HistoryCreate}, actions)
+
+	updated := history[2]
+	assertEqual(t, int64(2), updated.Version)
+	assertEqual(t, "ingredients", updated.Changes[0].Field)
+	assertEqual(t, `["cream","skim milk","sugar"]`, string(updated.Changes[0].Before))
+	assertEqual(t, `["cream","nuts"]`, string(updated.Changes[0].After))
+	assertEqual(t, []string{"cream", "nuts"}, updated.Snapshot.Ingredients)
+	assertEqual(t, 0, len(history[1].Changes))
+
+	//deletes and restores snapshot the whole ice cream so that they can
+	//be reverted to like any other version
+	current := mustGet(t, store, "Chocobar")
+	for _, entry := range history[:2] {
+		assertEqual(t, current.IngredientTree, entry.Snapshot.IngredientTree)
+		assertEqual(t, current.Allergens, entry.Snapshot.Allergens)
+	}
+
+	created := history[3]
+	assertEqual(t, int64(1), created.Version)
+	assertEqual(t, sampleIceCream("Chocobar").Story, created.Snapshot.Story)
+
+	missing, err := store.History(context.Background(), "Strawberry")
+	if err != nil {
+		t.Fatalf("reading history: %s", err)
+	}
+	assertEqual(t, 0, len(missing))
+}
+
+func testReplace(t *testing.T, store models.IceCreamStore) {
+	mustStore(t, store, sampleIceCream("Chocobar"))
+
+	replacement := models.IceCream{Name: "Chocobar", Story: "only a story", Version: 2}
+	assertEqual(t, models.ErrVersionMismatch, store.Replace(context.Background(), replacement))
+
+	replacement.Version = 1
+	if err := store.Replace(context.Background(), replacement); err != nil {
+		t.Fatalf("replacing: %s", err)
+	}
+	expected := replacement.DeriveAllergens()
+	expected.Version = 2
+	assertEqual(t, expected, mustGet(t, store, "Chocobar"))
+
+	missing := models.IceCream{Name: "Vanilla"}
+	assertEqual(t, models.ErrNoRows, store.Replace(context.Background(), missing))
+	assertMissing(t, store, "Vanilla")
+}
+
+func testPatch(t *testing.T, store models.IceCreamStore) {
+	original := sampleIceCream("Chocobar")
+	mustStore(t, store, original)
+
+	empty := ""
+	var cleared []string
+	patched, err := store.Patch(context.Background(), "Chocobar", models.IceCreamPatch{
+		Story:          &empty,
+		SourcingValues: &cleared,
+		Ingredients:    &[]string{},
+	})
+	if err != nil {
+		t.Fatalf("patching: %s", err)
+	}
+
+	expected := original
+	expected.Story = ""
+	expected.SourcingValues = nil
+	expected.Ingredients = []string{}
+	expected.IngredientTree = nil
+	expected = expected.DeriveAllergens()
+	expected.Version = 2
+	assertEqual(t, expected, *patched)
+	assertEqual(t, expected, mustGet(t, store, "Chocobar"))
+
+	//an empty patch changes nothing, not even the version
+	unchanged, err := store.Patch(context.Background(), "Chocobar", models.IceCreamPatch{})
+	if err != nil {
+		t.Fatalf("patching: %s", err)
+	}
+	assertEqual(t, expected, *unchanged)
+
+	_, err = store.Patch(context.Background(), "Vanilla", models.IceCreamPatch{Story: &empty})
+	assertEqual(t, models.ErrNoRows, err)
+	assertMissing(t, store, "Vanilla")
+}
+
+func testConditionalPatch(t *testing.T, store models.IceCreamStore) {
+	mustStore(t, store, sampleIceCream("Chocobar"))
+
+	story := "patched"
+	_, err := store.Patch(context.Background(), "Chocobar", models.IceCreamPatch{Story: &story, Version: 2})
+	assertEqual(t, models.ErrVersionMismatch, err)
+	assertEqual(t, "The story of Chocobar", mustGet(t, store, "Chocobar").Story)
+
+	patched, err := store.Patch(context.Background(), "Chocobar", models.IceCreamPatch{Story: &story, Version: 1})
+	if err != nil {
+		t.Fatalf("patching: %s", err)
+	}
+	assertEqual(t, "patched", patched.Story)
+	assertEqual(t, int64(2), patched.Version)
+
+	_, err = store.Patch(context.Background(), "Vanilla", models.IceCreamPatch{Story: &story, Version: 1})
+	assertEqual(t, models.ErrVersionMismatch, err)
+}
+
+func testUpsert(t *testing.T, store models.IceCreamStore) {
+	created, isNew, err := store.Upsert(context.Background(), sampleIceCream("Chocobar"))
+	if err != nil {
+		t.Fatalf("upserting: %s", err)
+	}
+	assertEqual(t, true, isNew)
+	assertEqual(t, int64(1), created.Version)
+	assertEqual(t, *created, mustGet(t, store, "Chocobar"))
+
+	replacement := models.IceCream{Name: "Chocobar", Story: "only a story"}
+	replaced, isNew, err := store.Upsert(context.Background(), replacement)
+	if err != nil {
+		t.Fatalf("upserting: %s", err)
+	}
+	assertEqual(t, false, isNew)
+	replacement = replacement.DeriveAllergens()
+	replacement.Version = 2
+	assertEqual(t, replacement, *replaced)
+	assertEqual(t, replacement, mustGet(t, store, "Chocobar"))
+
+	//trashed ice creams are created anew
+	if err := store.Delete(context.Background(), "Chocobar", 0); err != nil {
+		t.Fatalf("deleting: %s", err)
+	}
+	_, isNew, err = store.Upsert(context.Background(), sampleIceCream("Chocobar"))
+	if err != nil {
+		t.Fatalf("upserting: %s", err)
+	}
+	assertEqual(t, true, isNew)
+	assertEqual(t, "The story of Chocobar", mustGet(t, store, "Chocobar").Story)
+}
+
+func testConditionalUpsert(t *testing.T, store models.IceCreamStore) {
+	stale := sampleIceCream("Chocobar")
+	stale.Version = 1
+	_, _, err := store.Upsert(context.Background(), stale)
+	assertEqual(t, models.ErrVersionMismatch, err)
+	assertMissing(t, store, "Chocobar")
+
+	mustStore(t, store, sampleIceCream("Chocobar"))
+	stale.Version = 2
+	_, _, err = store.Upsert(context.Background(), stale)
+	assertEqual(t, models.ErrVersionMismatch, err)
+
+	current := models.IceCream{Name: "Chocobar", Story: "current", Version: 1}
+	replaced, isNew, err := store.Upsert(context.Background(), current)
+	if err != nil {
+		t.Fatalf("upserting: %s", err)
+	}
+	assertEqual(t, false, isNew)
+	assertEqual(t, int64(2), replaced.Version)
+}
+
+func testIngredientTree(t *testing.T, store models.IceCreamStore) {
+	iceCream := sampleIceCream("Chocobar")
+	iceCream.Ingredients = []string{"cream", "cream cheese (pasteurized milk", "cream",
+		"cheese cultures", "salt", "carob bean gum)", "pretzels (wheat flour", "malt)"}
+	mustStore(t, store, iceCream)
+
+	expectedTree := []models.Ingredient{
+		{Name: "cream"},
+		{Name: "cream cheese", Ingredients: []models.Ingredient{{Name: "pasteurized milk"}, {Name: "cream"},
+			{Name: "cheese cultures"}, {Name: "salt"}, {Name: "carob bean gum"}}},
+		{Name: "pretzels", Ingredients: []models.Ingredient{{Name: "wheat flour"}, {Name: "malt"}}},
+	}
+	stored := mustGet(t, store, "Chocobar")
+	assertEqual(t, []string{"cream", "cream cheese (pasteurized milk, cream, cheese cultures, salt, carob bean gum)",
+		"pretzels (wheat flour, malt)"}, stored.Ingredients)
+	assertEqual(t, expectedTree, stored.IngredientTree)
+
+	page, err := store.GetAll(context.Background(), models.IceCreamFilter{}, 10, "")
+	if err != nil {
+		t.Fatalf("listing: %s", err)
+	}
+	assertEqual(t, expectedTree, page.IceCreams[0].IngredientTree)
+
+	ingredients := []string{"butter (cream", "salt)"}
+	patched, err := store.Patch(context.Background(), "Chocobar", models.IceCreamPatch{Ingredients: &ingredients})
+	if err != nil {
+		t.Fatalf("patching: %s", err)
+	}
+	expectedTree = []models.Ingredient{
+		{Name: "butter", Ingredients: []models.Ingredient{{Name: "cream"}, {Name: "salt"}}},
+	}
+	assertEqual(t, expectedTree, patched.IngredientTree)
+	assertEqual(t, expectedTree, mustGet(t, store, "Chocobar").IngredientTree)
+
+	replacement := models.IceCream{Name: "Chocobar"}
+	if err := store.Replace(context.Background(), replacement); err != nil {
+		t.Fatalf("replacing: %s", err)
+	}
+	assertEqual(t, []models.Ingredient(nil), mustGet(t, store, "Chocobar").IngredientTree)
+}
@@ -0,0 +1,181 @@
+package storetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//IngredientStoreFactory returns a new, empty IngredientStore on every
+//call. It should register any cleanup it needs on t
+type IngredientStoreFactory func(t *testing.T) models.IngredientStore
+
+var ingredientStoreTests = []struct {
+	desc string
+	run  func(t *testing.T, store models.IngredientStore)
+}{
+	{"registered ingredients can be read back and listed by name", testIngredientStoreAndGet},
+	{"names and synonyms cannot be registered twice", testIngredientTaken},
+	{"updates replace the ingredient and may rename it", testIngredientUpdate},
+	{"deleted ingredients are no longer registered", testIngredientDelete},
+	{"names and synonyms resolve to their canonical name", testCanonicalNames},
+}
+
+//RunIngredientStoreTests runs the IngredientStore suite against the
+//stores built by newStore. Every test gets a store of its own
+func RunIngredientStoreTests(t *testing.T, newStore IngredientStoreFactory) {
+	for _, test := range ingredientStoreTests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			test.run(t, newStore(t))
+		})
+	}
+}
+
+func skimMilk() models.RegisteredIngredient {
+	return models.RegisteredIngredient{
+		Name:     "skim milk",
+		Synonyms: []string{"nonfat milk", "skimmed milk"},
+		Category: "dairy",
+	}
+}
+
+func lecithin() models.RegisteredIngredient {
+	return models.RegisteredIngredient{
+		Name:     "soy lecithin",
+		Synonyms: []string{},
+		Category: "emulsifier",
+		ENumber:  "E322",
+	}
+}
+
+func storeIngredients(t *testing.T, store models.IngredientStore, ingredients ...models.RegisteredIngredient) {
+	t.Helper()
+	for _, ingredient := range ingredients {
+		if err := store.StoreIngredient(context.Background(), ingredient); err != nil {
+			t.Fatalf("storing %s: %s", ingredient.Name, err)
+		}
+	}
+}
+
+func testIngredientStoreAndGet(t *testing.T, store models.IngredientStore) {
+	ctx := context.Background()
+	storeIngredients(t, store, skimMilk(), lecithin())
+
+	got, err := store.GetIngredient(ctx, "skim milk")
+	if err != nil {
+		t.Fatalf("getting skim milk: %s", err)
+	}
+	assertEqual(t, skimMilk(), *got)
+
+	//ingredients are addressed by their exact name
+	if _, err := store.GetIngredient(ctx, "nonfat milk"); err != models.ErrNoRows {
+		t.Errorf("getting a synonym: expected ErrNoRows, got %v", err)
+	}
+
+	ingredients, err := store.ListIngredients(ctx)
+	if err != nil {
+		t.Fatalf("listing: %s", err)
+	}
+	assertEqual(t, []models.RegisteredIngredient{skimMilk(), lecithin()}, ingredients)
+}
+
+func testIngredientTaken(t *testing.T, store models.IngredientStore) {
+	ctx := context.Background()
+	storeIngredients(t, store, skimMilk())
+
+	for _, ingredient := range []models.RegisteredIngredient{
+		{Name: "skim milk", Synonyms: []string{}},
+		{Name: "Skim  Milk", Synonyms: []string{}},
+		{Name: "milk", Synonyms: []string{"Nonfat milk"}},
+		{Name: "nonfat milk", Synonyms: []string{}},
+	} {
+		if err := store.StoreIngredient(ctx, ingredient); err != models.ErrRowAlreadyExists {
+			t.Errorf("storing %v: expected ErrRowAlreadyExists, got %v", ingredient, err)
+		}
+	}
+
+	//failed writes leave nothing behind
+	canonical, err := store.CanonicalNames(ctx, []string{"milk"})
+	if err != nil {
+		t.Fatalf("resolving names: %s", err)
+	}
+	assertEqual(t, map[string]string{}, canonical)
+}
+
+func testIngredientUpdate(t *testing.T, store models.IngredientStore) {
+	ctx := context.Background()
+	storeIngredients(t, store, skimMilk(), lecithin())
+
+	renamed := models.RegisteredIngredient{
+		Name:     "nonfat milk",
+		Synonyms: []string{"skim milk"},
+		Category: "dairy",
+	}
+	if err := store.UpdateIngredient(ctx, "skim milk", renamed); err != nil {
+		t.Fatalf("renaming skim milk: %s", err)
+	}
+	if _, err := store.GetIngredient(ctx, "skim milk"); err != models.ErrNoRows {
+		t.Errorf("getting the old name: expected ErrNoRows, got %v", err)
+	}
+	got, err := store.GetIngredient(ctx, "nonfat milk")
+	if err != nil {
+		t.Fatalf("getting the new name: %s", err)
+	}
+	assertEqual(t, renamed, *got)
+
+	canonical, err := store.CanonicalNames(ctx, []string{"skim milk", "skimmed milk"})
+	if err != nil {
+		t.Fatalf("resolving names: %s", err)
+	}
+	//the dropped synonym is free again
+	assertEqual(t, map[string]string{"skim milk": "nonfat milk"}, canonical)
+
+	taken := lecithin()
+	taken.Synonyms = []string{"skim milk"}
+	if err := store.UpdateIngredient(ctx, "soy lecithin", taken); err != models.ErrRowAlreadyExists {
+		t.Errorf("taking a synonym: expected ErrRowAlreadyExists, got %v", err)
+	}
+	got, err = store.GetIngredient(ctx, "soy lecithin")
+	if err != nil {
+		t.Fatalf("getting soy lecithin: %s", err)
+	}
+	assertEqual(t, lecithin(), *got)
+
+	if err := store.UpdateIngredient(ctx, "missing", lecithin()); err != models.ErrNoRows {
+		t.Errorf("updating a missing ingredient: expected ErrNoRows, got %v", err)
+	}
+}
+
+func testIngredientDelete(t *testing.T, store models.IngredientStore) {
+	ctx := context.Background()
+	storeIngredients(t, store, skimMilk())
+
+	if err := store.DeleteIngredient(ctx, "skim milk"); err != nil {
+		t.Fatalf("deleting: %s", err)
+	}
+	if _, err := store.GetIngredient(ctx, "skim milk"); err != models.ErrNoRows {
+		t.Errorf("getting a deleted ingredient: expected ErrNoRows, got %v", err)
+	}
+	if err := store.DeleteIngredient(ctx, "skim milk"); err != models.ErrNoRows {
+		t.Errorf("deleting twice: expected ErrNoRows, got %v", err)
+	}
+	//its names can be registered again
+	storeIngredients(t, store, models.RegisteredIngredient{Name: "nonfat milk", Synonyms: []string{}})
+}
+
+func testCanonicalNames(t *testing.T, store models.IngredientStore) {
+	storeIngredients(t, store, skimMilk(), lecithin())
+
+	canonical, err := store.CanonicalNames(context.Background(),
+		[]string{"skim milk", "Nonfat  Milk", "SOY LECITHIN", "sugar"})
+	if err != nil {
+		t.Fatalf("resolving names: %s", err)
+	}
+	assertEqual(t, map[string]string{
+		"skim milk":    "skim milk",
+		"Nonfat  Milk": "skim milk",
+		"SOY LECITHIN": "soy lecithin",
+	}, canonical)
+}
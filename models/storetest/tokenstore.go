@@ -0,0 +1,175 @@
+package storetest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//TokenStoreFactory returns a new, empty TokenStore on every call. It
+//should register any cleanup it needs on t
+type TokenStoreFactory func(t *testing.T) models.TokenStore
+
+var tokenStoreTests = []struct {
+	desc string
+	run  func(t *testing.T, store models.TokenStore)
+}{
+	{"stored tokens can be read back and listed oldest first", testTokenStoreAndGet},
+	{"token ids cannot be stored twice", testTokenTaken},
+	{"revoking keeps the time of the first revocation", testTokenRevoke},
+	{"touching records the last use", testTokenTouch},
+	{"revoked access tokens are remembered", testAccessTokenRevoke},
+}
+
+//RunTokenStoreTests runs the TokenStore suite against the stores built
+//by newStore. Every test gets a store of its own
+func RunTokenStoreTests(t *testing.T, newStore TokenStoreFactory) {
+	for _, test := range tokenStoreTests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			test.run(t, newStore(t))
+		})
+	}
+}
+
+//testTime is a time every store keeps as it is, whatever its precision
+var testTime = time.Date(2019, time.March, 14, 10, 30, 0, 0, time.UTC)
+
+func sampleToken(id string, createdAt time.Time) models.APIToken {
+	expiresAt := createdAt.Add(24 * time.Hour)
+	return models.APIToken{
+		ID:         id,
+		Owner:      "catalog team",
+		Kind:       models.TokenKindAPI,
+		Scopes:     []string{"read.icecream", "post.icecream"},
+		CreatedAt:  createdAt,
+		ExpiresAt:  &expiresAt,
+		SecretHash: []byte{0x01, 0x02, 0x03},
+	}
+}
+
+func mustStoreTokens(t *testing.T, store models.TokenStore, tokens ...models.APIToken) {
+	t.Helper()
+	for _, token := range tokens {
+		if err := store.StoreToken(context.Background(), token); err != nil {
+			t.Fatalf("storing %s: %s", token.ID, err)
+		}
+	}
+}
+
+//assertTokens compares tokens, their times as instants whatever the
+//location they are read in
+func assertTokens(t *testing.T, expected, actual []models.APIToken) {
+	t.Helper()
+	normalize := func(tokens []models.APIToken) []models.APIToken {
+		normalized := []models.APIToken{}
+		for _, token := range tokens {
+			token.CreatedAt = token.CreatedAt.UTC()
+			for _, at := range []**time.Time{&token.ExpiresAt, &token.LastUsedAt, &token.RevokedAt} {
+				if *at != nil {
+					utc := (*at).UTC()
+					*at = &utc
+				}
+			}
+			normalized = append(normalized, token)
+		}
+		return normalized
+	}
+	if !reflect.DeepEqual(normalize(expected), normalize(actual)) {
+		t.Errorf("expected\n\t%#v\ngot\n\t%#v", expected, actual)
+	}
+}
+
+func mustGetToken(t *testing.T, store models.TokenStore, id string) models.APIToken {
+	t.Helper()
+	token, err := store.GetToken(context.Background(), id)
+	if err != nil {
+		t.Fatalf("getting %s: %s", id, err)
+	}
+	return *token
+}
+
+func testTokenStoreAndGet(t *testing.T, store models.TokenStore) {
+	newer := sampleToken("b", testTime.Add(time.Hour))
+	newer.ExpiresAt = nil
+	older := sampleToken("a", testTime)
+	mustStoreTokens(t, store, newer, older)
+
+	assertTokens(t, []models.APIToken{older}, []models.APIToken{mustGetToken(t, store, "a")})
+
+	tokens, err := store.ListTokens(context.Background())
+	if err != nil {
+		t.Fatalf("listing: %s", err)
+	}
+	assertTokens(t, []models.APIToken{older, newer}, tokens)
+
+	if _, err := store.GetToken(context.Background(), "c"); err != models.ErrNoRows {
+		t.Errorf("getting a missing token: expected ErrNoRows, got %v", err)
+	}
+}
+
+func testTokenTaken(t *testing.T, store models.TokenStore) {
+	mustStoreTokens(t, store, sampleToken("a", testTime))
+	taken := sampleToken("a", testTime.Add(time.Hour))
+	taken.Owner = "someone else"
+	assertEqual(t, models.ErrRowAlreadyExists, store.StoreToken(context.Background(), taken))
+	assertTokens(t, []models.APIToken{sampleToken("a", testTime)}, []models.APIToken{mustGetToken(t, store, "a")})
+}
+
+func testTokenRevoke(t *testing.T, store models.TokenStore) {
+	mustStoreTokens(t, store, sampleToken("a", testTime))
+
+	revokedAt := testTime.Add(time.Hour)
+	expected := sampleToken("a", testTime)
+	expected.RevokedAt = &revokedAt
+	revoked, err := store.RevokeToken(context.Background(), "a", revokedAt)
+	if err != nil {
+		t.Fatalf("revoking: %s", err)
+	}
+	assertTokens(t, []models.APIToken{expected}, []models.APIToken{*revoked})
+
+	revoked, err = store.RevokeToken(context.Background(), "a", revokedAt.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("revoking again: %s", err)
+	}
+	assertTokens(t, []models.APIToken{expected}, []models.APIToken{*revoked})
+	assertTokens(t, []models.APIToken{expected}, []models.APIToken{mustGetToken(t, store, "a")})
+
+	_, err = store.RevokeToken(context.Background(), "b", revokedAt)
+	assertEqual(t, models.ErrNoRows, err)
+}
+
+func testTokenTouch(t *testing.T, store models.TokenStore) {
+	mustStoreTokens(t, store, sampleToken("a", testTime))
+
+	usedAt := testTime.Add(time.Minute)
+	if err := store.TouchToken(context.Background(), "a", usedAt); err != nil {
+		t.Fatalf("touching: %s", err)
+	}
+	expected := sampleToken("a", testTime)
+	expected.LastUsedAt = &usedAt
+	assertTokens(t, []models.APIToken{expected}, []models.APIToken{mustGetToken(t, store, "a")})
+
+	assertEqual(t, models.ErrNoRows, store.TouchToken(context.Background(), "b", usedAt))
+}
+
+func testAccessTokenRevoke(t *testing.T, store models.TokenStore) {
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour)
+	for _, jti := range []string{"a", "a", "b"} {
+		if err := store.RevokeAccessToken(ctx, jti, expiresAt); err != nil {
+			t.Fatalf("revoking %s: %s", jti, err)
+		}
+	}
+
+	for jti, expected := range map[string]bool{"a": true, "b": true, "c": false} {
+		revoked, err := store.AccessTokenRevoked(ctx, jti)
+		if err != nil {
+			t.Fatalf("reading %s: %s", jti, err)
+		}
+		assertEqual(t, expected, revoked)
+	}
+}
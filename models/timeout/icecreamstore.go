@@ -0,0 +1,154 @@
+//Package timeout holds decorators bounding every call to the models
+//stores by a deadline, so a slow store cannot hold on to a request
+//for longer than it is worth waiting for
+package timeout
+
+import (
+	"context"
+	"time"
+
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//Config holds the settings of the timeout decorators
+type Config struct {
+	//QueryTimeout bounds every call to the store. 0 leaves calls bound
+	//only by the context they are given
+	QueryTimeout time.Duration
+}
+
+type iceCreamStore struct {
+	models.IceCreamStore
+	cfg Config
+}
+
+//NewIceCreamStore wraps store so every call is given at most
+//cfg.QueryTimeout. A call outliving it fails with models.ErrQueryTimeout
+//while one interrupted by its own context fails with the context error
+func NewIceCreamStore(store models.IceCreamStore, cfg Config) models.IceCreamStore {
+	return &iceCreamStore{
+		IceCreamStore: store,
+		cfg:           cfg,
+	}
+}
+
+//bound derives the context of a single call from ctx
+func (i *iceCreamStore) bound(ctx context.Context) (context.Context, context.CancelFunc) {
+	if i.cfg.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, i.cfg.QueryTimeout)
+}
+
+//check replaces the error of a call that was interrupted, whatever the
+//store made of the interruption, with the reason for it
+func check(parent, ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if parentErr := parent.Err(); parentErr != nil {
+		return parentErr
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return models.ErrQueryTimeout
+	}
+	return err
+}
+
+func (i *iceCreamStore) StoreContext(parent context.Context, iceCreamInput models.IceCream) error {
+	ctx, cancel := i.bound(parent)
+	defer cancel()
+	return check(parent, ctx, i.IceCreamStore.StoreContext(ctx, iceCreamInput))
+}
+
+func (i *iceCreamStore) Get(parent context.Context, name string) (*models.IceCream, error) {
+	ctx, cancel := i.bound(parent)
+	defer cancel()
+	iceCream, err := i.IceCreamStore.Get(ctx, name)
+	return iceCream, check(parent, ctx, err)
+}
+
+func (i *iceCreamStore) GetAll(parent context.Context, filter models.IceCreamFilter, pageSize int,
+	cursor string) (*models.IceCreamPage, error) {
+	ctx, cancel := i.bound(parent)
+	defer cancel()
+	page, err := i.IceCreamStore.GetAll(ctx, filter, pageSize, cursor)
+	return page, check(parent, ctx, err)
+}
+
+func (i *iceCreamStore) Search(parent context.Context, query models.SearchQuery,
+	limit int) ([]models.SearchResult, error) {
+	ctx, cancel := i.bound(parent)
+	defer cancel()
+	results, err := i.IceCreamStore.Search(ctx, query, limit)
+	return results, check(parent, ctx, err)
+}
+
+func (i *iceCreamStore) Update(parent context.Context, iceCreamInput models.IceCream) (*models.IceCream, error) {
+	ctx, cancel := i.bound(parent)
+	defer cancel()
+	iceCream, err := i.IceCreamStore.Update(ctx, iceCreamInput)
+	return iceCream, check(parent, ctx, err)
+}
+
+func (i *iceCreamStore) Replace(parent context.Context, iceCreamInput models.IceCream) error {
+	ctx, cancel := i.bound(parent)
+	defer cancel()
+	return check(parent, ctx, i.IceCreamStore.Replace(ctx, iceCreamInput))
+}
+
+func (i *iceCreamStore) Upsert(parent context.Context,
+	iceCreamInput models.IceCream) (*models.IceCream, bool, error) {
+	ctx, cancel := i.bound(parent)
+	defer cancel()
+	iceCream, created, err := i.IceCreamStore.Upsert(ctx, iceCreamInput)
+	return iceCream, created, check(parent, ctx, err)
+}
+
+func (i *iceCreamStore) Patch(parent context.Context, name string,
+	patch models.IceCreamPatch) (*models.IceCream, error) {
+	ctx, cancel := i.bound(parent)
+	defer cancel()
+	iceCream, err := i.IceCreamStore.Patch(ctx, name, patch)
+	return iceCream, check(parent, ctx, err)
+}
+
+func (i *iceCreamStore) Delete(parent context.Context, name string, version int64) error {
+	ctx, cancel := i.bound(parent)
+	defer cancel()
+	return check(parent, ctx, i.IceCreamStore.Delete(ctx, name, version))
+}
+
+func (i *iceCreamStore) GetTrash(parent context.Context, pageSize int, cursor string) (*models.TrashPage, error) {
+	ctx, cancel := i.bound(parent)
+	defer cancel()
+	page, err := i.IceCreamStore.GetTrash(ctx, pageSize, cursor)
+	return page, check(parent, ctx, err)
+}
+
+func (i *iceCreamStore) GetTrashed(parent context.Context, name string) (*models.TrashedIceCream, error) {
+	ctx, cancel := i.bound(parent)
+	defer cancel()
+	trashed, err := i.IceCreamStore.GetTrashed(ctx, name)
+	return trashed, check(parent, ctx, err)
+}
+
+func (i *iceCreamStore) Restore(parent context.Context, name string, version int64) error {
+	ctx, cancel := i.bound(parent)
+	defer cancel()
+	return check(parent, ctx, i.IceCreamStore.Restore(ctx, name, version))
+}
+
+func (i *iceCreamStore) Purge(parent context.Context, olderThan time.Time) (int64, error) {
+	ctx, cancel := i.bound(parent)
+	defer cancel()
+	purged, err := i.IceCreamStore.Purge(ctx, olderThan)
+	return purged, check(parent, ctx, err)
+}
+
+func (i *iceCreamStore) History(parent context.Context, name string) ([]models.HistoryEntry, error) {
+	ctx, cancel := i.bound(parent)
+	defer cancel()
+	history, err := i.IceCreamStore.History(ctx, name)
+	return history, check(parent, ctx, err)
+}
@@ -0,0 +1,67 @@
+package timeout
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+	"github.com/sudarshan-reddy/benjerry/models/memory"
+	"github.com/sudarshan-reddy/benjerry/models/storetest"
+)
+
+//slowStore blocks every Get until its context is done and then fails
+//the way a database driver would, without the context error
+type slowStore struct {
+	models.IceCreamStore
+}
+
+func (s *slowStore) Get(ctx context.Context, name string) (*models.IceCream, error) {
+	<-ctx.Done()
+	return nil, errors.New("pq: canceling statement due to user request")
+}
+
+func Test_IceCreamStoreConformance(t *testing.T) {
+	storetest.RunIceCreamStoreTests(t, func(t *testing.T) models.IceCreamStore {
+		return NewIceCreamStore(memory.NewIceCreamStore(), Config{QueryTimeout: time.Second})
+	})
+}
+
+func Test_Timeouts(t *testing.T) {
+	expired, cancelExpired := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancelExpired()
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var tests = []struct {
+		desc          string
+		ctx           context.Context
+		expectedError error
+	}{
+		{
+			desc:          "a call outliving the query timeout fails with ErrQueryTimeout",
+			ctx:           context.Background(),
+			expectedError: models.ErrQueryTimeout,
+		},
+		{
+			desc:          "a call outliving the deadline of its context fails with it",
+			ctx:           expired,
+			expectedError: context.DeadlineExceeded,
+		},
+		{
+			desc:          "a call whose context is cancelled fails with context.Canceled",
+			ctx:           cancelled,
+			expectedError: context.Canceled,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			store := NewIceCreamStore(&slowStore{}, Config{QueryTimeout: 20 * time.Millisecond})
+			_, err := store.Get(test.ctx, "Chocobar")
+			assert.Equal(t, test.expectedError, err)
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+//tokenPrefix starts every minted token, telling them apart from static
+//tokens and JWTs
+const tokenPrefix = "bj_"
+
+//Kinds of APIToken. API tokens are bearer tokens of the api, OAuth
+//clients are only accepted by the OAuth server, which issues them short
+//lived access tokens
+const (
+	TokenKindAPI         = "api"
+	TokenKindOAuthClient = "oauth_client"
+)
+
+//APIToken is a bearer token kept by a TokenStore. The token itself is
+//`bj_<ID>_<secret>` and is only known when minted: the store only keeps
+//SecretHash, the SHA-256 of its secret
+type APIToken struct {
+	ID         string     `json:"id"`
+	Owner      string     `json:"owner"`
+	Kind       string     `json:"kind"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	SecretHash []byte     `json:"-"`
+}
+
+//TokenStore holds the API tokens. Tokens are addressed by their ID,
+//missing ones fail with ErrNoRows
+type TokenStore interface {
+	//StoreToken fails with ErrRowAlreadyExists when the ID is taken
+	StoreToken(ctx context.Context, token APIToken) error
+	GetToken(ctx context.Context, id string) (*APIToken, error)
+	//ListTokens returns every token, revoked ones included, oldest first
+	ListTokens(ctx context.Context) ([]APIToken, error)
+	//RevokeToken revokes the token at at and returns it. Revoking it
+	//again keeps the time of the first revocation
+	RevokeToken(ctx context.Context, id string, at time.Time) (*APIToken, error)
+	//TouchToken records the token was last used at at
+	TouchToken(ctx context.Context, id string, at time.Time) error
+	//RevokeAccessToken records the access token of jti as revoked. The
+	//record is only kept until expiresAt, when the token expires anyway
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	//AccessTokenRevoked tells whether the access token of jti is revoked
+	AccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+//ScopeAll is the scope of superuser tokens, which are granted every
+//scope
+const ScopeAll = "*"
+
+//GrantsScope tells whether a token holding scopes is granted scope. The
+//scopes of tokens are literal, only ScopeAll grants scopes other than
+//itself
+func GrantsScope(scopes []string, scope string) bool {
+	for _, held := range scopes {
+		if held == scope || held == ScopeAll {
+			return true
+		}
+	}
+	return false
+}
+
+//MintToken creates an API token of owner holding scopes, returning it
+//along with the bearer token it is used with
+func MintToken(owner string, scopes []string, expiresAt *time.Time, now time.Time) (APIToken, string, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return APIToken{}, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return APIToken{}, "", err
+	}
+	token := APIToken{
+		ID:         id,
+		Owner:      owner,
+		Kind:       TokenKindAPI,
+		Scopes:     scopes,
+		CreatedAt:  TokenTime(now),
+		ExpiresAt:  expiresAt,
+		SecretHash: hashSecret(secret),
+	}
+	return token, tokenPrefix + id + "_" + secret, nil
+}
+
+//TokenTime is the form the times of tokens are kept in, in UTC to the
+//microsecond like postgres keeps them
+func TokenTime(at time.Time) time.Time {
+	return at.UTC().Truncate(time.Microsecond)
+}
+
+func randomHex(size int) (string, error) {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+func hashSecret(secret string) []byte {
+	hash := sha256.Sum256([]byte(secret))
+	return hash[:]
+}
+
+//ParseToken splits a bearer token minted by MintToken into its ID and
+//secret. It returns false for any other token
+func ParseToken(bearer string) (id, secret string, ok bool) {
+	if !strings.HasPrefix(bearer, tokenPrefix) {
+		return "", "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(bearer, tokenPrefix), "_")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+//Matches reports whether secret is the secret of the token, in constant
+//time
+func (t APIToken) Matches(secret string) bool {
+	return subtle.ConstantTimeCompare(hashSecret(secret), t.SecretHash) == 1
+}
+
+//Active reports whether the token can be used at now, being neither
+//revoked nor expired
+func (t APIToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
+
+//Validate returns every constraint a token about to be minted at now
+//breaks
+func (t APIToken) Validate(now time.Time) []FieldError {
+	var errs []FieldError
+	if msg := (stringField{required: true, maxLength: 200}).validate(strings.TrimSpace(t.Owner)); msg != "" {
+		errs = append(errs, FieldError{Pointer: "/owner", Message: msg})
+	}
+	if t.Kind != TokenKindAPI && t.Kind != TokenKindOAuthClient {
+		errs = append(errs, FieldError{Pointer: "/kind",
+			Message: "should be " + TokenKindAPI + " or " + TokenKindOAuthClient})
+	}
+	if len(t.Scopes) == 0 {
+		errs = append(errs, FieldError{Pointer: "/scopes", Message: "should list at least one scope"})
+	}
+	errs = append(errs, listField{pointer: "/scopes"}.validate(t.Scopes)...)
+	if t.ExpiresAt != nil && !t.ExpiresAt.After(now) {
+		errs = append(errs, FieldError{Pointer: "/expires_at", Message: "should be in the future"})
+	}
+	return errs
+}
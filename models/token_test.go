@@ -0,0 +1,94 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MintToken(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+
+	token, bearer, err := MintToken("catalog team", []string{"read.icecream"}, nil, now)
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(bearer, "bj_"+token.ID+"_"))
+	assert.Equal(TokenKindAPI, token.Kind)
+
+	id, secret, ok := ParseToken(bearer)
+	assert.True(ok)
+	assert.Equal(token.ID, id)
+	assert.True(token.Matches(secret))
+	assert.False(token.Matches(secret[1:]))
+
+	other, _, err := MintToken("catalog team", []string{"read.icecream"}, nil, now)
+	assert.NoError(err)
+	assert.NotEqual(token.ID, other.ID)
+	assert.False(other.Matches(secret))
+}
+
+func Test_ParseToken(t *testing.T) {
+	for _, bearer := range []string{"suWsnKCXYjz12hQO", "bj_", "bj_id", "bj__secret", "bj_id_", "bj_id_secret_more"} {
+		_, _, ok := ParseToken(bearer)
+		assert.False(t, ok, bearer)
+	}
+}
+
+func Test_APITokenActive(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Minute)
+	earlier := now.Add(-time.Minute)
+
+	assert.True(t, APIToken{}.Active(now))
+	assert.True(t, APIToken{ExpiresAt: &later}.Active(now))
+	assert.False(t, APIToken{ExpiresAt: &earlier}.Active(now))
+	assert.False(t, APIToken{RevokedAt: &earlier}.Active(now))
+}
+
+func Test_GrantsScope(t *testing.T) {
+	assert.True(t, GrantsScope([]string{"read.icecream", "post.icecream"}, "post.icecream"))
+	assert.True(t, GrantsScope([]string{ScopeAll}, "admin.token"))
+	assert.False(t, GrantsScope([]string{"*.icecream"}, "delete.icecream"))
+	assert.False(t, GrantsScope([]string{"p*"}, "post.icecream"))
+	assert.False(t, GrantsScope(nil, "read.icecream"))
+}
+
+func Test_APITokenValidate(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Minute)
+
+	var tests = []struct {
+		desc     string
+		token    APIToken
+		expected []FieldError
+	}{
+		{
+			desc:  "a valid token breaks nothing",
+			token: APIToken{Owner: "catalog team", Kind: TokenKindAPI, Scopes: []string{"read.icecream"}},
+		},
+		{
+			desc:  "every broken constraint is returned in field order",
+			token: APIToken{Owner: " ", Scopes: []string{"read.icecream", "", "read.icecream"}, ExpiresAt: &earlier},
+			expected: []FieldError{
+				{Pointer: "/owner", Message: "is required"},
+				{Pointer: "/kind", Message: "should be api or oauth_client"},
+				{Pointer: "/scopes/1", Message: "should not be empty"},
+				{Pointer: "/scopes/2", Message: "repeats /scopes/0"},
+				{Pointer: "/expires_at", Message: "should be in the future"},
+			},
+		},
+		{
+			desc:     "tokens hold at least one scope",
+			token:    APIToken{Owner: "catalog team", Kind: TokenKindOAuthClient},
+			expected: []FieldError{{Pointer: "/scopes", Message: "should list at least one scope"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.token.Validate(now))
+		})
+	}
+}
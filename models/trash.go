@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+//TrashedIceCream is an IceCream that has been deleted but not yet
+//purged
+type TrashedIceCream struct {
+	IceCream
+	DeletedAt time.Time `json:"deleted_at"`
+	DeletedBy string    `json:"deleted_by"`
+}
+
+//TrashPage is a single page of TrashedIceCream data, see IceCreamPage
+type TrashPage struct {
+	IceCreams  []TrashedIceCream
+	NextCursor string
+	PrevCursor string
+}
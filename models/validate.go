@@ -0,0 +1,131 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+//FieldError is a constraint broken by a field of an IceCream. Pointer
+//is the RFC 6901 json pointer of the field
+type FieldError struct {
+	Pointer string
+	Message string
+}
+
+func (f FieldError) Error() string {
+	return strings.TrimPrefix(f.Pointer, "/") + " " + f.Message
+}
+
+//stringField declares the constraints on a string field of an IceCream.
+//A zero maxLength leaves the length unbounded
+type stringField struct {
+	pointer   string
+	value     func(IceCream) string
+	required  bool
+	maxLength int
+	image     bool
+}
+
+//listField declares the constraints on a list field of an IceCream.
+//Entries may never be empty or repeated
+type listField struct {
+	pointer string
+	values  func(IceCream) []string
+}
+
+//iceCreamStringFields bounds the fields after the columns of the
+//ice_cream table. text columns are unbounded but name, being the key
+//and part of urls, is kept short
+var iceCreamStringFields = []stringField{
+	{pointer: "/name", value: func(i IceCream) string { return i.Name }, required: true, maxLength: 200},
+	{pointer: "/image_open", value: func(i IceCream) string { return i.ImageOpen }, image: true},
+	{pointer: "/image_closed", value: func(i IceCream) string { return i.ImageClosed }, image: true},
+	{pointer: "/story", value: func(i IceCream) string { return i.Story }},
+	{pointer: "/description", value: func(i IceCream) string { return i.Description }},
+	{pointer: "/allergy_info", value: func(i IceCream) string { return i.AllergyInfo }},
+	{pointer: "/dietary_certification", value: func(i IceCream) string { return i.DietaryCertification }},
+	{pointer: "/product_id", value: func(i IceCream) string { return i.ProductID }, maxLength: 10},
+}
+
+//iceCreamListFields check ingredients as they are stored, once
+//compound ingredients split on their commas are put back together
+var iceCreamListFields = []listField{
+	{pointer: "/sourcing_values", values: func(i IceCream) []string { return i.SourcingValues }},
+	{pointer: "/ingredients", values: func(i IceCream) []string { return i.NormalizeIngredients().Ingredients }},
+}
+
+//Validate returns every constraint iceCream breaks, in the order of its
+//fields, or nothing when it can be stored
+func (i IceCream) Validate() []FieldError {
+	var errs []FieldError
+	for _, field := range iceCreamStringFields {
+		if msg := field.validate(field.value(i)); msg != "" {
+			errs = append(errs, FieldError{Pointer: field.pointer, Message: msg})
+		}
+	}
+	for _, field := range iceCreamListFields {
+		errs = append(errs, field.validate(field.values(i))...)
+	}
+	return errs
+}
+
+//Validate returns every constraint the fields set by the patch break
+func (p IceCreamPatch) Validate() []FieldError {
+	var errs []FieldError
+	//fields left unset are empty, which only the name cannot be, and
+	//the name is never patched
+	for _, err := range p.Apply(IceCream{}).Validate() {
+		if err.Pointer != "/name" {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func (f stringField) validate(value string) string {
+	switch {
+	case value == "":
+		if f.required {
+			return "is required"
+		}
+	case f.maxLength != 0 && utf8.RuneCountInString(value) > f.maxLength:
+		return fmt.Sprintf("should be at most %d characters long", f.maxLength)
+	case f.image && !isImagePath(value):
+		return "should be an absolute path or an http(s) url"
+	}
+	return ""
+}
+
+func (f listField) validate(values []string) []FieldError {
+	var errs []FieldError
+	seen := map[string]int{}
+	for index, value := range values {
+		pointer := fmt.Sprintf("%s/%d", f.pointer, index)
+		if strings.TrimSpace(value) == "" {
+			errs = append(errs, FieldError{Pointer: pointer, Message: "should not be empty"})
+			continue
+		}
+		if first, ok := seen[value]; ok {
+			errs = append(errs, FieldError{Pointer: pointer,
+				Message: fmt.Sprintf("repeats %s/%d", f.pointer, first)})
+			continue
+		}
+		seen[value] = index
+	}
+	return errs
+}
+
+//isImagePath accepts the absolute paths images of the catalog are
+//served from as well as http(s) urls
+func isImagePath(value string) bool {
+	imageURL, err := url.Parse(value)
+	if err != nil || strings.ContainsAny(value, " \t\n") {
+		return false
+	}
+	if imageURL.Scheme == "" {
+		return imageURL.Host == "" && strings.HasPrefix(imageURL.Path, "/")
+	}
+	return (imageURL.Scheme == "http" || imageURL.Scheme == "https") && imageURL.Host != ""
+}
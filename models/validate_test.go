@@ -0,0 +1,76 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_IceCreamValidate(t *testing.T) {
+	var tests = []struct {
+		desc     string
+		iceCream IceCream
+		expected []FieldError
+	}{
+		{
+			desc: "a valid ice cream breaks nothing",
+			iceCream: IceCream{
+				Name:           "Chillin' the Roast™",
+				ImageOpen:      "/files/flavors/chillin-the-roast-open.png",
+				ImageClosed:    "https://www.benjerry.com/files/flavors/chillin-the-roast.png",
+				SourcingValues: []string{"Fairtrade"},
+				Ingredients:    []string{"cream", "coffee"},
+				ProductID:      "1234567890",
+			},
+		},
+		{
+			desc:     "the name is required and bounded",
+			iceCream: IceCream{Name: strings.Repeat("a", 201)},
+			expected: []FieldError{{Pointer: "/name", Message: "should be at most 200 characters long"}},
+		},
+		{
+			desc: "every broken constraint is returned in field order",
+			iceCream: IceCream{
+				ImageOpen:      "files/relative.png",
+				ImageClosed:    "ftp://benjerry.com/closed.png",
+				ProductID:      "ÅÅÅÅÅÅÅÅÅÅÅ",
+				SourcingValues: []string{"Fairtrade", " ", "Fairtrade"},
+			},
+			expected: []FieldError{
+				{Pointer: "/name", Message: "is required"},
+				{Pointer: "/image_open", Message: "should be an absolute path or an http(s) url"},
+				{Pointer: "/image_closed", Message: "should be an absolute path or an http(s) url"},
+				{Pointer: "/product_id", Message: "should be at most 10 characters long"},
+				{Pointer: "/sourcing_values/1", Message: "should not be empty"},
+				{Pointer: "/sourcing_values/2", Message: "repeats /sourcing_values/0"},
+			},
+		},
+		{
+			desc:     "protocol relative and spaced image paths are rejected",
+			iceCream: IceCream{Name: "a", ImageOpen: "//evil.com/a.png", ImageClosed: "/a b.png"},
+			expected: []FieldError{
+				{Pointer: "/image_open", Message: "should be an absolute path or an http(s) url"},
+				{Pointer: "/image_closed", Message: "should be an absolute path or an http(s) url"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.iceCream.Validate())
+		})
+	}
+}
+
+func Test_IceCreamPatchValidate(t *testing.T) {
+	assert := assert.New(t)
+	productID := "12345678901"
+	ingredients := []string{"cream", "cream"}
+
+	assert.Empty(IceCreamPatch{}.Validate())
+	assert.Equal([]FieldError{
+		{Pointer: "/product_id", Message: "should be at most 10 characters long"},
+		{Pointer: "/ingredients/1", Message: "repeats /ingredients/0"},
+	}, IceCreamPatch{ProductID: &productID, Ingredients: &ingredients}.Validate())
+}
@@ -0,0 +1,52 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/sudarshan-reddy/benjerry/httputils"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//routeAccess is a route along with the scopes the policy requires for
+//it
+type routeAccess struct {
+	Method     string `json:"method"`
+	Pattern    string `json:"pattern"`
+	Requires   string `json:"requires"`
+	Allowed    bool   `json:"allowed"`
+	expression ScopeExpression
+}
+
+//accessExplanation tells the caller who it is authenticated as and
+//which routes its token can access
+type accessExplanation struct {
+	Actor  string        `json:"actor"`
+	Scopes []string      `json:"scopes"`
+	Routes []routeAccess `json:"routes"`
+}
+
+//explainAccess lists the scopes of the token of the request and every
+//route along with whether the token is allowed to access it
+func (router *Router) explainAccess(w http.ResponseWriter, r *http.Request) {
+	scopes, ok := r.Context().Value(ContextKeyScopes).([]string)
+	if !ok {
+		subError := httputils.NewSubError(httputils.InvalidScope, "message", "context does not have scope set")
+		writeAuthError(httputils.NewHandlerError(http.StatusUnauthorized, subError), r, w)
+		return
+	}
+
+	explanation := accessExplanation{
+		Actor:  models.ActorFromContext(r.Context()),
+		Scopes: scopes,
+		Routes: make([]routeAccess, 0, len(router.routes)),
+	}
+	for _, route := range router.routes {
+		route.Requires = route.expression.String()
+		route.Allowed = route.expression.Allows(scopes)
+		explanation.Routes = append(explanation.Routes, route)
+	}
+	if err := httputils.WriteJSON(http.StatusOK, explanation, w); err != nil {
+		httputils.WriteHandlerError(httputils.NewUnexpectedError(err), r, w)
+		return
+	}
+}
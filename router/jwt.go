@@ -0,0 +1,282 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sudarshan-reddy/benjerry/httputils"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//The signing algorithms JWTs are verified with
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+//JWTKey is a key tokens are verified with. Key is a []byte secret for
+//HS256, an *rsa.PublicKey for RS256 or a P-256 *ecdsa.PublicKey for
+//ES256. Tokens naming a kid are only verified with the key of that ID,
+//and a key with an Alg only verifies tokens signed with it
+type JWTKey struct {
+	ID  string
+	Alg string
+	Key interface{}
+}
+
+//verify checks signature is the signature of signed by the key with alg
+func (k JWTKey) verify(alg string, signed, signature []byte) error {
+	if k.Alg != "" && k.Alg != alg {
+		return errWrongKey
+	}
+	digest := sha256.Sum256(signed)
+
+	switch key := k.Key.(type) {
+	case []byte:
+		if alg != AlgHS256 {
+			return errWrongKey
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errInvalidSignature
+		}
+	case *rsa.PublicKey:
+		if alg != AlgRS256 {
+			return errWrongKey
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return errInvalidSignature
+		}
+	case *ecdsa.PublicKey:
+		if alg != AlgES256 || key.Curve != elliptic.P256() {
+			return errWrongKey
+		}
+		//ES256 signatures are the 32 byte r and s put together
+		if len(signature) != 64 {
+			return errInvalidSignature
+		}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(key, digest[:], r, s) {
+			return errInvalidSignature
+		}
+	default:
+		return errWrongKey
+	}
+	return nil
+}
+
+var (
+	errWrongKey         = errors.New("key does not verify the algorithm")
+	errInvalidSignature = errors.New("invalid signature")
+)
+
+//JWTConfig tells which tokens JWT authentication accepts
+type JWTConfig struct {
+	//Audience has to be one of the aud of the token when set
+	Audience string
+	//Issuer has to be the iss of the token when set
+	Issuer string
+	//ScopesClaim names the claim holding the scopes of the token, either
+	//as a space separated string or as an array of strings
+	ScopesClaim string
+	//Leeway is the clock skew tolerated on exp and nbf
+	Leeway time.Duration
+}
+
+type jwtauthenticator struct {
+	keys []JWTKey
+	cfg  JWTConfig
+}
+
+//NewJWTAuthenticator instantiates an AuthHandler accepting bearer JWTs
+//signed by one of keys. The scopes of a request are read from the
+//cfg.ScopesClaim claim of its token
+func NewJWTAuthenticator(keys []JWTKey, cfg JWTConfig) AuthHandler {
+	return &jwtauthenticator{
+		keys: keys,
+		cfg:  cfg,
+	}
+}
+
+//jwtHeader is the part of the JOSE header of a token that is read
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func (j *jwtauthenticator) Authenticate(r *http.Request) (*http.Request, *httputils.HandlerError) {
+	authToken, err := bearerToken(r)
+	if err != nil {
+		return nil, unauthorized(err.Error())
+	}
+
+	claims, err := j.verify(authToken, time.Now())
+	if err != nil {
+		return nil, unauthorized(err.Error())
+	}
+
+	scopeContext := context.WithValue(r.Context(), ContextKeyScopes, claimStrings(claims[j.cfg.ScopesClaim]))
+	authContext := context.WithValue(scopeContext, ContextKeyAuthToken, authToken)
+	//changes are audited with the subject of the token, or a
+	//fingerprint of the token when it has none
+	actor, _ := claims["sub"].(string)
+	if actor == "" {
+		actor = tokenActor(authToken)
+	}
+	return r.WithContext(models.ContextWithActor(authContext, actor)), nil
+}
+
+//verify checks the signature of token and its registered claims at
+//now, returning its claims
+func (j *jwtauthenticator) verify(token string, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token is not a JWT")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %s", err)
+	}
+	switch header.Alg {
+	case AlgHS256, AlgRS256, AlgES256:
+	default:
+		return nil, fmt.Errorf("unsupported token algorithm: %q", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature: %s", err)
+	}
+	if err := j.verifySignature(header, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %s", err)
+	}
+	return claims, j.checkClaims(claims, now)
+}
+
+//verifySignature tries every key that may have signed a token with
+//header until one verifies signature
+func (j *jwtauthenticator) verifySignature(header jwtHeader, signed, signature []byte) error {
+	err := fmt.Errorf("no key verifies tokens of kid %q and algorithm %s", header.Kid, header.Alg)
+	for _, key := range j.keys {
+		if header.Kid != "" && key.ID != header.Kid {
+			continue
+		}
+		switch keyErr := key.verify(header.Alg, signed, signature); keyErr {
+		case nil:
+			return nil
+		case errInvalidSignature:
+			err = keyErr
+		}
+	}
+	return err
+}
+
+//checkClaims checks exp, nbf, aud and iss. Tokens have to expire
+func (j *jwtauthenticator) checkClaims(claims map[string]interface{}, now time.Time) error {
+	expiry, ok, err := numericDate(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("token has no exp")
+	}
+	if !now.Before(expiry.Add(j.cfg.Leeway)) {
+		return errors.New("token is expired")
+	}
+
+	notBefore, ok, err := numericDate(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(j.cfg.Leeway).Before(notBefore) {
+		return errors.New("token is not valid yet")
+	}
+
+	if j.cfg.Audience != "" {
+		//a single audience is a string of its own, spaces and all
+		audiences := claimStrings(claims["aud"])
+		if audience, ok := claims["aud"].(string); ok {
+			audiences = []string{audience}
+		}
+		var found bool
+		for _, audience := range audiences {
+			found = found || audience == j.cfg.Audience
+		}
+		if !found {
+			return fmt.Errorf("token is not meant for audience %s", j.cfg.Audience)
+		}
+	}
+
+	if issuer, _ := claims["iss"].(string); j.cfg.Issuer != "" && issuer != j.cfg.Issuer {
+		return fmt.Errorf("token is not issued by %s", j.cfg.Issuer)
+	}
+	return nil
+}
+
+//decodeSegment decodes a base64url encoded json segment of a token
+func decodeSegment(segment string, value interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(value)
+}
+
+//numericDate reads the claim called name as seconds since the epoch.
+//It returns false when the claim is missing
+func numericDate(claims map[string]interface{}, name string) (time.Time, bool, error) {
+	value, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	number, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("token %s is not a number", name)
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("token %s is not a number", name)
+	}
+	return time.Unix(int64(seconds), 0), true, nil
+}
+
+//claimStrings reads a claim holding either a space separated string or
+//an array of strings, like scope or aud
+func claimStrings(claim interface{}) []string {
+	values := []string{}
+	switch claim := claim.(type) {
+	case string:
+		values = append(values, strings.Fields(claim)...)
+	case []interface{}:
+		for _, value := range claim {
+			if value, ok := value.(string); ok {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
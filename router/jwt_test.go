@@ -0,0 +1,216 @@
+package router
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//signers of the algorithms accepted by the JWT authenticator
+var (
+	testSecret    = []byte("a shared secret of at least 32 bytes")
+	testRSAKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	testECKey, _  = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+)
+
+//signJWT builds a token of header and claims signed with alg
+func signJWT(t *testing.T, header, claims map[string]interface{}) string {
+	encode := func(value interface{}) string {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(header) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch header["alg"] {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, testSecret)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case AlgRS256:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, testRSAKey, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case AlgES256:
+		r, s, err := ecdsa.Sign(rand.Reader, testECKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func Test_JWTAuthenticate(t *testing.T) {
+	now := time.Now().Unix()
+	validClaims := func(overrides map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{
+			"sub": "svc-catalog", "iss": "https://auth.example.com", "aud": []string{"benjerry", "other"},
+			"exp": now + 60, "nbf": now - 60, "scope": "read.icecream post.icecream",
+		}
+		for key, value := range overrides {
+			if value == nil {
+				delete(claims, key)
+				continue
+			}
+			claims[key] = value
+		}
+		return claims
+	}
+
+	var tests = []struct {
+		desc           string
+		header         map[string]interface{}
+		claims         map[string]interface{}
+		token          string
+		expectedScopes []string
+		expectedErr    string
+	}{
+		{
+			desc:           "an HS256 token gets the scopes of its claims",
+			header:         map[string]interface{}{"alg": AlgHS256, "kid": "shared"},
+			claims:         validClaims(nil),
+			expectedScopes: []string{"read.icecream", "post.icecream"},
+		},
+		{
+			desc:           "an RS256 token without kid is tried against every key",
+			header:         map[string]interface{}{"alg": AlgRS256},
+			claims:         validClaims(map[string]interface{}{"scope": []string{"read.icecream"}}),
+			expectedScopes: []string{"read.icecream"},
+		},
+		{
+			desc:           "an ES256 token within the leeway of its exp is accepted",
+			header:         map[string]interface{}{"alg": AlgES256, "kid": "ec"},
+			claims:         validClaims(map[string]interface{}{"exp": now - 5, "scope": nil}),
+			expectedScopes: []string{},
+		},
+		{
+			desc:        "an expired token is rejected",
+			header:      map[string]interface{}{"alg": AlgHS256},
+			claims:      validClaims(map[string]interface{}{"exp": now - 60}),
+			expectedErr: "token is expired",
+		},
+		{
+			desc:        "a token without exp is rejected",
+			header:      map[string]interface{}{"alg": AlgHS256},
+			claims:      validClaims(map[string]interface{}{"exp": nil}),
+			expectedErr: "token has no exp",
+		},
+		{
+			desc:        "a token used before nbf is rejected",
+			header:      map[string]interface{}{"alg": AlgHS256},
+			claims:      validClaims(map[string]interface{}{"nbf": now + 60}),
+			expectedErr: "token is not valid yet",
+		},
+		{
+			desc:        "a token for another audience is rejected",
+			header:      map[string]interface{}{"alg": AlgHS256},
+			claims:      validClaims(map[string]interface{}{"aud": "benjerry admin"}),
+			expectedErr: "token is not meant for audience benjerry",
+		},
+		{
+			desc:        "a token of another issuer is rejected",
+			header:      map[string]interface{}{"alg": AlgHS256},
+			claims:      validClaims(map[string]interface{}{"iss": "https://evil.example.com"}),
+			expectedErr: "token is not issued by https://auth.example.com",
+		},
+		{
+			desc:        "a token naming the kid of a key of another algorithm is rejected",
+			header:      map[string]interface{}{"alg": AlgRS256, "kid": "shared"},
+			claims:      validClaims(nil),
+			expectedErr: "no key verifies tokens of kid \"shared\" and algorithm RS256",
+		},
+		{
+			desc:        "unsigned tokens are rejected",
+			token:       "eyJhbGciOiJub25lIn0.eyJleHAiOjk5OTk5OTk5OTl9.",
+			expectedErr: "unsupported token algorithm: \"none\"",
+		},
+		{
+			desc:        "static tokens are not JWTs",
+			token:       "suWsnKCXYjz12hQO",
+			expectedErr: "token is not a JWT",
+		},
+	}
+
+	authHandler := NewJWTAuthenticator([]JWTKey{
+		{ID: "shared", Alg: AlgHS256, Key: testSecret},
+		{ID: "rsa", Key: &testRSAKey.PublicKey},
+		{ID: "ec", Key: &testECKey.PublicKey},
+	}, JWTConfig{
+		Audience:    "benjerry",
+		Issuer:      "https://auth.example.com",
+		ScopesClaim: "scope",
+		Leeway:      30 * time.Second,
+	})
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			token := test.token
+			if token == "" {
+				token = signJWT(t, test.header, test.claims)
+			}
+			req, err := http.NewRequest("GET", "/url", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			req, handlerErr := authHandler.Authenticate(req)
+			if test.expectedErr != "" {
+				if assert.NotNil(handlerErr) {
+					assert.Equal(http.StatusUnauthorized, handlerErr.HTTPStatusCode)
+					assert.Equal(test.expectedErr, handlerErr.SubErrors[0].Details["message"])
+				}
+				return
+			}
+			if assert.Nil(handlerErr) {
+				assert.Equal(test.expectedScopes, req.Context().Value(ContextKeyScopes))
+				assert.Equal(token, req.Context().Value(ContextKeyAuthToken))
+				assert.Equal("svc-catalog", models.ActorFromContext(req.Context()))
+			}
+		})
+	}
+}
+
+func Test_JWTAuthenticateTamperedSignature(t *testing.T) {
+	assert := assert.New(t)
+	authHandler := NewJWTAuthenticator([]JWTKey{{Key: &testRSAKey.PublicKey}}, JWTConfig{ScopesClaim: "scope"})
+
+	token := signJWT(t, map[string]interface{}{"alg": AlgRS256},
+		map[string]interface{}{"exp": time.Now().Unix() + 60, "scope": "read.icecream"})
+	parts := strings.Split(token, ".")
+	tampered := signJWT(t, map[string]interface{}{"alg": AlgRS256},
+		map[string]interface{}{"exp": time.Now().Unix() + 60, "scope": "*"})
+	parts[1] = strings.Split(tampered, ".")[1]
+
+	req, err := http.NewRequest("GET", "/url", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.Join(parts, "."))
+	_, handlerErr := authHandler.Authenticate(req)
+	if assert.NotNil(handlerErr) {
+		assert.Equal("invalid signature", handlerErr.SubErrors[0].Details["message"])
+	}
+}
@@ -0,0 +1,97 @@
+package router
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LoadJWKS(t *testing.T) {
+	assert := assert.New(t)
+	encode := base64.RawURLEncoding.EncodeToString
+	jwks := map[string]interface{}{"keys": []map[string]string{
+		{"kty": "oct", "kid": "shared", "alg": AlgHS256, "k": encode(testSecret)},
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encode(testRSAKey.N.Bytes()),
+			"e": encode(big.NewInt(int64(testRSAKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encode(testECKey.X.Bytes()), "y": encode(testECKey.Y.Bytes())},
+		{"kty": "RSA", "kid": "encryption", "use": "enc"},
+	}}
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadJWKS(path)
+	assert.NoError(err)
+	assert.Equal([]JWTKey{
+		{ID: "shared", Alg: AlgHS256, Key: testSecret},
+		{ID: "rsa", Key: &testRSAKey.PublicKey},
+		{ID: "ec", Key: &testECKey.PublicKey},
+	}, keys)
+
+	if err := ioutil.WriteFile(path, []byte(`{"keys":[{"kty":"EC","crv":"P-384"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadJWKS(path)
+	assert.EqualError(err, "invalid key 0 of JWKS "+path+": unsupported curve \"P-384\"")
+}
+
+func Test_LoadPEMKeys(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writePEM := func(name, blockType string, der []byte) {
+		data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ecDER, err := x509.MarshalPKIXPublicKey(&testECKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM("ec.pem", "PUBLIC KEY", ecDER)
+	writePEM("rsa.pem", "RSA PUBLIC KEY", x509.MarshalPKCS1PublicKey(&testRSAKey.PublicKey))
+	writePEM("notes.txt", "PUBLIC KEY", nil)
+
+	keys, err := LoadPEMKeys(dir)
+	assert.NoError(err)
+	assert.Equal([]JWTKey{
+		{ID: "ec", Key: &testECKey.PublicKey},
+		{ID: "rsa", Key: &testRSAKey.PublicKey},
+	}, keys)
+
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384DER, err := x509.MarshalPKIXPublicKey(&p384Key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM("p384.pem", "PUBLIC KEY", p384DER)
+	_, err = LoadPEMKeys(dir)
+	assert.EqualError(err, "invalid key "+filepath.Join(dir, "p384.pem")+": unsupported curve P-384")
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM("p384.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(privateKey))
+	_, err = LoadPEMKeys(dir)
+	assert.EqualError(err, "invalid key "+filepath.Join(dir, "p384.pem")+": unsupported PEM block \"RSA PRIVATE KEY\"")
+}
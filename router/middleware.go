@@ -2,18 +2,79 @@ package router
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"net/http"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
 	"github.com/sudarshan-reddy/benjerry/httputils"
+	"github.com/sudarshan-reddy/benjerry/models"
 )
 
+//AuditRequestID hands the id set by chi's middleware.RequestID over to
+//the stores so they can record it along with the changes they make
+func AuditRequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := models.ContextWithRequestID(r.Context(), middleware.GetReqID(r.Context()))
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+//Deadline bounds the context of every request by timeout, or by the
+//timeout routeTimeouts holds for its route pattern. The pattern is only
+//known once the request is routed, so Deadline has to be used within a
+//group or inline. A timeout of 0 leaves the request unbounded
+func Deadline(timeout time.Duration, routeTimeouts map[string]time.Duration) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestTimeout := timeout
+			if rctx, ok := r.Context().Value(chi.RouteCtxKey).(*chi.Context); ok {
+				if routeTimeout, ok := routeTimeouts[rctx.RoutePattern()]; ok {
+					requestTimeout = routeTimeout
+				}
+			}
+			if requestTimeout <= 0 {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+			defer cancel()
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
 //AuthHandler dictates the interface that can be used to inject
 //authentication
 type AuthHandler interface {
 	Authenticate(r *http.Request) (*http.Request, *httputils.HandlerError)
 }
 
+//errMissingBearer rejects requests without a bearer token
+var errMissingBearer = errors.New("Authorization Type 'Bearer ' is missing")
+
+//bearerToken returns the token of the bearer Authorization header of r
+func bearerToken(r *http.Request) (string, error) {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return "", errMissingBearer
+	}
+	return strings.TrimPrefix(authorization, "Bearer "), nil
+}
+
+//unauthorized rejects a request for the reason in message, which is
+//only logged
+func unauthorized(message string) *httputils.HandlerError {
+	subError := httputils.NewSubError(httputils.InvalidScope, "message", message)
+	return httputils.NewHandlerError(http.StatusUnauthorized, subError)
+}
+
 //authenticator is the primary structure holding all the data required
 //to process scope authentication
 type authenticator struct {
@@ -51,7 +112,7 @@ func (s *authenticator) Authenticate(h http.Handler) http.Handler {
 		}
 
 		if handlerError != nil {
-			httputils.WriteHandlerError(handlerError, r, w)
+			writeAuthError(handlerError, r, w)
 			return
 		}
 
@@ -62,30 +123,67 @@ func (s *authenticator) Authenticate(h http.Handler) http.Handler {
 type statictokenauthenticator struct {
 	//tokenScopes is provided as a mapping of allowed scopes by
 	//static tokens.
-	tokenScopes map[string][]string
+	tokenScopes *StaticTokenSet
 }
 
 //NewStaticTokenAuthenticator instantiates a new instance of authenticator.ScopeGetter
 func NewStaticTokenAuthenticator(tokenScopes map[string][]string) AuthHandler {
+	return NewStaticTokenSetAuthenticator(NewStaticTokenSet(tokenScopes))
+}
+
+//NewStaticTokenSetAuthenticator instantiates an AuthHandler accepting
+//the static tokens tokenScopes holds at the time of each request
+func NewStaticTokenSetAuthenticator(tokenScopes *StaticTokenSet) AuthHandler {
 	return &statictokenauthenticator{
 		tokenScopes: tokenScopes,
 	}
 }
 
-func (s *statictokenauthenticator) Authenticate(r *http.Request) (*http.Request, *httputils.HandlerError) {
-	authToken := r.Header.Get("Authorization")
+//StaticTokenSet holds static tokens that can be replaced while
+//requests are being authenticated. Requests see either the whole
+//previous set or the whole new one
+type StaticTokenSet struct {
+	tokenScopes atomic.Value
+}
 
-	if !strings.HasPrefix(authToken, "Bearer ") {
-		subError := httputils.NewSubError(httputils.InvalidScope, "message", "Authorization Type 'Bearer ' is missing")
-		return nil, httputils.NewHandlerError(http.StatusUnauthorized, subError)
-	}
+//NewStaticTokenSet returns a new StaticTokenSet holding tokenScopes
+func NewStaticTokenSet(tokenScopes map[string][]string) *StaticTokenSet {
+	set := &StaticTokenSet{}
+	set.Store(tokenScopes)
+	return set
+}
 
-	authToken = strings.Replace(authToken, "Bearer ", "", 1)
+//Store replaces the tokens of the set. tokenScopes should not be
+//changed afterwards
+func (s *StaticTokenSet) Store(tokenScopes map[string][]string) {
+	s.tokenScopes.Store(tokenScopes)
+}
+
+//Load returns the tokens of the set
+func (s *StaticTokenSet) Load() map[string][]string {
+	return s.tokenScopes.Load().(map[string][]string)
+}
+
+//tokenActor identifies the bearer of token in the audit records by a
+//prefix of the sha256 hash of token
+func tokenActor(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return "token " + hex.EncodeToString(hash[:4])
+}
+
+func (s *statictokenauthenticator) Authenticate(r *http.Request) (*http.Request, *httputils.HandlerError) {
+	authToken, err := bearerToken(r)
+	if err != nil {
+		return nil, unauthorized(err.Error())
+	}
 
-	if scopes, ok := s.tokenScopes[authToken]; ok {
+	if scopes, ok := s.tokenScopes.Load()[authToken]; ok {
 		scopeContext := context.WithValue(r.Context(), ContextKeyScopes, scopes)
 		authContext := context.WithValue(scopeContext, ContextKeyAuthToken, authToken)
-		r = r.WithContext(authContext)
+		//writes are audited with a fingerprint of the token so no part
+		//of the token itself ends up in the database
+		actorContext := models.ContextWithActor(authContext, tokenActor(authToken))
+		r = r.WithContext(actorContext)
 		return r, nil
 	}
 
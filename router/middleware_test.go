@@ -1,12 +1,20 @@
 package router
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
 	"github.com/stretchr/testify/assert"
 	"github.com/sudarshan-reddy/benjerry/httputils"
+	"github.com/sudarshan-reddy/benjerry/models"
+	"github.com/sudarshan-reddy/benjerry/models/memory"
 )
 
 type fakeAuthHandler struct {
@@ -80,3 +88,182 @@ func Test_Authenticate(t *testing.T) {
 	}
 
 }
+
+func Test_AuditRequestID(t *testing.T) {
+	assert := assert.New(t)
+
+	var requestID string
+	handler := middleware.RequestID(AuditRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID = models.RequestIDFromContext(r.Context())
+	})))
+
+	req, err := http.NewRequest("GET", "/url", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.NotEmpty(requestID)
+}
+
+func Test_StaticTokenActor(t *testing.T) {
+	assert := assert.New(t)
+	authHandler := NewStaticTokenAuthenticator(map[string][]string{"suWsnKCXYjz12hQO": {"*"}})
+
+	req, err := http.NewRequest("GET", "/url", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer suWsnKCXYjz12hQO")
+
+	req, handlerErr := authHandler.Authenticate(req)
+	assert.Nil(handlerErr)
+	assert.Equal("token ced85b42", models.ActorFromContext(req.Context()))
+}
+
+func Test_StaticTokenSetStore(t *testing.T) {
+	assert := assert.New(t)
+	set := NewStaticTokenSet(map[string][]string{"suWsnKCXYjz12hQO": {"read.icecream"}})
+	authHandler := NewStaticTokenSetAuthenticator(set)
+	authenticate := func(bearer string) (*http.Request, *httputils.HandlerError) {
+		req, err := http.NewRequest("GET", "/url", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		return authHandler.Authenticate(req)
+	}
+
+	_, handlerErr := authenticate("suWsnKCXYjz12hQO")
+	assert.Nil(handlerErr)
+
+	set.Store(map[string][]string{"kfcmUYgqxzM0ZTAs": {"post.icecream"}})
+	_, handlerErr = authenticate("suWsnKCXYjz12hQO")
+	assert.NotNil(handlerErr)
+	req, handlerErr := authenticate("kfcmUYgqxzM0ZTAs")
+	assert.Nil(handlerErr)
+	assert.Equal([]string{"post.icecream"}, req.Context().Value(ContextKeyScopes))
+}
+
+func Test_Deadline(t *testing.T) {
+	var tests = []struct {
+		desc            string
+		path            string
+		routeTimeouts   map[string]time.Duration
+		expectedTimeout time.Duration
+	}{
+		{
+			desc:            "requests are bound by the default timeout",
+			path:            "/icecreams/chocobar",
+			expectedTimeout: time.Minute,
+		},
+		{
+			desc:            "a route timeout overrides the default one",
+			path:            "/icecreams/chocobar",
+			routeTimeouts:   map[string]time.Duration{"/icecreams/{ice-cream-name}": time.Hour},
+			expectedTimeout: time.Hour,
+		},
+		{
+			desc:          "a route timeout of 0 leaves requests unbounded",
+			path:          "/icecreams/chocobar",
+			routeTimeouts: map[string]time.Duration{"/icecreams/{ice-cream-name}": 0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var deadline time.Time
+			var bounded bool
+			router := chi.NewRouter()
+			router.Group(func(r chi.Router) {
+				r.Use(Deadline(time.Minute, test.routeTimeouts))
+				r.Get("/icecreams/{ice-cream-name}", func(w http.ResponseWriter, r *http.Request) {
+					deadline, bounded = r.Context().Deadline()
+				})
+			})
+
+			req, err := http.NewRequest("GET", test.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			router.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(test.expectedTimeout != 0, bounded)
+			if bounded {
+				assert.WithinDuration(start.Add(test.expectedTimeout), deadline, time.Second)
+			}
+		})
+	}
+}
+
+//slowIceCreamStore takes delay to read the pages after the first one
+type slowIceCreamStore struct {
+	models.IceCreamStore
+	delay time.Duration
+}
+
+func (s *slowIceCreamStore) GetAll(ctx context.Context, filter models.IceCreamFilter, pageSize int,
+	cursor string) (*models.IceCreamPage, error) {
+	if cursor != "" {
+		time.Sleep(s.delay)
+	}
+	return s.IceCreamStore.GetAll(ctx, filter, pageSize, cursor)
+}
+
+func Test_DeadlineStreamingRoutes(t *testing.T) {
+	var tests = []struct {
+		desc          string
+		routeTimeouts map[string]time.Duration
+		expectedCount int
+	}{
+		{
+			desc:          "the export outlives the request timeout",
+			expectedCount: models.MaxPageSize + 1,
+		},
+		{
+			desc:          "a route timeout still bounds the export",
+			routeTimeouts: map[string]time.Duration{"/api/v1/export": 10 * time.Millisecond},
+		},
+	}
+
+	iceCreamStore := memory.NewIceCreamStore()
+	for index := 0; index <= models.MaxPageSize; index++ {
+		err := iceCreamStore.StoreContext(context.Background(), models.IceCream{Name: fmt.Sprintf("icecream%03d", index)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			router := NewRouter([]AuthHandler{
+				NewStaticTokenAuthenticator(map[string][]string{"suWsnKCXYjz12hQO": {"read.icecream"}}),
+			}, Config{
+				IceCreamStore:  &slowIceCreamStore{IceCreamStore: iceCreamStore, delay: 50 * time.Millisecond},
+				TokenStore:     memory.NewTokenStore(),
+				RequestTimeout: 10 * time.Millisecond,
+				RouteTimeouts:  test.routeTimeouts,
+			})
+			router.AddRoutes()
+
+			req := httptest.NewRequest("GET", "/api/v1/export", nil)
+			req.Header.Set("Authorization", "Bearer suWsnKCXYjz12hQO")
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			assert.Equal(http.StatusOK, rr.Code)
+
+			var iceCreams []models.IceCream
+			err := json.Unmarshal(rr.Body.Bytes(), &iceCreams)
+			if test.expectedCount == 0 {
+				assert.Error(err, "the export should be cut short")
+				return
+			}
+			assert.NoError(err)
+			assert.Len(iceCreams, test.expectedCount)
+		})
+	}
+}
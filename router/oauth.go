@@ -0,0 +1,400 @@
+package router
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sudarshan-reddy/benjerry/httputils"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//grantClientCredentials is the only grant the OAuth server supports
+const grantClientCredentials = "client_credentials"
+
+//oauthKeyID is the kid of the access tokens the OAuth server signs
+const oauthKeyID = "oauth"
+
+//OAuthConfig tells how the OAuth server issues access tokens
+type OAuthConfig struct {
+	//SigningKey is the HS256 secret access tokens are signed with
+	SigningKey []byte
+	//Issuer is the iss of the access tokens
+	Issuer string
+	//TokenTTL is how long access tokens are valid
+	TokenTTL time.Duration
+	//ClientCacheTTL is how long clients are used to verify access
+	//tokens without reading them again, and so how long the access
+	//tokens of a revoked client are still accepted
+	ClientCacheTTL time.Duration
+}
+
+//OAuthServer issues short lived access tokens through the client
+//credentials grant of RFC 6749, and introspects (RFC 7662) and revokes
+//(RFC 7009) them. Clients are the oauth client tokens of its token
+//store: the id of a token is its client_id and the token itself its
+//client_secret. API tokens are not clients, nor are clients accepted as
+//API tokens
+type OAuthServer struct {
+	tokenStore models.TokenStore
+	cfg        OAuthConfig
+	verifier   *jwtauthenticator
+	clients    *tokenCache
+}
+
+//NewOAuthServer returns a new OAuthServer for the clients of tokenStore
+func NewOAuthServer(tokenStore models.TokenStore, cfg OAuthConfig) *OAuthServer {
+	key := JWTKey{ID: oauthKeyID, Alg: AlgHS256, Key: cfg.SigningKey}
+	return &OAuthServer{
+		tokenStore: tokenStore,
+		cfg:        cfg,
+		verifier:   &jwtauthenticator{keys: []JWTKey{key}, cfg: JWTConfig{Issuer: cfg.Issuer}},
+		clients:    newTokenCache(tokenStore, cfg.ClientCacheTTL),
+	}
+}
+
+//oauthError is an error response of RFC 6749, sent with status
+type oauthError struct {
+	status      int
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func newOAuthError(status int, code, description string) *oauthError {
+	return &oauthError{status: status, Code: code, Description: description}
+}
+
+//writeOAuthError writes oauthErr and logs it. Clients that failed to
+//authenticate with HTTP Basic are challenged to do it again
+func writeOAuthError(oauthErr *oauthError, r *http.Request, w http.ResponseWriter) {
+	log.WithFields(map[string]interface{}{
+		"error":       oauthErr.Code,
+		"description": oauthErr.Description,
+		"requestURI":  r.RequestURI,
+		"method":      r.Method,
+	}).Error("oauth request failed")
+
+	if _, _, basic := r.BasicAuth(); basic && oauthErr.status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="benjerry"`)
+	}
+	writeOAuthJSON(oauthErr.status, oauthErr, w)
+}
+
+//writeOAuthJSON writes response, which is never to be cached as it may
+//hold tokens
+func writeOAuthJSON(status int, response interface{}, w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	if err := httputils.WriteJSON(status, response, w); err != nil {
+		log.Errorf("error writing oauth response : %s", err)
+	}
+}
+
+//authenticateClient parses the form of r and returns the client whose
+//credentials it holds, either through HTTP Basic or as client_id and
+//client_secret form parameters
+func (s *OAuthServer) authenticateClient(r *http.Request) (*models.APIToken, *oauthError) {
+	if err := r.ParseForm(); err != nil {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", err.Error())
+	}
+	clientID, clientSecret, basic := r.BasicAuth()
+	if !basic {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID == "" || clientSecret == "" {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "client authentication is required")
+	}
+
+	id, secret, ok := models.ParseToken(clientSecret)
+	if !ok || id != clientID {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "invalid client credentials")
+	}
+	client, err := s.tokenStore.GetToken(r.Context(), id)
+	if err == models.ErrNoRows {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "invalid client credentials")
+	}
+	if err != nil {
+		log.WithField("client", id).Errorf("error reading oauth client : %s", err)
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "")
+	}
+	if !client.Matches(secret) || client.Kind != models.TokenKindOAuthClient {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "invalid client credentials")
+	}
+	if !client.Active(time.Now()) {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "client is revoked or expired")
+	}
+	return client, nil
+}
+
+//accessToken is the token response of RFC 6749
+type accessToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+//Token issues an access token to the client authenticating the
+//request, holding the scopes of its scope parameter or, without one,
+//every scope of the client
+func (s *OAuthServer) Token(w http.ResponseWriter, r *http.Request) {
+	client, oauthErr := s.authenticateClient(r)
+	if oauthErr != nil {
+		writeOAuthError(oauthErr, r, w)
+		return
+	}
+
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case grantClientCredentials:
+	case "":
+		writeOAuthError(newOAuthError(http.StatusBadRequest, "invalid_request", "grant_type is required"), r, w)
+		return
+	default:
+		writeOAuthError(newOAuthError(http.StatusBadRequest, "unsupported_grant_type",
+			fmt.Sprintf("grant_type %s is not supported, expected %s", grantType, grantClientCredentials)), r, w)
+		return
+	}
+
+	scopes, oauthErr := narrowScopes(client.Scopes, r.PostForm.Get("scope"))
+	if oauthErr != nil {
+		writeOAuthError(oauthErr, r, w)
+		return
+	}
+
+	now := time.Now()
+	token, err := s.issue(client.ID, scopes, now)
+	if err != nil {
+		log.WithField("client", client.ID).Errorf("error issuing access token : %s", err)
+		writeOAuthError(newOAuthError(http.StatusInternalServerError, "server_error", ""), r, w)
+		return
+	}
+	if err := s.tokenStore.TouchToken(r.Context(), client.ID, models.TokenTime(now)); err != nil {
+		log.WithField("token", client.ID).Errorf("error recording the use of token: %s", err)
+	}
+
+	writeOAuthJSON(http.StatusOK, accessToken{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.cfg.TokenTTL / time.Second),
+		Scope:       strings.Join(scopes, " "),
+	}, w)
+}
+
+//narrowScopes returns the scopes of requested, space separated, when
+//the client is allowed every one of them, and all of allowed when
+//requested is empty. Scopes are granted like models.GrantsScope does
+func narrowScopes(allowed []string, requested string) ([]string, *oauthError) {
+	if strings.TrimSpace(requested) == "" {
+		return allowed, nil
+	}
+
+	scopes := []string{}
+	seen := map[string]bool{}
+	for _, scope := range strings.Fields(requested) {
+		if !models.GrantsScope(allowed, scope) {
+			return nil, newOAuthError(http.StatusBadRequest, "invalid_scope",
+				fmt.Sprintf("scope %s is not allowed to the client", scope))
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+//issue signs an access token for clientID holding scopes, valid from
+//now for TokenTTL
+func (s *OAuthServer) issue(clientID string, scopes []string, now time.Time) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	header, err := json.Marshal(map[string]string{"alg": AlgHS256, "kid": oauthKeyID, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":       s.cfg.Issuer,
+		"sub":       clientID,
+		"client_id": clientID,
+		"scope":     strings.Join(scopes, " "),
+		"iat":       now.Unix(),
+		"exp":       now.Add(s.cfg.TokenTTL).Unix(),
+		"jti":       hex.EncodeToString(jti),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, s.cfg.SigningKey)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+//tokenStoreError is a failure of the token store while verifying an
+//access token, which tells nothing about the token
+type tokenStoreError struct {
+	err error
+}
+
+func (t *tokenStoreError) Error() string {
+	return t.err.Error()
+}
+
+//verifyAccessToken returns the claims of token when it is an access
+//token the server issued that is neither expired nor revoked at now,
+//to a client that is still active. Failures of the token store are
+//returned as a *tokenStoreError
+func (s *OAuthServer) verifyAccessToken(ctx context.Context, token string,
+	now time.Time) (map[string]interface{}, error) {
+	claims, err := s.verifier.verify(token, now)
+	if err != nil {
+		return nil, err
+	}
+	jti, _ := claims["jti"].(string)
+	clientID, _ := claims["client_id"].(string)
+	if clientID == "" || jti == "" {
+		return nil, errors.New("token was not issued by the oauth server")
+	}
+
+	revoked, err := s.tokenStore.AccessTokenRevoked(ctx, jti)
+	if err != nil {
+		return nil, &tokenStoreError{err}
+	}
+	if revoked {
+		return nil, errors.New("token is revoked")
+	}
+
+	client, _, err := s.clients.lookup(ctx, clientID, now)
+	if err == models.ErrNoRows {
+		return nil, errors.New("client is unknown")
+	}
+	if err != nil {
+		return nil, &tokenStoreError{err}
+	}
+	if client.Kind != models.TokenKindOAuthClient || !client.Active(now) {
+		return nil, errors.New("client is revoked or expired")
+	}
+	return claims, nil
+}
+
+//Introspect tells the client authenticating the request whether the
+//token of its token parameter is active, along with its claims when it
+//is
+func (s *OAuthServer) Introspect(w http.ResponseWriter, r *http.Request) {
+	if _, oauthErr := s.authenticateClient(r); oauthErr != nil {
+		writeOAuthError(oauthErr, r, w)
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(newOAuthError(http.StatusBadRequest, "invalid_request", "token is required"), r, w)
+		return
+	}
+
+	claims, err := s.verifyAccessToken(r.Context(), token, time.Now())
+	if _, ok := err.(*tokenStoreError); ok {
+		log.Errorf("error introspecting access token : %s", err)
+		writeOAuthError(newOAuthError(http.StatusInternalServerError, "server_error", ""), r, w)
+		return
+	}
+	if err != nil {
+		writeOAuthJSON(http.StatusOK, map[string]interface{}{"active": false}, w)
+		return
+	}
+	introspection := map[string]interface{}{"active": true, "token_type": "Bearer"}
+	for _, claim := range []string{"scope", "client_id", "sub", "iss", "iat", "exp", "jti"} {
+		introspection[claim] = claims[claim]
+	}
+	writeOAuthJSON(http.StatusOK, introspection, w)
+}
+
+//Revoke revokes the access token of the token parameter, which has to
+//be issued to the client authenticating the request. As RFC 7009 asks,
+//tokens that are invalid or expired already are not reported
+func (s *OAuthServer) Revoke(w http.ResponseWriter, r *http.Request) {
+	client, oauthErr := s.authenticateClient(r)
+	if oauthErr != nil {
+		writeOAuthError(oauthErr, r, w)
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(newOAuthError(http.StatusBadRequest, "invalid_request", "token is required"), r, w)
+		return
+	}
+
+	claims, err := s.verifyAccessToken(r.Context(), token, time.Now())
+	if _, ok := err.(*tokenStoreError); ok {
+		log.Errorf("error revoking access token : %s", err)
+		writeOAuthError(newOAuthError(http.StatusInternalServerError, "server_error", ""), r, w)
+		return
+	}
+	if err != nil {
+		writeOAuthJSON(http.StatusOK, struct{}{}, w)
+		return
+	}
+	if clientID, _ := claims["client_id"].(string); clientID != client.ID {
+		writeOAuthError(newOAuthError(http.StatusBadRequest, "unauthorized_client",
+			"the token was issued to another client"), r, w)
+		return
+	}
+	expiry, _, err := numericDate(claims, "exp")
+	if err != nil {
+		writeOAuthError(newOAuthError(http.StatusInternalServerError, "server_error", ""), r, w)
+		return
+	}
+
+	if err := s.tokenStore.RevokeAccessToken(r.Context(), claims["jti"].(string), expiry); err != nil {
+		log.WithField("client", client.ID).Errorf("error revoking access token : %s", err)
+		writeOAuthError(newOAuthError(http.StatusInternalServerError, "server_error", ""), r, w)
+		return
+	}
+	writeOAuthJSON(http.StatusOK, struct{}{}, w)
+}
+
+type oauthauthenticator struct {
+	server *OAuthServer
+}
+
+//NewOAuthAuthenticator instantiates an AuthHandler accepting the access
+//tokens server issues until they expire or are revoked, or their client
+//is
+func NewOAuthAuthenticator(server *OAuthServer) AuthHandler {
+	return &oauthauthenticator{
+		server: server,
+	}
+}
+
+func (o *oauthauthenticator) Authenticate(r *http.Request) (*http.Request, *httputils.HandlerError) {
+	authToken, err := bearerToken(r)
+	if err != nil {
+		return nil, unauthorized(err.Error())
+	}
+
+	claims, err := o.server.verifyAccessToken(r.Context(), authToken, time.Now())
+	if _, ok := err.(*tokenStoreError); ok {
+		return nil, httputils.NewUnexpectedError(err)
+	}
+	if err != nil {
+		return nil, unauthorized(err.Error())
+	}
+
+	scopeContext := context.WithValue(r.Context(), ContextKeyScopes, claimStrings(claims["scope"]))
+	authContext := context.WithValue(scopeContext, ContextKeyAuthToken, authToken)
+	//changes are audited with the client the token was issued to
+	actor := fmt.Sprintf("oauth client %s", claims["client_id"])
+	return r.WithContext(models.ContextWithActor(authContext, actor)), nil
+}
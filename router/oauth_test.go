@@ -0,0 +1,236 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+	"github.com/sudarshan-reddy/benjerry/models/memory"
+)
+
+//mintTestClient stores an oauth client allowed scopes and returns it
+//with its secret
+func mintTestClient(t *testing.T, tokenStore models.TokenStore, scopes ...string) (models.APIToken, string) {
+	client, secret, err := models.MintToken("partner", scopes, nil, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Kind = models.TokenKindOAuthClient
+	if err := tokenStore.StoreToken(context.Background(), client); err != nil {
+		t.Fatal(err)
+	}
+	return client, secret
+}
+
+//newTestOAuthServer returns an OAuthServer along with a client allowed
+//the read.icecream and registry.ingredient scopes
+func newTestOAuthServer(t *testing.T) (*OAuthServer, models.TokenStore, models.APIToken, string) {
+	tokenStore := memory.NewTokenStore()
+	client, secret := mintTestClient(t, tokenStore, "read.icecream", "registry.ingredient")
+	server := NewOAuthServer(tokenStore, OAuthConfig{
+		SigningKey: []byte("0123456789abcdef0123456789abcdef"),
+		Issuer:     "benjerry",
+		TokenTTL:   time.Minute,
+	})
+	return server, tokenStore, client, secret
+}
+
+//postOAuth posts form to handler, authenticating as clientID with
+//clientSecret through HTTP Basic when both are set
+func postOAuth(handler http.HandlerFunc, clientID, clientSecret string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/oauth", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" || clientSecret != "" {
+		req.SetBasicAuth(clientID, clientSecret)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func Test_OAuthToken(t *testing.T) {
+	server, _, client, secret := newTestOAuthServer(t)
+
+	var tests = []struct {
+		desc             string
+		clientID         string
+		clientSecret     string
+		form             url.Values
+		expectedStatus   int
+		expectedResponse string
+		expectedScope    string
+	}{
+		{
+			desc:           "a client gets every scope it is allowed by default",
+			clientID:       client.ID,
+			clientSecret:   secret,
+			form:           url.Values{"grant_type": {"client_credentials"}},
+			expectedStatus: 200,
+			expectedScope:  "read.icecream registry.ingredient",
+		},
+		{
+			desc:           "the scope parameter narrows the scopes",
+			clientID:       client.ID,
+			clientSecret:   secret,
+			form:           url.Values{"grant_type": {"client_credentials"}, "scope": {"registry.ingredient"}},
+			expectedStatus: 200,
+			expectedScope:  "registry.ingredient",
+		},
+		{
+			desc: "clients may authenticate with form parameters",
+			form: url.Values{
+				"grant_type": {"client_credentials"}, "client_id": {client.ID}, "client_secret": {secret},
+			},
+			expectedStatus: 200,
+			expectedScope:  "read.icecream registry.ingredient",
+		},
+		{
+			desc:             "wildcards are not granted the scopes they match",
+			clientID:         client.ID,
+			clientSecret:     secret,
+			form:             url.Values{"grant_type": {"client_credentials"}, "scope": {"*.ingredient"}},
+			expectedStatus:   400,
+			expectedResponse: `{"error":"invalid_scope","error_description":"scope *.ingredient is not allowed to the client"}`,
+		},
+		{
+			desc:             "scopes the client is not allowed are refused",
+			clientID:         client.ID,
+			clientSecret:     secret,
+			form:             url.Values{"grant_type": {"client_credentials"}, "scope": {"read.icecream post.icecream"}},
+			expectedStatus:   400,
+			expectedResponse: `{"error":"invalid_scope","error_description":"scope post.icecream is not allowed to the client"}`,
+		},
+		{
+			desc:           "only the client credentials grant is supported",
+			clientID:       client.ID,
+			clientSecret:   secret,
+			form:           url.Values{"grant_type": {"password"}},
+			expectedStatus: 400,
+			expectedResponse: `{"error":"unsupported_grant_type",` +
+				`"error_description":"grant_type password is not supported, expected client_credentials"}`,
+		},
+		{
+			desc:             "the secret has to be the one of the client",
+			clientID:         client.ID,
+			clientSecret:     "bj_" + client.ID + "_0123",
+			form:             url.Values{"grant_type": {"client_credentials"}},
+			expectedStatus:   401,
+			expectedResponse: `{"error":"invalid_client","error_description":"invalid client credentials"}`,
+		},
+		{
+			desc:             "clients have to authenticate",
+			form:             url.Values{"grant_type": {"client_credentials"}},
+			expectedStatus:   401,
+			expectedResponse: `{"error":"invalid_client","error_description":"client authentication is required"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			rr := postOAuth(server.Token, test.clientID, test.clientSecret, test.form)
+			assert.Equal(test.expectedStatus, rr.Code)
+			assert.Equal("no-store", rr.Header().Get("Cache-Control"))
+			if test.expectedResponse != "" {
+				assert.Equal(test.expectedResponse+"\n", rr.Body.String())
+				return
+			}
+
+			var token accessToken
+			assert.NoError(json.Unmarshal(rr.Body.Bytes(), &token))
+			assert.Equal("Bearer", token.TokenType)
+			assert.Equal(int64(60), token.ExpiresIn)
+			assert.Equal(test.expectedScope, token.Scope)
+		})
+	}
+}
+
+func Test_OAuthTokenLifecycle(t *testing.T) {
+	assert := assert.New(t)
+	server, tokenStore, client, secret := newTestOAuthServer(t)
+	other, otherSecret := mintTestClient(t, tokenStore, "read.icecream")
+	authHandler := NewOAuthAuthenticator(server)
+
+	rr := postOAuth(server.Token, client.ID, secret, url.Values{
+		"grant_type": {"client_credentials"}, "scope": {"read.icecream"},
+	})
+	var token accessToken
+	assert.NoError(json.Unmarshal(rr.Body.Bytes(), &token))
+
+	req, errMessage := authenticateBearer(t, authHandler, token.AccessToken)
+	assert.Empty(errMessage)
+	assert.Equal([]string{"read.icecream"}, req.Context().Value(ContextKeyScopes))
+	assert.Equal("oauth client "+client.ID, models.ActorFromContext(req.Context()))
+	_, errMessage = authenticateBearer(t, authHandler, secret)
+	assert.Equal("token is not a JWT", errMessage)
+
+	rr = postOAuth(server.Introspect, other.ID, otherSecret, url.Values{"token": {token.AccessToken}})
+	var introspection map[string]interface{}
+	assert.NoError(json.Unmarshal(rr.Body.Bytes(), &introspection))
+	assert.Equal(true, introspection["active"])
+	assert.Equal("read.icecream", introspection["scope"])
+	assert.Equal(client.ID, introspection["client_id"])
+
+	//only the client the token was issued to can revoke it
+	rr = postOAuth(server.Revoke, other.ID, otherSecret, url.Values{"token": {token.AccessToken}})
+	assert.Equal(400, rr.Code)
+	assert.Contains(rr.Body.String(), "unauthorized_client")
+	rr = postOAuth(server.Revoke, client.ID, secret, url.Values{"token": {token.AccessToken}})
+	assert.Equal(200, rr.Code)
+	rr = postOAuth(server.Revoke, client.ID, secret, url.Values{"token": {"not a token"}})
+	assert.Equal(200, rr.Code)
+
+	_, errMessage = authenticateBearer(t, authHandler, token.AccessToken)
+	assert.Equal("token is revoked", errMessage)
+	rr = postOAuth(server.Introspect, client.ID, secret, url.Values{"token": {token.AccessToken}})
+	assert.Equal("{\"active\":false}\n", rr.Body.String())
+
+	//revocations are kept by the token store, across restarts and replicas
+	restarted := NewOAuthServer(tokenStore, server.cfg)
+	_, errMessage = authenticateBearer(t, NewOAuthAuthenticator(restarted), token.AccessToken)
+	assert.Equal("token is revoked", errMessage)
+}
+
+func Test_OAuthClientRevocation(t *testing.T) {
+	assert := assert.New(t)
+	server, tokenStore, client, secret := newTestOAuthServer(t)
+	authHandler := NewOAuthAuthenticator(server)
+
+	rr := postOAuth(server.Token, client.ID, secret, url.Values{"grant_type": {"client_credentials"}})
+	var token accessToken
+	assert.NoError(json.Unmarshal(rr.Body.Bytes(), &token))
+	_, errMessage := authenticateBearer(t, authHandler, token.AccessToken)
+	assert.Empty(errMessage)
+
+	//the access tokens of a revoked client stop being accepted before
+	//they expire
+	_, err := tokenStore.RevokeToken(context.Background(), client.ID, time.Now())
+	assert.NoError(err)
+	_, errMessage = authenticateBearer(t, authHandler, token.AccessToken)
+	assert.Equal("client is revoked or expired", errMessage)
+	other, otherSecret := mintTestClient(t, tokenStore, "read.icecream")
+	rr = postOAuth(server.Introspect, other.ID, otherSecret, url.Values{"token": {token.AccessToken}})
+	assert.Equal("{\"active\":false}\n", rr.Body.String())
+}
+
+func Test_OAuthClientsAreNotAPITokens(t *testing.T) {
+	assert := assert.New(t)
+	server, tokenStore, _, secret := newTestOAuthServer(t)
+	apiToken, bearer := mintTestToken(t, tokenStore, nil)
+
+	//clients cannot be used as bearer tokens of the api
+	_, errMessage := authenticateBearer(t, NewStoredTokenAuthenticator(tokenStore, time.Minute), secret)
+	assert.Equal("token is an oauth client", errMessage)
+
+	//nor can api tokens get access tokens
+	rr := postOAuth(server.Token, apiToken.ID, bearer, url.Values{"grant_type": {"client_credentials"}})
+	assert.Equal(401, rr.Code)
+	assert.Equal(`{"error":"invalid_client","error_description":"invalid client credentials"}`+"\n", rr.Body.String())
+}
@@ -0,0 +1,313 @@
+package router
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//DefaultPolicy is the policy routes are authorized with when no other
+//one is configured
+const DefaultPolicy = `
+# method  route pattern                                   scopes
+*         /api/v1/ingredients*                            registry.ingredient
+*         /api/v1/tokens*                                 admin.token
+POST      /api/v1/create                                  post.icecream
+POST      /api/v1/icecreams:bulk                          post.icecream
+PUT       /api/v1/update                                  post.icecream
+PUT       /api/v1/icecreams/{ice-cream-name}              post.icecream
+PATCH     /api/v1/icecreams/{ice-cream-name}              post.icecream
+POST      /api/v1/icecreams/{ice-cream-name}/revert/*     post.icecream
+POST      /api/v1/icecreams/{ice-cream-name}/restore      trash.icecream
+GET       /api/v1/trash                                   trash.icecream
+DELETE    /api/v1/trash                                   trash.icecream
+DELETE    /api/v1/delete/{ice-cream-name}                 delete.icecream
+GET       /api/v1/*                                       read.icecream
+`
+
+//ScopeExpression is a requirement on the scopes of a token. The scopes
+//of an expression are globs where * matches any run of characters, so
+//`*.icecream` requires any ice cream scope. The scopes of tokens are
+//literal, except for models.ScopeAll which satisfies every expression
+type ScopeExpression interface {
+	//Allows tells whether a token holding scopes satisfies the
+	//expression
+	Allows(scopes []string) bool
+	//Scopes lists the scopes the expression mentions
+	Scopes() []string
+	String() string
+}
+
+type scopeMatch string
+
+func (s scopeMatch) Allows(scopes []string) bool {
+	for _, scope := range scopes {
+		if scope == models.ScopeAll || matchGlob(string(s), scope) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s scopeMatch) Scopes() []string {
+	return []string{string(s)}
+}
+
+func (s scopeMatch) String() string {
+	return string(s)
+}
+
+//allOf requires all of its expressions, anyOf any of them
+type allOf []ScopeExpression
+type anyOf []ScopeExpression
+
+func (a allOf) Allows(scopes []string) bool {
+	for _, expression := range a {
+		if !expression.Allows(scopes) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a allOf) Scopes() []string {
+	return joinScopes(a)
+}
+
+func (a allOf) String() string {
+	return joinExpressions(a, " AND ")
+}
+
+func (a anyOf) Allows(scopes []string) bool {
+	for _, expression := range a {
+		if expression.Allows(scopes) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a anyOf) Scopes() []string {
+	return joinScopes(a)
+}
+
+func (a anyOf) String() string {
+	return joinExpressions(a, " OR ")
+}
+
+func joinScopes(expressions []ScopeExpression) []string {
+	var scopes []string
+	for _, expression := range expressions {
+		scopes = append(scopes, expression.Scopes()...)
+	}
+	return scopes
+}
+
+//joinExpressions wraps the compound expressions in parentheses so the
+//result parses back to the same expression
+func joinExpressions(expressions []ScopeExpression, separator string) string {
+	parts := make([]string, 0, len(expressions))
+	for _, expression := range expressions {
+		if _, ok := expression.(scopeMatch); ok {
+			parts = append(parts, expression.String())
+			continue
+		}
+		parts = append(parts, "("+expression.String()+")")
+	}
+	return strings.Join(parts, separator)
+}
+
+//denyAll is satisfied by no token, it guards the routes no policy
+//rule covers
+type denyAll struct{}
+
+func (denyAll) Allows(scopes []string) bool {
+	return false
+}
+
+func (denyAll) Scopes() []string {
+	return nil
+}
+
+func (denyAll) String() string {
+	return "no token"
+}
+
+//matchGlob tells whether value matches pattern, where * matches any
+//run of characters
+func matchGlob(pattern, value string) bool {
+	star := strings.Index(pattern, "*")
+	if star < 0 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, pattern[:star]) {
+		return false
+	}
+	rest := pattern[star+1:]
+	for index := star; index <= len(value); index++ {
+		if matchGlob(rest, value[index:]) {
+			return true
+		}
+	}
+	return false
+}
+
+//ParseScopeExpression parses scopes joined by AND and OR, AND binding
+//tighter, and grouped by parentheses, e.g.
+//`read.icecream AND (post.icecream OR *.admin)`
+func ParseScopeExpression(value string) (ScopeExpression, error) {
+	value = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(value)
+	parser := &scopeParser{tokens: strings.Fields(value)}
+	if len(parser.tokens) == 0 {
+		return nil, fmt.Errorf("empty scope expression")
+	}
+	expression, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.position < len(parser.tokens) {
+		return nil, fmt.Errorf("unexpected %s in scope expression", parser.tokens[parser.position])
+	}
+	return expression, nil
+}
+
+type scopeParser struct {
+	tokens   []string
+	position int
+}
+
+func (p *scopeParser) peek() string {
+	if p.position < len(p.tokens) {
+		return p.tokens[p.position]
+	}
+	return ""
+}
+
+func (p *scopeParser) parseOr() (ScopeExpression, error) {
+	var expressions anyOf
+	for {
+		expression, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		expressions = append(expressions, expression)
+		if p.peek() != "OR" {
+			break
+		}
+		p.position++
+	}
+	if len(expressions) == 1 {
+		return expressions[0], nil
+	}
+	return expressions, nil
+}
+
+func (p *scopeParser) parseAnd() (ScopeExpression, error) {
+	var expressions allOf
+	for {
+		expression, err := p.parseScope()
+		if err != nil {
+			return nil, err
+		}
+		expressions = append(expressions, expression)
+		if p.peek() != "AND" {
+			break
+		}
+		p.position++
+	}
+	if len(expressions) == 1 {
+		return expressions[0], nil
+	}
+	return expressions, nil
+}
+
+func (p *scopeParser) parseScope() (ScopeExpression, error) {
+	token := p.peek()
+	p.position++
+	switch token {
+	case "":
+		return nil, fmt.Errorf("scope expression ends where a scope is expected")
+	case "AND", "OR", ")":
+		return nil, fmt.Errorf("unexpected %s in scope expression", token)
+	case "(":
+		expression, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing ) in scope expression")
+		}
+		p.position++
+		return expression, nil
+	}
+	if strings.ContainsAny(token, `",\`) {
+		return nil, fmt.Errorf("invalid scope : %s", token)
+	}
+	return scopeMatch(token), nil
+}
+
+//Policy maps routes to the scopes they require
+type Policy struct {
+	rules []policyRule
+}
+
+type policyRule struct {
+	method     string
+	pattern    string
+	expression ScopeExpression
+}
+
+//ParsePolicy parses a policy of one rule per line, holding a method,
+//a route pattern and a scope expression, like DefaultPolicy. The
+//method * matches any method and * in patterns matches any run of
+//characters. Routes are authorized by the first rule they match.
+//Blank lines and lines starting with # are ignored
+func ParsePolicy(data string) (*Policy, error) {
+	policy := &Policy{}
+	for index, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: expected a method, a route pattern and a scope expression", index+1)
+		}
+		expression, err := ParseScopeExpression(strings.Join(fields[2:], " "))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", index+1, err)
+		}
+		policy.rules = append(policy.rules, policyRule{
+			method:     strings.ToUpper(fields[0]),
+			pattern:    fields[1],
+			expression: expression,
+		})
+	}
+	if len(policy.rules) == 0 {
+		return nil, fmt.Errorf("no policy rules found")
+	}
+	return policy, nil
+}
+
+//LoadPolicy parses the policy of the file at path
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(string(data))
+}
+
+//Expression returns the scope expression of the first rule matching
+//method and the route pattern. ok is false when no rule does
+func (p *Policy) Expression(method, pattern string) (expression ScopeExpression, ok bool) {
+	for _, rule := range p.rules {
+		if (rule.method == "*" || rule.method == method) && matchGlob(rule.pattern, pattern) {
+			return rule.expression, true
+		}
+	}
+	return nil, false
+}
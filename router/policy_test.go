@@ -0,0 +1,183 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models/memory"
+)
+
+func Test_ParseScopeExpression(t *testing.T) {
+	var tests = []struct {
+		desc        string
+		expression  string
+		scopes      []string
+		allowed     bool
+		expectedErr string
+	}{
+		{
+			desc:       "a scope is allowed to tokens holding it",
+			expression: "read.icecream",
+			scopes:     []string{"post.icecream", "read.icecream"},
+			allowed:    true,
+		},
+		{
+			desc:       "a wildcard scope requires any matching scope",
+			expression: "*.icecream",
+			scopes:     []string{"read.icecream"},
+			allowed:    true,
+		},
+		{
+			desc:       "wildcards of tokens are not globs",
+			expression: "delete.icecream",
+			scopes:     []string{"*.icecream"},
+		},
+		{
+			desc:       "prefixes of tokens are not globs",
+			expression: "admin.token",
+			scopes:     []string{"p*"},
+		},
+		{
+			desc:       "wildcard scopes are matched by tokens holding them",
+			expression: "*.icecream",
+			scopes:     []string{"*.icecream"},
+			allowed:    true,
+		},
+		{
+			desc:       "* grants every scope",
+			expression: "read.icecream AND admin.token",
+			scopes:     []string{"*"},
+			allowed:    true,
+		},
+		{
+			desc:       "AND binds tighter than OR",
+			expression: "admin.token OR read.icecream AND post.icecream",
+			scopes:     []string{"read.icecream"},
+		},
+		{
+			desc:       "parentheses group expressions",
+			expression: "(admin.token OR read.icecream) AND post.icecream",
+			scopes:     []string{"read.icecream", "post.icecream"},
+			allowed:    true,
+		},
+		{
+			desc:        "operators need scopes on both sides",
+			expression:  "read.icecream AND",
+			expectedErr: "scope expression ends where a scope is expected",
+		},
+		{
+			desc:        "parentheses are closed",
+			expression:  "(read.icecream OR admin.token",
+			expectedErr: "missing ) in scope expression",
+		},
+		{
+			desc:        "scopes are joined by operators",
+			expression:  "read.icecream admin.token",
+			expectedErr: "unexpected admin.token in scope expression",
+		},
+		{
+			desc:        "expressions are not empty",
+			expression:  " ",
+			expectedErr: "empty scope expression",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			expression, err := ParseScopeExpression(test.expression)
+			if test.expectedErr != "" {
+				assert.EqualError(err, test.expectedErr)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(test.allowed, expression.Allows(test.scopes))
+
+			reparsed, err := ParseScopeExpression(expression.String())
+			assert.NoError(err)
+			assert.Equal(expression, reparsed)
+		})
+	}
+}
+
+func Test_ParsePolicy(t *testing.T) {
+	assert := assert.New(t)
+	policy, err := ParsePolicy("# rules\nget /api/v1/icecreams read.icecream OR *.admin\n* /api/v1/* admin.all\n")
+	assert.NoError(err)
+
+	expression, ok := policy.Expression("GET", "/api/v1/icecreams")
+	assert.True(ok)
+	assert.Equal("read.icecream OR *.admin", expression.String())
+	expression, ok = policy.Expression("POST", "/api/v1/icecreams")
+	assert.True(ok)
+	assert.Equal("admin.all", expression.String())
+	_, ok = policy.Expression("GET", "/health")
+	assert.False(ok)
+
+	_, err = ParsePolicy("GET /api/v1/icecreams")
+	assert.EqualError(err, "line 1: expected a method, a route pattern and a scope expression")
+	_, err = ParsePolicy("\nGET /api/v1/icecreams read.icecream OR")
+	assert.EqualError(err, "line 2: scope expression ends where a scope is expected")
+	_, err = ParsePolicy("# nothing yet")
+	assert.EqualError(err, "no policy rules found")
+}
+
+func Test_DefaultPolicyCoversEveryRoute(t *testing.T) {
+	router := NewRouter(nil, Config{})
+	router.AddRoutes()
+	for _, route := range router.routes {
+		assert.NotEqual(t, denyAll{}, route.expression, route.Method+" "+route.Pattern)
+	}
+}
+
+func Test_ExplainAccess(t *testing.T) {
+	assert := assert.New(t)
+	router := NewRouter([]AuthHandler{
+		NewStaticTokenAuthenticator(map[string][]string{"suWsnKCXYjz12hQO": {"read.icecream", "trash.icecream"}}),
+	}, Config{IceCreamStore: memory.NewIceCreamStore(), TokenStore: memory.NewTokenStore()})
+	router.AddRoutes()
+
+	req := httptest.NewRequest("GET", "/api/v1/auth/explain", nil)
+	req.Header.Set("Authorization", "Bearer suWsnKCXYjz12hQO")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(http.StatusOK, rr.Code)
+
+	var explanation accessExplanation
+	assert.NoError(json.Unmarshal(rr.Body.Bytes(), &explanation))
+	assert.Equal("token ced85b42", explanation.Actor)
+	assert.Equal([]string{"read.icecream", "trash.icecream"}, explanation.Scopes)
+	allowed := map[string]bool{}
+	for _, route := range explanation.Routes {
+		allowed[route.Method+" "+route.Pattern] = route.Allowed
+	}
+	assert.True(allowed["GET /api/v1/icecreams"])
+	assert.True(allowed["DELETE /api/v1/trash"])
+	assert.False(allowed["DELETE /api/v1/delete/{ice-cream-name}"])
+	assert.False(allowed["POST /api/v1/tokens"])
+
+	//the token is forbidden from the routes it cannot access
+	req = httptest.NewRequest("POST", "/api/v1/tokens", nil)
+	req.Header.Set("Authorization", "Bearer suWsnKCXYjz12hQO")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(http.StatusForbidden, rr.Code)
+	assert.Equal(`Bearer realm="benjerry", error="insufficient_scope", error_description="requires admin.token", `+
+		`scope="admin.token"`, rr.Header().Get("WWW-Authenticate"))
+
+	req = httptest.NewRequest("GET", "/api/v1/auth/explain", nil)
+	req.Header.Set("Authorization", "Bearer kfcmUYgqxzM0ZTAs")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(http.StatusUnauthorized, rr.Code)
+	assert.Equal(`Bearer realm="benjerry", error="invalid_token"`, rr.Header().Get("WWW-Authenticate"))
+
+	req = httptest.NewRequest("GET", "/api/v1/auth/explain", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(http.StatusUnauthorized, rr.Code)
+	assert.Equal(`Bearer realm="benjerry"`, rr.Header().Get("WWW-Authenticate"))
+}
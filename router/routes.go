@@ -1,8 +1,12 @@
 package router
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
+	log "github.com/sirupsen/logrus"
 	"github.com/sudarshan-reddy/benjerry/handlers"
 	"github.com/sudarshan-reddy/benjerry/models"
 )
@@ -15,46 +19,140 @@ const (
 type Router struct {
 	*chi.Mux
 	authenticator Authenticator
+	//routes lists the routes the policy authorizes, for explainAccess
+	routes []routeAccess
 	Config
 }
 
 //Config holds the config values required for router to work
 type Config struct {
-	IceCreamStore models.IceCreamStore
+	IceCreamStore   models.IceCreamStore
+	IngredientStore models.IngredientStore
+	TokenStore      models.TokenStore
+	//RequireIfMatch makes updates and deletes require an If-Match header
+	RequireIfMatch bool
+	//TrashRetention is how long deleted ice creams are kept before
+	//they can be purged
+	TrashRetention time.Duration
+	//RequestTimeout bounds the handling of every request, unless
+	//RouteTimeouts holds another timeout for its route pattern.
+	//streamingRoutes are unbounded unless RouteTimeouts holds them
+	RequestTimeout time.Duration
+	RouteTimeouts  map[string]time.Duration
+	//Policy holds the scopes every route requires, DefaultPolicy when
+	//it is nil
+	Policy *Policy
+	//OAuthServer serves the /oauth routes, which are left out when it
+	//is nil
+	OAuthServer *OAuthServer
 }
 
-//NewRouter returns a new instance of Router
-func NewRouter(staticTokens map[string][]string, cfg Config) *Router {
-	staticTokenAuth := NewStaticTokenAuthenticator(staticTokens)
+//NewRouter returns a new instance of Router authenticating requests
+//with the first of authHandlers to accept them
+func NewRouter(authHandlers []AuthHandler, cfg Config) *Router {
+	if cfg.Policy == nil {
+		policy, err := ParsePolicy(DefaultPolicy)
+		if err != nil {
+			panic(err)
+		}
+		cfg.Policy = policy
+	}
 	return &Router{
-		authenticator: NewAuthenticator(staticTokenAuth),
+		authenticator: NewAuthenticator(authHandlers...),
 		Mux:           chi.NewRouter(),
 		Config:        cfg,
 	}
 }
 
+//streamingRoutes write their response as they go, so a request
+//deadline would cut them short once their 200 is sent. Every store
+//call they make is still bounded on its own
+var streamingRoutes = []string{apiVersion1 + "/export", apiVersion1 + "/icecreams:bulk"}
+
+//routeTimeouts returns the RouteTimeouts of the config along with the
+//timeouts of the streaming routes it does not override
+func (router *Router) routeTimeouts() map[string]time.Duration {
+	routeTimeouts := map[string]time.Duration{}
+	for _, pattern := range streamingRoutes {
+		routeTimeouts[pattern] = 0
+	}
+	for pattern, timeout := range router.Config.RouteTimeouts {
+		routeTimeouts[pattern] = timeout
+	}
+	return routeTimeouts
+}
+
 //AddRoutes adds all the routes to the router
 //Scoping and middleware should also be done here
 func (router *Router) AddRoutes() {
 	router.Use(middleware.RequestID)
+	router.Use(AuditRequestID)
 	router.Use(middleware.RealIP)
 	router.Use(middleware.Recoverer)
 
-	iceCreamHandler := handlers.NewIceCreamHandler(router.Config.IceCreamStore)
+	iceCreamHandler := handlers.NewIceCreamHandler(router.Config.IceCreamStore, handlers.Config{
+		RequireIfMatch: router.Config.RequireIfMatch,
+		TrashRetention: router.Config.TrashRetention,
+	})
+	ingredientHandler := handlers.NewIngredientHandler(router.Config.IngredientStore, router.Config.IceCreamStore)
+	tokenHandler := handlers.NewTokenHandler(router.Config.TokenStore, requestScopes)
+
+	//clients authenticate to the oauth routes with their own credentials
+	if router.Config.OAuthServer != nil {
+		router.Group(func(r chi.Router) {
+			r.Use(Deadline(router.Config.RequestTimeout, router.routeTimeouts()))
+
+			r.Post("/oauth/token", router.Config.OAuthServer.Token)
+			r.Post("/oauth/introspect", router.Config.OAuthServer.Introspect)
+			r.Post("/oauth/revoke", router.Config.OAuthServer.Revoke)
+		})
+	}
 
 	router.Group(func(r chi.Router) {
+		r.Use(Deadline(router.Config.RequestTimeout, router.routeTimeouts()))
 		r.Use(router.authenticator.Authenticate)
+		route := func(method, pattern string, h http.HandlerFunc) {
+			r.With(router.authorize(method, pattern)).Method(method, pattern, h)
+		}
 
-		r.With(AnyScope([]string{"*", "post.icecream"})).
-			Post(apiVersion1+"/create", iceCreamHandler.PostIceCreamData)
-
-		r.With(AnyScope([]string{"*", "read.icecream"})).
-			Get(apiVersion1+"/read/{ice-cream-name}", iceCreamHandler.GetIceCreamData)
+		r.Get(apiVersion1+"/auth/explain", router.explainAccess)
 
-		r.With(AnyScope([]string{"*", "post.icecream"})).
-			Put(apiVersion1+"/update", iceCreamHandler.UpdateIceCreamData)
-
-		r.With(AnyScope([]string{"*", "delete.icecream"})).
-			Delete(apiVersion1+"/delete/{ice-cream-name}", iceCreamHandler.DeleteIceCreamData)
+		route("POST", apiVersion1+"/create", iceCreamHandler.PostIceCreamData)
+		route("POST", apiVersion1+"/icecreams:bulk", iceCreamHandler.BulkImportIceCreams)
+		route("GET", apiVersion1+"/read/{ice-cream-name}", iceCreamHandler.GetIceCreamData)
+		route("GET", apiVersion1+"/icecreams", iceCreamHandler.ListIceCreamData)
+		route("GET", apiVersion1+"/search", iceCreamHandler.SearchIceCreamData)
+		route("GET", apiVersion1+"/export", iceCreamHandler.ExportIceCreams)
+		route("PUT", apiVersion1+"/update", iceCreamHandler.UpdateIceCreamData)
+		route("PUT", apiVersion1+"/icecreams/{ice-cream-name}", iceCreamHandler.PutIceCreamData)
+		route("PATCH", apiVersion1+"/icecreams/{ice-cream-name}", iceCreamHandler.PatchIceCreamData)
+		route("DELETE", apiVersion1+"/delete/{ice-cream-name}", iceCreamHandler.DeleteIceCreamData)
+		route("GET", apiVersion1+"/icecreams/{ice-cream-name}/history", iceCreamHandler.GetIceCreamHistory)
+		route("POST", apiVersion1+"/icecreams/{ice-cream-name}/revert/{version}", iceCreamHandler.RevertIceCream)
+		route("GET", apiVersion1+"/trash", iceCreamHandler.ListTrash)
+		route("DELETE", apiVersion1+"/trash", iceCreamHandler.PurgeTrash)
+		route("POST", apiVersion1+"/icecreams/{ice-cream-name}/restore", iceCreamHandler.RestoreIceCream)
+		route("POST", apiVersion1+"/ingredients", ingredientHandler.PostIngredient)
+		route("GET", apiVersion1+"/ingredients", ingredientHandler.ListIngredients)
+		route("GET", apiVersion1+"/ingredients:unrecognized", ingredientHandler.UnrecognizedIngredients)
+		route("GET", apiVersion1+"/ingredients/{ingredient-name}", ingredientHandler.GetIngredient)
+		route("PUT", apiVersion1+"/ingredients/{ingredient-name}", ingredientHandler.PutIngredient)
+		route("DELETE", apiVersion1+"/ingredients/{ingredient-name}", ingredientHandler.DeleteIngredient)
+		route("POST", apiVersion1+"/tokens", tokenHandler.PostToken)
+		route("GET", apiVersion1+"/tokens", tokenHandler.ListTokens)
+		route("DELETE", apiVersion1+"/tokens/{token-id}", tokenHandler.RevokeToken)
 	})
 }
+
+//authorize returns the middleware checking requests to the route of
+//method and pattern against the policy. Routes no rule covers are
+//denied to every token
+func (router *Router) authorize(method, pattern string) ScopeMiddleware {
+	expression, ok := router.Config.Policy.Expression(method, pattern)
+	if !ok {
+		log.Warnf("no policy rule covers %s %s, it is denied to every token", method, pattern)
+		expression = denyAll{}
+	}
+	router.routes = append(router.routes, routeAccess{Method: method, Pattern: pattern, expression: expression})
+	return RequireScopes(expression)
+}
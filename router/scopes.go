@@ -1,7 +1,9 @@
 package router
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/sudarshan-reddy/benjerry/httputils"
 )
@@ -22,6 +24,13 @@ const (
 	ContextKeyAuthToken AuthTokenType = 1
 )
 
+//requestScopes returns the scopes the authenticator set on the context
+//of r
+func requestScopes(r *http.Request) []string {
+	scopes, _ := r.Context().Value(ContextKeyScopes).([]string)
+	return scopes
+}
+
 //ScopeMiddleware is a type cast of the http.Handler signature for
 //ease of use
 type ScopeMiddleware func(http.Handler) http.Handler
@@ -31,56 +40,71 @@ type ScopeMiddleware func(http.Handler) http.Handler
 //Any implementation that wants to use IsAuthorized will have to use
 //the underlying `middleware.Scopes` type to set context value.
 func AnyScope(scopes []string) ScopeMiddleware {
-	var scopeMap = make(map[string]struct{}, 0)
-	for _, scopes := range scopes {
-		scopeMap[scopes] = struct{}{}
-	}
-	return func(h http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			requestScopes, ok := r.Context().Value(ContextKeyScopes).([]string)
-			if !ok {
-				subError := httputils.NewSubError(httputils.InvalidScope, "message", "context does not have scope set")
-				httputils.WriteHandlerError(httputils.NewHandlerError(http.StatusUnauthorized, subError), r, w)
-				return
-			}
-
-			for _, requestScope := range requestScopes {
-				if _, ok := scopeMap[requestScope]; ok {
-					h.ServeHTTP(w, r)
-					return
-				}
-			}
-			httputils.WriteHandlerError(httputils.NewHandlerError(http.StatusUnauthorized, nil), r, w)
-		})
+	expression := anyOf{}
+	for _, scope := range scopes {
+		expression = append(expression, scopeMatch(scope))
 	}
+	return RequireScopes(expression)
 }
 
 //AllScopes checks if the method is authorized to access all the scopes
 func AllScopes(scopes []string) ScopeMiddleware {
+	expression := allOf{}
+	for _, scope := range scopes {
+		expression = append(expression, scopeMatch(scope))
+	}
+	return RequireScopes(expression)
+}
+
+//RequireScopes lets through the requests whose token satisfies
+//expression. Tokens that do not are forbidden, with the scopes they
+//lack in the WWW-Authenticate header
+func RequireScopes(expression ScopeExpression) ScopeMiddleware {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			requestScopes, ok := r.Context().Value(ContextKeyScopes).([]string)
 			if !ok {
 				subError := httputils.NewSubError(httputils.InvalidScope, "message", "context does not have scope set")
-				httputils.WriteHandlerError(httputils.NewHandlerError(http.StatusUnauthorized, subError), r, w)
+				writeAuthError(httputils.NewHandlerError(http.StatusUnauthorized, subError), r, w)
 				return
 			}
 
-			for _, scope := range scopes {
-				var foundScope bool
-				for _, requestScope := range requestScopes {
-					if scope == requestScope {
-						foundScope = true
-						break
-					}
-				}
-				if !foundScope {
-					httputils.WriteHandlerError(httputils.NewHandlerError(http.StatusUnauthorized, nil), r, w)
-					return
-				}
+			if !expression.Allows(requestScopes) {
+				subError := httputils.NewSubError(httputils.InvalidScope, "message", "requires "+expression.String())
+				w.Header().Set("WWW-Authenticate", bearerChallenge(
+					"error", "insufficient_scope",
+					"error_description", "requires "+expression.String(),
+					"scope", strings.Join(expression.Scopes(), " ")))
+				httputils.WriteHandlerError(httputils.NewHandlerError(http.StatusForbidden, subError), r, w)
+				return
 			}
 			h.ServeHTTP(w, r)
 		})
 	}
+}
 
+//writeAuthError writes handlerErr, challenging the client to send
+//another token when it is a 401. A request that sent no bearer token
+//is only told one is required
+func writeAuthError(handlerErr *httputils.HandlerError, r *http.Request, w http.ResponseWriter) {
+	if handlerErr.HTTPStatusCode == http.StatusUnauthorized {
+		if _, err := bearerToken(r); err == nil {
+			w.Header().Set("WWW-Authenticate", bearerChallenge("error", "invalid_token"))
+		} else {
+			w.Header().Set("WWW-Authenticate", bearerChallenge())
+		}
+	}
+	httputils.WriteHandlerError(handlerErr, r, w)
+}
+
+//bearerChallenge builds a WWW-Authenticate Bearer challenge out of
+//key value pairs, as RFC 6750 describes
+func bearerChallenge(keyValues ...string) string {
+	params := []string{`realm="benjerry"`}
+	for index := 0; index+1 < len(keyValues); index += 2 {
+		if keyValues[index+1] != "" {
+			params = append(params, fmt.Sprintf("%s=%q", keyValues[index], keyValues[index+1]))
+		}
+	}
+	return "Bearer " + strings.Join(params, ", ")
 }
@@ -27,7 +27,7 @@ func Test_AnyScope(t *testing.T) {
 			"if the request context does not has a valid scope, dont throw an error",
 			[]string{"first", "second", "third"},
 			[]string{"zeroth", "sixth", "fifth"},
-			`{"httpStatus":401,"httpCode":"unauthorized","requestId":"","errors":[]}` + "\n",
+			`{"httpStatus":403,"httpCode":"forbidden","requestId":"","errors":[]}` + "\n",
 		},
 	}
 
@@ -71,7 +71,7 @@ func Test_AllScopes(t *testing.T) {
 			"if the request context does not match with all valid scope throw an error",
 			[]string{"first", "second", "third"},
 			[]string{"first", "second", "fifth"},
-			`{"httpStatus":401,"httpCode":"unauthorized","requestId":"","errors":[]}` + "\n",
+			`{"httpStatus":403,"httpCode":"forbidden","requestId":"","errors":[]}` + "\n",
 		},
 		{
 			"if the request context has all valid scopes and they are jumbled, dont throw an error",
@@ -83,7 +83,7 @@ func Test_AllScopes(t *testing.T) {
 			"if the request context has all less scopes and they are jumbled, throw an error",
 			[]string{"first", "second"},
 			[]string{"first", "third", "second"},
-			`{"httpStatus":401,"httpCode":"unauthorized","requestId":"","errors":[]}` + "\n",
+			`{"httpStatus":403,"httpCode":"forbidden","requestId":"","errors":[]}` + "\n",
 		},
 	}
 
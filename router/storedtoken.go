@@ -0,0 +1,123 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sudarshan-reddy/benjerry/httputils"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//cachedToken is a token as it was read from the store at fetchedAt
+type cachedToken struct {
+	token     models.APIToken
+	fetchedAt time.Time
+}
+
+//tokenCache reads the tokens of a token store, using them for ttl
+//before reading them again. ttl is as long as a revocation can take to
+//be noticed
+type tokenCache struct {
+	tokenStore models.TokenStore
+	ttl        time.Duration
+
+	mu     sync.Mutex
+	tokens map[string]cachedToken
+}
+
+func newTokenCache(tokenStore models.TokenStore, ttl time.Duration) *tokenCache {
+	return &tokenCache{
+		tokenStore: tokenStore,
+		ttl:        ttl,
+		tokens:     map[string]cachedToken{},
+	}
+}
+
+type storedtokenauthenticator struct {
+	tokenStore models.TokenStore
+	cache      *tokenCache
+}
+
+//NewStoredTokenAuthenticator instantiates an AuthHandler accepting the
+//API tokens minted into tokenStore. Tokens are read again once cacheTTL has
+//passed, which also records when they were last used
+func NewStoredTokenAuthenticator(tokenStore models.TokenStore, cacheTTL time.Duration) AuthHandler {
+	return &storedtokenauthenticator{
+		tokenStore: tokenStore,
+		cache:      newTokenCache(tokenStore, cacheTTL),
+	}
+}
+
+func (s *storedtokenauthenticator) Authenticate(r *http.Request) (*http.Request, *httputils.HandlerError) {
+	authToken, err := bearerToken(r)
+	if err != nil {
+		return nil, unauthorized(err.Error())
+	}
+
+	id, secret, ok := models.ParseToken(authToken)
+	if !ok {
+		return nil, unauthorized("token was not minted by the token store")
+	}
+
+	now := time.Now()
+	token, fetched, err := s.cache.lookup(r.Context(), id, now)
+	if err == models.ErrNoRows {
+		return nil, unauthorized("unknown token")
+	}
+	if err != nil {
+		return nil, httputils.NewUnexpectedError(err)
+	}
+	if !token.Matches(secret) {
+		return nil, unauthorized("invalid token")
+	}
+	//oauth clients only get access tokens from the oauth server
+	if token.Kind != models.TokenKindAPI {
+		return nil, unauthorized("token is an oauth client")
+	}
+	if !token.Active(now) {
+		return nil, unauthorized("token is revoked or expired")
+	}
+	//uses are recorded as often as tokens are read
+	if fetched {
+		if err := s.tokenStore.TouchToken(r.Context(), id, models.TokenTime(now)); err != nil {
+			log.WithField("token", id).Errorf("error recording the use of token: %s", err)
+		}
+	}
+
+	scopeContext := context.WithValue(r.Context(), ContextKeyScopes, token.Scopes)
+	authContext := context.WithValue(scopeContext, ContextKeyAuthToken, authToken)
+	//changes are audited with the owner and the id of the token, never
+	//with its secret
+	actor := fmt.Sprintf("%s (%s)", token.Owner, token.ID)
+	return r.WithContext(models.ContextWithActor(authContext, actor)), nil
+}
+
+//lookup returns the token of id, reading it from the store unless it
+//was read less than ttl ago. It returns true when it was read
+func (c *tokenCache) lookup(ctx context.Context, id string, now time.Time) (models.APIToken, bool, error) {
+	c.mu.Lock()
+	cached, ok := c.tokens[id]
+	c.mu.Unlock()
+	if ok && now.Sub(cached.fetchedAt) < c.ttl {
+		return cached.token, false, nil
+	}
+
+	token, err := c.tokenStore.GetToken(ctx, id)
+	if err != nil {
+		return models.APIToken{}, false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for cachedID, cached := range c.tokens {
+		if now.Sub(cached.fetchedAt) >= c.ttl {
+			delete(c.tokens, cachedID)
+		}
+	}
+	c.tokens[id] = cachedToken{token: *token, fetchedAt: now}
+	return *token, true, nil
+}
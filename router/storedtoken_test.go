@@ -0,0 +1,124 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+	"github.com/sudarshan-reddy/benjerry/models/memory"
+)
+
+//mintTestToken stores a token minted with expiresAt and returns it
+//with its bearer token
+func mintTestToken(t *testing.T, tokenStore models.TokenStore, expiresAt *time.Time) (models.APIToken, string) {
+	token, bearer, err := models.MintToken("catalog team", []string{"read.icecream"}, expiresAt, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tokenStore.StoreToken(context.Background(), token); err != nil {
+		t.Fatal(err)
+	}
+	return token, bearer
+}
+
+//authenticateBearer authenticates a request holding bearer
+func authenticateBearer(t *testing.T, authHandler AuthHandler, bearer string) (*http.Request, string) {
+	req, err := http.NewRequest("GET", "/url", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+bearer)
+	req, handlerErr := authHandler.Authenticate(req)
+	if handlerErr != nil {
+		return nil, handlerErr.SubErrors[0].Details["message"].(string)
+	}
+	return req, ""
+}
+
+func Test_StoredTokenAuthenticate(t *testing.T) {
+	tokenStore := memory.NewTokenStore()
+	token, bearer := mintTestToken(t, tokenStore, nil)
+	expired := time.Now().Add(-time.Minute)
+	_, expiredBearer := mintTestToken(t, tokenStore, &expired)
+	revoked, revokedBearer := mintTestToken(t, tokenStore, nil)
+	if _, err := tokenStore.RevokeToken(context.Background(), revoked.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		desc        string
+		bearer      string
+		expectedErr string
+	}{
+		{
+			desc:   "a minted token gets its scopes",
+			bearer: bearer,
+		},
+		{
+			desc:        "another secret is rejected",
+			bearer:      "bj_" + token.ID + "_0123",
+			expectedErr: "invalid token",
+		},
+		{
+			desc:        "a token missing from the store is rejected",
+			bearer:      "bj_0123_0123",
+			expectedErr: "unknown token",
+		},
+		{
+			desc:        "an expired token is rejected",
+			bearer:      expiredBearer,
+			expectedErr: "token is revoked or expired",
+		},
+		{
+			desc:        "a revoked token is rejected",
+			bearer:      revokedBearer,
+			expectedErr: "token is revoked or expired",
+		},
+		{
+			desc:        "static tokens are left to other auth handlers",
+			bearer:      "suWsnKCXYjz12hQO",
+			expectedErr: "token was not minted by the token store",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			authHandler := NewStoredTokenAuthenticator(tokenStore, time.Minute)
+
+			req, errMessage := authenticateBearer(t, authHandler, test.bearer)
+			assert.Equal(test.expectedErr, errMessage)
+			if test.expectedErr == "" {
+				assert.Equal([]string{"read.icecream"}, req.Context().Value(ContextKeyScopes))
+				assert.Equal("catalog team ("+token.ID+")", models.ActorFromContext(req.Context()))
+			}
+		})
+	}
+}
+
+func Test_StoredTokenCache(t *testing.T) {
+	assert := assert.New(t)
+	tokenStore := memory.NewTokenStore()
+	token, bearer := mintTestToken(t, tokenStore, nil)
+
+	cached := NewStoredTokenAuthenticator(tokenStore, time.Hour)
+	uncached := NewStoredTokenAuthenticator(tokenStore, 0)
+	_, errMessage := authenticateBearer(t, cached, bearer)
+	assert.Empty(errMessage)
+
+	stored, err := tokenStore.GetToken(context.Background(), token.ID)
+	assert.NoError(err)
+	assert.NotNil(stored.LastUsedAt)
+
+	if _, err := tokenStore.RevokeToken(context.Background(), token.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	//the revocation is only noticed once the token is read again
+	_, errMessage = authenticateBearer(t, cached, bearer)
+	assert.Empty(errMessage)
+	_, errMessage = authenticateBearer(t, uncached, bearer)
+	assert.Equal("token is revoked or expired", errMessage)
+}
@@ -0,0 +1,67 @@
+package scripts
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//BackfillSummary tells which ice creams BackfillIngredients repaired.
+//Skipped ones were written by someone else while it ran, which
+//repairs them as well
+type BackfillSummary struct {
+	Repaired  []string
+	Skipped   []string
+	Unchanged int
+}
+
+func (s *BackfillSummary) String() string {
+	return fmt.Sprintf("%d repaired, %d skipped, %d unchanged", len(s.Repaired), len(s.Skipped), s.Unchanged)
+}
+
+//BackfillIngredients rewrites the ingredients of the stored ice creams
+//that were written before ingredients were parsed, so that their
+//compound ingredients are put back together and their ingredient tree
+//is stored, or before allergens were derived, so that they are. Ice
+//creams are repaired one at a time, a failure leaves the ones before it
+//repaired
+func BackfillIngredients(ctx context.Context, iceCreamStore models.IceCreamStore) (*BackfillSummary, error) {
+	summary := &BackfillSummary{}
+	cursor := ""
+	for {
+		page, err := iceCreamStore.GetAll(ctx, models.IceCreamFilter{}, models.MaxPageSize, cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, iceCream := range page.IceCreams {
+			normalized := iceCream.NormalizeIngredients()
+			if reflect.DeepEqual(normalized.Ingredients, iceCream.Ingredients) &&
+				reflect.DeepEqual(normalized.IngredientTree, iceCream.IngredientTree) &&
+				iceCream.Allergens != nil {
+				summary.Unchanged++
+				continue
+			}
+
+			_, err := iceCreamStore.Patch(ctx, iceCream.Name, models.IceCreamPatch{
+				Ingredients: &normalized.Ingredients,
+				Version:     iceCream.Version,
+			})
+			switch err {
+			case nil:
+				summary.Repaired = append(summary.Repaired, iceCream.Name)
+			case models.ErrVersionMismatch:
+				summary.Skipped = append(summary.Skipped, iceCream.Name)
+			default:
+				return nil, fmt.Errorf("repairing %s: %s", iceCream.Name, err)
+			}
+		}
+
+		if page.NextCursor == "" {
+			return summary, nil
+		}
+		cursor = page.NextCursor
+	}
+}
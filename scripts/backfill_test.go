@@ -0,0 +1,74 @@
+package scripts
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+)
+
+//legacyStore serves pages of ice creams as they were stored before
+//ingredients were parsed or allergens derived and records the patches
+//it is sent
+type legacyStore struct {
+	models.IceCreamStore
+	pages     map[string]*models.IceCreamPage
+	patches   map[string]models.IceCreamPatch
+	patchErrs map[string]error
+}
+
+func (l *legacyStore) GetAll(ctx context.Context, filter models.IceCreamFilter, pageSize int,
+	cursor string) (*models.IceCreamPage, error) {
+	return l.pages[cursor], nil
+}
+
+func (l *legacyStore) Patch(ctx context.Context, name string, patch models.IceCreamPatch) (*models.IceCream, error) {
+	if err, ok := l.patchErrs[name]; ok {
+		return nil, err
+	}
+	l.patches[name] = patch
+	return &models.IceCream{}, nil
+}
+
+func Test_BackfillIngredients(t *testing.T) {
+	assert := assert.New(t)
+	store := &legacyStore{
+		pages: map[string]*models.IceCreamPage{
+			"": {
+				IceCreams: []models.IceCream{
+					{Name: "split", Ingredients: []string{"cream", "butter (cream", "salt)"}, Version: 3},
+					models.IceCream{Name: "parsed", Ingredients: []string{"cream"}}.NormalizeIngredients().
+						DeriveAllergens(),
+					models.IceCream{Name: "underived", Ingredients: []string{"cream"}, Version: 4}.
+						NormalizeIngredients(),
+					{Name: "unparsed", Ingredients: []string{"cream"}, Version: 1},
+				},
+				NextCursor: "next",
+			},
+			"next": {
+				IceCreams: []models.IceCream{
+					{Name: "raced", Ingredients: []string{"water)"}, Version: 2},
+					models.IceCream{Name: "none"}.DeriveAllergens(),
+				},
+			},
+		},
+		patches: map[string]models.IceCreamPatch{},
+		patchErrs: map[string]error{
+			"raced": models.ErrVersionMismatch,
+		},
+	}
+
+	summary, err := BackfillIngredients(context.Background(), store)
+	assert.NoError(err)
+	assert.Equal(&BackfillSummary{Repaired: []string{"split", "underived", "unparsed"}, Skipped: []string{"raced"},
+		Unchanged: 2}, summary)
+	assert.Equal(models.IceCreamPatch{Ingredients: &[]string{"cream", "butter (cream, salt)"}, Version: 3},
+		store.patches["split"])
+	assert.Equal(models.IceCreamPatch{Ingredients: &[]string{"cream"}, Version: 4}, store.patches["underived"])
+	assert.Equal(models.IceCreamPatch{Ingredients: &[]string{"cream"}, Version: 1}, store.patches["unparsed"])
+
+	store.patchErrs["split"] = models.ErrQueryTimeout
+	_, err = BackfillIngredients(context.Background(), store)
+	assert.EqualError(err, "repairing split: query timed out")
+}
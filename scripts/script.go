@@ -1,45 +1,283 @@
 package scripts
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
-	"os"
+	"reflect"
 	"regexp"
+	"sort"
 
 	"github.com/sudarshan-reddy/benjerry/models"
 )
 
-//MoveData moves the data from icecream.json to the db
-func MoveData(iceCreamStore models.IceCreamStore) error {
-	f, err := os.Open("icecream.json")
+//DefaultFieldMapping renames the keys of icecream.json that differ from
+//the json fields of models.IceCream
+var DefaultFieldMapping = map[string]string{
+	"dietary_certifications": "dietary_certification",
+	"productId":              "product_id",
+}
+
+//Config configures LoadData
+type Config struct {
+	//Path is the json file to load, an array of ice creams
+	Path string
+	//FieldMapping renames keys of the file to the json fields of
+	//models.IceCream. Keys it does not hold are used as they are
+	FieldMapping map[string]string
+	//DryRun only tells what loading the file would change
+	DryRun bool
+	//IngredientStore renames the ingredients of the rows after its
+	//registry, as canonical.NewIceCreamStore does when they are
+	//written, so rows compare to the ice creams stored through it. Rows
+	//keep their ingredients as they are when it is nil
+	IngredientStore models.IngredientStore
+}
+
+//Summary tells what LoadData changed, or would change on a dry run
+type Summary struct {
+	DryRun   bool
+	Inserted []string
+	Updated  []RowDiff
+	Skipped  []SkippedRow
+}
+
+func (s *Summary) String() string {
+	return fmt.Sprintf("%d inserted, %d updated, %d skipped", len(s.Inserted), len(s.Updated), len(s.Skipped))
+}
+
+//RowDiff holds the fields of a stored ice cream that the file changes
+type RowDiff struct {
+	Name   string
+	Fields []FieldDiff
+}
+
+//FieldDiff is a single changed field, keyed by its json name
+type FieldDiff struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+//SkippedRow is a row of the file that was not loaded and why. Index is
+//its position in the file
+type SkippedRow struct {
+	Index  int
+	Name   string
+	Reason string
+}
+
+//ReasonUnchanged skips rows that are already stored as they are
+const ReasonUnchanged = "unchanged"
+
+//legacyNameStripper reproduces the names stored by earlier versions of
+//the loader, which stripped non ascii characters out of the file
+var legacyNameStripper = regexp.MustCompile("[[:^ascii:]]")
+
+//LoadData loads the ice creams of the file at cfg.Path into the store.
+//New ones are inserted, stored ones that differ are replaced and the
+//others are skipped. Rows that cannot be read are skipped along with
+//the reason, only store failures stop the load, in which case nothing
+//is loaded
+func LoadData(ctx context.Context, iceCreamStore models.IceCreamStore, cfg Config) (*Summary, error) {
+	data, err := ioutil.ReadFile(cfg.Path)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, fmt.Errorf("%s should hold a json array of ice creams: %s", cfg.Path, err)
 	}
 
-	data, err := ioutil.ReadAll(f)
+	summary := &Summary{DryRun: cfg.DryRun}
+	load := func(ctx context.Context) error {
+		seen := map[string]int{}
+		for index, row := range rows {
+			iceCream, err := decodeRow(row, cfg.FieldMapping)
+			if err != nil {
+				summary.Skipped = append(summary.Skipped, SkippedRow{Index: index, Name: iceCream.Name,
+					Reason: err.Error()})
+				continue
+			}
+			iceCream, err = canonicalizeRow(ctx, cfg.IngredientStore, iceCream)
+			if err != nil {
+				return fmt.Errorf("row %d, %s: %s", index, iceCream.Name, err)
+			}
+			if first, ok := seen[iceCream.Name]; ok {
+				summary.Skipped = append(summary.Skipped, SkippedRow{Index: index, Name: iceCream.Name,
+					Reason: fmt.Sprintf("duplicate of row %d", first)})
+				continue
+			}
+			seen[iceCream.Name] = index
+
+			if err := loadRow(ctx, iceCreamStore, index, iceCream, cfg.DryRun, summary); err != nil {
+				return fmt.Errorf("row %d, %s: %s", index, iceCream.Name, err)
+			}
+		}
+		return nil
+	}
+
+	if cfg.DryRun {
+		err = load(ctx)
+	} else {
+		err = iceCreamStore.WithTxContext(ctx, load)
+	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return summary, nil
+}
+
+//decodeRow reads a row of the file as an IceCream, renaming its keys
+//with fieldMapping first. Keys that are not fields of IceCream fail
+func decodeRow(row json.RawMessage, fieldMapping map[string]string) (models.IceCream, error) {
+	var iceCream models.IceCream
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(row, &fields); err != nil || fields == nil {
+		return iceCream, fmt.Errorf("should be a json object")
+	}
+
+	renamed := map[string]json.RawMessage{}
+	for key, value := range fields {
+		field := key
+		if mapped, ok := fieldMapping[key]; ok {
+			field = mapped
+		}
+		if _, ok := renamed[field]; ok {
+			return iceCream, fmt.Errorf("%s is set more than once", field)
+		}
+		renamed[field] = value
+	}
+
+	data, err := json.Marshal(renamed)
+	if err != nil {
+		return iceCream, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&iceCream); err != nil {
+		return iceCream, err
+	}
+	if iceCream.Name == "" {
+		return iceCream, fmt.Errorf("name is required")
 	}
+	//rows are compared to stored ice creams as they would be stored
+	return iceCream.NormalizeIngredients().DeriveAllergens(), nil
+}
 
-	re := regexp.MustCompile("[[:^ascii:]]")
-	t := re.ReplaceAllLiteralString(string(data), "")
+//canonicalizeRow renames the ingredients of iceCream after those of
+//ingredientStore, like they would be stored
+func canonicalizeRow(ctx context.Context, ingredientStore models.IngredientStore,
+	iceCream models.IceCream) (models.IceCream, error) {
+	if ingredientStore == nil || iceCream.Ingredients == nil {
+		return iceCream, nil
+	}
+	canonical, err := ingredientStore.CanonicalNames(ctx, models.IngredientNames(iceCream.IngredientTree))
+	if err != nil {
+		return iceCream, err
+	}
+	return iceCream.CanonicalizeIngredients(canonical).DeriveAllergens(), nil
+}
 
-	var iceCreamData []models.IceCream
+//loadRow inserts or replaces iceCream unless it is stored as it is, and
+//adds what it did to summary
+func loadRow(ctx context.Context, iceCreamStore models.IceCreamStore, index int,
+	iceCream models.IceCream, dryRun bool, summary *Summary) error {
+	current, err := iceCreamStore.Get(ctx, iceCream.Name)
+	if err == models.ErrNoRows {
+		return loadNewRow(ctx, iceCreamStore, iceCream, dryRun, summary)
+	}
+	if err != nil {
+		return err
+	}
 
-	err = json.Unmarshal([]byte(t), &iceCreamData)
+	fields, err := diffIceCreams(*current, iceCream)
 	if err != nil {
 		return err
 	}
+	if len(fields) == 0 {
+		summary.Skipped = append(summary.Skipped, SkippedRow{Index: index, Name: iceCream.Name,
+			Reason: ReasonUnchanged})
+		return nil
+	}
 
-	ctx := context.Background()
-	return iceCreamStore.WithTxContext(ctx, func(ctx context.Context) error {
-		for _, iceCreamInfo := range iceCreamData {
-			err := iceCreamStore.StoreContext(ctx, iceCreamInfo)
-			if err != nil {
+	if !dryRun {
+		//the row must not have changed since it was compared
+		iceCream.Version = current.Version
+		if _, _, err := iceCreamStore.Upsert(ctx, iceCream); err != nil {
+			return err
+		}
+	}
+	summary.Updated = append(summary.Updated, RowDiff{Name: iceCream.Name, Fields: fields})
+	return nil
+}
+
+//loadNewRow inserts iceCream. A row stored under its name stripped of
+//non ascii characters by an earlier load is replaced by it
+func loadNewRow(ctx context.Context, iceCreamStore models.IceCreamStore, iceCream models.IceCream,
+	dryRun bool, summary *Summary) error {
+	legacyName := legacyNameStripper.ReplaceAllLiteralString(iceCream.Name, "")
+	var legacy *models.IceCream
+	if legacyName != iceCream.Name {
+		var err error
+		legacy, err = iceCreamStore.Get(ctx, legacyName)
+		if err != nil && err != models.ErrNoRows {
+			return err
+		}
+	}
+
+	if !dryRun {
+		if legacy != nil {
+			if err := iceCreamStore.Delete(ctx, legacy.Name, legacy.Version); err != nil {
 				return err
 			}
 		}
+		if err := iceCreamStore.StoreContext(ctx, iceCream); err != nil {
+			return err
+		}
+	}
+
+	if legacy == nil {
+		summary.Inserted = append(summary.Inserted, iceCream.Name)
 		return nil
-	})
+	}
+	fields, err := diffIceCreams(*legacy, iceCream)
+	if err != nil {
+		return err
+	}
+	summary.Updated = append(summary.Updated, RowDiff{Name: iceCream.Name, Fields: fields})
+	return nil
+}
+
+//diffIceCreams returns the fields that differ between from and to,
+//ordered by their json name
+func diffIceCreams(from, to models.IceCream) ([]FieldDiff, error) {
+	var fromFields, toFields map[string]interface{}
+	if err := remarshal(from, &fromFields); err != nil {
+		return nil, err
+	}
+	if err := remarshal(to, &toFields); err != nil {
+		return nil, err
+	}
+
+	var diffs []FieldDiff
+	for field, value := range toFields {
+		if !reflect.DeepEqual(fromFields[field], value) {
+			diffs = append(diffs, FieldDiff{Field: field, Old: fromFields[field], New: value})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Field < diffs[j].Field })
+	return diffs, nil
+}
+
+//remarshal converts from into to through their json form
+func remarshal(from interface{}, to interface{}) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, to)
 }
@@ -0,0 +1,195 @@
+package scripts
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sudarshan-reddy/benjerry/models"
+	"github.com/sudarshan-reddy/benjerry/models/canonical"
+	"github.com/sudarshan-reddy/benjerry/models/memory"
+)
+
+func Test_LoadData(t *testing.T) {
+	var tests = []struct {
+		desc             string
+		stored           []models.IceCream
+		file             string
+		dryRun           bool
+		expectedSummary  *Summary
+		expectedStored   []models.IceCream
+		expectedMissing  []string
+		expectedErrorMsg string
+	}{
+		{
+			desc: "keys of the seed file are mapped and unicode is kept",
+			file: `[{"name":"Chillin' the Roast™","story":"“curly”","dietary_certifications":"Kosher",` +
+				`"productId":"p1","ingredients":["cream"]}]`,
+			expectedSummary: &Summary{Inserted: []string{"Chillin' the Roast™"}},
+			expectedStored: []models.IceCream{{Name: "Chillin' the Roast™", Story: "“curly”",
+				DietaryCertification: "Kosher", ProductID: "p1", Ingredients: []string{"cream"}}},
+		},
+		{
+			desc:   "changed rows are replaced and unchanged ones skipped",
+			stored: []models.IceCream{{Name: "a", Story: "old"}, {Name: "b", Story: "same"}},
+			file:   `[{"name":"a","story":"new"},{"name":"b","story":"same"}]`,
+			expectedSummary: &Summary{
+				Updated: []RowDiff{{Name: "a", Fields: []FieldDiff{{Field: "story", Old: "old", New: "new"}}}},
+				Skipped: []SkippedRow{{Index: 1, Name: "b", Reason: ReasonUnchanged}},
+			},
+			expectedStored: []models.IceCream{{Name: "a", Story: "new"}, {Name: "b", Story: "same"}},
+		},
+		{
+			desc:   "dry runs report the changes without making them",
+			stored: []models.IceCream{{Name: "a", Story: "old"}},
+			file:   `[{"name":"a","story":"new"},{"name":"b"}]`,
+			dryRun: true,
+			expectedSummary: &Summary{
+				DryRun:   true,
+				Inserted: []string{"b"},
+				Updated:  []RowDiff{{Name: "a", Fields: []FieldDiff{{Field: "story", Old: "old", New: "new"}}}},
+			},
+			expectedStored:  []models.IceCream{{Name: "a", Story: "old"}},
+			expectedMissing: []string{"b"},
+		},
+		{
+			desc:   "rows stored by earlier loads without their unicode are replaced",
+			stored: []models.IceCream{{Name: "Half Baked", Story: "s"}},
+			file:   `[{"name":"Half Baked®","story":"s"}]`,
+			expectedSummary: &Summary{
+				Updated: []RowDiff{{Name: "Half Baked®",
+					Fields: []FieldDiff{{Field: "name", Old: "Half Baked", New: "Half Baked®"}}}},
+			},
+			expectedStored:  []models.IceCream{{Name: "Half Baked®", Story: "s"}},
+			expectedMissing: []string{"Half Baked"},
+		},
+		{
+			desc: "rows that cannot be read are skipped with the reason",
+			file: `[{"story":"nameless"},{"name":"a","colour":"red"},{"name":"b","productId":"p",` +
+				`"product_id":"q"},{"name":1},"a",{"name":"c"},{"name":"c"}]`,
+			expectedSummary: &Summary{
+				Inserted: []string{"c"},
+				Skipped: []SkippedRow{
+					{Index: 0, Reason: "name is required"},
+					{Index: 1, Name: "a", Reason: `json: unknown field "colour"`},
+					{Index: 2, Reason: "product_id is set more than once"},
+					{Index: 3, Reason: "json: cannot unmarshal number into Go struct field IceCream.name of type string"},
+					{Index: 4, Reason: "should be a json object"},
+					{Index: 6, Name: "c", Reason: "duplicate of row 5"},
+				},
+			},
+			expectedStored: []models.IceCream{{Name: "c"}},
+		},
+		{
+			desc:             "a file that is not an array fails",
+			file:             `{"name":"a"}`,
+			expectedErrorMsg: "should hold a json array of ice creams",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			ctx := context.Background()
+			iceCreamStore := memory.NewIceCreamStore()
+			for _, iceCream := range test.stored {
+				if err := iceCreamStore.StoreContext(ctx, iceCream); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			path := filepath.Join(t.TempDir(), "icecream.json")
+			if err := ioutil.WriteFile(path, []byte(test.file), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			summary, err := LoadData(ctx, iceCreamStore, Config{
+				Path:         path,
+				FieldMapping: DefaultFieldMapping,
+				DryRun:       test.dryRun,
+			})
+			if test.expectedErrorMsg != "" {
+				assert.Contains(err.Error(), test.expectedErrorMsg)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(test.expectedSummary, summary)
+
+			for _, expected := range test.expectedStored {
+				stored, err := iceCreamStore.Get(ctx, expected.Name)
+				if assert.NoError(err) {
+					stored.Version = 0
+					assert.Equal(expected.NormalizeIngredients().DeriveAllergens(), *stored)
+				}
+			}
+			for _, name := range test.expectedMissing {
+				_, err := iceCreamStore.Get(ctx, name)
+				assert.Equal(models.ErrNoRows, err)
+			}
+		})
+	}
+}
+
+func Test_LoadDataSeedFile(t *testing.T) {
+	assert := assert.New(t)
+	iceCreamStore := memory.NewIceCreamStore()
+	cfg := Config{Path: "../icecream.json", FieldMapping: DefaultFieldMapping}
+
+	summary, err := LoadData(context.Background(), iceCreamStore, cfg)
+	assert.NoError(err)
+	assert.Len(summary.Inserted, 51)
+	assert.Empty(summary.Skipped)
+
+	iceCream, err := iceCreamStore.Get(context.Background(), "Chillin' the Roast™")
+	if assert.NoError(err) {
+		assert.NotEmpty(iceCream.ProductID)
+		assert.NotEmpty(iceCream.DietaryCertification)
+	}
+
+	//loading the file again changes nothing
+	summary, err = LoadData(context.Background(), iceCreamStore, cfg)
+	assert.NoError(err)
+	assert.Empty(summary.Inserted)
+	assert.Empty(summary.Updated)
+	assert.Len(summary.Skipped, 51)
+}
+
+func Test_LoadDataCanonicalIngredients(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	ingredientStore := memory.NewIngredientStore()
+	err := ingredientStore.StoreIngredient(ctx, models.RegisteredIngredient{
+		Name:     "nonfat milk",
+		Synonyms: []string{"skim milk"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	iceCreamStore := canonical.NewIceCreamStore(memory.NewIceCreamStore(), ingredientStore)
+
+	path := filepath.Join(t.TempDir(), "icecream.json")
+	file := `[{"name":"a","ingredients":["cream","skim milk","fudge (skim milk, cocoa)"]}]`
+	if err := ioutil.WriteFile(path, []byte(file), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{Path: path, IngredientStore: ingredientStore}
+
+	summary, err := LoadData(ctx, iceCreamStore, cfg)
+	assert.NoError(err)
+	assert.Equal([]string{"a"}, summary.Inserted)
+
+	//rows listing synonyms compare to what was stored under their names
+	for load := 0; load < 2; load++ {
+		summary, err = LoadData(ctx, iceCreamStore, cfg)
+		assert.NoError(err)
+		assert.Empty(summary.Updated)
+		assert.Equal([]SkippedRow{{Name: "a", Reason: ReasonUnchanged}}, summary.Skipped)
+	}
+
+	stored, err := iceCreamStore.Get(ctx, "a")
+	if assert.NoError(err) {
+		assert.Equal([]string{"cream", "nonfat milk", "fudge (nonfat milk, cocoa)"}, stored.Ingredients)
+	}
+}